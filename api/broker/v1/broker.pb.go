@@ -0,0 +1,832 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: broker/v1/broker.proto
+
+// The gRPC API of the broker, for internal services. It submits trades and
+// reads account stats with the same checks, authentication and errors as the
+// HTTP API; see the "gRPC API" section of the README.
+
+package brokerv1
+
+import (
+	status "google.golang.org/genproto/googleapis/rpc/status"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Side int32
+
+const (
+	Side_SIDE_UNSPECIFIED Side = 0
+	Side_SIDE_BUY         Side = 1
+	Side_SIDE_SELL        Side = 2
+)
+
+// Enum value maps for Side.
+var (
+	Side_name = map[int32]string{
+		0: "SIDE_UNSPECIFIED",
+		1: "SIDE_BUY",
+		2: "SIDE_SELL",
+	}
+	Side_value = map[string]int32{
+		"SIDE_UNSPECIFIED": 0,
+		"SIDE_BUY":         1,
+		"SIDE_SELL":        2,
+	}
+)
+
+func (x Side) Enum() *Side {
+	p := new(Side)
+	*p = x
+	return p
+}
+
+func (x Side) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Side) Descriptor() protoreflect.EnumDescriptor {
+	return file_broker_v1_broker_proto_enumTypes[0].Descriptor()
+}
+
+func (Side) Type() protoreflect.EnumType {
+	return &file_broker_v1_broker_proto_enumTypes[0]
+}
+
+func (x Side) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Side.Descriptor instead.
+func (Side) EnumDescriptor() ([]byte, []int) {
+	return file_broker_v1_broker_proto_rawDescGZIP(), []int{0}
+}
+
+type SubmitTradeRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Account string                 `protobuf:"bytes,1,opt,name=account,proto3" json:"account,omitempty"`
+	Symbol  string                 `protobuf:"bytes,2,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Volume  float64                `protobuf:"fixed64,3,opt,name=volume,proto3" json:"volume,omitempty"`
+	Open    float64                `protobuf:"fixed64,4,opt,name=open,proto3" json:"open,omitempty"`
+	Close   float64                `protobuf:"fixed64,5,opt,name=close,proto3" json:"close,omitempty"`
+	Side    Side                   `protobuf:"varint,6,opt,name=side,proto3,enum=broker.v1.Side" json:"side,omitempty"`
+	// open_time and close_time are optional.
+	OpenTime      *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=open_time,json=openTime,proto3" json:"open_time,omitempty"`
+	CloseTime     *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=close_time,json=closeTime,proto3" json:"close_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitTradeRequest) Reset() {
+	*x = SubmitTradeRequest{}
+	mi := &file_broker_v1_broker_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitTradeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitTradeRequest) ProtoMessage() {}
+
+func (x *SubmitTradeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_v1_broker_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitTradeRequest.ProtoReflect.Descriptor instead.
+func (*SubmitTradeRequest) Descriptor() ([]byte, []int) {
+	return file_broker_v1_broker_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubmitTradeRequest) GetAccount() string {
+	if x != nil {
+		return x.Account
+	}
+	return ""
+}
+
+func (x *SubmitTradeRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *SubmitTradeRequest) GetVolume() float64 {
+	if x != nil {
+		return x.Volume
+	}
+	return 0
+}
+
+func (x *SubmitTradeRequest) GetOpen() float64 {
+	if x != nil {
+		return x.Open
+	}
+	return 0
+}
+
+func (x *SubmitTradeRequest) GetClose() float64 {
+	if x != nil {
+		return x.Close
+	}
+	return 0
+}
+
+func (x *SubmitTradeRequest) GetSide() Side {
+	if x != nil {
+		return x.Side
+	}
+	return Side_SIDE_UNSPECIFIED
+}
+
+func (x *SubmitTradeRequest) GetOpenTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OpenTime
+	}
+	return nil
+}
+
+func (x *SubmitTradeRequest) GetCloseTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CloseTime
+	}
+	return nil
+}
+
+type SubmitTradeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TradeId       int64                  `protobuf:"varint,1,opt,name=trade_id,json=tradeId,proto3" json:"trade_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitTradeResponse) Reset() {
+	*x = SubmitTradeResponse{}
+	mi := &file_broker_v1_broker_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitTradeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitTradeResponse) ProtoMessage() {}
+
+func (x *SubmitTradeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_v1_broker_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitTradeResponse.ProtoReflect.Descriptor instead.
+func (*SubmitTradeResponse) Descriptor() ([]byte, []int) {
+	return file_broker_v1_broker_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SubmitTradeResponse) GetTradeId() int64 {
+	if x != nil {
+		return x.TradeId
+	}
+	return 0
+}
+
+type SubmitTradesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*SubmitTradeResult   `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	Accepted      int32                  `protobuf:"varint,2,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	Rejected      int32                  `protobuf:"varint,3,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitTradesResponse) Reset() {
+	*x = SubmitTradesResponse{}
+	mi := &file_broker_v1_broker_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitTradesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitTradesResponse) ProtoMessage() {}
+
+func (x *SubmitTradesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_v1_broker_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitTradesResponse.ProtoReflect.Descriptor instead.
+func (*SubmitTradesResponse) Descriptor() ([]byte, []int) {
+	return file_broker_v1_broker_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SubmitTradesResponse) GetResults() []*SubmitTradeResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *SubmitTradesResponse) GetAccepted() int32 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *SubmitTradesResponse) GetRejected() int32 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+// SubmitTradeResult is the outcome of one trade of SubmitTrades: its id when
+// it was enqueued, else the error SubmitTrade would have returned.
+type SubmitTradeResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TradeId       int64                  `protobuf:"varint,1,opt,name=trade_id,json=tradeId,proto3" json:"trade_id,omitempty"`
+	Error         *status.Status         `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitTradeResult) Reset() {
+	*x = SubmitTradeResult{}
+	mi := &file_broker_v1_broker_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitTradeResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitTradeResult) ProtoMessage() {}
+
+func (x *SubmitTradeResult) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_v1_broker_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitTradeResult.ProtoReflect.Descriptor instead.
+func (*SubmitTradeResult) Descriptor() ([]byte, []int) {
+	return file_broker_v1_broker_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SubmitTradeResult) GetTradeId() int64 {
+	if x != nil {
+		return x.TradeId
+	}
+	return 0
+}
+
+func (x *SubmitTradeResult) GetError() *status.Status {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+type GetTradeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTradeRequest) Reset() {
+	*x = GetTradeRequest{}
+	mi := &file_broker_v1_broker_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTradeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTradeRequest) ProtoMessage() {}
+
+func (x *GetTradeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_v1_broker_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTradeRequest.ProtoReflect.Descriptor instead.
+func (*GetTradeRequest) Descriptor() ([]byte, []int) {
+	return file_broker_v1_broker_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetTradeRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type Trade struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Id      int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Version int32                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	// pending, processed or cancelled
+	Status  string  `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Account string  `protobuf:"bytes,4,opt,name=account,proto3" json:"account,omitempty"`
+	Symbol  string  `protobuf:"bytes,5,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Volume  float64 `protobuf:"fixed64,6,opt,name=volume,proto3" json:"volume,omitempty"`
+	Open    float64 `protobuf:"fixed64,7,opt,name=open,proto3" json:"open,omitempty"`
+	Close   float64 `protobuf:"fixed64,8,opt,name=close,proto3" json:"close,omitempty"`
+	Side    Side    `protobuf:"varint,9,opt,name=side,proto3,enum=broker.v1.Side" json:"side,omitempty"`
+	// profit added to the account; 0 while pending and once cancelled
+	Profit        float64                `protobuf:"fixed64,10,opt,name=profit,proto3" json:"profit,omitempty"`
+	OpenTime      *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=open_time,json=openTime,proto3" json:"open_time,omitempty"`
+	CloseTime     *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=close_time,json=closeTime,proto3" json:"close_time,omitempty"`
+	ReceivedAt    *timestamppb.Timestamp `protobuf:"bytes,13,opt,name=received_at,json=receivedAt,proto3" json:"received_at,omitempty"`
+	ProcessedAt   *timestamppb.Timestamp `protobuf:"bytes,14,opt,name=processed_at,json=processedAt,proto3" json:"processed_at,omitempty"`
+	CancelledAt   *timestamppb.Timestamp `protobuf:"bytes,15,opt,name=cancelled_at,json=cancelledAt,proto3" json:"cancelled_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Trade) Reset() {
+	*x = Trade{}
+	mi := &file_broker_v1_broker_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Trade) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Trade) ProtoMessage() {}
+
+func (x *Trade) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_v1_broker_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Trade.ProtoReflect.Descriptor instead.
+func (*Trade) Descriptor() ([]byte, []int) {
+	return file_broker_v1_broker_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Trade) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Trade) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Trade) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Trade) GetAccount() string {
+	if x != nil {
+		return x.Account
+	}
+	return ""
+}
+
+func (x *Trade) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Trade) GetVolume() float64 {
+	if x != nil {
+		return x.Volume
+	}
+	return 0
+}
+
+func (x *Trade) GetOpen() float64 {
+	if x != nil {
+		return x.Open
+	}
+	return 0
+}
+
+func (x *Trade) GetClose() float64 {
+	if x != nil {
+		return x.Close
+	}
+	return 0
+}
+
+func (x *Trade) GetSide() Side {
+	if x != nil {
+		return x.Side
+	}
+	return Side_SIDE_UNSPECIFIED
+}
+
+func (x *Trade) GetProfit() float64 {
+	if x != nil {
+		return x.Profit
+	}
+	return 0
+}
+
+func (x *Trade) GetOpenTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OpenTime
+	}
+	return nil
+}
+
+func (x *Trade) GetCloseTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CloseTime
+	}
+	return nil
+}
+
+func (x *Trade) GetReceivedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ReceivedAt
+	}
+	return nil
+}
+
+func (x *Trade) GetProcessedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ProcessedAt
+	}
+	return nil
+}
+
+func (x *Trade) GetCancelledAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CancelledAt
+	}
+	return nil
+}
+
+type GetAccountStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Account       string                 `protobuf:"bytes,1,opt,name=account,proto3" json:"account,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAccountStatsRequest) Reset() {
+	*x = GetAccountStatsRequest{}
+	mi := &file_broker_v1_broker_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAccountStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAccountStatsRequest) ProtoMessage() {}
+
+func (x *GetAccountStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_v1_broker_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAccountStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetAccountStatsRequest) Descriptor() ([]byte, []int) {
+	return file_broker_v1_broker_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetAccountStatsRequest) GetAccount() string {
+	if x != nil {
+		return x.Account
+	}
+	return ""
+}
+
+type WatchAccountStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Account       string                 `protobuf:"bytes,1,opt,name=account,proto3" json:"account,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchAccountStatsRequest) Reset() {
+	*x = WatchAccountStatsRequest{}
+	mi := &file_broker_v1_broker_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchAccountStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchAccountStatsRequest) ProtoMessage() {}
+
+func (x *WatchAccountStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_v1_broker_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchAccountStatsRequest.ProtoReflect.Descriptor instead.
+func (*WatchAccountStatsRequest) Descriptor() ([]byte, []int) {
+	return file_broker_v1_broker_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *WatchAccountStatsRequest) GetAccount() string {
+	if x != nil {
+		return x.Account
+	}
+	return ""
+}
+
+type AccountStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Account       string                 `protobuf:"bytes,1,opt,name=account,proto3" json:"account,omitempty"`
+	Trades        int64                  `protobuf:"varint,2,opt,name=trades,proto3" json:"trades,omitempty"`
+	Profit        float64                `protobuf:"fixed64,3,opt,name=profit,proto3" json:"profit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AccountStats) Reset() {
+	*x = AccountStats{}
+	mi := &file_broker_v1_broker_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccountStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccountStats) ProtoMessage() {}
+
+func (x *AccountStats) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_v1_broker_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccountStats.ProtoReflect.Descriptor instead.
+func (*AccountStats) Descriptor() ([]byte, []int) {
+	return file_broker_v1_broker_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *AccountStats) GetAccount() string {
+	if x != nil {
+		return x.Account
+	}
+	return ""
+}
+
+func (x *AccountStats) GetTrades() int64 {
+	if x != nil {
+		return x.Trades
+	}
+	return 0
+}
+
+func (x *AccountStats) GetProfit() float64 {
+	if x != nil {
+		return x.Profit
+	}
+	return 0
+}
+
+var File_broker_v1_broker_proto protoreflect.FileDescriptor
+
+const file_broker_v1_broker_proto_rawDesc = "" +
+	"\n" +
+	"\x16broker/v1/broker.proto\x12\tbroker.v1\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x17google/rpc/status.proto\"\xa1\x02\n" +
+	"\x12SubmitTradeRequest\x12\x18\n" +
+	"\aaccount\x18\x01 \x01(\tR\aaccount\x12\x16\n" +
+	"\x06symbol\x18\x02 \x01(\tR\x06symbol\x12\x16\n" +
+	"\x06volume\x18\x03 \x01(\x01R\x06volume\x12\x12\n" +
+	"\x04open\x18\x04 \x01(\x01R\x04open\x12\x14\n" +
+	"\x05close\x18\x05 \x01(\x01R\x05close\x12#\n" +
+	"\x04side\x18\x06 \x01(\x0e2\x0f.broker.v1.SideR\x04side\x127\n" +
+	"\topen_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\bopenTime\x129\n" +
+	"\n" +
+	"close_time\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tcloseTime\"0\n" +
+	"\x13SubmitTradeResponse\x12\x19\n" +
+	"\btrade_id\x18\x01 \x01(\x03R\atradeId\"\x86\x01\n" +
+	"\x14SubmitTradesResponse\x126\n" +
+	"\aresults\x18\x01 \x03(\v2\x1c.broker.v1.SubmitTradeResultR\aresults\x12\x1a\n" +
+	"\baccepted\x18\x02 \x01(\x05R\baccepted\x12\x1a\n" +
+	"\brejected\x18\x03 \x01(\x05R\brejected\"X\n" +
+	"\x11SubmitTradeResult\x12\x19\n" +
+	"\btrade_id\x18\x01 \x01(\x03R\atradeId\x12(\n" +
+	"\x05error\x18\x02 \x01(\v2\x12.google.rpc.StatusR\x05error\"!\n" +
+	"\x0fGetTradeRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\xa9\x04\n" +
+	"\x05Trade\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x05R\aversion\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x18\n" +
+	"\aaccount\x18\x04 \x01(\tR\aaccount\x12\x16\n" +
+	"\x06symbol\x18\x05 \x01(\tR\x06symbol\x12\x16\n" +
+	"\x06volume\x18\x06 \x01(\x01R\x06volume\x12\x12\n" +
+	"\x04open\x18\a \x01(\x01R\x04open\x12\x14\n" +
+	"\x05close\x18\b \x01(\x01R\x05close\x12#\n" +
+	"\x04side\x18\t \x01(\x0e2\x0f.broker.v1.SideR\x04side\x12\x16\n" +
+	"\x06profit\x18\n" +
+	" \x01(\x01R\x06profit\x127\n" +
+	"\topen_time\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\bopenTime\x129\n" +
+	"\n" +
+	"close_time\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\tcloseTime\x12;\n" +
+	"\vreceived_at\x18\r \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"receivedAt\x12=\n" +
+	"\fprocessed_at\x18\x0e \x01(\v2\x1a.google.protobuf.TimestampR\vprocessedAt\x12=\n" +
+	"\fcancelled_at\x18\x0f \x01(\v2\x1a.google.protobuf.TimestampR\vcancelledAt\"2\n" +
+	"\x16GetAccountStatsRequest\x12\x18\n" +
+	"\aaccount\x18\x01 \x01(\tR\aaccount\"4\n" +
+	"\x18WatchAccountStatsRequest\x12\x18\n" +
+	"\aaccount\x18\x01 \x01(\tR\aaccount\"X\n" +
+	"\fAccountStats\x12\x18\n" +
+	"\aaccount\x18\x01 \x01(\tR\aaccount\x12\x16\n" +
+	"\x06trades\x18\x02 \x01(\x03R\x06trades\x12\x16\n" +
+	"\x06profit\x18\x03 \x01(\x01R\x06profit*9\n" +
+	"\x04Side\x12\x14\n" +
+	"\x10SIDE_UNSPECIFIED\x10\x00\x12\f\n" +
+	"\bSIDE_BUY\x10\x01\x12\r\n" +
+	"\tSIDE_SELL\x10\x022\x86\x03\n" +
+	"\x06Broker\x12L\n" +
+	"\vSubmitTrade\x12\x1d.broker.v1.SubmitTradeRequest\x1a\x1e.broker.v1.SubmitTradeResponse\x12P\n" +
+	"\fSubmitTrades\x12\x1d.broker.v1.SubmitTradeRequest\x1a\x1f.broker.v1.SubmitTradesResponse(\x01\x128\n" +
+	"\bGetTrade\x12\x1a.broker.v1.GetTradeRequest\x1a\x10.broker.v1.Trade\x12M\n" +
+	"\x0fGetAccountStats\x12!.broker.v1.GetAccountStatsRequest\x1a\x17.broker.v1.AccountStats\x12S\n" +
+	"\x11WatchAccountStats\x12#.broker.v1.WatchAccountStatsRequest\x1a\x17.broker.v1.AccountStats0\x01B;Z9gitlab.com/digineat/go-broker-test/api/broker/v1;brokerv1b\x06proto3"
+
+var (
+	file_broker_v1_broker_proto_rawDescOnce sync.Once
+	file_broker_v1_broker_proto_rawDescData []byte
+)
+
+func file_broker_v1_broker_proto_rawDescGZIP() []byte {
+	file_broker_v1_broker_proto_rawDescOnce.Do(func() {
+		file_broker_v1_broker_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_broker_v1_broker_proto_rawDesc), len(file_broker_v1_broker_proto_rawDesc)))
+	})
+	return file_broker_v1_broker_proto_rawDescData
+}
+
+var file_broker_v1_broker_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_broker_v1_broker_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_broker_v1_broker_proto_goTypes = []any{
+	(Side)(0),                        // 0: broker.v1.Side
+	(*SubmitTradeRequest)(nil),       // 1: broker.v1.SubmitTradeRequest
+	(*SubmitTradeResponse)(nil),      // 2: broker.v1.SubmitTradeResponse
+	(*SubmitTradesResponse)(nil),     // 3: broker.v1.SubmitTradesResponse
+	(*SubmitTradeResult)(nil),        // 4: broker.v1.SubmitTradeResult
+	(*GetTradeRequest)(nil),          // 5: broker.v1.GetTradeRequest
+	(*Trade)(nil),                    // 6: broker.v1.Trade
+	(*GetAccountStatsRequest)(nil),   // 7: broker.v1.GetAccountStatsRequest
+	(*WatchAccountStatsRequest)(nil), // 8: broker.v1.WatchAccountStatsRequest
+	(*AccountStats)(nil),             // 9: broker.v1.AccountStats
+	(*timestamppb.Timestamp)(nil),    // 10: google.protobuf.Timestamp
+	(*status.Status)(nil),            // 11: google.rpc.Status
+}
+var file_broker_v1_broker_proto_depIdxs = []int32{
+	0,  // 0: broker.v1.SubmitTradeRequest.side:type_name -> broker.v1.Side
+	10, // 1: broker.v1.SubmitTradeRequest.open_time:type_name -> google.protobuf.Timestamp
+	10, // 2: broker.v1.SubmitTradeRequest.close_time:type_name -> google.protobuf.Timestamp
+	4,  // 3: broker.v1.SubmitTradesResponse.results:type_name -> broker.v1.SubmitTradeResult
+	11, // 4: broker.v1.SubmitTradeResult.error:type_name -> google.rpc.Status
+	0,  // 5: broker.v1.Trade.side:type_name -> broker.v1.Side
+	10, // 6: broker.v1.Trade.open_time:type_name -> google.protobuf.Timestamp
+	10, // 7: broker.v1.Trade.close_time:type_name -> google.protobuf.Timestamp
+	10, // 8: broker.v1.Trade.received_at:type_name -> google.protobuf.Timestamp
+	10, // 9: broker.v1.Trade.processed_at:type_name -> google.protobuf.Timestamp
+	10, // 10: broker.v1.Trade.cancelled_at:type_name -> google.protobuf.Timestamp
+	1,  // 11: broker.v1.Broker.SubmitTrade:input_type -> broker.v1.SubmitTradeRequest
+	1,  // 12: broker.v1.Broker.SubmitTrades:input_type -> broker.v1.SubmitTradeRequest
+	5,  // 13: broker.v1.Broker.GetTrade:input_type -> broker.v1.GetTradeRequest
+	7,  // 14: broker.v1.Broker.GetAccountStats:input_type -> broker.v1.GetAccountStatsRequest
+	8,  // 15: broker.v1.Broker.WatchAccountStats:input_type -> broker.v1.WatchAccountStatsRequest
+	2,  // 16: broker.v1.Broker.SubmitTrade:output_type -> broker.v1.SubmitTradeResponse
+	3,  // 17: broker.v1.Broker.SubmitTrades:output_type -> broker.v1.SubmitTradesResponse
+	6,  // 18: broker.v1.Broker.GetTrade:output_type -> broker.v1.Trade
+	9,  // 19: broker.v1.Broker.GetAccountStats:output_type -> broker.v1.AccountStats
+	9,  // 20: broker.v1.Broker.WatchAccountStats:output_type -> broker.v1.AccountStats
+	16, // [16:21] is the sub-list for method output_type
+	11, // [11:16] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_broker_v1_broker_proto_init() }
+func file_broker_v1_broker_proto_init() {
+	if File_broker_v1_broker_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_broker_v1_broker_proto_rawDesc), len(file_broker_v1_broker_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_broker_v1_broker_proto_goTypes,
+		DependencyIndexes: file_broker_v1_broker_proto_depIdxs,
+		EnumInfos:         file_broker_v1_broker_proto_enumTypes,
+		MessageInfos:      file_broker_v1_broker_proto_msgTypes,
+	}.Build()
+	File_broker_v1_broker_proto = out.File
+	file_broker_v1_broker_proto_goTypes = nil
+	file_broker_v1_broker_proto_depIdxs = nil
+}
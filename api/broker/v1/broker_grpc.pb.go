@@ -0,0 +1,298 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: broker/v1/broker.proto
+
+// The gRPC API of the broker, for internal services. It submits trades and
+// reads account stats with the same checks, authentication and errors as the
+// HTTP API; see the "gRPC API" section of the README.
+
+package brokerv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Broker_SubmitTrade_FullMethodName       = "/broker.v1.Broker/SubmitTrade"
+	Broker_SubmitTrades_FullMethodName      = "/broker.v1.Broker/SubmitTrades"
+	Broker_GetTrade_FullMethodName          = "/broker.v1.Broker/GetTrade"
+	Broker_GetAccountStats_FullMethodName   = "/broker.v1.Broker/GetAccountStats"
+	Broker_WatchAccountStats_FullMethodName = "/broker.v1.Broker/WatchAccountStats"
+)
+
+// BrokerClient is the client API for Broker service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BrokerClient interface {
+	// SubmitTrade checks and enqueues a trade, like POST /trades. Requires the
+	// trade:write scope.
+	SubmitTrade(ctx context.Context, in *SubmitTradeRequest, opts ...grpc.CallOption) (*SubmitTradeResponse, error)
+	// SubmitTrades checks and enqueues each trade of the stream on its own and
+	// answers with the outcome of every trade, in the order received.
+	// Requires the trade:write scope.
+	SubmitTrades(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SubmitTradeRequest, SubmitTradesResponse], error)
+	// GetTrade returns a trade, like GET /trades/{id}. Requires the
+	// trade:amend scope.
+	GetTrade(ctx context.Context, in *GetTradeRequest, opts ...grpc.CallOption) (*Trade, error)
+	// GetAccountStats returns the stats of an account, like GET /stats/{acc}.
+	// Requires the stats:read scope.
+	GetAccountStats(ctx context.Context, in *GetAccountStatsRequest, opts ...grpc.CallOption) (*AccountStats, error)
+	// WatchAccountStats sends the stats of an account, then again every time
+	// they change, until the client cancels. An account without processed
+	// trades has zero stats. Requires the stats:read scope.
+	WatchAccountStats(ctx context.Context, in *WatchAccountStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AccountStats], error)
+}
+
+type brokerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBrokerClient(cc grpc.ClientConnInterface) BrokerClient {
+	return &brokerClient{cc}
+}
+
+func (c *brokerClient) SubmitTrade(ctx context.Context, in *SubmitTradeRequest, opts ...grpc.CallOption) (*SubmitTradeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitTradeResponse)
+	err := c.cc.Invoke(ctx, Broker_SubmitTrade_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) SubmitTrades(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SubmitTradeRequest, SubmitTradesResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Broker_ServiceDesc.Streams[0], Broker_SubmitTrades_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubmitTradeRequest, SubmitTradesResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Broker_SubmitTradesClient = grpc.ClientStreamingClient[SubmitTradeRequest, SubmitTradesResponse]
+
+func (c *brokerClient) GetTrade(ctx context.Context, in *GetTradeRequest, opts ...grpc.CallOption) (*Trade, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Trade)
+	err := c.cc.Invoke(ctx, Broker_GetTrade_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) GetAccountStats(ctx context.Context, in *GetAccountStatsRequest, opts ...grpc.CallOption) (*AccountStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AccountStats)
+	err := c.cc.Invoke(ctx, Broker_GetAccountStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) WatchAccountStats(ctx context.Context, in *WatchAccountStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AccountStats], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Broker_ServiceDesc.Streams[1], Broker_WatchAccountStats_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchAccountStatsRequest, AccountStats]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Broker_WatchAccountStatsClient = grpc.ServerStreamingClient[AccountStats]
+
+// BrokerServer is the server API for Broker service.
+// All implementations must embed UnimplementedBrokerServer
+// for forward compatibility.
+type BrokerServer interface {
+	// SubmitTrade checks and enqueues a trade, like POST /trades. Requires the
+	// trade:write scope.
+	SubmitTrade(context.Context, *SubmitTradeRequest) (*SubmitTradeResponse, error)
+	// SubmitTrades checks and enqueues each trade of the stream on its own and
+	// answers with the outcome of every trade, in the order received.
+	// Requires the trade:write scope.
+	SubmitTrades(grpc.ClientStreamingServer[SubmitTradeRequest, SubmitTradesResponse]) error
+	// GetTrade returns a trade, like GET /trades/{id}. Requires the
+	// trade:amend scope.
+	GetTrade(context.Context, *GetTradeRequest) (*Trade, error)
+	// GetAccountStats returns the stats of an account, like GET /stats/{acc}.
+	// Requires the stats:read scope.
+	GetAccountStats(context.Context, *GetAccountStatsRequest) (*AccountStats, error)
+	// WatchAccountStats sends the stats of an account, then again every time
+	// they change, until the client cancels. An account without processed
+	// trades has zero stats. Requires the stats:read scope.
+	WatchAccountStats(*WatchAccountStatsRequest, grpc.ServerStreamingServer[AccountStats]) error
+	mustEmbedUnimplementedBrokerServer()
+}
+
+// UnimplementedBrokerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBrokerServer struct{}
+
+func (UnimplementedBrokerServer) SubmitTrade(context.Context, *SubmitTradeRequest) (*SubmitTradeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitTrade not implemented")
+}
+func (UnimplementedBrokerServer) SubmitTrades(grpc.ClientStreamingServer[SubmitTradeRequest, SubmitTradesResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method SubmitTrades not implemented")
+}
+func (UnimplementedBrokerServer) GetTrade(context.Context, *GetTradeRequest) (*Trade, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTrade not implemented")
+}
+func (UnimplementedBrokerServer) GetAccountStats(context.Context, *GetAccountStatsRequest) (*AccountStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAccountStats not implemented")
+}
+func (UnimplementedBrokerServer) WatchAccountStats(*WatchAccountStatsRequest, grpc.ServerStreamingServer[AccountStats]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchAccountStats not implemented")
+}
+func (UnimplementedBrokerServer) mustEmbedUnimplementedBrokerServer() {}
+func (UnimplementedBrokerServer) testEmbeddedByValue()                {}
+
+// UnsafeBrokerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BrokerServer will
+// result in compilation errors.
+type UnsafeBrokerServer interface {
+	mustEmbedUnimplementedBrokerServer()
+}
+
+func RegisterBrokerServer(s grpc.ServiceRegistrar, srv BrokerServer) {
+	// If the following call pancis, it indicates UnimplementedBrokerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Broker_ServiceDesc, srv)
+}
+
+func _Broker_SubmitTrade_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitTradeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).SubmitTrade(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Broker_SubmitTrade_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).SubmitTrade(ctx, req.(*SubmitTradeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_SubmitTrades_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BrokerServer).SubmitTrades(&grpc.GenericServerStream[SubmitTradeRequest, SubmitTradesResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Broker_SubmitTradesServer = grpc.ClientStreamingServer[SubmitTradeRequest, SubmitTradesResponse]
+
+func _Broker_GetTrade_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTradeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).GetTrade(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Broker_GetTrade_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).GetTrade(ctx, req.(*GetTradeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_GetAccountStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAccountStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).GetAccountStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Broker_GetAccountStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).GetAccountStats(ctx, req.(*GetAccountStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_WatchAccountStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchAccountStatsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BrokerServer).WatchAccountStats(m, &grpc.GenericServerStream[WatchAccountStatsRequest, AccountStats]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Broker_WatchAccountStatsServer = grpc.ServerStreamingServer[AccountStats]
+
+// Broker_ServiceDesc is the grpc.ServiceDesc for Broker service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Broker_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "broker.v1.Broker",
+	HandlerType: (*BrokerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitTrade",
+			Handler:    _Broker_SubmitTrade_Handler,
+		},
+		{
+			MethodName: "GetTrade",
+			Handler:    _Broker_GetTrade_Handler,
+		},
+		{
+			MethodName: "GetAccountStats",
+			Handler:    _Broker_GetAccountStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubmitTrades",
+			Handler:       _Broker_SubmitTrades_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchAccountStats",
+			Handler:       _Broker_WatchAccountStats_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "broker/v1/broker.proto",
+}
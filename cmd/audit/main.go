@@ -0,0 +1,85 @@
+// Command audit checks the hash chain of the audit log:
+//
+//	audit verify --db data.db [--head <seq>:<hash>]
+//
+// It exits with status 1 when an entry was modified, removed or reordered.
+// Entries removed from the end of the log leave a valid chain; pass a head
+// printed by an earlier run to detect those too.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"os"
+	"strconv"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: audit verify [--db path] [--head seq:hash]")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	dbPath := fs.String("db", "data.db", "path to SQLite database")
+	head := fs.String("head", "", "head of an earlier verification (seq:hash) the log must still contain")
+	_ = fs.Parse(os.Args[2:])
+
+	if err := verify(context.Background(), *dbPath, *head); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func verify(ctx context.Context, dbPath, head string) error {
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dbManager := dbmanager.Manager{}
+	if err = dbManager.InitDbManager(db); err != nil {
+		return err
+	}
+
+	wantSeq, wantHash, err := parseHead(head)
+	if err != nil {
+		return err
+	}
+	seq, hash, err := dbManager.VerifyAudit(ctx)
+	if err != nil {
+		return err
+	}
+	if wantSeq > seq {
+		return fmt.Errorf("audit log ends at entry %d, but entry %d was seen before; entries were removed", seq, wantSeq)
+	}
+	if wantSeq > 0 {
+		entries, err := dbManager.ListAudit(ctx, wantSeq, 1)
+		if err != nil {
+			return err
+		}
+		if entries[0].Hash != wantHash {
+			return fmt.Errorf("entry %d has hash %s, but %s was seen before", wantSeq, entries[0].Hash, wantHash)
+		}
+	}
+	fmt.Printf("audit log ok: %d entries, head %d:%s\n", seq, seq, hash)
+	return nil
+}
+
+func parseHead(head string) (int64, string, error) {
+	if head == "" {
+		return 0, "", nil
+	}
+	s, hash, ok := strings.Cut(head, ":")
+	seq, err := strconv.ParseInt(s, 10, 64)
+	if !ok || err != nil || seq < 1 || hash == "" {
+		return 0, "", errors.New("head must be <seq>:<hash>")
+	}
+	return seq, hash, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	dbManager := dbmanager.Manager{}
+	if err = dbManager.InitDbManager(conn); err != nil {
+		t.Fatalf("init db manager: %v", err)
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	for range 3 {
+		trade := model.Trade{Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: "buy"}
+		if err = dbManager.CreateTrade(t.Context(), &trade); err != nil {
+			t.Fatalf("CreateTrade: %v", err)
+		}
+	}
+	_, head, err := dbManager.VerifyAudit(t.Context())
+	if err != nil {
+		t.Fatalf("VerifyAudit: %v", err)
+	}
+
+	if err = verify(t.Context(), path, "3:"+head); err != nil {
+		t.Errorf("verify intact log: %v", err)
+	}
+	if err = verify(t.Context(), path, "3:"+strings.Repeat("0", 64)); err == nil {
+		t.Error("verify with foreign head succeeded")
+	}
+
+	// removing the last entry leaves a valid chain, but not the head
+	if _, err = conn.Exec(`DROP TRIGGER audit_log_no_delete; DELETE FROM audit_log WHERE seq = 3`); err != nil {
+		t.Fatalf("delete entry: %v", err)
+	}
+	if err = verify(t.Context(), path, ""); err != nil {
+		t.Errorf("verify without head: %v", err)
+	}
+	if err = verify(t.Context(), path, "3:"+head); err == nil {
+		t.Error("verify did not detect the removed entry")
+	}
+}
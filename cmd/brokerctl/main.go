@@ -0,0 +1,182 @@
+// Command brokerctl is the operators' tool for the broker. Commands that
+// accept --server talk to the HTTP API when it is set, the others always
+// work on the database file:
+//
+//	brokerctl submit [--account 123 --symbol EURUSD --side buy --volume 1 --open 1.1 --close 1.105] [--file trades.json] [--rules rules.json]
+//	brokerctl stats <account>...
+//	brokerctl discard --reason text <trade id>...
+//	brokerctl queue
+//	brokerctl stuck [--older-than 1m] [--limit 100]
+//	brokerctl requeue --reason text <trade id>...
+//	brokerctl migrate
+//	brokerctl rebuild [--dry-run]
+//	brokerctl verify
+//
+// Every command takes --db (default data.db) and --output table, json or
+// csv; --server (default $BROKER_URL) comes with --api-key (default
+// $BROKER_API_KEY). The exit status is 1 when anything failed.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/pkg/client"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const usage = `usage: brokerctl <command> [flags] [args]
+
+commands:
+  submit    enqueue trades given by flags or read from a JSON file
+  stats     show the stats of accounts
+  discard   cancel trades
+  queue     count the queued trades by status
+  stuck     list trades pending for too long
+  requeue   put processed trades back on the queue
+  migrate   create or upgrade the database schema
+  rebuild   recompute the account stats from the processed trades
+  verify    check the database, the audit log and the account stats
+
+Run brokerctl <command> --help for the flags of a command.`
+
+// actor is recorded in the audit log for changes made on the database.
+const actor = "brokerctl"
+
+type command struct {
+	// remote commands can use the HTTP API instead of the database.
+	remote bool
+	run    func(ctx context.Context, t *target, fs *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]command{
+	"submit":  {remote: true, run: runSubmit},
+	"stats":   {remote: true, run: runStats},
+	"discard": {remote: true, run: runDiscard},
+	"queue":   {run: runQueue},
+	"stuck":   {run: runStuck},
+	"requeue": {run: runRequeue},
+	"migrate": {run: runMigrate},
+	"rebuild": {run: runRebuild},
+	"verify":  {run: runVerify},
+}
+
+func main() {
+	ctx := audit.WithActor(context.Background(), actor)
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) < 1 {
+		return errors.New(usage)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return errors.New(usage)
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	t := &target{stdin: stdin, stdout: stdout}
+	fs.StringVar(&t.dbPath, "db", "data.db", "path to SQLite database")
+	fs.StringVar(&t.format, "output", formatTable, "output format: table, json or csv")
+	if cmd.remote {
+		fs.StringVar(&t.server, "server", os.Getenv("BROKER_URL"), "base URL of the HTTP API to use instead of --db")
+		fs.StringVar(&t.apiKey, "api-key", os.Getenv("BROKER_API_KEY"), "API key for --server")
+	}
+	return cmd.run(ctx, t, fs, args[1:])
+}
+
+// target is where a command reads and changes data and how it prints its
+// results.
+type target struct {
+	dbPath string
+	server string
+	apiKey string
+	format string
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+// parse parses the flags of a command and checks those of t.
+func (t *target) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch t.format {
+	case formatTable, formatJSON, formatCSV:
+		return nil
+	}
+	return fmt.Errorf("invalid --output %q, expected table, json or csv", t.format)
+}
+
+// client returns the API client, or nil when the command works on the
+// database.
+func (t *target) client() *client.Client {
+	if t.server == "" {
+		return nil
+	}
+	c := client.New(t.server)
+	c.ApiKey = t.apiKey
+	c.UserAgent = actor
+	return c
+}
+
+// open opens the database, read-only unless the command changes it.
+func (t *target) open(readOnly bool) (*dbmanager.Manager, func(), error) {
+	dsn := t.dbPath
+	if readOnly {
+		dsn = "file:" + t.dbPath + "?mode=ro"
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbManager := &dbmanager.Manager{}
+	if err = dbManager.InitDbManager(db); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return dbManager, func() { db.Close() }, nil
+}
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// write prints v as indented JSON, or header and rows as an aligned table or
+// as CSV.
+func (t *target) write(v any, header []string, rows [][]string) error {
+	switch t.format {
+	case formatJSON:
+		enc := json.NewEncoder(t.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case formatCSV:
+		w := csv.NewWriter(t.stdout)
+		w.Write(header)
+		w.WriteAll(rows)
+		return w.Error()
+	}
+	w := tabwriter.NewWriter(t.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.db")
+	file := filepath.Join(dir, "trades.json")
+	err := os.WriteFile(file, []byte(`{"account":"456","symbol":"GBPUSD","volume":2,"open":1.3,"close":1.29,"side":"sell"}
+{"account":"456","symbol":"GBP","volume":2,"open":1.3,"close":1.29,"side":"hold"}
+`), 0o644)
+	if err != nil {
+		t.Fatalf("write trades: %v", err)
+	}
+	rules := filepath.Join(dir, "rules.json")
+	if err = os.WriteFile(rules, []byte(`{"default":"all","groups":{"all":{"rules":[{"rule":"max_volume","default":0.5}]}}}`), 0o644); err != nil {
+		t.Fatalf("write rules: %v", err)
+	}
+	ctx := audit.WithActor(t.Context(), actor)
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+		// process claims the oldest pending trade as the worker does
+		// before the command runs.
+		process bool
+		// corrupt overwrites the stats of account 123 before the command
+		// runs.
+		corrupt bool
+		want    string
+		err     bool
+	}{
+		{name: "migrate", args: []string{"migrate"}, want: "schema of " + path + " is up to date\n"},
+		{name: "submit from flags", args: []string{"submit", "--account", "123", "--symbol", "EURUSD", "--side", "buy",
+			"--volume", "1", "--open", "1.1", "--close", "1.105"},
+			want: "N  ID  ACCOUNT  SYMBOL  SIDE  VOLUME  ERROR\n1  1   123      EURUSD  buy   1       \n"},
+		{name: "submit from file", args: []string{"submit", "--file", file, "--output", "csv"}, err: true,
+			want: "n,id,account,symbol,side,volume,error\n1,2,456,GBPUSD,sell,2,\n" +
+				"2,,456,GBP,hold,2,\"symbol failed the symbol rule; side must be one of buy, sell\"\n"},
+		{name: "submit from stdin", args: []string{"submit", "--file", "-", "--output", "csv"},
+			stdin: `[{"account":"123","symbol":"EURUSD","volume":1,"open":1.1,"close":1.1,"side":"buy"}]`,
+			want:  "n,id,account,symbol,side,volume,error\n1,3,123,EURUSD,buy,1,\n"},
+		{name: "submit with file and flags", args: []string{"submit", "--file", file, "--account", "123"}, err: true},
+		{name: "submit to unknown account", args: []string{"submit", "--auto-create-accounts=false", "--account", "789",
+			"--symbol", "EURUSD", "--side", "buy", "--volume", "1", "--open", "1.1", "--close", "1.105", "--output", "csv"}, err: true,
+			want: "n,id,account,symbol,side,volume,error\n1,,789,EURUSD,buy,1,account 789 does not exist\n"},
+		{name: "submit against rules", args: []string{"submit", "--rules", rules, "--account", "123",
+			"--symbol", "EURUSD", "--side", "buy", "--volume", "1", "--open", "1.1", "--close", "1.105", "--output", "csv"}, err: true,
+			want: "n,id,account,symbol,side,volume,error\n1,,123,EURUSD,buy,1,volume must be at most 0.5 for EURUSD\n"},
+		{name: "queue", args: []string{"queue", "--output", "csv"}, process: true,
+			want: "pending,processed,cancelled,oldest_pending\n2,1,0,"},
+		{name: "stuck", args: []string{"stuck", "--older-than", "0s", "--output", "csv"},
+			want: "id,account,symbol,side,volume,received_at,age\n2,456,GBPUSD,sell,2,"},
+		{name: "stats", args: []string{"stats", "--output", "json", "123"},
+			want: "[\n  {\n    \"account\": \"123\",\n    \"trades\": 1,\n    \"profit\": 499.9999999999893\n  }\n]\n"},
+		{name: "stats of unknown account", args: []string{"stats", "123", "789"}, err: true,
+			want: "ACCOUNT  TRADES  PROFIT\n123      1       499.9999999999893\n"},
+		{name: "requeue pending trade", args: []string{"requeue", "--reason", "retry", "2"}, err: true,
+			want: "ID  ACCOUNT  STATUS  VERSION\n"},
+		{name: "requeue without reason", args: []string{"requeue", "1"}, err: true},
+		{name: "requeue", args: []string{"requeue", "--reason", "wrong group", "--output", "csv", "1"},
+			want: "id,account,status,version\n1,123,pending,2\n"},
+		{name: "discard", args: []string{"discard", "--reason", "duplicate", "--output", "csv", "2", "99"}, err: true,
+			want: "id,account,status,version\n2,456,cancelled,2\n"},
+		{name: "verify", args: []string{"verify", "--output", "csv"}, process: true,
+			want: "check,status,detail\ndatabase,ok,integrity check passed\naudit log,ok,"},
+		{name: "verify drifted stats", args: []string{"verify", "--output", "csv"}, corrupt: true, err: true,
+			want: "check,status,detail\ndatabase,ok,integrity check passed\naudit log,ok,"},
+		{name: "rebuild dry run", args: []string{"rebuild", "--dry-run", "--output", "csv"},
+			want: "account,trades,profit,want_trades,want_profit\n123,7,1,1,499.9999999999893\n"},
+		{name: "rebuild", args: []string{"rebuild", "--output", "csv"},
+			want: "account,trades,profit,want_trades,want_profit\n123,7,1,1,499.9999999999893\n"},
+		{name: "nothing left to rebuild", args: []string{"rebuild", "--output", "json"}, want: "[]\n"},
+		{name: "remote only flag", args: []string{"queue", "--server", "http://localhost:8080"}, err: true},
+		{name: "unknown output", args: []string{"queue", "--output", "yaml"}, err: true},
+		{name: "unknown command", args: []string{"drop"}, err: true},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if test.process {
+			process(t, path)
+		}
+		if test.corrupt {
+			exec(t, path, `UPDATE clients SET trades = 7, profit = 1 WHERE account = '123'`)
+		}
+		var out strings.Builder
+		args := append([]string{test.args[0], "--db", path}, test.args[1:]...)
+		err := run(ctx, args, strings.NewReader(test.stdin), &out)
+		if (err != nil) != test.err {
+			t.Fatalf("run = %v; want error %v", err, test.err)
+		}
+		if !strings.HasPrefix(out.String(), test.want) {
+			t.Errorf("output = %q; want %q", out.String(), test.want)
+		}
+	}
+}
+
+// process claims the oldest pending trade of the database at path and
+// applies it to the account stats, as the worker does.
+func process(t *testing.T, path string) {
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	dbManager := dbmanager.Manager{}
+	if err = dbManager.InitDbManager(conn); err != nil {
+		t.Fatalf("init db manager: %v", err)
+	}
+	tx, err := dbManager.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	defer tx.Rollback()
+	trade, err := dbManager.GetTrade(t.Context(), tx, time.Now())
+	if err != nil || trade == nil {
+		t.Fatalf("GetTrade = %v, %v", trade, err)
+	}
+	if err = dbManager.UpdateAccount(t.Context(), tx, trade.Account, trade.Profit()); err != nil {
+		t.Fatalf("UpdateAccount: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+func exec(t *testing.T, path, query string) {
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	if _, err = conn.Exec(query); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+}
+
+func TestRun_Server(t *testing.T) {
+	var submitted []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "id.secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /trades":
+			var trade map[string]any
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &trade)
+			if trade["account"] == "456" {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"status":403,"code":"forbidden","detail":"account 456 is not allowed"}`))
+				return
+			}
+			submitted = append(submitted, trade)
+		case "GET /stats/123":
+			w.Write([]byte(`{"account":"123","trades":2,"profit":1000}`))
+		case "POST /trades/5/cancel":
+			w.Write([]byte(`{"id":5,"version":2,"status":"cancelled","account":"123"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+		err  bool
+	}{
+		{name: "submit", args: []string{"submit", "--account", "123", "--symbol", "EURUSD", "--side", "buy",
+			"--volume", "1", "--open", "1.1", "--close", "1.105", "--output", "csv"},
+			want: "n,id,account,symbol,side,volume,error\n1,,123,EURUSD,buy,1,\n"},
+		{name: "submit rejected", args: []string{"submit", "--account", "456", "--symbol", "EURUSD", "--side", "buy",
+			"--volume", "1", "--open", "1.1", "--close", "1.105", "--output", "csv"}, err: true,
+			want: "n,id,account,symbol,side,volume,error\n1,,456,EURUSD,buy,1,broker: 403 forbidden: account 456 is not allowed\n"},
+		{name: "stats", args: []string{"stats", "--output", "csv", "123"}, want: "account,trades,profit\n123,2,1000\n"},
+		{name: "discard", args: []string{"discard", "--reason", "duplicate", "--output", "csv", "5"},
+			want: "id,account,status,version\n5,123,cancelled,2\n"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		var out strings.Builder
+		args := append([]string{test.args[0], "--server", srv.URL, "--api-key", "id.secret"}, test.args[1:]...)
+		err := run(t.Context(), args, strings.NewReader(""), &out)
+		if (err != nil) != test.err {
+			t.Fatalf("run = %v; want error %v", err, test.err)
+		}
+		if out.String() != test.want {
+			t.Errorf("output = %q; want %q", out.String(), test.want)
+		}
+	}
+	if len(submitted) != 1 || submitted[0]["symbol"] != "EURUSD" {
+		t.Errorf("submitted = %v; want one trade", submitted)
+	}
+}
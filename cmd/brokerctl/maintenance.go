@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"strings"
+)
+
+// errVerifyFailed reports a verification that found problems.
+var errVerifyFailed = errors.New("verification failed")
+
+func runMigrate(ctx context.Context, t *target, fs *flag.FlagSet, args []string) error {
+	if err := t.parse(fs, args); err != nil {
+		return err
+	}
+	dbManager, done, err := t.open(false)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		return err
+	}
+	fmt.Fprintln(t.stdout, "schema of", t.dbPath, "is up to date")
+	return nil
+}
+
+func runRebuild(ctx context.Context, t *target, fs *flag.FlagSet, args []string) error {
+	dryRun := fs.Bool("dry-run", false, "only list the accounts whose stats would change")
+	if err := t.parse(fs, args); err != nil {
+		return err
+	}
+	dbManager, done, err := t.open(*dryRun)
+	if err != nil {
+		return err
+	}
+	defer done()
+	rebuild := dbManager.RebuildStats
+	if *dryRun {
+		rebuild = dbManager.StatsDrift
+	}
+	drifts, err := rebuild(ctx)
+	if err != nil {
+		return err
+	}
+	return t.writeDrifts(drifts)
+}
+
+// writeDrifts prints the stored and recomputed stats of drifted accounts.
+func (t *target) writeDrifts(drifts []model.StatsDrift) error {
+	if drifts == nil {
+		drifts = []model.StatsDrift{}
+	}
+	rows := make([][]string, 0, len(drifts))
+	for _, d := range drifts {
+		rows = append(rows, []string{format.Text(d.Account), format.Int(d.Trades), format.Float(d.Profit),
+			format.Int(d.WantTrades), format.Float(d.WantProfit)})
+	}
+	return t.write(drifts, []string{"account", "trades", "profit", "want_trades", "want_profit"}, rows)
+}
+
+// check is the outcome of one verification.
+type check struct {
+	Name   string `json:"name"`
+	Ok     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+func runVerify(ctx context.Context, t *target, fs *flag.FlagSet, args []string) error {
+	if err := t.parse(fs, args); err != nil {
+		return err
+	}
+	dbManager, done, err := t.open(true)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	var checks []check
+	problems, err := dbManager.IntegrityCheck(ctx)
+	if err != nil {
+		return err
+	}
+	c := check{Name: "database", Ok: len(problems) == 0, Detail: "integrity check passed"}
+	if !c.Ok {
+		c.Detail = strings.Join(problems, "; ")
+	}
+	checks = append(checks, c)
+
+	seq, hash, err := dbManager.VerifyAudit(ctx)
+	if err != nil && !errors.Is(err, audit.ErrBroken) {
+		return err
+	}
+	c = check{Name: "audit log", Ok: err == nil, Detail: fmt.Sprintf("%d entries, head %d:%s", seq, seq, hash)}
+	if err != nil {
+		c.Detail = err.Error()
+	}
+	checks = append(checks, c)
+
+	drifts, err := dbManager.StatsDrift(ctx)
+	if err != nil {
+		return err
+	}
+	c = check{Name: "account stats", Ok: len(drifts) == 0, Detail: "stats match the processed trades"}
+	if !c.Ok {
+		accounts := make([]string, 0, len(drifts))
+		for _, d := range drifts {
+			accounts = append(accounts, d.Account)
+		}
+		c.Detail = "stats differ from the processed trades for " + strings.Join(accounts, ", ") + "; run brokerctl rebuild"
+	}
+	checks = append(checks, c)
+
+	rows := make([][]string, 0, len(checks))
+	ok := true
+	for _, c := range checks {
+		status := "ok"
+		if !c.Ok {
+			status, ok = "failed", false
+		}
+		rows = append(rows, []string{c.Name, status, c.Detail})
+	}
+	if err = t.write(checks, []string{"check", "status", "detail"}, rows); err != nil {
+		return err
+	}
+	if !ok {
+		return errVerifyFailed
+	}
+	return nil
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/export"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"gitlab.com/digineat/go-broker-test/pkg/client"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errTradesFailed reports trades that were not submitted; the others were.
+var errTradesFailed = errors.New("some trades were not submitted")
+
+// format formats the values of tables.
+var format = export.Format{}
+
+// submitResult is the outcome of submitting the Nth trade.
+type submitResult struct {
+	N       int     `json:"n"`
+	Id      int     `json:"id,omitempty"`
+	Account string  `json:"account"`
+	Symbol  string  `json:"symbol"`
+	Side    string  `json:"side"`
+	Volume  float64 `json:"volume"`
+	Error   string  `json:"error,omitempty"`
+}
+
+func runSubmit(ctx context.Context, t *target, fs *flag.FlagSet, args []string) error {
+	trade := model.Trade{}
+	fs.StringVar(&trade.Account, "account", "", "account of the trade")
+	fs.StringVar(&trade.Symbol, "symbol", "", "symbol of the trade, e.g. EURUSD")
+	fs.StringVar(&trade.Side, "side", "", "buy or sell")
+	fs.Float64Var(&trade.Volume, "volume", 0, "volume of the trade")
+	fs.Float64Var(&trade.Open, "open", 0, "open price")
+	fs.Float64Var(&trade.Close, "close", 0, "close price")
+	file := fs.String("file", "", "JSON file with an array of trades or one trade per line, - for stdin")
+	autoCreate := fs.Bool("auto-create-accounts", true, "without --server, create unknown accounts instead of rejecting their trades")
+	rulesPath := fs.String("rules", "", "without --server, JSON file with the trade validation rules of the server")
+	if err := t.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: brokerctl submit [flags]; trades are given by flags or --file")
+	}
+
+	trades := []model.Trade{trade}
+	if *file != "" {
+		if trade != (model.Trade{}) {
+			return errors.New("--file can not be combined with the flags of a trade")
+		}
+		var err error
+		if trades, err = readTrades(t.stdin, *file); err != nil {
+			return err
+		}
+	}
+
+	submit, done, err := t.submitter(*autoCreate, *rulesPath)
+	if err != nil {
+		return err
+	}
+	defer done()
+	results := make([]submitResult, 0, len(trades))
+	rows := make([][]string, 0, len(trades))
+	failed := false
+	for i := range trades {
+		tr := &trades[i]
+		res := submitResult{N: i + 1, Account: tr.Account, Symbol: tr.Symbol, Side: tr.Side, Volume: tr.Volume}
+		if err := submit(ctx, tr); err != nil {
+			res.Error = err.Error()
+			failed = true
+		}
+		res.Id = tr.Id
+		results = append(results, res)
+		id := ""
+		if res.Id > 0 {
+			id = format.Int(res.Id)
+		}
+		rows = append(rows, []string{format.Int(res.N), id, format.Text(res.Account), format.Text(res.Symbol),
+			format.Text(res.Side), format.Float(res.Volume), format.Text(res.Error)})
+	}
+	if err = t.write(results, []string{"n", "id", "account", "symbol", "side", "volume", "error"}, rows); err != nil {
+		return err
+	}
+	if failed {
+		return errTradesFailed
+	}
+	return nil
+}
+
+// readTrades reads the trades of a JSON file: an array of trades, or one
+// trade per line.
+func readTrades(stdin io.Reader, path string) ([]model.Trade, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var trades []model.Trade
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err = dec.Decode(&trades); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return trades, nil
+	}
+	for {
+		var trade model.Trade
+		if err = dec.Decode(&trade); err == io.EOF {
+			return trades, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: trade %d: %w", path, len(trades)+1, err)
+		}
+		trades = append(trades, trade)
+	}
+}
+
+// submitter returns a function enqueuing a trade through the API, or into
+// the database after the field, time and account checks of the server and
+// the rules of rulesPath, if any. Unknown accounts are created when
+// autoCreate is set, as the server does with --auto-create-accounts. Limits
+// and the calendar of the server only apply through the API, and so do
+// market_hours rules.
+func (t *target) submitter(autoCreate bool, rulesPath string) (func(ctx context.Context, trade *model.Trade) error, func(), error) {
+	if c := t.client(); c != nil {
+		if rulesPath != "" {
+			return nil, nil, errors.New("--rules can not be combined with --server, which applies its own rules")
+		}
+		return func(ctx context.Context, trade *model.Trade) error {
+			_, err := c.SubmitTrade(ctx, client.SubmitTradeRequest{Account: trade.Account, Symbol: trade.Symbol,
+				Volume: trade.Volume, Open: trade.Open, Close: trade.Close, Side: trade.Side,
+				OpenTime: trade.OpenTime, CloseTime: trade.CloseTime})
+			return err
+		}, func() {}, nil
+	}
+	dbManager, done, err := t.open(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rules *validation.Engine
+	if rulesPath != "" {
+		if rules, err = validation.Load(rulesPath, validation.Deps{Quotes: dbManager, Accounts: dbManager}); err != nil {
+			done()
+			return nil, nil, err
+		}
+	}
+	return func(ctx context.Context, trade *model.Trade) error {
+		now := time.Now()
+		var errs []problem.FieldError
+		if err := validation.Struct(trade); err != nil {
+			errs = problem.FromValidation(err).Errors
+		} else {
+			errs = validation.Times(trade, now, 0)
+		}
+		missing := false
+		if len(errs) == 0 {
+			var fe *problem.FieldError
+			missing, fe, err = validation.Account(ctx, dbManager, trade.Account, autoCreate)
+			if err != nil {
+				return err
+			}
+			if fe != nil {
+				errs = append(errs, *fe)
+			}
+		}
+		if len(errs) == 0 {
+			if errs, err = rules.Check(ctx, trade); err != nil {
+				return err
+			}
+		}
+		if len(errs) > 0 {
+			messages := make([]string, 0, len(errs))
+			for _, fe := range errs {
+				messages = append(messages, fe.Message)
+			}
+			return errors.New(strings.Join(messages, "; "))
+		}
+		var account *model.TradingAccount
+		if missing {
+			account = model.NewTradingAccount(trade.Account, now)
+		}
+		trade.ReceivedAt = now
+		if err = dbManager.CreateAccountTrade(ctx, account, trade); err != nil {
+			return err
+		}
+		rules.Record(ctx, trade)
+		return nil
+	}, done, nil
+}
+
+func runStats(ctx context.Context, t *target, fs *flag.FlagSet, args []string) error {
+	if err := t.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: brokerctl stats [flags] <account>...")
+	}
+
+	var get func(ctx context.Context, account string) (*model.Account, error)
+	if c := t.client(); c != nil {
+		get = func(ctx context.Context, account string) (*model.Account, error) {
+			stats, err := c.GetStats(ctx, account)
+			if err != nil {
+				return nil, err
+			}
+			return &model.Account{AccountId: stats.Account, Trades: stats.Trades, Profit: stats.Profit}, nil
+		}
+	} else {
+		dbManager, done, err := t.open(true)
+		if err != nil {
+			return err
+		}
+		defer done()
+		get = func(ctx context.Context, account string) (*model.Account, error) {
+			stats, err := dbManager.GetClient(ctx, account)
+			if err == nil && stats == nil {
+				err = errors.New("no processed trades")
+			}
+			return stats, err
+		}
+	}
+
+	accounts := []model.Account{}
+	var rows [][]string
+	var errs []error
+	for _, account := range fs.Args() {
+		stats, err := get(ctx, account)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", account, err))
+			continue
+		}
+		accounts = append(accounts, *stats)
+		rows = append(rows, []string{format.Text(stats.AccountId), format.Int(stats.Trades), format.Float(stats.Profit)})
+	}
+	if err := t.write(accounts, []string{"account", "trades", "profit"}, rows); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// changedTrade is a trade discarded or requeued by a command.
+type changedTrade struct {
+	Id      int    `json:"id"`
+	Account string `json:"account"`
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+}
+
+func runDiscard(ctx context.Context, t *target, fs *flag.FlagSet, args []string) error {
+	reason := fs.String("reason", "", "why the trades are discarded (required)")
+	if err := t.parse(fs, args); err != nil {
+		return err
+	}
+	ids, err := tradeIds(fs, *reason, "discard")
+	if err != nil {
+		return err
+	}
+
+	if c := t.client(); c != nil {
+		return t.changeTrades(ids, func(id int) (*changedTrade, error) {
+			trade, err := c.CancelTrade(ctx, id, *reason)
+			if err != nil {
+				return nil, err
+			}
+			return &changedTrade{Id: trade.Id, Account: trade.Account, Status: trade.Status, Version: trade.Version}, nil
+		})
+	}
+	dbManager, done, err := t.open(false)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return t.changeTrades(ids, func(id int) (*changedTrade, error) {
+		prev, err := findTrade(ctx, dbManager, id)
+		if err != nil {
+			return nil, err
+		}
+		if prev.Status() == model.TradeStatusCancelled {
+			return nil, errors.New("trade is already cancelled")
+		}
+		if _, err = dbManager.CancelTrade(ctx, prev, audit.Actor(ctx), *reason, time.Now()); err != nil {
+			return nil, err
+		}
+		return &changedTrade{Id: id, Account: prev.Account, Status: model.TradeStatusCancelled, Version: prev.Version + 1}, nil
+	})
+}
+
+func runRequeue(ctx context.Context, t *target, fs *flag.FlagSet, args []string) error {
+	reason := fs.String("reason", "", "why the trades are processed again (required)")
+	if err := t.parse(fs, args); err != nil {
+		return err
+	}
+	ids, err := tradeIds(fs, *reason, "requeue")
+	if err != nil {
+		return err
+	}
+
+	dbManager, done, err := t.open(false)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return t.changeTrades(ids, func(id int) (*changedTrade, error) {
+		prev, err := findTrade(ctx, dbManager, id)
+		if err != nil {
+			return nil, err
+		}
+		if status := prev.Status(); status != model.TradeStatusProcessed {
+			return nil, errors.New("trade is " + status + "; only processed trades can be requeued")
+		}
+		if _, err = dbManager.RequeueTrade(ctx, prev, audit.Actor(ctx), *reason, time.Now()); err != nil {
+			return nil, err
+		}
+		return &changedTrade{Id: id, Account: prev.Account, Status: model.TradeStatusPending, Version: prev.Version + 1}, nil
+	})
+}
+
+// tradeIds returns the trade ids given as arguments of command, which
+// requires a reason.
+func tradeIds(fs *flag.FlagSet, reason, command string) ([]int, error) {
+	if fs.NArg() == 0 || reason == "" {
+		return nil, fmt.Errorf("usage: brokerctl %s --reason text [flags] <trade id>...", command)
+	}
+	ids := make([]int, 0, fs.NArg())
+	for _, arg := range fs.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("invalid trade id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func findTrade(ctx context.Context, dbManager *dbmanager.Manager, id int) (*model.Trade, error) {
+	trade, err := dbManager.FindTrade(ctx, id)
+	if err == nil && trade == nil {
+		err = errors.New("trade not found")
+	}
+	return trade, err
+}
+
+// changeTrades applies change to every trade in ids and prints the changed
+// trades. A trade that can not be changed does not stop the others.
+func (t *target) changeTrades(ids []int, change func(id int) (*changedTrade, error)) error {
+	changed := []changedTrade{}
+	var rows [][]string
+	var errs []error
+	for _, id := range ids {
+		c, err := change(id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("trade %d: %w", id, err))
+			continue
+		}
+		changed = append(changed, *c)
+		rows = append(rows, []string{format.Int(c.Id), format.Text(c.Account), c.Status, format.Int(c.Version)})
+	}
+	if err := t.write(changed, []string{"id", "account", "status", "version"}, rows); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+func runQueue(ctx context.Context, t *target, fs *flag.FlagSet, args []string) error {
+	if err := t.parse(fs, args); err != nil {
+		return err
+	}
+	dbManager, done, err := t.open(true)
+	if err != nil {
+		return err
+	}
+	defer done()
+	depth, err := dbManager.QueueDepth(ctx)
+	if err != nil {
+		return err
+	}
+	return t.write(depth, []string{"pending", "processed", "cancelled", "oldest_pending"}, [][]string{{
+		format.Int(depth.Pending), format.Int(depth.Processed), format.Int(depth.Cancelled), format.Time(depth.OldestPending),
+	}})
+}
+
+// stuckTrade is a trade waiting in the queue for Age.
+type stuckTrade struct {
+	Id         int       `json:"id"`
+	Account    string    `json:"account"`
+	Symbol     string    `json:"symbol"`
+	Side       string    `json:"side"`
+	Volume     float64   `json:"volume"`
+	ReceivedAt time.Time `json:"received_at"`
+	Age        string    `json:"age"`
+}
+
+func runStuck(ctx context.Context, t *target, fs *flag.FlagSet, args []string) error {
+	olderThan := fs.Duration("older-than", time.Minute, "list trades pending for longer than this")
+	limit := fs.Int("limit", 100, "list at most this many trades")
+	if err := t.parse(fs, args); err != nil {
+		return err
+	}
+	dbManager, done, err := t.open(true)
+	if err != nil {
+		return err
+	}
+	defer done()
+	now := time.Now()
+	trades, err := dbManager.StuckTrades(ctx, now.Add(-*olderThan), *limit)
+	if err != nil {
+		return err
+	}
+
+	stuck := make([]stuckTrade, 0, len(trades))
+	rows := make([][]string, 0, len(trades))
+	for _, trade := range trades {
+		s := stuckTrade{Id: trade.Id, Account: trade.Account, Symbol: trade.Symbol, Side: trade.Side, Volume: trade.Volume,
+			ReceivedAt: trade.ReceivedAt}
+		if !trade.ReceivedAt.IsZero() {
+			s.Age = now.Sub(trade.ReceivedAt).Truncate(time.Second).String()
+		}
+		stuck = append(stuck, s)
+		rows = append(rows, []string{format.Int(s.Id), format.Text(s.Account), format.Text(s.Symbol), format.Text(s.Side),
+			format.Float(s.Volume), format.Time(&s.ReceivedAt), s.Age})
+	}
+	return t.write(stuck, []string{"id", "account", "symbol", "side", "volume", "received_at", "age"}, rows)
+}
@@ -0,0 +1,123 @@
+// Command export writes trades or account stats as CSV, with the same
+// columns and formatting as the server's CSV endpoints:
+//
+//	export trades --db data.db [--account 123] [--from t] [--to t] [--columns id,profit] [--tz Europe/London] [--bom] [--out file]
+//	export stats --db data.db [--columns account,profit] [--bom] [--out file]
+//
+// The database is opened read-only and rows are streamed, so it can run
+// next to the server on a live database.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/export"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"io"
+	"os"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const usage = "usage: export trades|stats [--db path] [--account id] [--from time] [--to time] [--columns list] [--tz zone] [--bom] [--out file]"
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) < 1 || (args[0] != "trades" && args[0] != "stats") {
+		return errors.New(usage)
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	dbPath := fs.String("db", "data.db", "path to SQLite database")
+	account := fs.String("account", "", "export the trades of this account only")
+	fromFlag := fs.String("from", "", "export trades processed at or after this RFC 3339 time")
+	toFlag := fs.String("to", "", "export trades processed before this RFC 3339 time")
+	columns := fs.String("columns", "", "comma separated columns, in order (default all)")
+	tz := fs.String("tz", "UTC", "IANA time zone of the exported times")
+	bom := fs.Bool("bom", false, "start with a UTF-8 byte order mark for Excel")
+	out := fs.String("out", "", "output file (default stdout)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		return fmt.Errorf("invalid --tz: %w", err)
+	}
+	format := export.Format{Location: loc}
+	from, err := parseTime("from", *fromFlag)
+	if err != nil {
+		return err
+	}
+	to, err := parseTime("to", *toFlag)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+*dbPath+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dbManager := dbmanager.Manager{}
+	if err = dbManager.InitDbManager(db); err != nil {
+		return err
+	}
+
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	names := export.ParseColumns(*columns)
+	if args[0] == "stats" {
+		return write(w, export.Stats, names, format, *bom, func(fn func(model.Account) error) error {
+			return dbManager.EachClient(ctx, fn)
+		})
+	}
+	return write(w, export.Trades, names, format, *bom, func(fn func(*model.Trade) error) error {
+		return dbManager.EachTrade(ctx, *account, from, to, fn)
+	})
+}
+
+func write[T any](w io.Writer, table export.Table[T], names []string, format export.Format, bom bool,
+	each func(fn func(T) error) error) error {
+	columns, err := table.Select(names)
+	if err != nil {
+		return err
+	}
+	cw, err := export.NewWriter(w, columns, format, bom)
+	if err != nil {
+		return err
+	}
+	if err = each(cw.Write); err != nil {
+		return err
+	}
+	return cw.Flush()
+}
+
+func parseTime(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", name, err)
+	}
+	return &t, nil
+}
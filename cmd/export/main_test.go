@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/export"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	dbManager := dbmanager.Manager{}
+	if err = dbManager.InitDbManager(conn); err != nil {
+		t.Fatalf("init db manager: %v", err)
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	for _, account := range []string{"123", "456", "123"} {
+		trade := model.Trade{Account: account, Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: "buy"}
+		if err = dbManager.CreateTrade(t.Context(), &trade); err != nil {
+			t.Fatalf("CreateTrade: %v", err)
+		}
+	}
+	// the worker processes the first trade
+	tx, err := dbManager.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	trade, err := dbManager.GetTrade(t.Context(), tx, time.Date(2025, 6, 2, 23, 30, 0, 0, time.UTC))
+	if err != nil || trade == nil {
+		t.Fatalf("GetTrade = %v, %v", trade, err)
+	}
+	if err = dbManager.UpdateAccount(t.Context(), tx, trade.Account, trade.Profit()); err != nil {
+		t.Fatalf("UpdateAccount: %v", err)
+	}
+	if err = dbManager.CommitTx(tx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+		err  bool
+	}{
+		{name: "trades of account", args: []string{"trades", "--account", "123", "--columns", "id,status,processed_at", "--tz", "Asia/Tokyo"},
+			want: "id,status,processed_at\r\n1,processed,2025-06-03T08:30:00.000+09:00\r\n3,pending,\r\n"},
+		{name: "trades processed in range", args: []string{"trades", "--columns", "id,account", "--from", "2025-06-02T00:00:00Z", "--to", "2025-06-03T00:00:00Z"},
+			want: "id,account\r\n1,123\r\n"},
+		{name: "stats", args: []string{"stats"},
+			want: "account,trades,profit\r\n123,1," + export.Format{}.Float(trade.Profit()) + "\r\n"},
+		{name: "unknown column", args: []string{"stats", "--columns", "account,volume"}, err: true},
+		{name: "unknown time zone", args: []string{"trades", "--tz", "Mars/Olympus"}, err: true},
+		{name: "unknown export", args: []string{"clients"}, err: true},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		var out strings.Builder
+		err := run(t.Context(), append(test.args, "--db", path), &out)
+		if (err != nil) != test.err {
+			t.Fatalf("run = %v; want error %v", err, test.err)
+		}
+		if !test.err && out.String() != test.want {
+			t.Errorf("output = %q; want %q", out.String(), test.want)
+		}
+	}
+}
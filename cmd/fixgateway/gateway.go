@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/fix"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/tracing"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User defined tags carrying the opening leg of a fill, which FIX 4.4 has
+// no standard field for.
+const (
+	TagOpenPx   = 7001
+	TagOpenTime = 7002
+)
+
+// ExecTypeTrade is the ExecType of an execution report for a fill; other
+// execution reports are ignored.
+const ExecTypeTrade = "F"
+
+// Values of BusinessRejectReason, TrdRptStatus and TradeReportRejectReason.
+const (
+	businessRejectOther       = "0"
+	businessRejectUnsupported = "3"
+
+	trdRptAccepted = "0"
+	trdRptRejected = "1"
+
+	tradeReportRejectInvalidType = "4"
+	tradeReportRejectOther       = "99"
+)
+
+// tradeStore is the part of *dbmanager.Manager the gateway uses.
+type tradeStore interface {
+	CreateTrade(ctx context.Context, trade *model.Trade) error
+	GetTradingAccount(ctx context.Context, id string) (*model.TradingAccount, error)
+}
+
+// gateway turns the fills received over FIX into queued trades.
+type gateway struct {
+	store tradeStore
+	clock clock.Clock
+	// clockSkew is how far TransactTime and OpenTime may be ahead of the
+	// clock.
+	clockSkew time.Duration
+}
+
+// FromApp handles the application messages of a session. Fills that can not
+// be booked are rejected to the counterparty; an error of the store drops
+// the connection, so the fill comes again after the counterparty
+// reconnects.
+func (g *gateway) FromApp(ctx context.Context, id fix.SessionID, msg *fix.Message) (reply *fix.Message, err error) {
+	ctx = audit.WithActor(ctx, "fix:"+id.TargetCompID)
+	ctx, span := tracing.Tracer().Start(ctx, "fix.receive "+msg.Type(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("fix.session", id.String()),
+			attribute.Int("fix.seq_num", msg.SeqNum()),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	switch msg.Type() {
+	case fix.MsgExecutionReport:
+		return g.executionReport(ctx, id, msg)
+	case fix.MsgTradeCaptureReport:
+		return g.tradeCaptureReport(ctx, id, msg)
+	}
+	slog.WarnContext(ctx, "unsupported FIX message", "fix_session", id.String(), "msg_type", msg.Type())
+	return businessReject(msg, businessRejectUnsupported, "unsupported message type "+msg.Type()), nil
+}
+
+func (g *gateway) executionReport(ctx context.Context, id fix.SessionID, msg *fix.Message) (*fix.Message, error) {
+	if msg.Get(fix.TagExecType) != ExecTypeTrade {
+		return nil, nil
+	}
+	_, reason, err := g.book(ctx, id, msg, msg.Get(fix.TagExecID))
+	if err != nil || reason == "" {
+		return nil, err
+	}
+	return businessReject(msg, businessRejectOther, reason).Set(fix.TagBusinessRejectRefID, msg.Get(fix.TagExecID)), nil
+}
+
+func (g *gateway) tradeCaptureReport(ctx context.Context, id fix.SessionID, msg *fix.Message) (*fix.Message, error) {
+	ack := fix.NewMessage(fix.MsgTradeCaptureReportAck).
+		Set(fix.TagTradeReportID, msg.Get(fix.TagTradeReportID)).
+		Set(fix.TagExecType, ExecTypeTrade).
+		Set(fix.TagSymbol, msg.Get(fix.TagSymbol))
+	if t := msg.Get(fix.TagTradeReportType); t != "" && t != "0" {
+		return ack.Set(fix.TagTrdRptStatus, trdRptRejected).
+			Set(fix.TagTradeReportRejectReason, tradeReportRejectInvalidType).
+			Set(fix.TagText, "only TradeReportType 0 (submit) is supported"), nil
+	}
+	duplicate, reason, err := g.book(ctx, id, msg, msg.Get(fix.TagTradeReportID))
+	switch {
+	case err != nil:
+		return nil, err
+	case reason != "":
+		return ack.Set(fix.TagTrdRptStatus, trdRptRejected).
+			Set(fix.TagTradeReportRejectReason, tradeReportRejectOther).
+			Set(fix.TagText, reason), nil
+	case duplicate:
+		ack.Set(fix.TagText, "duplicate")
+	}
+	return ack.Set(fix.TagTrdRptStatus, trdRptAccepted), nil
+}
+
+// book enqueues the fill in msg, which ref identifies among the fills of the
+// session. A fill that can not be booked is not an error; reason tells the
+// counterparty why. A fill booked before is not booked again.
+func (g *gateway) book(ctx context.Context, id fix.SessionID, msg *fix.Message, ref string) (duplicate bool, reason string, err error) {
+	log := slog.With("fix_session", id.String(), "msg_type", msg.Type(), "ref", ref)
+	now := g.clock.Now()
+	trade, errs := tradeFromMessage(msg)
+	if ref == "" {
+		errs = append(errs, problem.FieldError{Field: "ref", Rule: "required", Message: "ExecID or TradeReportID is required"})
+	}
+	if trade != nil && len(errs) == 0 {
+		errs = validation.Times(trade, now, g.clockSkew)
+	}
+	if len(errs) == 0 {
+		account, err := g.store.GetTradingAccount(ctx, trade.Account)
+		if err != nil {
+			return false, "", err
+		}
+		if account != nil && account.Status != model.AccountStatusActive {
+			errs = append(errs, problem.FieldError{Field: "account", Rule: "account_active",
+				Message: "account " + trade.Account + " is " + account.Status})
+		}
+	}
+	if len(errs) > 0 {
+		var messages []string
+		for _, fe := range errs {
+			messages = append(messages, fe.Message)
+		}
+		reason = strings.Join(messages, "; ")
+		log.InfoContext(ctx, "FIX fill rejected", "reason", reason)
+		return false, reason, nil
+	}
+
+	trade.ImportKey = "fix:" + id.TargetCompID + ":" + ref
+	trade.ReceivedAt = now
+	err = g.store.CreateTrade(ctx, trade)
+	if errors.Is(err, dbmanager.ErrDuplicateTrade) {
+		log.InfoContext(ctx, "FIX fill received again")
+		return true, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("trade.id", trade.Id))
+	log.InfoContext(ctx, "trade enqueued",
+		"trade_id", trade.Id,
+		"account", trade.Account,
+		"symbol", trade.Symbol,
+		"side", trade.Side,
+		"volume", trade.Volume,
+	)
+	return false, "", nil
+}
+
+// tradeFromMessage maps an execution report or trade capture report to a
+// trade. The account and side of a trade capture report are those of its
+// first side; LastQty is in units and becomes a volume in lots.
+func tradeFromMessage(msg *fix.Message) (*model.Trade, []problem.FieldError) {
+	var errs []problem.FieldError
+	number := func(tag int, field string) float64 {
+		v := msg.Get(tag)
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: field, Rule: "number",
+				Message: fmt.Sprintf("tag %d (%s) must be a number", tag, field), Value: v})
+		}
+		return f
+	}
+	timestamp := func(tag int, field string) *time.Time {
+		v, ok := msg.Lookup(tag)
+		if !ok {
+			return nil
+		}
+		t, err := fix.ParseTime(v)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: field, Rule: "datetime",
+				Message: fmt.Sprintf("tag %d (%s) must be a UTCTimestamp", tag, field), Value: v})
+			return nil
+		}
+		return &t
+	}
+
+	trade := &model.Trade{
+		Account:   msg.Get(fix.TagAccount),
+		Symbol:    strings.ReplaceAll(msg.Get(fix.TagSymbol), "/", ""),
+		Volume:    number(fix.TagLastQty, "volume") / model.Lot,
+		Open:      number(TagOpenPx, "open"),
+		Close:     number(fix.TagLastPx, "close"),
+		OpenTime:  timestamp(TagOpenTime, "open_time"),
+		CloseTime: timestamp(fix.TagTransactTime, "close_time"),
+	}
+	switch msg.Get(fix.TagSide) {
+	case "1":
+		trade.Side = "buy"
+	case "2":
+		trade.Side = "sell"
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if err := validation.Struct(trade); err != nil {
+		return nil, problem.FromValidation(err).Errors
+	}
+	return trade, nil
+}
+
+// businessReject rejects the application message msg.
+func businessReject(msg *fix.Message, reason, text string) *fix.Message {
+	return fix.NewMessage(fix.MsgBusinessMessageReject).
+		Set(fix.TagRefSeqNum, msg.Get(fix.TagMsgSeqNum)).
+		Set(fix.TagRefMsgType, msg.Type()).
+		Set(fix.TagBusinessRejectReason, reason).
+		Set(fix.TagText, text)
+}
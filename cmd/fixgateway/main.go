@@ -0,0 +1,158 @@
+// Command fixgateway accepts FIX 4.4 sessions from execution venues and
+// enqueues the fills they report, as ExecutionReport (35=8, ExecType F) or
+// TradeCaptureReport (35=AE) messages, for the worker:
+//
+//	fixgateway --db data.db --listen :9878 --sender-comp-id BROKER --target-comp-ids VENUE1,VENUE2
+//
+// Sequence numbers and the messages sent are stored in the database, so a
+// restarted gateway continues its sessions and answers resend requests.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/fix"
+	"gitlab.com/digineat/go-broker-test/internal/logging"
+	"gitlab.com/digineat/go-broker-test/internal/tracing"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	// Command line flags
+	dbPath := flag.String("db", "data.db", "path to SQLite database")
+	listenAddr := flag.String("listen", ":9878", "FIX listen address")
+	senderCompID := flag.String("sender-comp-id", "BROKER", "our SenderCompID")
+	targetCompIDs := flag.String("target-comp-ids", "", "comma separated SenderCompIDs of the counterparties allowed to log on")
+	clockSkew := flag.Duration("clock-skew", 5*time.Second, "how far TransactTime and OpenTime may be ahead of the gateway clock")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", logging.FormatJSON, "log format: json or text")
+	traceExporter := flag.String("trace-exporter", tracing.ExporterNone, "trace exporter: none, stdout or otlp")
+	traceEndpoint := flag.String("trace-endpoint", "", "OTLP/HTTP collector endpoint (host:port)")
+	traceInsecure := flag.Bool("trace-insecure", false, "disable TLS for the OTLP exporter")
+	traceFile := flag.String("trace-file", "", "file for the stdout trace exporter (default stdout)")
+	traceSample := flag.Float64("trace-sample-ratio", 1, "fraction of traces to sample")
+	flag.Parse()
+
+	logger, err := logging.New(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	targets := splitList(*targetCompIDs)
+	if *senderCompID == "" || len(targets) == 0 {
+		fmt.Fprintln(os.Stderr, "--sender-comp-id and --target-comp-ids are required")
+		os.Exit(2)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: "broker-fixgateway",
+		Exporter:    *traceExporter,
+		Endpoint:    *traceEndpoint,
+		Insecure:    *traceInsecure,
+		File:        *traceFile,
+		SampleRatio: *traceSample,
+	})
+	if err != nil {
+		fatal("can not set up tracing", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	// Initialize database connection
+	db, err := sql.Open("sqlite3", *dbPath)
+	if err != nil {
+		fatal("failed to open database", err)
+	}
+	defer func(db *sql.DB) {
+		if err := db.Close(); err != nil {
+			slog.Error("failed to close database", "error", err)
+		}
+	}(db)
+
+	// Test database connection
+	if err = db.Ping(); err != nil {
+		fatal("failed to ping database", err)
+	}
+
+	dbManager := dbmanager.Manager{}
+	err = dbManager.InitDbManager(db)
+	if err != nil {
+		fatal("can not init DB manager", err)
+	}
+	err = dbManager.CreateTablesIfNeed()
+	if err != nil {
+		fatal("can not create tables", err)
+	}
+
+	acceptor := newAcceptor(&dbManager, clock.System{}, *senderCompID, targets, *clockSkew)
+	l, err := net.Listen("tcp", *listenAddr)
+	if err != nil {
+		fatal("can not listen", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// closed is closed once the sessions have logged out
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		<-ctx.Done()
+		slog.Info("shutting down FIX gateway")
+		if err := acceptor.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Error("failed to close listener", "error", err)
+		}
+	}()
+
+	slog.Info("FIX gateway started", "addr", l.Addr().String(), "sender_comp_id", *senderCompID, "target_comp_ids", targets)
+	if err = acceptor.Serve(l); err != nil {
+		fatal("FIX gateway failed", err)
+	}
+	<-closed
+}
+
+// newAcceptor returns an acceptor for the sessions between sender and each
+// of targets that books fills into dbManager.
+func newAcceptor(dbManager *dbmanager.Manager, c clock.Clock, sender string, targets []string, clockSkew time.Duration) *fix.Acceptor {
+	dbManager.SetClock(c)
+	return &fix.Acceptor{
+		SenderCompID:  sender,
+		TargetCompIDs: targets,
+		Store:         dbManager,
+		App:           &gateway{store: dbManager, clock: c, clockSkew: clockSkew},
+		Clock:         c,
+	}
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// fatal logs err and terminates the process. Only main may call it.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
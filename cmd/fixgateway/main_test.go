@@ -0,0 +1,208 @@
+package main
+
+import (
+	"database/sql"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/fix"
+	"gitlab.com/digineat/go-broker-test/internal/fix/fixtest"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var now = time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+
+// startGateway serves a gateway for the session BROKER-VENUE on a loopback
+// port, backed by the database at dbPath.
+func startGateway(t *testing.T, dbPath string) (*dbmanager.Manager, string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	dbManager := &dbmanager.Manager{}
+	if err = dbManager.InitDbManager(db); err != nil {
+		t.Fatalf("InitDbManager: %v", err)
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+
+	acceptor := newAcceptor(dbManager, clock.NewFake(now), "BROKER", []string{"VENUE"}, 5*time.Second)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- acceptor.Serve(l) }()
+	t.Cleanup(func() {
+		acceptor.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return dbManager, l.Addr().String()
+}
+
+func tradeCaptureReport(id, account, symbol, side, qty, px, openPx string) *fix.Message {
+	return fix.NewMessage(fix.MsgTradeCaptureReport).
+		Set(fix.TagTradeReportID, id).
+		Set(fix.TagTradeReportType, "0").
+		Set(fix.TagSymbol, symbol).
+		Set(fix.TagLastQty, qty).
+		Set(fix.TagLastPx, px).
+		Set(fix.TagTransactTime, "20250602-11:59:00.000").
+		Set(TagOpenPx, openPx).
+		Set(TagOpenTime, "20250602-10:00:00").
+		Add(fix.TagNoSides, "1").
+		Add(fix.TagSide, side).
+		Add(fix.TagAccount, account)
+}
+
+func executionReport(execID, execType, account, side, qty, px, openPx string) *fix.Message {
+	return fix.NewMessage(fix.MsgExecutionReport).
+		Set(fix.TagExecID, execID).
+		Set(fix.TagExecType, execType).
+		Set(fix.TagAccount, account).
+		Set(fix.TagSymbol, "GBP/USD").
+		Set(fix.TagSide, side).
+		Set(fix.TagLastQty, qty).
+		Set(fix.TagLastPx, px).
+		Set(TagOpenPx, openPx)
+}
+
+// roundTrip sends a test request and waits for its heartbeat, so that
+// everything sent before it has been handled.
+func roundTrip(t *testing.T, i *fixtest.Initiator) {
+	t.Helper()
+	i.Send(fix.NewMessage(fix.MsgTestRequest).Set(fix.TagTestReqID, "sync"))
+	if hb := i.Expect(fix.MsgHeartbeat); hb.Get(fix.TagTestReqID) != "sync" {
+		t.Fatalf("received %s; want the heartbeat for the test request", hb)
+	}
+}
+
+func TestGateway_TradeCaptureReports(t *testing.T) {
+	dbManager, addr := startGateway(t, filepath.Join(t.TempDir(), "data.db"))
+	frozen := model.TradingAccount{Id: "FRZ", Name: "FRZ", Currency: "USD", Leverage: 1,
+		Status: model.AccountStatusFrozen, CreatedAt: now, UpdatedAt: now}
+	if err := dbManager.CreateTradingAccount(t.Context(), &frozen); err != nil {
+		t.Fatalf("CreateTradingAccount: %v", err)
+	}
+	i := fixtest.Dial(t, addr, "VENUE", "BROKER")
+	i.Logon(30, false)
+
+	tests := []struct {
+		name   string
+		report *fix.Message
+		status string
+		reason string
+		text   string
+	}{
+		{name: "accepted", report: tradeCaptureReport("R1", "123", "EUR/USD", "1", "100000", "1.105", "1.1"),
+			status: "0"},
+		{name: "received again", report: tradeCaptureReport("R1", "123", "EUR/USD", "1", "100000", "1.105", "1.1"),
+			status: "0", text: "duplicate"},
+		{name: "sell", report: tradeCaptureReport("R2", "123", "EURUSD", "2", "50000", "1.095", "1.1"),
+			status: "0"},
+		{name: "invalid fields", report: tradeCaptureReport("R3", "123", "EURUSD", "5", "x", "1.1", "1.1"),
+			status: "1", reason: "99", text: "tag 32 (volume) must be a number"},
+		{name: "invalid side", report: tradeCaptureReport("R3", "123", "EURUSD", "5", "100000", "1.1", "1.1"),
+			status: "1", reason: "99", text: "side must be one of buy, sell"},
+		{name: "frozen account", report: tradeCaptureReport("R4", "FRZ", "EURUSD", "1", "100000", "1.1", "1.1"),
+			status: "1", reason: "99", text: "account FRZ is frozen"},
+		{name: "cancel", report: tradeCaptureReport("R1", "123", "EURUSD", "1", "100000", "1.1", "1.1").Set(fix.TagTradeReportType, "6"),
+			status: "1", reason: "4", text: "only TradeReportType 0 (submit) is supported"},
+		{name: "in the future", report: tradeCaptureReport("R5", "123", "EURUSD", "1", "100000", "1.1", "1.1").Set(fix.TagTransactTime, "20250602-13:00:00"),
+			status: "1", reason: "99", text: "close_time must not be in the future (server time 2025-06-02T12:00:00Z)"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		i.Send(test.report)
+		ack := i.Expect(fix.MsgTradeCaptureReportAck)
+		if ack.Get(fix.TagTradeReportID) != test.report.Get(fix.TagTradeReportID) || ack.Get(fix.TagTrdRptStatus) != test.status ||
+			ack.Get(fix.TagTradeReportRejectReason) != test.reason || ack.Get(fix.TagText) != test.text {
+			t.Errorf("ack = %s; want status %s, reason %q, text %q", ack, test.status, test.reason, test.text)
+		}
+	}
+
+	if n, err := dbManager.CountPendingTrades(t.Context()); err != nil || n != 2 {
+		t.Errorf("CountPendingTrades = %d, %v; want 2", n, err)
+	}
+	trade, err := dbManager.FindTrade(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("FindTrade: %v", err)
+	}
+	openTime, closeTime := time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC), time.Date(2025, 6, 2, 11, 59, 0, 0, time.UTC)
+	want := model.Trade{Id: 1, Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: "buy",
+		OpenTime: &openTime, CloseTime: &closeTime, ReceivedAt: now, Version: 1}
+	if trade.TraceParent = ""; !reflect.DeepEqual(*trade, want) {
+		t.Errorf("trade = %+v; want %+v", trade, want)
+	}
+	if trade, err = dbManager.FindTrade(t.Context(), 2); err != nil || trade.Side != "sell" || trade.Volume != 0.5 {
+		t.Errorf("second trade = %+v, %v; want sell 0.5", trade, err)
+	}
+
+	entries, err := dbManager.ListAudit(t.Context(), 1, 100)
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	var actors []string
+	for _, e := range entries {
+		if e.Action == audit.ActionTradeSubmit {
+			actors = append(actors, e.Actor)
+		}
+	}
+	if want := []string{"fix:VENUE", "fix:VENUE"}; !reflect.DeepEqual(actors, want) {
+		t.Errorf("actors of trade.submit = %v; want %v", actors, want)
+	}
+	i.Logout()
+}
+
+func TestGateway_ExecutionReports(t *testing.T) {
+	dbManager, addr := startGateway(t, filepath.Join(t.TempDir(), "data.db"))
+	i := fixtest.Dial(t, addr, "VENUE", "BROKER")
+	i.Logon(30, false)
+
+	// a fill, an order acknowledgement, which is ignored, and a fill
+	// received again
+	i.Send(executionReport("E1", "F", "123", "2", "200000", "1.29", "1.3"))
+	i.Send(executionReport("E2", "0", "123", "1", "0", "0", "0"))
+	i.Send(executionReport("E1", "F", "123", "2", "200000", "1.29", "1.3"))
+	roundTrip(t, i)
+
+	i.Send(executionReport("E3", "F", "123", "1", "100000", "1.29", ""))
+	reject := i.Expect(fix.MsgBusinessMessageReject)
+	if reject.Get(fix.TagRefSeqNum) != "6" || reject.Get(fix.TagRefMsgType) != fix.MsgExecutionReport ||
+		reject.Get(fix.TagBusinessRejectReason) != "0" || reject.Get(fix.TagBusinessRejectRefID) != "E3" ||
+		reject.Get(fix.TagText) != "tag 7001 (open) must be a number" {
+		t.Errorf("reject = %s", reject)
+	}
+
+	i.Send(fix.NewMessage("D").Set(fix.TagSymbol, "EURUSD"))
+	if reject = i.Expect(fix.MsgBusinessMessageReject); reject.Get(fix.TagBusinessRejectReason) != "3" {
+		t.Errorf("reject of an unsupported message = %s", reject)
+	}
+
+	if n, err := dbManager.CountPendingTrades(t.Context()); err != nil || n != 1 {
+		t.Errorf("CountPendingTrades = %d, %v; want 1", n, err)
+	}
+	trade, err := dbManager.FindTrade(t.Context(), 1)
+	if err != nil || trade.Symbol != "GBPUSD" || trade.Side != "sell" || trade.Volume != 2 {
+		t.Errorf("trade = %+v, %v", trade, err)
+	}
+	i.Close()
+
+	// the sequence numbers were stored
+	nextSender, nextTarget, err := dbManager.FixSession(t.Context(), "FIX.4.4:BROKER->VENUE")
+	if err != nil || nextSender != 5 || nextTarget != 8 {
+		t.Errorf("FixSession = %d, %d, %v; want 5, 8", nextSender, nextTarget, err)
+	}
+}
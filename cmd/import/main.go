@@ -0,0 +1,124 @@
+// Command import loads historical trades from a CSV file, with the same
+// checks and deduplication as POST /imports:
+//
+//	import --db data.db [--mode enqueue|apply] [--dry-run] [--auto-create-accounts=false] [--map account=Login,symbol=Instrument] file.csv
+//
+// The job is recorded in the database, so its result can also be read with
+// GET /imports/{id}. Invalid rows are printed with their line number; the
+// exit status is 1 when the job fails or any row is invalid.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/importer"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const usage = "usage: import [--db path] [--mode enqueue|apply] [--dry-run] [--auto-create-accounts=false] [--map field=header,...] file.csv"
+
+// errRowsFailed reports an import that completed with invalid rows.
+var errRowsFailed = errors.New("some rows were not imported")
+
+func main() {
+	ctx := audit.WithActor(context.Background(), "import")
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dbPath := fs.String("db", "data.db", "path to SQLite database")
+	mode := fs.String("mode", model.ImportModeEnqueue, "enqueue to queue trades for the worker, apply to book them as processed")
+	dryRun := fs.Bool("dry-run", false, "check and count the rows without storing them")
+	autoCreate := fs.Bool("auto-create-accounts", true, "create unknown accounts on their first row instead of rejecting the row")
+	mapFlag := fs.String("map", "", "comma separated field=header pairs for columns not named like the field")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(usage)
+	}
+	if *mode != model.ImportModeEnqueue && *mode != model.ImportModeApply {
+		return fmt.Errorf("invalid --mode %q, expected enqueue or apply", *mode)
+	}
+	mapping, err := importer.ParseMapping(*mapFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --map: %w", err)
+	}
+
+	path := fs.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	now := time.Now()
+	reader, err := importer.NewReader(f, mapping, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	db, err := sql.Open("sqlite3", *dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dbManager := dbmanager.Manager{}
+	if err = dbManager.InitDbManager(db); err != nil {
+		return err
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		return err
+	}
+
+	job := &model.ImportJob{
+		Status:    model.ImportStatusRunning,
+		Mode:      *mode,
+		DryRun:    *dryRun,
+		Source:    filepath.Base(path),
+		Actor:     audit.Actor(ctx),
+		CreatedAt: now.UTC().Truncate(time.Millisecond),
+	}
+	if err = dbManager.CreateImportJob(ctx, job); err != nil {
+		return err
+	}
+	runErr := importer.Run(ctx, &dbManager, job, reader, *autoCreate, time.Now)
+
+	errs, err := dbManager.ListImportErrors(ctx, job.Id)
+	if err != nil {
+		return err
+	}
+	for _, e := range errs {
+		fmt.Fprintf(stdout, "%s:%d: %s: %s\n", path, e.Line, e.Field, e.Message)
+	}
+	if len(errs) >= importer.MaxErrors {
+		fmt.Fprintf(stdout, "%s: errors after the first %d are not listed\n", path, importer.MaxErrors)
+	}
+	verb := "imported"
+	if job.DryRun {
+		verb = "would import"
+	}
+	fmt.Fprintf(stdout, "import %d: %d rows, %s %d, %d duplicates, %d failed\n",
+		job.Id, job.Rows, verb, job.Imported, job.Duplicates, job.Failed)
+	if runErr != nil {
+		return runErr
+	}
+	if job.Failed > 0 {
+		return errRowsFailed
+	}
+	return nil
+}
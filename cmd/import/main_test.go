@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data.db")
+	file := filepath.Join(dir, "history.csv")
+	csv := "Ticket,Login,symbol,side,volume,open,close,close_time\n" +
+		"T1,123,EURUSD,buy,1,1.1,1.105,2025-06-01T10:00:00Z\n" +
+		"T2,123,EURUSD,buy,1,1.1,1.105,yesterday\n"
+	if err := os.WriteFile(file, []byte(csv), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+		err  error
+	}{
+		{name: "dry run", args: []string{"--dry-run", "--map", "external_id=Ticket,account=Login", file},
+			want: file + ":3: close_time: close_time must be an RFC 3339 time\nimport 1: 2 rows, would import 1, 0 duplicates, 1 failed\n",
+			err:  errRowsFailed},
+		{name: "apply", args: []string{"--mode", "apply", "--map", "external_id=Ticket,account=Login", file},
+			want: file + ":3: close_time: close_time must be an RFC 3339 time\nimport 2: 2 rows, imported 1, 0 duplicates, 1 failed\n",
+			err:  errRowsFailed},
+		{name: "apply again", args: []string{"--mode", "apply", "--map", "external_id=Ticket,account=Login", file},
+			want: file + ":3: close_time: close_time must be an RFC 3339 time\nimport 3: 2 rows, imported 0, 1 duplicates, 1 failed\n",
+			err:  errRowsFailed},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		var out strings.Builder
+		err := run(t.Context(), append([]string{"--db", dbPath}, test.args...), &out)
+		if !errors.Is(err, test.err) {
+			t.Errorf("run error = %v; want %v", err, test.err)
+		}
+		if out.String() != test.want {
+			t.Errorf("output = %q; want %q", out.String(), test.want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{file},
+		{"--mode", "replace", file},
+		{"--map", "login=Login", file},
+		{"--map", "account=Login"},
+	} {
+		t.Log(args)
+		if err := run(t.Context(), append([]string{"--db", dbPath}, args...), &strings.Builder{}); err == nil {
+			t.Errorf("run(%v) succeeded", args)
+		}
+	}
+}
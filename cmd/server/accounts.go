@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type CreateAccountRequest struct {
+	Id       string `json:"id"       validate:"required,alphanum,max=50"`
+	Name     string `json:"name"     validate:"max=100"`
+	Currency string `json:"currency" validate:"omitempty,iso4217"`
+	Group    string `json:"group"    validate:"max=50"`
+	Leverage int    `json:"leverage" validate:"omitempty,min=1,max=1000"`
+}
+
+// UpdateAccountRequest sets the fields to change; fields left out keep their
+// value. Closing an account is final.
+type UpdateAccountRequest struct {
+	Name     *string `json:"name,omitempty"     validate:"omitempty,min=1,max=100"`
+	Currency *string `json:"currency,omitempty" validate:"omitempty,iso4217"`
+	Group    *string `json:"group,omitempty"    validate:"omitempty,max=50"`
+	Leverage *int    `json:"leverage,omitempty" validate:"omitempty,min=1,max=1000"`
+	Status   *string `json:"status,omitempty"   validate:"omitempty,oneof=active frozen closed"`
+}
+
+type AccountsResponse struct {
+	Accounts []model.TradingAccount `json:"accounts"`
+}
+
+func (h *Handlers) HandlePostAccounts(w http.ResponseWriter, r *http.Request) {
+	req := CreateAccountRequest{}
+	if p := problem.Decode(r.Body, &req); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		problem.Write(w, r, problem.FromValidation(err))
+		return
+	}
+	if !auth.FromContext(r.Context()).CanAccess(req.Id) {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "account "+req.Id+" is not allowed")
+		return
+	}
+	if !h.checkGroup(w, r, req.Group) {
+		return
+	}
+
+	account := model.NewTradingAccount(req.Id, h.now())
+	setIfNotZero(&account.Name, req.Name)
+	setIfNotZero(&account.Currency, req.Currency)
+	setIfNotZero(&account.Group, req.Group)
+	setIfNotZero(&account.Leverage, req.Leverage)
+	err := h.dbManager.CreateTradingAccount(r.Context(), account)
+	if errors.Is(err, dbmanager.ErrAccountExists) {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "account "+req.Id+" already exists")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not create account", "account", req.Id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not create account")
+		return
+	}
+	slog.InfoContext(r.Context(), "account created", "account", account.Id, "group", account.Group)
+	writeJSON(w, r, http.StatusCreated, account)
+}
+
+// HandleGetAccounts lists the accessible accounts, optionally only those with
+// the given status.
+func (h *Handlers) HandleGetAccounts(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", model.AccountStatusActive, model.AccountStatusFrozen, model.AccountStatusClosed:
+	default:
+		problem.Write(w, r, problem.Validation(problem.FieldError{
+			Field:   "status",
+			Rule:    "oneof",
+			Message: "status must be one of active, frozen or closed",
+			Value:   status,
+		}))
+		return
+	}
+	accounts, err := h.dbManager.ListTradingAccounts(r.Context(), status)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not list accounts", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not list accounts")
+		return
+	}
+	p := auth.FromContext(r.Context())
+	resp := AccountsResponse{Accounts: []model.TradingAccount{}}
+	for _, a := range accounts {
+		if p.CanAccess(a.Id) {
+			resp.Accounts = append(resp.Accounts, a)
+		}
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+func (h *Handlers) HandleGetAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.findAccount(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, account)
+}
+
+func (h *Handlers) HandlePatchAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.findAccount(w, r)
+	if !ok {
+		return
+	}
+	req := UpdateAccountRequest{}
+	if p := problem.Decode(r.Body, &req); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		problem.Write(w, r, problem.FromValidation(err))
+		return
+	}
+	if req == (UpdateAccountRequest{}) {
+		problem.Write(w, r, problem.Validation(problem.FieldError{
+			Rule:    "required",
+			Message: "at least one field must be changed",
+		}))
+		return
+	}
+	// Moving an account only affects trades processed from now on.
+	if req.Group != nil && !h.checkGroup(w, r, *req.Group) {
+		return
+	}
+
+	setIf(&account.Name, req.Name)
+	setIf(&account.Currency, req.Currency)
+	setIf(&account.Group, req.Group)
+	setIf(&account.Leverage, req.Leverage)
+	setIf(&account.Status, req.Status)
+	h.updateAccount(w, r, account)
+}
+
+// HandleDeleteAccount closes an account. The account and its trades are
+// kept.
+func (h *Handlers) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.findAccount(w, r)
+	if !ok {
+		return
+	}
+	account.Status = model.AccountStatusClosed
+	h.updateAccount(w, r, account)
+}
+
+func (h *Handlers) updateAccount(w http.ResponseWriter, r *http.Request, account *model.TradingAccount) {
+	account.UpdatedAt = h.now().UTC().Truncate(time.Millisecond)
+	err := h.dbManager.UpdateTradingAccount(r.Context(), account)
+	if errors.Is(err, dbmanager.ErrAccountClosed) {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "account "+account.Id+" is closed")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not update account", "account", account.Id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not update account")
+		return
+	}
+	slog.InfoContext(r.Context(), "account updated", "account", account.Id, "status", account.Status)
+	writeJSON(w, r, http.StatusOK, account)
+}
+
+// findAccount loads the account of the {id} path value. It writes the error
+// response and reports false when the account is missing or not accessible.
+func (h *Handlers) findAccount(w http.ResponseWriter, r *http.Request) (*model.TradingAccount, bool) {
+	id := r.PathValue("id")
+	if !auth.FromContext(r.Context()).CanAccess(id) {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "account "+id+" is not allowed")
+		return nil, false
+	}
+	account, err := h.dbManager.GetTradingAccount(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not get account", "account", id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not get account")
+		return nil, false
+	}
+	if account == nil {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "account "+id+" not found")
+		return nil, false
+	}
+	return account, true
+}
+
+// checkTradeAccount reports whether trades may be booked on account, and
+// the rejection if not. A missing account is accepted, and then needs to be
+// created, only when accounts are created on first use; missing reports that
+// case.
+func (h *Handlers) checkTradeAccount(ctx context.Context, account string) (missing bool, p *problem.Problem) {
+	missing, fe, err := validation.Account(ctx, h.dbManager, account, !h.requireAccounts)
+	if err != nil {
+		slog.ErrorContext(ctx, "can not get account", "account", account, "error", err)
+		return false, problem.New(http.StatusInternalServerError, problem.CodeInternal, "can not check account")
+	}
+	if fe != nil {
+		slog.InfoContext(ctx, "trade rejected for account", "account", account, "rule", fe.Rule)
+		return false, problem.Validation(*fe)
+	}
+	return missing, nil
+}
+
+func setIfNotZero[T comparable](dst *T, v T) {
+	var zero T
+	if v != zero {
+		*dst = v
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccounts_Lifecycle(t *testing.T) {
+	doc := loadSpec(t)
+	srv, _ := newAuthServer(t, func(h *Handlers) { h.requireAccounts = true })
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		specPath   string
+		body       string
+		statusCode int
+		status     string
+		rule       string
+	}{
+		{name: "trade for unknown account", method: http.MethodPost, path: "/trades", specPath: "/trades",
+			body: tradeJSON("A1"), statusCode: http.StatusBadRequest, rule: "account_exists"},
+		{name: "create account", method: http.MethodPost, path: "/accounts", specPath: "/accounts",
+			body:       `{"id":"A1","name":"Alice","currency":"EUR","leverage":100}`,
+			statusCode: http.StatusCreated, status: model.AccountStatusActive},
+		{name: "create existing account", method: http.MethodPost, path: "/accounts", specPath: "/accounts",
+			body: `{"id":"A1"}`, statusCode: http.StatusConflict},
+		{name: "create with invalid currency", method: http.MethodPost, path: "/accounts", specPath: "/accounts",
+			body: `{"id":"A2","currency":"EURO"}`, statusCode: http.StatusBadRequest},
+		{name: "create with invalid leverage", method: http.MethodPost, path: "/accounts", specPath: "/accounts",
+			body: `{"id":"A2","leverage":5000}`, statusCode: http.StatusBadRequest},
+		{name: "trade for active account", method: http.MethodPost, path: "/trades", specPath: "/trades",
+			body: tradeJSON("A1"), statusCode: http.StatusOK},
+		{name: "freeze account", method: http.MethodPatch, path: "/accounts/A1", specPath: "/accounts/{id}",
+			body: `{"status":"frozen"}`, statusCode: http.StatusOK, status: model.AccountStatusFrozen},
+		{name: "trade for frozen account", method: http.MethodPost, path: "/trades", specPath: "/trades",
+			body: tradeJSON("A1"), statusCode: http.StatusBadRequest, rule: "account_active"},
+		{name: "change nothing", method: http.MethodPatch, path: "/accounts/A1", specPath: "/accounts/{id}",
+			body: `{}`, statusCode: http.StatusBadRequest},
+		{name: "change to unknown status", method: http.MethodPatch, path: "/accounts/A1", specPath: "/accounts/{id}",
+			body: `{"status":"dormant"}`, statusCode: http.StatusBadRequest},
+		{name: "list frozen accounts", method: http.MethodGet, path: "/accounts?status=frozen", specPath: "/accounts",
+			statusCode: http.StatusOK},
+		{name: "list by unknown status", method: http.MethodGet, path: "/accounts?status=dormant", specPath: "/accounts",
+			statusCode: http.StatusBadRequest},
+		{name: "close account", method: http.MethodDelete, path: "/accounts/A1", specPath: "/accounts/{id}",
+			statusCode: http.StatusOK, status: model.AccountStatusClosed},
+		{name: "trade for closed account", method: http.MethodPost, path: "/trades", specPath: "/trades",
+			body: tradeJSON("A1"), statusCode: http.StatusBadRequest, rule: "account_active"},
+		{name: "reopen closed account", method: http.MethodPatch, path: "/accounts/A1", specPath: "/accounts/{id}",
+			body: `{"status":"active"}`, statusCode: http.StatusConflict},
+		{name: "close twice", method: http.MethodDelete, path: "/accounts/A1", specPath: "/accounts/{id}",
+			statusCode: http.StatusConflict},
+		{name: "get closed account", method: http.MethodGet, path: "/accounts/A1", specPath: "/accounts/{id}",
+			statusCode: http.StatusOK, status: model.AccountStatusClosed},
+		{name: "get unknown account", method: http.MethodGet, path: "/accounts/A9", specPath: "/accounts/{id}",
+			statusCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		res := doRequest(t, test.method, srv.URL+test.path, testAdminKey, test.body)
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if err := doc.ValidateResponse(test.method, test.specPath, res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+			t.Fatalf("response does not match spec: %v", err)
+		}
+		if test.status != "" {
+			var got model.TradingAccount
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("decode account: %v", err)
+			}
+			if got.Id != "A1" || got.Status != test.status {
+				t.Errorf("account = %+v; want A1 %s", got, test.status)
+			}
+		}
+		if test.rule != "" {
+			var p problem.Problem
+			if err := json.Unmarshal(body, &p); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if len(p.Errors) != 1 || p.Errors[0].Field != "account" || p.Errors[0].Rule != test.rule {
+				t.Errorf("errors = %+v; want account %s", p.Errors, test.rule)
+			}
+		}
+	}
+}
+
+func TestAccounts_CreatedOnFirstTrade(t *testing.T) {
+	srv, _ := newAuthServer(t)
+
+	if res := doRequest(t, http.MethodPost, srv.URL+"/trades", testAdminKey, tradeJSON("123")); res.StatusCode != http.StatusOK {
+		t.Fatalf("post trade: status %d", res.StatusCode)
+	}
+	res := doRequest(t, http.MethodGet, srv.URL+"/accounts/123", testAdminKey, "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("get account: status %d", res.StatusCode)
+	}
+	var got model.TradingAccount
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode account: %v", err)
+	}
+	if got.Status != model.AccountStatusActive || got.Currency != model.DefaultCurrency || got.Leverage != model.DefaultLeverage {
+		t.Errorf("account = %+v; want active with defaults", got)
+	}
+
+	// auto-creation does not reopen accounts
+	if res = doRequest(t, http.MethodDelete, srv.URL+"/accounts/123", testAdminKey, ""); res.StatusCode != http.StatusOK {
+		t.Fatalf("close account: status %d", res.StatusCode)
+	}
+	if res = doRequest(t, http.MethodPost, srv.URL+"/trades", testAdminKey, tradeJSON("123")); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("trade for closed account: status %d; want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestAccounts_AuthDisabled(t *testing.T) {
+	dbManager := newMemoryManager(t)
+	hs := Handlers{dbManager: dbManager, requireAccounts: true}
+	mux := http.NewServeMux()
+	hs.Register(mux, &auth.Guard{})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		statusCode int
+	}{
+		{name: "trade for unknown account", method: http.MethodPost, path: "/trades", body: tradeJSON("A1"), statusCode: http.StatusBadRequest},
+		{name: "create account", method: http.MethodPost, path: "/accounts", body: `{"id":"A1"}`, statusCode: http.StatusCreated},
+		{name: "trade for created account", method: http.MethodPost, path: "/trades", body: tradeJSON("A1"), statusCode: http.StatusOK},
+		{name: "create group", method: http.MethodPost, path: "/groups", body: `{"id":"G1","name":"Gold"}`, statusCode: http.StatusCreated},
+		{name: "issue key", method: http.MethodPost, path: "/admin/keys", body: `{"name":"x","scopes":["stats:read"]}`, statusCode: http.StatusCreated},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if res := doRequest(t, test.method, srv.URL+test.path, "", test.body); res.StatusCode != test.statusCode {
+			t.Errorf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type CreateApiKeyRequest struct {
+	Name     string   `json:"name"     validate:"required,max=100"`
+	Scopes   []string `json:"scopes"   validate:"required,min=1,dive,required"`
+	Accounts []string `json:"accounts" validate:"dive,required,alphanum"`
+}
+
+type CreateApiKeyResponse struct {
+	model.ApiKey
+	// Key is the plain text token. It is returned only once.
+	Key string `json:"key"`
+}
+
+func (h *Handlers) HandlePostApiKeys(w http.ResponseWriter, r *http.Request) {
+	req := CreateApiKeyRequest{}
+	if p := problem.Decode(r.Body, &req); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		problem.Write(w, r, problem.FromValidation(err))
+		return
+	}
+	var errs []problem.FieldError
+	for i, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			errs = append(errs, problem.FieldError{
+				Field:   fmt.Sprintf("scopes[%d]", i),
+				Rule:    "scope",
+				Message: "unknown scope " + scope,
+				Value:   scope,
+			})
+		}
+	}
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs...))
+		return
+	}
+
+	id, token, hash, err := auth.GenerateApiKey()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not generate api key", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not create api key")
+		return
+	}
+	key := model.ApiKey{
+		Id:        id,
+		Name:      req.Name,
+		Hash:      hash,
+		Scopes:    req.Scopes,
+		Accounts:  req.Accounts,
+		CreatedAt: h.now().UTC().Truncate(time.Second),
+	}
+	if err = h.dbManager.CreateApiKey(r.Context(), &key); err != nil {
+		slog.ErrorContext(r.Context(), "can not store api key", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not create api key")
+		return
+	}
+	slog.InfoContext(r.Context(), "api key issued",
+		"key_id", key.Id, "scopes", key.Scopes, "by", audit.Actor(r.Context()))
+
+	writeJSON(w, r, http.StatusCreated, CreateApiKeyResponse{ApiKey: key, Key: token})
+}
+
+func (h *Handlers) HandleGetApiKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.dbManager.ListApiKeys(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not list api keys", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not list api keys")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, keys)
+}
+
+func (h *Handlers) HandleDeleteApiKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	revoked, err := h.dbManager.RevokeApiKey(r.Context(), id, h.now())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not revoke api key", "key_id", id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not revoke api key")
+		return
+	}
+	if !revoked {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "api key "+id+" not found")
+		return
+	}
+	slog.InfoContext(r.Context(), "api key revoked", "key_id", id, "by", audit.Actor(r.Context()))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// bootstrapAdminKey registers token as an admin key unless a key with the same
+// id already exists, so a fresh deployment can issue its first keys.
+func bootstrapAdminKey(ctx context.Context, dbManager *dbmanager.Manager, token string) error {
+	id, secret, err := auth.ParseApiKey(token)
+	if err != nil {
+		return err
+	}
+	existing, err := dbManager.GetApiKey(ctx, id)
+	if err != nil || existing != nil {
+		return err
+	}
+	return dbManager.CreateApiKey(audit.WithActor(ctx, "bootstrap"), &model.ApiKey{
+		Id:        id,
+		Name:      "bootstrap",
+		Hash:      auth.HashSecret(secret),
+		Scopes:    []string{auth.ScopeAdmin},
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not marshal response", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not encode response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(resp); err != nil {
+		slog.ErrorContext(r.Context(), "can not write response", "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testAdminKey = "0123456789abcdef.bootstrap-secret"
+
+// newAuthServer starts a server with API key authentication and the
+// bootstrap admin key; opts adjust its handlers.
+func newAuthServer(t *testing.T, opts ...func(*Handlers)) (*httptest.Server, *dbmanager.Manager) {
+	dbManager := newMemoryManager(t)
+	if err := bootstrapAdminKey(t.Context(), dbManager, testAdminKey); err != nil {
+		t.Fatalf("bootstrap admin key: %v", err)
+	}
+	limiter, err := ratelimit.New(ratelimit.Config{})
+	if err != nil {
+		t.Fatalf("new limiter: %v", err)
+	}
+	hs := Handlers{
+		dbManager:  dbManager,
+		limiter:    limiter,
+		queueDepth: ratelimit.NewDepthGauge(dbManager.CountPendingTrades, 0),
+	}
+	for _, opt := range opts {
+		opt(&hs)
+	}
+	mux := http.NewServeMux()
+	hs.Register(mux, &auth.Guard{Authn: &auth.ApiKeyAuthenticator{Store: dbManager}})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, dbManager
+}
+
+func doRequest(t *testing.T, method, url, key, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if key != "" {
+		req.Header.Set(auth.ApiKeyHeader, key)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestApiKeys_Lifecycle(t *testing.T) {
+	srv, _ := newAuthServer(t)
+
+	res := doRequest(t, http.MethodPost, srv.URL+"/admin/keys", testAdminKey,
+		`{"name":"algo-1","scopes":["trade:write","stats:read"],"accounts":["123"]}`)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("issue key: status = %d; want %d", res.StatusCode, http.StatusCreated)
+	}
+	var issued CreateApiKeyResponse
+	if err := json.NewDecoder(res.Body).Decode(&issued); err != nil {
+		t.Fatalf("decode issued key: %v", err)
+	}
+
+	trade := func(account string) string {
+		return `{"account":"` + account + `","symbol":"EURUSD","volume":1.0,"open":1.1000,"close":1.1050,"side":"buy"}`
+	}
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		key        string
+		body       string
+		statusCode int
+	}{
+		{name: "healthz without key", method: http.MethodGet, path: "/healthz", statusCode: http.StatusOK},
+		{name: "trade without key", method: http.MethodPost, path: "/trades", body: trade("123"), statusCode: http.StatusUnauthorized},
+		{name: "trade with bad key", method: http.MethodPost, path: "/trades", key: issued.Id + ".nope", body: trade("123"), statusCode: http.StatusUnauthorized},
+		{name: "trade for own account", method: http.MethodPost, path: "/trades", key: issued.Key, body: trade("123"), statusCode: http.StatusOK},
+		{name: "trade for foreign account", method: http.MethodPost, path: "/trades", key: issued.Key, body: trade("456"), statusCode: http.StatusForbidden},
+		{name: "stats for foreign account", method: http.MethodGet, path: "/stats/456", key: issued.Key, statusCode: http.StatusForbidden},
+		{name: "admin route without admin scope", method: http.MethodGet, path: "/admin/keys", key: issued.Key, statusCode: http.StatusForbidden},
+		{name: "unknown scope", method: http.MethodPost, path: "/admin/keys", key: testAdminKey, body: `{"name":"x","scopes":["root"]}`, statusCode: http.StatusBadRequest},
+		{name: "revoke", method: http.MethodDelete, path: "/admin/keys/" + issued.Id, key: testAdminKey, statusCode: http.StatusNoContent},
+		{name: "revoke twice", method: http.MethodDelete, path: "/admin/keys/" + issued.Id, key: testAdminKey, statusCode: http.StatusNotFound},
+		{name: "trade with revoked key", method: http.MethodPost, path: "/trades", key: issued.Key, body: trade("123"), statusCode: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		res := doRequest(t, test.method, srv.URL+test.path, test.key, test.body)
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+	}
+
+	res = doRequest(t, http.MethodGet, srv.URL+"/admin/keys", testAdminKey, "")
+	var keys []map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&keys); err != nil {
+		t.Fatalf("decode keys: %v", err)
+	}
+	if len(keys) != 2 || keys[1]["revoked_at"] == nil {
+		t.Errorf("unexpected key list %v", keys)
+	}
+	for _, key := range keys {
+		if _, ok := key["hash"]; ok {
+			t.Errorf("key hash leaked in listing: %v", key)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// maxAuditPage caps the entries returned by one export request.
+const maxAuditPage = 1000
+
+type AuditExportResponse struct {
+	Entries []audit.Entry `json:"entries"`
+	// Next is the from of the following page; it is omitted on the last page.
+	Next int64 `json:"next,omitempty"`
+}
+
+// HandleGetAudit exports the audit log from sequence number "from" (default
+// 1), at most "limit" entries at a time.
+func (h *Handlers) HandleGetAudit(w http.ResponseWriter, r *http.Request) {
+	from, limit := int64(1), maxAuditPage
+	var errs []problem.FieldError
+	q := r.URL.Query()
+	if s := q.Get("from"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 1 {
+			errs = append(errs, problem.FieldError{Field: "from", Rule: "min", Message: "from must be an integer of at least 1", Value: s})
+		}
+		from = n
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxAuditPage {
+			errs = append(errs, problem.FieldError{Field: "limit", Rule: "range",
+				Message: "limit must be an integer from 1 to " + strconv.Itoa(maxAuditPage), Value: s})
+		}
+		limit = n
+	}
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs...))
+		return
+	}
+
+	// One extra entry tells whether there is another page.
+	entries, err := h.dbManager.ListAudit(r.Context(), from, limit+1)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not read audit log", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not read audit log")
+		return
+	}
+	resp := AuditExportResponse{Entries: entries}
+	if len(entries) > limit {
+		resp.Entries, resp.Next = entries[:limit], entries[limit].Seq
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestOpenAPI_AuditActions(t *testing.T) {
+	doc := loadSpec(t)
+	var actions []string
+	for _, action := range doc.Components.Schemas["AuditEntry"].Properties["action"].Enum {
+		actions = append(actions, action.(string))
+	}
+	want := slices.Clone(audit.Actions)
+	sort.Strings(actions)
+	sort.Strings(want)
+	if !slices.Equal(actions, want) {
+		t.Errorf("documented audit actions %v; want %v", actions, want)
+	}
+}
+
+func TestAudit_ExportPages(t *testing.T) {
+	srv, _ := newAuthServer(t)
+
+	// bootstrap key, then one entry per trade
+	for range 3 {
+		if res := doRequest(t, http.MethodPost, srv.URL+"/trades", testAdminKey, tradeJSON("123")); res.StatusCode != http.StatusOK {
+			t.Fatalf("post trade: status %d", res.StatusCode)
+		}
+	}
+	if res := doRequest(t, http.MethodPut, srv.URL+"/admin/limits", testAdminKey, `{"max_pending":100}`); res.StatusCode != http.StatusOK {
+		t.Fatalf("put limits: status %d", res.StatusCode)
+	}
+
+	var entries []audit.Entry
+	path := "/admin/audit?limit=2"
+	for {
+		res := doRequest(t, http.MethodGet, srv.URL+path, testAdminKey, "")
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, res.StatusCode)
+		}
+		var page AuditExportResponse
+		if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+			t.Fatalf("decode page: %v", err)
+		}
+		entries = append(entries, page.Entries...)
+		if page.Next == 0 {
+			break
+		}
+		path = "/admin/audit?limit=2&from=" + strconv.FormatInt(page.Next, 10)
+	}
+
+	want := []string{audit.ActionApiKeyCreate, audit.ActionAccountCreate, audit.ActionTradeSubmit, audit.ActionTradeSubmit, audit.ActionTradeSubmit, audit.ActionLimitsUpdate}
+	var actions []string
+	v := audit.NewVerifier()
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+		if err := v.Check(e); err != nil {
+			t.Errorf("exported entry: %v", err)
+		}
+	}
+	if !slices.Equal(actions, want) {
+		t.Errorf("actions = %v; want %v", actions, want)
+	}
+	if entries[0].Actor != "bootstrap" || entries[1].Actor != "key:0123456789abcdef" {
+		t.Errorf("actors = %q, %q", entries[0].Actor, entries[1].Actor)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"gitlab.com/digineat/go-broker-test/internal/calendar"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type MarketResponse struct {
+	Name     string            `json:"name"`
+	Timezone string            `json:"timezone"`
+	Rollover string            `json:"rollover,omitempty"`
+	Sessions []SessionResponse `json:"sessions"`
+	Holidays []HolidayResponse `json:"holidays"`
+}
+
+type SessionResponse struct {
+	Days  []string `json:"days"`
+	Open  string   `json:"open"`
+	Close string   `json:"close"`
+}
+
+type HolidayResponse struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+type MarketStatusResponse struct {
+	Symbol       string     `json:"symbol"`
+	Market       string     `json:"market"`
+	At           time.Time  `json:"at"`
+	Open         bool       `json:"open"`
+	Holiday      string     `json:"holiday,omitempty"`
+	NextOpen     *time.Time `json:"next_open,omitempty"`
+	NextClose    *time.Time `json:"next_close,omitempty"`
+	NextRollover *time.Time `json:"next_rollover,omitempty"`
+}
+
+func (h *Handlers) HandleGetCalendar(w http.ResponseWriter, r *http.Request) {
+	if h.calendar == nil {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeCalendarOff, "no trading calendar configured")
+		return
+	}
+	markets := []MarketResponse{}
+	for _, m := range h.calendar.Markets() {
+		markets = append(markets, marketResponse(m))
+	}
+	writeJSON(w, r, http.StatusOK, markets)
+}
+
+// HandleGetMarketStatus answers whether a symbol is tradable now or at the
+// time given by the "at" query parameter (RFC 3339).
+func (h *Handlers) HandleGetMarketStatus(w http.ResponseWriter, r *http.Request) {
+	if h.calendar == nil {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeCalendarOff, "no trading calendar configured")
+		return
+	}
+	symbol := r.PathValue("symbol")
+	if !validation.SymbolPattern.MatchString(symbol) {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidPath, "symbol must match "+validation.SymbolPattern.String())
+		return
+	}
+	at := h.now()
+	if s := r.URL.Query().Get("at"); s != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			problem.Write(w, r, problem.Validation(problem.FieldError{
+				Field:   "at",
+				Rule:    "datetime",
+				Message: "at must be an RFC 3339 date-time",
+				Value:   s,
+			}))
+			return
+		}
+	}
+
+	m, err := h.calendar.Market(symbol)
+	if err != nil {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "symbol "+symbol+" is not traded on any market")
+		return
+	}
+	status := m.Status(at)
+	resp := MarketStatusResponse{
+		Symbol:       symbol,
+		Market:       status.Market,
+		At:           at.In(m.Location),
+		Open:         status.Open,
+		Holiday:      status.Holiday,
+		NextOpen:     localTime(status.NextOpen, m.Location),
+		NextClose:    localTime(status.NextClose, m.Location),
+		NextRollover: localTime(status.NextRollover, m.Location),
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// localTime returns t in loc, or nil for the zero time.
+func localTime(t time.Time, loc *time.Location) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.In(loc)
+	return &t
+}
+
+func marketResponse(m *calendar.Market) MarketResponse {
+	resp := MarketResponse{Name: m.Name, Timezone: m.Location.String(), Sessions: []SessionResponse{}, Holidays: []HolidayResponse{}}
+	if m.HasRollover {
+		resp.Rollover = calendar.FormatClock(m.Rollover)
+	}
+	for _, s := range m.Sessions {
+		sr := SessionResponse{Open: calendar.FormatClock(s.Open), Close: calendar.FormatClock(s.Close)}
+		for _, d := range s.Days {
+			sr.Days = append(sr.Days, calendar.FormatWeekday(d))
+		}
+		resp.Sessions = append(resp.Sessions, sr)
+	}
+	for date, name := range m.Holidays {
+		resp.Holidays = append(resp.Holidays, HolidayResponse{Date: date, Name: name})
+	}
+	sort.Slice(resp.Holidays, func(i, j int) bool { return resp.Holidays[i].Date < resp.Holidays[j].Date })
+	return resp
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"gitlab.com/digineat/go-broker-test/internal/calendar"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testCalendar = `{
+  "default": "fx",
+  "markets": {
+    "fx": {
+      "timezone": "America/New_York",
+      "rollover": "17:00",
+      "sessions": [
+        {"days": ["sun"], "open": "17:00", "close": "24:00"},
+        {"days": ["mon", "tue", "wed", "thu"], "open": "00:00", "close": "24:00"},
+        {"days": ["fri"], "open": "00:00", "close": "17:00"}
+      ],
+      "holidays": [{"date": "2024-12-25", "name": "Christmas Day"}]
+    }
+  }
+}`
+
+func TestCalendar_Endpoints(t *testing.T) {
+	doc := loadSpec(t)
+	cal, err := calendar.Parse([]byte(testCalendar))
+	if err != nil {
+		t.Fatalf("parse calendar: %v", err)
+	}
+	mux := http.NewServeMux()
+	(&Handlers{calendar: cal}).Register(mux, nil)
+	disabled := http.NewServeMux()
+	(&Handlers{}).Register(disabled, nil)
+
+	tests := []struct {
+		name       string
+		mux        *http.ServeMux
+		path       string
+		specPath   string
+		statusCode int
+		want       map[string]any
+	}{
+		{name: "markets", mux: mux, path: "/calendar", statusCode: http.StatusOK},
+		{name: "open", mux: mux, path: "/calendar/EURUSD?at=2024-03-06T12:00:00Z", specPath: "/calendar/{symbol}", statusCode: http.StatusOK,
+			want: map[string]any{
+				"symbol": "EURUSD", "market": "fx", "open": true,
+				"at":            "2024-03-06T07:00:00-05:00",
+				"next_close":    "2024-03-08T17:00:00-05:00",
+				"next_open":     "2024-03-10T17:00:00-04:00",
+				"next_rollover": "2024-03-06T17:00:00-05:00",
+			}},
+		{name: "holiday", mux: mux, path: "/calendar/EURUSD?at=2024-12-25T17:00:00Z", specPath: "/calendar/{symbol}", statusCode: http.StatusOK,
+			want: map[string]any{
+				"symbol": "EURUSD", "market": "fx", "open": false, "holiday": "Christmas Day",
+				"at":            "2024-12-25T12:00:00-05:00",
+				"next_open":     "2024-12-26T00:00:00-05:00",
+				"next_close":    "2024-12-27T17:00:00-05:00",
+				"next_rollover": "2024-12-26T17:00:00-05:00",
+			}},
+		{name: "invalid time", mux: mux, path: "/calendar/EURUSD?at=tomorrow", specPath: "/calendar/{symbol}", statusCode: http.StatusBadRequest},
+		{name: "invalid symbol", mux: mux, path: "/calendar/eur", specPath: "/calendar/{symbol}", statusCode: http.StatusBadRequest},
+		{name: "disabled", mux: disabled, path: "/calendar", statusCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		rec := httptest.NewRecorder()
+		test.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+		res := rec.Result()
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		body, _ := io.ReadAll(res.Body)
+		specPath := test.specPath
+		if specPath == "" {
+			specPath = test.path
+		}
+		if err = doc.ValidateResponse(http.MethodGet, specPath, res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+			t.Fatalf("response does not match spec: %v", err)
+		}
+		if test.want == nil {
+			continue
+		}
+		var got map[string]any
+		if err = json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		for k, v := range test.want {
+			if got[k] != v {
+				t.Errorf("%s = %v; want %v", k, got[k], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/pkg/client"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestClient_Trades runs the client SDK against the real handlers.
+func TestClient_Trades(t *testing.T) {
+	srv, dbManager := newAuthServer(t)
+	ctx := t.Context()
+	admin := client.New(srv.URL)
+	admin.ApiKey = testAdminKey
+
+	if err := admin.Health(ctx); err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	key, err := admin.CreateApiKey(ctx, client.CreateApiKeyRequest{Name: "desk",
+		Scopes: []string{client.ScopeTradeWrite, client.ScopeTradeAmend, client.ScopeStatsRead}, Accounts: []string{"123"}})
+	if err != nil {
+		t.Fatalf("CreateApiKey: %v", err)
+	}
+	trader := client.New(srv.URL)
+	trader.ApiKey = key.Key
+
+	// the same idempotency key enqueues once per caller
+	trade := client.SubmitTradeRequest{Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105,
+		Side: client.SideBuy, IdempotencyKey: "order-1"}
+	for _, c := range []*client.Client{trader, trader, admin} {
+		if _, err = c.SubmitTrade(ctx, trade); err != nil {
+			t.Fatalf("SubmitTrade: %v", err)
+		}
+	}
+	if n, err := dbManager.CountPendingTrades(ctx); err != nil || n != 2 {
+		t.Fatalf("CountPendingTrades = %d, %v; want 2", n, err)
+	}
+
+	trade.Account = "456"
+	if _, err = trader.SubmitTrade(ctx, trade); !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("trade for other account: err = %v; want ErrForbidden", err)
+	}
+	_, err = trader.SubmitTrade(ctx, client.SubmitTradeRequest{Account: "123", Symbol: "EUR", Volume: 1, Open: 1.1, Close: 1.1, Side: "hold"})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrInvalidRequest) || len(apiErr.Errors) != 2 ||
+		apiErr.Errors[0].Field != "symbol" || apiErr.Errors[1].Field != "side" {
+		t.Errorf("invalid trade: err = %#v; want field errors for symbol and side", err)
+	}
+
+	got, err := trader.GetTrade(ctx, 1)
+	if err != nil || got.Account != "123" || got.Status != client.TradeStatusPending || got.Version != 1 || got.ReceivedAt == nil {
+		t.Fatalf("GetTrade = %+v, %v", got, err)
+	}
+	closePrice := 1.106
+	if got, err = trader.AmendTrade(ctx, 1, client.AmendTradeRequest{Close: &closePrice, Reason: "mistyped close"}); err != nil ||
+		got.Version != 2 || got.Close != closePrice {
+		t.Fatalf("AmendTrade = %+v, %v", got, err)
+	}
+	if got, err = trader.CancelTrade(ctx, 2, "duplicate"); err != nil || got.Status != client.TradeStatusCancelled {
+		t.Fatalf("CancelTrade = %+v, %v", got, err)
+	}
+	if _, err = trader.CancelTrade(ctx, 2, "duplicate"); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("cancel twice: err = %v; want ErrConflict", err)
+	}
+	if _, err = trader.GetTrade(ctx, 99); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("unknown trade: err = %v; want ErrNotFound", err)
+	}
+
+	if _, err = trader.GetStats(ctx, "123"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("stats before processing: err = %v; want ErrNotFound", err)
+	}
+	tx, err := dbManager.CreateTx(ctx)
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	if err = dbManager.UpdateAccount(ctx, tx, "123", 500); err != nil {
+		t.Fatalf("UpdateAccount: %v", err)
+	}
+	if err = dbManager.CommitTx(tx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	stats, err := trader.GetStats(ctx, "123")
+	if err != nil || stats.Trades != 1 || math.Abs(stats.Profit-500) > 0.01 {
+		t.Errorf("GetStats = %+v, %v; want 1 trade with profit 500", stats, err)
+	}
+	body, err := trader.StatsCSV(ctx, client.ExportOptions{Columns: []string{"account", "trades"}})
+	if err != nil {
+		t.Fatalf("StatsCSV: %v", err)
+	}
+	csv, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(csv) != "account,trades\r\n123,1\r\n" {
+		t.Errorf("StatsCSV = %q, %v", csv, err)
+	}
+	if _, err = trader.TradesCSV(ctx, "123", client.ExportOptions{TimeZone: "Mars/Olympus"}); !errors.Is(err, client.ErrInvalidRequest) {
+		t.Errorf("TradesCSV with invalid tz: err = %v; want ErrInvalidRequest", err)
+	}
+
+	if err = admin.RevokeApiKey(ctx, key.Id); err != nil {
+		t.Fatalf("RevokeApiKey: %v", err)
+	}
+	if _, err = trader.GetStats(ctx, "123"); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("revoked key: err = %v; want ErrUnauthorized", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/trades", strings.NewReader(tradeJSON("123")))
+	req.Header.Set(client.ApiKeyHeader, testAdminKey)
+	req.Header.Set(IdempotencyKeyHeader, strings.Repeat("k", 129))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /trades: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("too long idempotency key: status %d; want 400", res.StatusCode)
+	}
+}
+
+// TestClient_Admin runs the admin methods of the client SDK against the real
+// handlers.
+func TestClient_Admin(t *testing.T) {
+	srv, _ := newAuthServer(t)
+	ctx := t.Context()
+	c := client.New(srv.URL)
+	c.ApiKey = testAdminKey
+
+	if _, err := c.CreateGroup(ctx, client.CreateGroupRequest{Id: "master"}); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	if _, err := c.CreateGroup(ctx, client.CreateGroupRequest{Id: "ib1", Parent: "master"}); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	if groups, err := c.ListGroups(ctx); err != nil || len(groups) != 2 {
+		t.Errorf("ListGroups = %+v, %v", groups, err)
+	}
+	rates, err := c.SetRebateRates(ctx, "ib1", []client.RebateRate{{Symbol: "*", PerLot: 2}})
+	if err != nil || len(rates) != 1 {
+		t.Errorf("SetRebateRates = %+v, %v", rates, err)
+	}
+	if rates, err = c.GetRebateRates(ctx, "ib1"); err != nil || len(rates) != 1 || rates[0].PerLot != 2 {
+		t.Errorf("GetRebateRates = %+v, %v", rates, err)
+	}
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	if payouts, err := c.GetRebatePayouts(ctx, from, from.AddDate(0, 1, 0)); err != nil || !payouts.From.Equal(from) {
+		t.Errorf("GetRebatePayouts = %+v, %v", payouts, err)
+	}
+
+	account, err := c.CreateAccount(ctx, client.CreateAccountRequest{Id: "789", Group: "ib1"})
+	if err != nil || account.Status != client.AccountStatusActive || account.Currency == "" {
+		t.Fatalf("CreateAccount = %+v, %v", account, err)
+	}
+	frozen := client.AccountStatusFrozen
+	if account, err = c.UpdateAccount(ctx, "789", client.UpdateAccountRequest{Status: &frozen}); err != nil || account.Status != frozen {
+		t.Errorf("UpdateAccount = %+v, %v", account, err)
+	}
+	if accounts, err := c.ListAccounts(ctx, frozen); err != nil || len(accounts) != 1 || accounts[0].Id != "789" {
+		t.Errorf("ListAccounts = %+v, %v", accounts, err)
+	}
+	if account, err = c.CloseAccount(ctx, "789"); err != nil || account.Status != client.AccountStatusClosed {
+		t.Errorf("CloseAccount = %+v, %v", account, err)
+	}
+	if account, err = c.GetAccount(ctx, "789"); err != nil || account.Status != client.AccountStatusClosed {
+		t.Errorf("GetAccount = %+v, %v", account, err)
+	}
+	if stats, err := c.GetGroupStats(ctx, "master", &from, nil); err != nil || stats.Group != "master" || stats.From == nil {
+		t.Errorf("GetGroupStats = %+v, %v", stats, err)
+	}
+
+	limits, err := c.SetLimits(ctx, client.Limits{Account: client.Limit{Rate: 10, Burst: 20}, MaxPending: 100})
+	if err != nil || limits.Account.Burst != 20 {
+		t.Errorf("SetLimits = %+v, %v", limits, err)
+	}
+	if limits, err = c.GetLimits(ctx); err != nil || limits.MaxPending != 100 {
+		t.Errorf("GetLimits = %+v, %v", limits, err)
+	}
+
+	job, err := c.StartImport(ctx, strings.NewReader("Ticket,Login,symbol,side,volume,open,close\nT1,123,EURUSD,buy,1,1.1,1.105\n"),
+		client.ImportOptions{Mapping: map[string]string{"external_id": "Ticket", "account": "Login"}, Source: "desk.csv"})
+	if err != nil {
+		t.Fatalf("StartImport: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); job.Status == model.ImportStatusRunning; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("import still running: %+v", job)
+		}
+		if job, err = c.GetImport(ctx, job.Id); err != nil {
+			t.Fatalf("GetImport: %v", err)
+		}
+	}
+	if job.Status != model.ImportStatusCompleted || job.Imported != 1 || job.Source != "desk.csv" {
+		t.Errorf("import = %+v", job)
+	}
+
+	keys, err := c.ListApiKeys(ctx)
+	if err != nil || len(keys) != 1 || keys[0].Name != "bootstrap" {
+		t.Errorf("ListApiKeys = %+v, %v", keys, err)
+	}
+	page, err := c.GetAudit(ctx, 1, 3)
+	if err != nil || len(page.Entries) != 3 || page.Next != 4 {
+		t.Errorf("GetAudit = %+v, %v", page, err)
+	}
+	if _, err = c.GetCalendar(ctx); !errors.Is(err, client.ErrDisabled) {
+		t.Errorf("GetCalendar: err = %v; want ErrDisabled", err)
+	}
+	if _, err = c.GetMarketStatus(ctx, "EURUSD", time.Time{}); !errors.Is(err, client.ErrDisabled) {
+		t.Errorf("GetMarketStatus: err = %v; want ErrDisabled", err)
+	}
+	if doc, err := c.GetOpenAPI(ctx); err != nil || !strings.Contains(string(doc), `"openapi"`) {
+		t.Errorf("GetOpenAPI: %v", err)
+	}
+}
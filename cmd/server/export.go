@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	"gitlab.com/digineat/go-broker-test/internal/export"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// exportParams are the query parameters of the CSV exports.
+type exportParams struct {
+	columns  []string
+	format   export.Format
+	bom      bool
+	from, to *time.Time
+}
+
+// parseExportParams reads columns, tz and bom, and from and to when
+// withRange is set.
+func parseExportParams(q url.Values, withRange bool) (exportParams, []problem.FieldError) {
+	var params exportParams
+	var errs []problem.FieldError
+	params.columns = export.ParseColumns(q.Get("columns"))
+	if tz := q.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: "tz", Rule: "timezone", Message: "tz must be an IANA time zone such as Europe/London", Value: tz})
+		}
+		params.format.Location = loc
+	}
+	if s := q.Get("bom"); s != "" {
+		bom, err := strconv.ParseBool(s)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: "bom", Rule: "boolean", Message: "bom must be true or false", Value: s})
+		}
+		params.bom = bom
+	}
+	if withRange {
+		var fe *problem.FieldError
+		if params.from, fe = parseTimeParam("from", q.Get("from")); fe != nil {
+			errs = append(errs, *fe)
+		}
+		if params.to, fe = parseTimeParam("to", q.Get("to")); fe != nil {
+			errs = append(errs, *fe)
+		}
+		if params.from != nil && params.to != nil && !params.to.After(*params.from) {
+			errs = append(errs, problem.FieldError{Field: "to", Rule: "after_from", Message: "to must be after from", Value: q.Get("to")})
+		}
+	}
+	return params, errs
+}
+
+// selectColumns returns the requested columns of table, or writes the error
+// response and reports false.
+func selectColumns[T any](w http.ResponseWriter, r *http.Request, table export.Table[T], names []string) ([]export.Column[T], bool) {
+	columns, err := table.Select(names)
+	if errors.Is(err, export.ErrUnknownColumn) {
+		problem.Write(w, r, problem.Validation(problem.FieldError{
+			Field:   "columns",
+			Rule:    "column",
+			Message: err.Error(),
+			Value:   r.URL.Query().Get("columns"),
+		}))
+		return nil, false
+	}
+	return columns, true
+}
+
+// streamCSV writes the rows produced by each as a CSV attachment. Once the
+// header is sent the status can no longer change, so a failure aborts the
+// response and the client sees a truncated download rather than a short
+// file.
+func streamCSV[T any](w http.ResponseWriter, r *http.Request, filename string, columns []export.Column[T],
+	params exportParams, each func(fn func(T) error) error) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	cw, err := export.NewWriter(w, columns, params.format, params.bom)
+	if err == nil {
+		rows := 0
+		err = each(func(row T) error {
+			rows++
+			return cw.Write(row)
+		})
+		if err == nil {
+			err = cw.Flush()
+		}
+		slog.DebugContext(r.Context(), "csv exported", "file", filename, "rows", rows)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "csv export failed", "file", filename, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// HandleGetTradesCSV exports the trades of an account; from and to bound
+// their processing time.
+func (h *Handlers) HandleGetTradesCSV(w http.ResponseWriter, r *http.Request) {
+	account := r.PathValue("acc")
+	if !accountPattern.MatchString(account) {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidPath, "account must contain only letters and digits")
+		return
+	}
+	if !auth.FromContext(r.Context()).CanAccess(account) {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "account "+account+" is not allowed")
+		return
+	}
+	params, errs := parseExportParams(r.URL.Query(), true)
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs...))
+		return
+	}
+	columns, ok := selectColumns(w, r, export.Trades, params.columns)
+	if !ok {
+		return
+	}
+	streamCSV(w, r, "trades-"+account+".csv", columns, params, func(fn func(*model.Trade) error) error {
+		return h.dbManager.EachTrade(r.Context(), account, params.from, params.to, fn)
+	})
+}
+
+// HandleGetStatsCSV exports the stats of every account the caller may
+// access.
+func (h *Handlers) HandleGetStatsCSV(w http.ResponseWriter, r *http.Request) {
+	params, errs := parseExportParams(r.URL.Query(), false)
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs...))
+		return
+	}
+	columns, ok := selectColumns(w, r, export.Stats, params.columns)
+	if !ok {
+		return
+	}
+	p := auth.FromContext(r.Context())
+	streamCSV(w, r, "stats.csv", columns, params, func(fn func(model.Account) error) error {
+		return h.dbManager.EachClient(r.Context(), func(a model.Account) error {
+			if !p.CanAccess(a.AccountId) {
+				return nil
+			}
+			return fn(a)
+		})
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"gitlab.com/digineat/go-broker-test/internal/export"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport_CSV(t *testing.T) {
+	doc := loadSpec(t)
+	srv, dbManager := newAuthServer(t)
+
+	for _, account := range []string{"123", "456", "123"} {
+		if res := doRequest(t, http.MethodPost, srv.URL+"/trades", testAdminKey, tradeJSON(account)); res.StatusCode != http.StatusOK {
+			t.Fatalf("post trade: status %d", res.StatusCode)
+		}
+	}
+	// the worker processes the first two trades
+	for range 2 {
+		tx, err := dbManager.CreateTx(t.Context())
+		if err != nil {
+			t.Fatalf("begin tx: %v", err)
+		}
+		trade, err := dbManager.GetTrade(t.Context(), tx, time.Now())
+		if err != nil || trade == nil {
+			t.Fatalf("GetTrade = %v, %v", trade, err)
+		}
+		if err = dbManager.UpdateAccount(t.Context(), tx, trade.Account, trade.Profit()); err != nil {
+			t.Fatalf("update account: %v", err)
+		}
+		if err = dbManager.CommitTx(tx); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		specPath   string
+		statusCode int
+		rows       int
+	}{
+		{name: "trades", path: "/accounts/123/trades.csv", specPath: "/accounts/{acc}/trades.csv", statusCode: http.StatusOK, rows: 2},
+		{name: "trades processed in range", path: "/accounts/123/trades.csv?from=2000-01-01T00:00:00Z&tz=America/New_York",
+			specPath: "/accounts/{acc}/trades.csv", statusCode: http.StatusOK, rows: 1},
+		{name: "trades of other account", path: "/accounts/789/trades.csv", specPath: "/accounts/{acc}/trades.csv", statusCode: http.StatusOK},
+		{name: "trades with unknown column", path: "/accounts/123/trades.csv?columns=id,margin",
+			specPath: "/accounts/{acc}/trades.csv", statusCode: http.StatusBadRequest},
+		{name: "trades with unknown time zone", path: "/accounts/123/trades.csv?tz=Mars/Olympus",
+			specPath: "/accounts/{acc}/trades.csv", statusCode: http.StatusBadRequest},
+		{name: "trades of invalid account", path: "/accounts/1-2/trades.csv", specPath: "/accounts/{acc}/trades.csv", statusCode: http.StatusBadRequest},
+		{name: "stats", path: "/stats.csv", specPath: "/stats.csv", statusCode: http.StatusOK, rows: 2},
+		{name: "stats with invalid bom", path: "/stats.csv?bom=maybe", specPath: "/stats.csv", statusCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		res := doRequest(t, http.MethodGet, srv.URL+test.path, testAdminKey, "")
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if err := doc.ValidateResponse(http.MethodGet, test.specPath, res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+			t.Fatalf("response does not match spec: %v", err)
+		}
+		if res.StatusCode != http.StatusOK {
+			continue
+		}
+		records, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+		if err != nil {
+			t.Fatalf("read csv: %v", err)
+		}
+		if len(records)-1 != test.rows {
+			t.Errorf("rows = %d; want %d", len(records)-1, test.rows)
+		}
+	}
+
+	// the numbers are those of the JSON API, which leaves out the profit of
+	// the pending trade 3 as the export leaves it empty
+	res := doRequest(t, http.MethodGet, srv.URL+"/accounts/123/trades.csv?columns=id,profit,status", testAdminKey, "")
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	for i, id := range []string{"1", "3"} {
+		var trade TradeResponse
+		if err = json.NewDecoder(doRequest(t, http.MethodGet, srv.URL+"/trades/"+id, testAdminKey, "").Body).Decode(&trade); err != nil {
+			t.Fatalf("decode trade: %v", err)
+		}
+		profit := ""
+		if trade.Profit != nil {
+			profit = export.Format{}.Float(*trade.Profit)
+		}
+		if want := []string{id, profit, trade.Status}; strings.Join(records[i+1], ",") != strings.Join(want, ",") {
+			t.Errorf("csv row = %v; want %v", records[i+1], want)
+		}
+		if (trade.Profit != nil) != (trade.Status == model.TradeStatusProcessed) {
+			t.Errorf("trade %s is %s with profit %v", id, trade.Status, trade.Profit)
+		}
+	}
+
+	res = doRequest(t, http.MethodGet, srv.URL+"/stats.csv", testAdminKey, "")
+	if records, err = csv.NewReader(res.Body).ReadAll(); err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	var stats model.Account
+	if err = json.NewDecoder(doRequest(t, http.MethodGet, srv.URL+"/stats/123", testAdminKey, "").Body).Decode(&stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if want := []string{"123", "1", export.Format{}.Float(stats.Profit)}; strings.Join(records[1], ",") != strings.Join(want, ",") {
+		t.Errorf("csv row = %v; want %v", records[1], want)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type CreateGroupRequest struct {
+	Id     string `json:"id"     validate:"required,alphanum,max=50"`
+	Name   string `json:"name"   validate:"max=100"`
+	Parent string `json:"parent" validate:"omitempty,alphanum,max=50"`
+}
+
+type GroupsResponse struct {
+	Groups []model.AccountGroup `json:"groups"`
+}
+
+// HandlePostGroups adds a group to the tree. Groups cannot be moved once
+// created; accounts are moved between groups with PATCH /accounts/{id}.
+func (h *Handlers) HandlePostGroups(w http.ResponseWriter, r *http.Request) {
+	req := CreateGroupRequest{}
+	if p := problem.Decode(r.Body, &req); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		problem.Write(w, r, problem.FromValidation(err))
+		return
+	}
+	group := model.AccountGroup{
+		Id:        req.Id,
+		Name:      req.Name,
+		Parent:    req.Parent,
+		CreatedAt: h.now().UTC().Truncate(time.Millisecond),
+	}
+	if group.Name == "" {
+		group.Name = group.Id
+	}
+	err := h.dbManager.CreateAccountGroup(r.Context(), &group)
+	switch {
+	case errors.Is(err, dbmanager.ErrGroupExists):
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "group "+req.Id+" already exists")
+		return
+	case errors.Is(err, dbmanager.ErrGroupNotFound):
+		problem.Write(w, r, problem.Validation(problem.FieldError{
+			Field:   "parent",
+			Rule:    "group_exists",
+			Message: "group " + req.Parent + " does not exist",
+			Value:   req.Parent,
+		}))
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "can not create group", "group", req.Id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not create group")
+		return
+	}
+	slog.InfoContext(r.Context(), "group created", "group", group.Id, "parent", group.Parent)
+	writeJSON(w, r, http.StatusCreated, group)
+}
+
+func (h *Handlers) HandleGetGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.dbManager.ListAccountGroups(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not list groups", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not list groups")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, GroupsResponse{Groups: groups})
+}
+
+// HandleGetGroupStats aggregates the trades of a group and all groups below
+// it, processed from "from" (inclusive) to "to" (exclusive). As the totals
+// span many accounts, callers bound to some accounts are refused.
+func (h *Handlers) HandleGetGroupStats(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !auth.FromContext(r.Context()).Unrestricted() {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "group stats require access to every account")
+		return
+	}
+	q := r.URL.Query()
+	from, fromErr := parseTimeParam("from", q.Get("from"))
+	to, toErr := parseTimeParam("to", q.Get("to"))
+	var errs []problem.FieldError
+	for _, fe := range []*problem.FieldError{fromErr, toErr} {
+		if fe != nil {
+			errs = append(errs, *fe)
+		}
+	}
+	if from != nil && to != nil && !to.After(*from) {
+		errs = append(errs, problem.FieldError{Field: "to", Rule: "after_from", Message: "to must be after from", Value: q.Get("to")})
+	}
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs...))
+		return
+	}
+
+	group, err := h.dbManager.GetAccountGroup(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not get group", "group", id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not get group stats")
+		return
+	}
+	if group == nil {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "group "+id+" not found")
+		return
+	}
+	stats, err := h.dbManager.GroupStats(r.Context(), id, from, to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not aggregate group stats", "group", id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not get group stats")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, stats)
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter.
+func parseTimeParam(name, value string) (*time.Time, *problem.FieldError) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, &problem.FieldError{Field: name, Rule: "datetime", Message: name + " must be an RFC 3339 date-time", Value: value}
+	}
+	return &t, nil
+}
+
+// checkGroup reports whether accounts can be put in group, writing the
+// error response if not. The empty group is always allowed.
+func (h *Handlers) checkGroup(w http.ResponseWriter, r *http.Request, group string) bool {
+	if group == "" {
+		return true
+	}
+	g, err := h.dbManager.GetAccountGroup(r.Context(), group)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not get group", "group", group, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not check group")
+		return false
+	}
+	if g == nil {
+		problem.Write(w, r, problem.Validation(problem.FieldError{
+			Field:   "group",
+			Rule:    "group_exists",
+			Message: "group " + group + " does not exist",
+			Value:   group,
+		}))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"io"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGroups_Stats(t *testing.T) {
+	doc := loadSpec(t)
+	srv, dbManager := newAuthServer(t)
+
+	res := doRequest(t, http.MethodPost, srv.URL+"/admin/keys", testAdminKey,
+		`{"name":"ib","scopes":["stats:read"],"accounts":["123"]}`)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create key: status %d", res.StatusCode)
+	}
+	var key CreateApiKeyResponse
+	if err := json.NewDecoder(res.Body).Decode(&key); err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		specPath   string
+		key        string
+		body       string
+		statusCode int
+	}{
+		{name: "create root", method: http.MethodPost, path: "/groups", specPath: "/groups",
+			body: `{"id":"master","name":"Master IB"}`, statusCode: http.StatusCreated},
+		{name: "create child", method: http.MethodPost, path: "/groups", specPath: "/groups",
+			body: `{"id":"ib1","parent":"master"}`, statusCode: http.StatusCreated},
+		{name: "create existing", method: http.MethodPost, path: "/groups", specPath: "/groups",
+			body: `{"id":"ib1"}`, statusCode: http.StatusConflict},
+		{name: "create below unknown parent", method: http.MethodPost, path: "/groups", specPath: "/groups",
+			body: `{"id":"ib2","parent":"nope"}`, statusCode: http.StatusBadRequest},
+		{name: "list", method: http.MethodGet, path: "/groups", specPath: "/groups", statusCode: http.StatusOK},
+		{name: "account in unknown group", method: http.MethodPost, path: "/accounts", specPath: "/accounts",
+			body: `{"id":"123","group":"nope"}`, statusCode: http.StatusBadRequest},
+		{name: "account in group", method: http.MethodPost, path: "/accounts", specPath: "/accounts",
+			body: `{"id":"123","group":"ib1"}`, statusCode: http.StatusCreated},
+		{name: "move account to unknown group", method: http.MethodPatch, path: "/accounts/123", specPath: "/accounts/{id}",
+			body: `{"group":"nope"}`, statusCode: http.StatusBadRequest},
+		{name: "stats", method: http.MethodGet, path: "/groups/master/stats?from=2025-06-01T00:00:00Z",
+			specPath: "/groups/{id}/stats", statusCode: http.StatusOK},
+		{name: "stats with invalid range", method: http.MethodGet, path: "/groups/master/stats?from=2025-06-02T00:00:00Z&to=2025-06-01T00:00:00Z",
+			specPath: "/groups/{id}/stats", statusCode: http.StatusBadRequest},
+		{name: "stats with invalid time", method: http.MethodGet, path: "/groups/master/stats?from=yesterday",
+			specPath: "/groups/{id}/stats", statusCode: http.StatusBadRequest},
+		{name: "stats of unknown group", method: http.MethodGet, path: "/groups/nope/stats",
+			specPath: "/groups/{id}/stats", statusCode: http.StatusNotFound},
+		{name: "stats for account bound key", method: http.MethodGet, path: "/groups/master/stats",
+			specPath: "/groups/{id}/stats", key: key.Key, statusCode: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if test.key == "" {
+			test.key = testAdminKey
+		}
+		res := doRequest(t, test.method, srv.URL+test.path, test.key, test.body)
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if err := doc.ValidateResponse(test.method, test.specPath, res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+			t.Fatalf("response does not match spec: %v", err)
+		}
+	}
+
+	if res = doRequest(t, http.MethodPost, srv.URL+"/trades", testAdminKey, tradeJSON("123")); res.StatusCode != http.StatusOK {
+		t.Fatalf("post trade: status %d", res.StatusCode)
+	}
+	tx, err := dbManager.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	if trade, err := dbManager.GetTrade(t.Context(), tx, time.Now()); err != nil || trade == nil || trade.Group != "ib1" {
+		t.Fatalf("GetTrade = %+v, %v; want a trade of group ib1", trade, err)
+	}
+	if err = dbManager.CommitTx(tx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	res = doRequest(t, http.MethodGet, srv.URL+"/groups/master/stats", testAdminKey, "")
+	var stats model.GroupStats
+	if err = json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if stats.Group != "master" || stats.Accounts != 1 || stats.Trades != 1 || math.Abs(stats.Profit-500) > 0.01 {
+		t.Errorf("stats = %+v; want 1 trade of 1 account with profit 500", stats)
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	brokerv1 "gitlab.com/digineat/go-broker-test/api/broker/v1"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	"gitlab.com/digineat/go-broker-test/internal/logging"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/ratelimit"
+	"gitlab.com/digineat/go-broker-test/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail of gRPC errors, whose
+// reason is the problem code of the HTTP API.
+const ErrorDomain = "broker"
+
+// grpcScopes is the scope each gRPC method requires, like the scope of the
+// route it mirrors.
+var grpcScopes = map[string]string{
+	brokerv1.Broker_SubmitTrade_FullMethodName:       auth.ScopeTradeWrite,
+	brokerv1.Broker_SubmitTrades_FullMethodName:      auth.ScopeTradeWrite,
+	brokerv1.Broker_GetTrade_FullMethodName:          auth.ScopeTradeAmend,
+	brokerv1.Broker_GetAccountStats_FullMethodName:   auth.ScopeStatsRead,
+	brokerv1.Broker_WatchAccountStats_FullMethodName: auth.ScopeStatsRead,
+}
+
+// grpcServer serves the Broker gRPC service with the checks of Handlers.
+type grpcServer struct {
+	brokerv1.UnimplementedBrokerServer
+
+	h     *Handlers
+	guard *auth.Guard
+	// watchInterval is how often WatchAccountStats looks for changed stats.
+	watchInterval time.Duration
+}
+
+// newGRPCServer returns a gRPC server for the Broker service. Calls are
+// authenticated by guard from their metadata, which carries the same
+// x-api-key or authorization header as an HTTP request, or from the client
+// certificate. The server speaks TLS with tlsConfig, the configuration of the
+// HTTPS server, and plaintext when it is nil.
+func newGRPCServer(h *Handlers, guard *auth.Guard, watchInterval time.Duration, tlsConfig *tls.Config) *grpc.Server {
+	g := &grpcServer{h: h, guard: guard, watchInterval: watchInterval}
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(g.unaryInterceptor),
+		grpc.StreamInterceptor(g.streamInterceptor),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(grpcTLSConfig(tlsConfig))))
+	}
+	s := grpc.NewServer(opts...)
+	brokerv1.RegisterBrokerServer(s, g)
+	return s
+}
+
+// grpcTLSConfig returns a copy of cfg that negotiates HTTP/2 by ALPN, as
+// gRPC requires, also in the configurations cfg picks per client.
+func grpcTLSConfig(cfg *tls.Config) *tls.Config {
+	cfg = cfg.Clone()
+	cfg.NextProtos = []string{"h2"}
+	if forClient := cfg.GetConfigForClient; forClient != nil {
+		cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := forClient(hello)
+			if c != nil {
+				c = c.Clone()
+				c.NextProtos = []string{"h2"}
+			}
+			return c, err
+		}
+	}
+	return cfg
+}
+
+func (g *grpcServer) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var resp any
+	err := g.intercept(ctx, info.FullMethod, func(ctx context.Context) (err error) {
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (g *grpcServer) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return g.intercept(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	})
+}
+
+// serverStream replaces the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// intercept does for a gRPC call what RequestID, Tracing and Guard.Require
+// do for an HTTP request: it takes the request id from the x-request-id
+// metadata (or generates one) and echoes it in the response header,
+// continues the caller's trace, authenticates the caller and logs the call.
+func (g *grpcServer) intercept(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	header := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, values := range md {
+		if strings.HasPrefix(k, ":") {
+			continue
+		}
+		for _, v := range values {
+			header.Add(k, v)
+		}
+	}
+
+	id := header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = logging.NewRequestID()
+	}
+	ctx = logging.WithRequestID(ctx, id)
+	if err := grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id)); err != nil {
+		slog.ErrorContext(ctx, "can not set response header", "error", err)
+	}
+
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+	ctx, span := tracing.Tracer().Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.method", method),
+			attribute.String(logging.RequestIDKey, id),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	ctx, err := g.authenticate(ctx, method, header)
+	if err == nil {
+		err = call(ctx)
+	}
+
+	code := status.Code(err)
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+	if code == codes.Internal || code == codes.Unknown || code == codes.Unavailable {
+		span.SetStatus(otelcodes.Error, code.String())
+	}
+	slog.InfoContext(ctx, "grpc request",
+		"method", method,
+		"code", code.String(),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return err
+}
+
+// authenticate resolves the caller from header, or from the client
+// certificate of a TLS connection, and checks that it holds the scope of
+// method. It returns ctx unchanged when guard is disabled.
+func (g *grpcServer) authenticate(ctx context.Context, method string, header http.Header) (context.Context, error) {
+	if !g.guard.Enabled() {
+		return ctx, nil
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, method, nil)
+	if err != nil {
+		return ctx, status.Error(codes.Internal, "can not authenticate")
+	}
+	r.Header = header
+	if pr, ok := peer.FromContext(ctx); ok {
+		if info, ok := pr.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	p, err := g.guard.Authn.Authenticate(r)
+	if err != nil {
+		if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+			slog.InfoContext(ctx, "authentication failed", "error", err)
+			return ctx, statusFromProblem(problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "missing or invalid credentials"), 0).Err()
+		}
+		slog.ErrorContext(ctx, "authentication error", "error", err)
+		return ctx, statusFromProblem(problem.New(http.StatusInternalServerError, problem.CodeAuthUnavailable, "authentication unavailable"), 0).Err()
+	}
+	scope := grpcScopes[method]
+	if !p.HasScope(scope) {
+		slog.InfoContext(ctx, "missing scope", "subject", p.Subject, "scope", scope)
+		return ctx, statusFromProblem(problem.New(http.StatusForbidden, problem.CodeForbidden, "scope "+scope+" is required"), 0).Err()
+	}
+	return auth.WithPrincipal(ctx, p), nil
+}
+
+func (g *grpcServer) SubmitTrade(ctx context.Context, req *brokerv1.SubmitTradeRequest) (*brokerv1.SubmitTradeResponse, error) {
+	trade, p := tradeFromRequest(req)
+	var limit ratelimit.Result
+	if p == nil {
+		limit, p = g.h.submitTrade(ctx, trade)
+	}
+	setLimitHeader(ctx, limit)
+	if p != nil {
+		return nil, statusFromProblem(p, retryAfter(limit, p)).Err()
+	}
+	return &brokerv1.SubmitTradeResponse{TradeId: int64(trade.Id)}, nil
+}
+
+// SubmitTrades submits every trade of the stream in its own span, so that a
+// rejected trade does not mark the others as failed.
+func (g *grpcServer) SubmitTrades(stream grpc.ClientStreamingServer[brokerv1.SubmitTradeRequest, brokerv1.SubmitTradesResponse]) error {
+	resp := &brokerv1.SubmitTradesResponse{}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+
+		ctx, span := tracing.Tracer().Start(stream.Context(), "submit trade",
+			trace.WithAttributes(attribute.Int("trade.index", len(resp.Results))))
+		trade, p := tradeFromRequest(req)
+		var limit ratelimit.Result
+		if p == nil {
+			limit, p = g.h.submitTrade(ctx, trade)
+		}
+		span.End()
+
+		if p != nil {
+			resp.Results = append(resp.Results, &brokerv1.SubmitTradeResult{Error: statusFromProblem(p, retryAfter(limit, p)).Proto()})
+			resp.Rejected++
+			continue
+		}
+		resp.Results = append(resp.Results, &brokerv1.SubmitTradeResult{TradeId: int64(trade.Id)})
+		resp.Accepted++
+	}
+}
+
+func (g *grpcServer) GetTrade(ctx context.Context, req *brokerv1.GetTradeRequest) (*brokerv1.Trade, error) {
+	if req.Id <= 0 {
+		return nil, statusFromProblem(problem.New(http.StatusBadRequest, problem.CodeInvalidPath, "trade id must be a positive integer"), 0).Err()
+	}
+	trade, p := g.h.lookupTrade(ctx, int(req.Id))
+	if p != nil {
+		return nil, statusFromProblem(p, 0).Err()
+	}
+	return tradeMessage(trade), nil
+}
+
+func (g *grpcServer) GetAccountStats(ctx context.Context, req *brokerv1.GetAccountStatsRequest) (*brokerv1.AccountStats, error) {
+	account, p := g.h.accountStats(ctx, req.Account)
+	if p != nil {
+		return nil, statusFromProblem(p, 0).Err()
+	}
+	return accountStatsMessage(account), nil
+}
+
+// WatchAccountStats polls the stats of the account every watchInterval and
+// sends them when they differ from the ones sent last.
+func (g *grpcServer) WatchAccountStats(req *brokerv1.WatchAccountStatsRequest, stream grpc.ServerStreamingServer[brokerv1.AccountStats]) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(g.watchInterval)
+	defer ticker.Stop()
+
+	var last *brokerv1.AccountStats
+	for {
+		account, p := g.h.accountStats(ctx, req.Account)
+		switch {
+		case p != nil && p.Code == problem.CodeNotFound:
+			account = &model.Account{AccountId: req.Account}
+		case p != nil:
+			return statusFromProblem(p, 0).Err()
+		}
+		if stats := accountStatsMessage(account); last == nil || !proto.Equal(stats, last) {
+			if err := stream.Send(stats); err != nil {
+				return err
+			}
+			last = stats
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// setLimitHeader sends the rate limit state of a trade submission as the
+// response metadata, like the X-RateLimit headers of POST /trades.
+func setLimitHeader(ctx context.Context, res ratelimit.Result) {
+	if res.Limit == 0 {
+		return
+	}
+	md := metadata.Pairs(
+		"x-ratelimit-limit", strconv.Itoa(res.Limit),
+		"x-ratelimit-remaining", strconv.Itoa(res.Remaining),
+		"x-ratelimit-reset", strconv.Itoa(seconds(res.Reset)),
+	)
+	if err := grpc.SetHeader(ctx, md); err != nil {
+		slog.ErrorContext(ctx, "can not set response header", "error", err)
+	}
+}
+
+// statusFromProblem converts p to the gRPC status with the code closest to
+// its HTTP status. The problem code is the reason of an ErrorInfo detail;
+// field errors become a BadRequest detail and retry a RetryInfo detail.
+func statusFromProblem(p *problem.Problem, retry time.Duration) *status.Status {
+	var code codes.Code
+	switch p.Status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	default:
+		code = codes.Internal
+	}
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: p.Code, Domain: ErrorDomain}}
+	if len(p.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, fe := range p.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       fe.Field,
+				Description: fe.Message,
+				Reason:      fe.Rule,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	if retry > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(retry)})
+	}
+
+	st := status.New(code, p.Detail)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// tradeFromRequest maps req to a trade; the trade is validated by
+// submitTrade.
+func tradeFromRequest(req *brokerv1.SubmitTradeRequest) (*model.Trade, *problem.Problem) {
+	trade := &model.Trade{
+		Account: req.Account,
+		Symbol:  req.Symbol,
+		Volume:  req.Volume,
+		Open:    req.Open,
+		Close:   req.Close,
+	}
+	switch req.Side {
+	case brokerv1.Side_SIDE_BUY:
+		trade.Side = "buy"
+	case brokerv1.Side_SIDE_SELL:
+		trade.Side = "sell"
+	}
+
+	var errs []problem.FieldError
+	timestamp := func(ts *timestamppb.Timestamp, field string) *time.Time {
+		if ts == nil {
+			return nil
+		}
+		if err := ts.CheckValid(); err != nil {
+			errs = append(errs, problem.FieldError{Field: field, Rule: "datetime",
+				Message: field + " must be a valid timestamp", Value: ts.String()})
+			return nil
+		}
+		t := ts.AsTime()
+		return &t
+	}
+	trade.OpenTime = timestamp(req.OpenTime, "open_time")
+	trade.CloseTime = timestamp(req.CloseTime, "close_time")
+	if len(errs) > 0 {
+		return nil, problem.Validation(errs...)
+	}
+	return trade, nil
+}
+
+func tradeMessage(t *model.Trade) *brokerv1.Trade {
+	timestamp := func(t *time.Time) *timestamppb.Timestamp {
+		if t == nil {
+			return nil
+		}
+		return timestamppb.New(*t)
+	}
+	msg := &brokerv1.Trade{
+		Id:          int64(t.Id),
+		Version:     int32(t.Version),
+		Status:      t.Status(),
+		Account:     t.Account,
+		Symbol:      t.Symbol,
+		Volume:      t.Volume,
+		Open:        t.Open,
+		Close:       t.Close,
+		OpenTime:    timestamp(t.OpenTime),
+		CloseTime:   timestamp(t.CloseTime),
+		ProcessedAt: timestamp(t.ProcessedAt),
+		CancelledAt: timestamp(t.CancelledAt),
+	}
+	switch t.Side {
+	case "buy":
+		msg.Side = brokerv1.Side_SIDE_BUY
+	case "sell":
+		msg.Side = brokerv1.Side_SIDE_SELL
+	}
+	// proto3 has no absent double, so an unapplied profit is 0
+	msg.Profit, _ = t.AppliedProfit()
+	if !t.ReceivedAt.IsZero() {
+		msg.ReceivedAt = timestamppb.New(t.ReceivedAt)
+	}
+	return msg
+}
+
+func accountStatsMessage(a *model.Account) *brokerv1.AccountStats {
+	return &brokerv1.AccountStats{Account: a.AccountId, Trades: int64(a.Trades), Profit: a.Profit}
+}
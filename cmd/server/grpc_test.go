@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	brokerv1 "gitlab.com/digineat/go-broker-test/api/broker/v1"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/ratelimit"
+	"gitlab.com/digineat/go-broker-test/internal/tlsconfig"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newGRPCClient serves the gRPC API with API key authentication and the
+// bootstrap admin key on an in-memory listener; opts adjust its handlers.
+func newGRPCClient(t *testing.T, opts ...func(*Handlers)) (brokerv1.BrokerClient, *dbmanager.Manager) {
+	dbManager := newMemoryManager(t)
+	if err := bootstrapAdminKey(t.Context(), dbManager, testAdminKey); err != nil {
+		t.Fatalf("bootstrap admin key: %v", err)
+	}
+	limiter, err := ratelimit.New(ratelimit.Config{})
+	if err != nil {
+		t.Fatalf("new limiter: %v", err)
+	}
+	hs := Handlers{
+		dbManager:  dbManager,
+		limiter:    limiter,
+		queueDepth: ratelimit.NewDepthGauge(dbManager.CountPendingTrades, 0),
+	}
+	for _, opt := range opts {
+		opt(&hs)
+	}
+
+	l := bufconn.Listen(1 << 20)
+	srv := newGRPCServer(&hs, &auth.Guard{Authn: &auth.ApiKeyAuthenticator{Store: dbManager}}, 10*time.Millisecond, nil)
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return brokerv1.NewBrokerClient(conn), dbManager
+}
+
+// createKey stores a new API key with scopes and accounts and returns its
+// token.
+func createKey(t *testing.T, dbManager *dbmanager.Manager, scopes, accounts []string) string {
+	id, token, hash, err := auth.GenerateApiKey()
+	if err != nil {
+		t.Fatalf("GenerateApiKey: %v", err)
+	}
+	if err = dbManager.CreateApiKey(t.Context(), &model.ApiKey{Id: id, Name: "test", Hash: hash,
+		Scopes: scopes, Accounts: accounts, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("CreateApiKey: %v", err)
+	}
+	return token
+}
+
+func withKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, auth.ApiKeyHeader, key)
+}
+
+func tradeRequest(account string) *brokerv1.SubmitTradeRequest {
+	return &brokerv1.SubmitTradeRequest{Account: account, Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: brokerv1.Side_SIDE_BUY}
+}
+
+// errorReason returns the problem code carried by the ErrorInfo of st.
+func errorReason(st *status.Status) string {
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.Domain == ErrorDomain {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+func TestGRPC_Unary(t *testing.T) {
+	client, dbManager := newGRPCClient(t)
+	statsKey := createKey(t, dbManager, []string{auth.ScopeStatsRead}, nil)
+	boundKey := createKey(t, dbManager, []string{auth.ScopeTradeWrite, auth.ScopeTradeAmend}, []string{"123"})
+
+	tests := []struct {
+		name   string
+		key    string
+		call   func(ctx context.Context) error
+		code   codes.Code
+		reason string
+		fields []string
+	}{
+		{name: "no credentials", call: func(ctx context.Context) error {
+			_, err := client.SubmitTrade(ctx, tradeRequest("123"))
+			return err
+		}, code: codes.Unauthenticated, reason: problem.CodeUnauthorized},
+		{name: "invalid key", key: "0123456789abcdef.wrong", call: func(ctx context.Context) error {
+			_, err := client.GetAccountStats(ctx, &brokerv1.GetAccountStatsRequest{Account: "123"})
+			return err
+		}, code: codes.Unauthenticated, reason: problem.CodeUnauthorized},
+		{name: "missing scope", key: statsKey, call: func(ctx context.Context) error {
+			_, err := client.SubmitTrade(ctx, tradeRequest("123"))
+			return err
+		}, code: codes.PermissionDenied, reason: problem.CodeForbidden},
+		{name: "submit", key: boundKey, call: func(ctx context.Context) error {
+			resp, err := client.SubmitTrade(ctx, tradeRequest("123"))
+			if err == nil && resp.TradeId != 1 {
+				t.Errorf("trade id = %d; want 1", resp.TradeId)
+			}
+			return err
+		}},
+		{name: "submit for other account", key: boundKey, call: func(ctx context.Context) error {
+			_, err := client.SubmitTrade(ctx, tradeRequest("456"))
+			return err
+		}, code: codes.PermissionDenied, reason: problem.CodeForbidden},
+		{name: "invalid trade", key: boundKey, call: func(ctx context.Context) error {
+			_, err := client.SubmitTrade(ctx, &brokerv1.SubmitTradeRequest{Account: "123", Symbol: "EURUSD", Volume: -1, Open: 1.1, Close: 1.1})
+			return err
+		}, code: codes.InvalidArgument, reason: problem.CodeValidationFailed, fields: []string{"volume", "side"}},
+		{name: "close time in the future", key: boundKey, call: func(ctx context.Context) error {
+			req := tradeRequest("123")
+			req.CloseTime = timestamppb.New(time.Now().Add(time.Hour))
+			_, err := client.SubmitTrade(ctx, req)
+			return err
+		}, code: codes.InvalidArgument, reason: problem.CodeValidationFailed, fields: []string{"close_time"}},
+		{name: "get trade", key: boundKey, call: func(ctx context.Context) error {
+			trade, err := client.GetTrade(ctx, &brokerv1.GetTradeRequest{Id: 1})
+			if err == nil && (trade.Account != "123" || trade.Status != model.TradeStatusPending ||
+				trade.Side != brokerv1.Side_SIDE_BUY || trade.Version != 1 || trade.ReceivedAt == nil || trade.Profit != 0) {
+				t.Errorf("trade = %v", trade)
+			}
+			return err
+		}},
+		{name: "get invalid trade id", key: boundKey, call: func(ctx context.Context) error {
+			_, err := client.GetTrade(ctx, &brokerv1.GetTradeRequest{})
+			return err
+		}, code: codes.InvalidArgument, reason: problem.CodeInvalidPath},
+		{name: "get unknown trade", key: boundKey, call: func(ctx context.Context) error {
+			_, err := client.GetTrade(ctx, &brokerv1.GetTradeRequest{Id: 99})
+			return err
+		}, code: codes.NotFound, reason: problem.CodeNotFound},
+		{name: "stats without trades", key: statsKey, call: func(ctx context.Context) error {
+			_, err := client.GetAccountStats(ctx, &brokerv1.GetAccountStatsRequest{Account: "123"})
+			return err
+		}, code: codes.NotFound, reason: problem.CodeNotFound},
+		{name: "stats of invalid account", key: statsKey, call: func(ctx context.Context) error {
+			_, err := client.GetAccountStats(ctx, &brokerv1.GetAccountStatsRequest{Account: "1-2"})
+			return err
+		}, code: codes.InvalidArgument, reason: problem.CodeInvalidPath},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		err := test.call(withKey(t.Context(), test.key))
+		st := status.Convert(err)
+		if st.Code() != test.code || errorReason(st) != test.reason {
+			t.Fatalf("status = %v, reason %q; want %v, reason %q", st, errorReason(st), test.code, test.reason)
+		}
+		var fields []string
+		for _, d := range st.Details() {
+			if br, ok := d.(*errdetails.BadRequest); ok {
+				for _, v := range br.FieldViolations {
+					fields = append(fields, v.Field)
+				}
+			}
+		}
+		if len(fields) != len(test.fields) {
+			t.Fatalf("field violations = %v; want %v", fields, test.fields)
+		}
+		for i := range fields {
+			if fields[i] != test.fields[i] {
+				t.Fatalf("field violations = %v; want %v", fields, test.fields)
+			}
+		}
+	}
+}
+
+func TestGRPC_RequestIDAndLimits(t *testing.T) {
+	client, _ := newGRPCClient(t, func(h *Handlers) {
+		h.limiter, _ = ratelimit.New(ratelimit.Config{Account: ratelimit.Limit{Rate: 0.001, Burst: 1}})
+	})
+	ctx := metadata.AppendToOutgoingContext(withKey(t.Context(), testAdminKey), RequestIDHeader, "req-1")
+
+	var header metadata.MD
+	if _, err := client.SubmitTrade(ctx, tradeRequest("123"), grpc.Header(&header)); err != nil {
+		t.Fatalf("SubmitTrade: %v", err)
+	}
+	if id := header.Get(RequestIDHeader); len(id) != 1 || id[0] != "req-1" {
+		t.Errorf("x-request-id = %v; want req-1", id)
+	}
+	if limit := header.Get("x-ratelimit-limit"); len(limit) != 1 || limit[0] != "1" {
+		t.Errorf("x-ratelimit-limit = %v; want 1", limit)
+	}
+
+	_, err := client.SubmitTrade(ctx, tradeRequest("123"))
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted || errorReason(st) != problem.CodeRateLimited {
+		t.Fatalf("status = %v; want ResourceExhausted", st)
+	}
+	var retry *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if r, ok := d.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	if retry == nil || retry.RetryDelay.AsDuration() <= 0 {
+		t.Errorf("retry info = %v; want a positive delay", retry)
+	}
+}
+
+func TestGRPC_SubmitTrades(t *testing.T) {
+	client, dbManager := newGRPCClient(t)
+	key := createKey(t, dbManager, []string{auth.ScopeTradeWrite}, []string{"123"})
+
+	stream, err := client.SubmitTrades(withKey(t.Context(), key))
+	if err != nil {
+		t.Fatalf("SubmitTrades: %v", err)
+	}
+	invalid := tradeRequest("123")
+	invalid.Symbol = "EUR"
+	for _, req := range []*brokerv1.SubmitTradeRequest{tradeRequest("123"), invalid, tradeRequest("456"), tradeRequest("123")} {
+		if err = stream.Send(req); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv: %v", err)
+	}
+
+	if resp.Accepted != 2 || resp.Rejected != 2 || len(resp.Results) != 4 {
+		t.Fatalf("response = %v; want 2 accepted and 2 rejected", resp)
+	}
+	want := []struct {
+		tradeID int64
+		code    codes.Code
+	}{{1, codes.OK}, {0, codes.InvalidArgument}, {0, codes.PermissionDenied}, {2, codes.OK}}
+	for i, result := range resp.Results {
+		if code := codes.Code(result.Error.GetCode()); result.TradeId != want[i].tradeID || code != want[i].code {
+			t.Errorf("result %d = %v; want trade %d, code %v", i, result, want[i].tradeID, want[i].code)
+		}
+	}
+	if n, err := dbManager.CountPendingTrades(t.Context()); err != nil || n != 2 {
+		t.Errorf("CountPendingTrades = %d, %v; want 2", n, err)
+	}
+
+	// the whole stream is rejected without credentials
+	stream, err = client.SubmitTrades(t.Context())
+	if err != nil {
+		t.Fatalf("SubmitTrades: %v", err)
+	}
+	stream.Send(tradeRequest("123"))
+	if _, err = stream.CloseAndRecv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("err = %v; want Unauthenticated", err)
+	}
+}
+
+func TestGRPC_WatchAccountStats(t *testing.T) {
+	client, dbManager := newGRPCClient(t)
+	key := createKey(t, dbManager, []string{auth.ScopeStatsRead}, []string{"123"})
+
+	stream, err := client.WatchAccountStats(withKey(t.Context(), key), &brokerv1.WatchAccountStatsRequest{Account: "456"})
+	if err != nil {
+		t.Fatalf("WatchAccountStats: %v", err)
+	}
+	if _, err = stream.Recv(); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("watch of other account: err = %v; want PermissionDenied", err)
+	}
+
+	ctx, cancel := context.WithCancel(withKey(t.Context(), key))
+	defer cancel()
+	stream, err = client.WatchAccountStats(ctx, &brokerv1.WatchAccountStatsRequest{Account: "123"})
+	if err != nil {
+		t.Fatalf("WatchAccountStats: %v", err)
+	}
+	stats, err := stream.Recv()
+	if err != nil || stats.Account != "123" || stats.Trades != 0 || stats.Profit != 0 {
+		t.Fatalf("first stats = %v, %v; want zero stats", stats, err)
+	}
+
+	for _, profit := range []float64{500, -200} {
+		tx, err := dbManager.CreateTx(t.Context())
+		if err != nil {
+			t.Fatalf("begin tx: %v", err)
+		}
+		if err = dbManager.UpdateAccount(t.Context(), tx, "123", profit); err != nil {
+			t.Fatalf("UpdateAccount: %v", err)
+		}
+		if err = dbManager.CommitTx(tx); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+	}
+	// the stats are polled, so both updates may arrive as one
+	for stats.Trades < 2 {
+		if stats, err = stream.Recv(); err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+	}
+	if stats.Trades != 2 || math.Abs(stats.Profit-300) > 0.01 {
+		t.Errorf("stats = %v; want 2 trades with profit 300", stats)
+	}
+
+	cancel()
+	if _, err = stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Errorf("Recv after cancel: err = %v; want Canceled", err)
+	}
+}
+
+// issueCert returns a PEM certificate and key for name signed by parent, or
+// self-signed as a CA when parent is nil.
+func issueCert(t *testing.T, name string, parent *tls.Certificate, client bool) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{name},
+	}
+	if client {
+		tmpl.ExtKeyUsage, tmpl.DNSNames = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, nil
+	}
+	signer, signerKey := tmpl, any(key)
+	if parent == nil {
+		tmpl.KeyUsage, tmpl.ExtKeyUsage, tmpl.DNSNames = x509.KeyUsageCertSign, nil, nil
+		tmpl.BasicConstraintsValid, tmpl.IsCA = true, true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestGRPC_TLS(t *testing.T) {
+	dir := t.TempDir()
+	caPEM, caKeyPEM := issueCert(t, "broker test CA", nil, false)
+	ca, err := tls.X509KeyPair(caPEM, caKeyPEM)
+	if err != nil {
+		t.Fatalf("load CA: %v", err)
+	}
+	files := map[string][]byte{"ca.pem": caPEM}
+	files["server.pem"], files["server.key"] = issueCert(t, "broker.test", &ca, false)
+	files["client.pem"], files["client.key"] = issueCert(t, "desk", &ca, true)
+	for name, data := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	// the configuration of the HTTPS server with optional client certificates
+	certs, err := tlsconfig.New(tlsconfig.Files{Cert: filepath.Join(dir, "server.pem"), Key: filepath.Join(dir, "server.key"),
+		ClientCA: filepath.Join(dir, "ca.pem"), ClientAuth: tlsconfig.ClientAuthOptional})
+	if err != nil {
+		t.Fatalf("load TLS files: %v", err)
+	}
+	grants, err := auth.NewCertAuthenticator([]auth.CertGrant{{Subject: "CN=desk", Scopes: []string{auth.ScopeStatsRead}}})
+	if err != nil {
+		t.Fatalf("new cert authenticator: %v", err)
+	}
+	hs := Handlers{dbManager: newMemoryManager(t)}
+	l := bufconn.Listen(1 << 20)
+	srv := newGRPCServer(&hs, &auth.Guard{Authn: grants}, time.Second, certs.Config())
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	clientCert, err := tls.X509KeyPair(files["client.pem"], files["client.key"])
+	if err != nil {
+		t.Fatalf("load client certificate: %v", err)
+	}
+	tests := []struct {
+		name  string
+		creds credentials.TransportCredentials
+		code  codes.Code
+	}{
+		{name: "plaintext", creds: insecure.NewCredentials(), code: codes.Unavailable},
+		{name: "TLS without client certificate", creds: credentials.NewTLS(&tls.Config{ServerName: "broker.test", RootCAs: roots}),
+			code: codes.Unauthenticated},
+		{name: "TLS with client certificate", creds: credentials.NewTLS(&tls.Config{ServerName: "broker.test", RootCAs: roots,
+			Certificates: []tls.Certificate{clientCert}}), code: codes.NotFound},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		conn, err := grpc.NewClient("passthrough:///bufconn",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+			grpc.WithTransportCredentials(test.creds))
+		if err != nil {
+			t.Fatalf("new client: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		_, err = brokerv1.NewBrokerClient(conn).GetAccountStats(ctx, &brokerv1.GetAccountStatsRequest{Account: "123"})
+		cancel()
+		conn.Close()
+		if code := status.Code(err); code != test.code {
+			t.Errorf("GetAccountStats: %v; want %s", err, test.code)
+		}
+	}
+}
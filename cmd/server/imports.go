@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/importer"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ImportResponse is an import job with the errors of its rows so far.
+type ImportResponse struct {
+	model.ImportJob
+	Errors []model.ImportError `json:"errors"`
+}
+
+// HandlePostImports starts importing the CSV file in the request body. The
+// file is stored in a temporary file and imported in the background; the
+// response is the new job, whose progress is polled with GET /imports/{id}.
+// The options are query parameters: mode (enqueue or apply), dry_run, map
+// (a field=header list, see importer.ParseMapping) and source, the name the
+// job records for the file.
+func (h *Handlers) HandlePostImports(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var errs []problem.FieldError
+	mode := q.Get("mode")
+	switch mode {
+	case "":
+		mode = model.ImportModeEnqueue
+	case model.ImportModeEnqueue, model.ImportModeApply:
+	default:
+		errs = append(errs, problem.FieldError{Field: "mode", Rule: "oneof", Message: "mode must be one of enqueue, apply", Value: mode})
+	}
+	var dryRun bool
+	if s := q.Get("dry_run"); s != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(s); err != nil {
+			errs = append(errs, problem.FieldError{Field: "dry_run", Rule: "boolean", Message: "dry_run must be true or false", Value: s})
+		}
+	}
+	mapping, err := importer.ParseMapping(q.Get("map"))
+	if err != nil {
+		errs = append(errs, problem.FieldError{Field: "map", Rule: "mapping", Message: err.Error(), Value: q.Get("map")})
+	}
+	source := q.Get("source")
+	if source == "" {
+		source = "upload"
+	}
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs...))
+		return
+	}
+
+	f, err := os.CreateTemp("", "import-*.csv")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not create import file", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not store file")
+		return
+	}
+	started := false
+	defer func() {
+		if !started {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = io.Copy(f, r.Body); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not store import file", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not store file")
+		return
+	}
+
+	now := h.now()
+	reader, err := importer.NewReader(f, mapping, now)
+	var parseErr *csv.ParseError
+	if errors.Is(err, importer.ErrMissingColumn) || errors.As(err, &parseErr) {
+		problem.Write(w, r, problem.Validation(problem.FieldError{
+			Field:   "body",
+			Rule:    "header",
+			Message: err.Error(),
+		}))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not read import file", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not read file")
+		return
+	}
+
+	job := &model.ImportJob{
+		Status:    model.ImportStatusRunning,
+		Mode:      mode,
+		DryRun:    dryRun,
+		Source:    source,
+		Actor:     audit.Actor(r.Context()),
+		CreatedAt: now.UTC().Truncate(time.Millisecond),
+	}
+	if err = h.dbManager.CreateImportJob(r.Context(), job); err != nil {
+		slog.ErrorContext(r.Context(), "can not create import job", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not create import job")
+		return
+	}
+	resp := *job
+
+	// The job outlives the request but keeps its actor and trace.
+	ctx := context.WithoutCancel(r.Context())
+	started = true
+	go func() {
+		defer os.Remove(f.Name())
+		defer f.Close()
+		if err := importer.Run(ctx, h.dbManager, job, reader, !h.requireAccounts, h.now); err != nil {
+			slog.ErrorContext(ctx, "import failed", "import_id", job.Id, "rows", job.Rows, "error", err)
+			return
+		}
+		slog.InfoContext(ctx, "import finished", "import_id", job.Id, "rows", job.Rows,
+			"imported", job.Imported, "duplicates", job.Duplicates, "failed", job.Failed, "dry_run", job.DryRun)
+	}()
+
+	slog.InfoContext(r.Context(), "import started", "import_id", resp.Id, "mode", mode, "dry_run", dryRun, "source", source)
+	w.Header().Set("Location", "/imports/"+strconv.Itoa(resp.Id))
+	writeJSON(w, r, http.StatusAccepted, resp)
+}
+
+// HandleGetImport returns the progress of an import job and the errors
+// found so far.
+func (h *Handlers) HandleGetImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidPath, "import id must be a positive integer")
+		return
+	}
+	job, err := h.dbManager.GetImportJob(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not get import job", "import_id", id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not get import job")
+		return
+	}
+	if job == nil {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "import "+strconv.Itoa(id)+" not found")
+		return
+	}
+	errs, err := h.dbManager.ListImportErrors(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not list import errors", "import_id", id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not get import job")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, ImportResponse{ImportJob: *job, Errors: errs})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitImport polls the job at url until it is no longer running.
+func waitImport(t *testing.T, url string) ImportResponse {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		res := doRequest(t, http.MethodGet, url, testAdminKey, "")
+		var job ImportResponse
+		if err := json.NewDecoder(res.Body).Decode(&job); err != nil {
+			t.Fatalf("decode job: %v", err)
+		}
+		if job.Status != model.ImportStatusRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("import still running: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestImports_Endpoints(t *testing.T) {
+	doc := loadSpec(t)
+	srv, dbManager := newAuthServer(t)
+
+	file := "Ticket,Login,symbol,side,volume,open,close,close_time\n" +
+		"T1,123,EURUSD,buy,1,1.1,1.105,2025-06-01T10:00:00Z\n" +
+		"T2,123,EURUSD,hold,1,1.1,1.105,2025-06-01T10:00:00Z\n" +
+		"T3,456,GBPUSD,sell,2,1.3,1.29,2025-06-01T11:00:00Z\n"
+	const mapping = "?map=external_id%3DTicket,account%3DLogin"
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		specPath   string
+		body       string
+		statusCode int
+	}{
+		{name: "dry run", method: http.MethodPost, path: "/imports" + mapping + "&dry_run=true&mode=apply", specPath: "/imports",
+			body: file, statusCode: http.StatusAccepted},
+		{name: "unknown mode", method: http.MethodPost, path: "/imports?mode=replace", specPath: "/imports",
+			body: file, statusCode: http.StatusBadRequest},
+		{name: "unknown field in map", method: http.MethodPost, path: "/imports?map=login%3DLogin", specPath: "/imports",
+			body: file, statusCode: http.StatusBadRequest},
+		{name: "unmapped columns", method: http.MethodPost, path: "/imports", specPath: "/imports",
+			body: file, statusCode: http.StatusBadRequest},
+		{name: "job", method: http.MethodGet, path: "/imports/1", specPath: "/imports/{id}",
+			statusCode: http.StatusOK},
+		{name: "unknown job", method: http.MethodGet, path: "/imports/99", specPath: "/imports/{id}",
+			statusCode: http.StatusNotFound},
+		{name: "invalid job id", method: http.MethodGet, path: "/imports/x", specPath: "/imports/{id}",
+			statusCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		res := doRequest(t, test.method, srv.URL+test.path, testAdminKey, test.body)
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if err := doc.ValidateResponse(test.method, test.specPath, res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+			t.Fatalf("response does not match spec: %v", err)
+		}
+		if res.StatusCode == http.StatusAccepted {
+			waitImport(t, srv.URL+res.Header.Get("Location"))
+		}
+	}
+
+	dry := waitImport(t, srv.URL+"/imports/1")
+	if dry.Rows != 3 || dry.Imported != 2 || dry.Failed != 1 || len(dry.Errors) != 1 || dry.Errors[0].Line != 3 || dry.Errors[0].Field != "side" {
+		t.Errorf("dry run = %+v", dry)
+	}
+	if n, err := dbManager.CountPendingTrades(t.Context()); err != nil || n != 0 {
+		t.Errorf("CountPendingTrades after dry run = %d, %v; want 0", n, err)
+	}
+
+	for _, want := range []struct{ imported, duplicates int }{{2, 0}, {0, 2}} {
+		res := doRequest(t, http.MethodPost, srv.URL+"/imports"+mapping+"&mode=apply&source=history.csv", testAdminKey, file)
+		if res.StatusCode != http.StatusAccepted {
+			t.Fatalf("import: status %d", res.StatusCode)
+		}
+		job := waitImport(t, srv.URL+res.Header.Get("Location"))
+		if job.Status != model.ImportStatusCompleted || job.Source != "history.csv" || !strings.HasPrefix(job.Actor, "key:") ||
+			job.Imported != want.imported || job.Duplicates != want.duplicates || job.Failed != 1 {
+			t.Errorf("job = %+v; want %d imported, %d duplicates", job, want.imported, want.duplicates)
+		}
+	}
+	res := doRequest(t, http.MethodGet, srv.URL+"/stats/456", testAdminKey, "")
+	var stats model.Account
+	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil || stats.Trades != 1 {
+		t.Errorf("stats of 456 = %+v, %v; want 1 trade", stats, err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/ratelimit"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// allowTrade applies the per-key and per-account rate limits and the queue
+// backpressure threshold to a trade submission. It returns the result of
+// the rate limits and, when the trade must not be enqueued, the rejection.
+func (h *Handlers) allowTrade(ctx context.Context, account string) (ratelimit.Result, *problem.Problem) {
+	if h.limiter == nil {
+		return ratelimit.Result{}, nil
+	}
+
+	targets := []ratelimit.Target{{Kind: ratelimit.KindAccount, Id: account}}
+	if p := auth.FromContext(ctx); p != nil {
+		targets = append(targets, ratelimit.Target{Kind: ratelimit.KindKey, Id: p.Subject})
+	}
+	res := h.limiter.Allow(targets...)
+	if !res.Allowed {
+		slog.InfoContext(ctx, "rate limit exceeded", "account", account, "retry_after", res.RetryAfter)
+		return res, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, "rate limit exceeded")
+	}
+
+	maxPending := h.limiter.Config().MaxPending
+	if maxPending == 0 || h.queueDepth == nil {
+		return res, nil
+	}
+	depth, err := h.queueDepth.Depth(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "can not count pending trades", "error", err)
+		return res, problem.New(http.StatusInternalServerError, problem.CodeInternal, "can not check queue depth")
+	}
+	if depth >= maxPending {
+		slog.WarnContext(ctx, "queue backpressure", "pending", depth, "max_pending", maxPending)
+		return res, problem.New(http.StatusServiceUnavailable, problem.CodeQueueFull, "trade queue is full")
+	}
+	return res, nil
+}
+
+// retryAfter is how long a client rejected with p should wait before it
+// submits again, or zero.
+func retryAfter(res ratelimit.Result, p *problem.Problem) time.Duration {
+	switch {
+	case p == nil:
+		return 0
+	case p.Code == problem.CodeRateLimited:
+		return res.RetryAfter
+	case p.Code == problem.CodeQueueFull:
+		return time.Second
+	}
+	return 0
+}
+
+// writeLimitHeaders sets the rate limit headers of a trade submission, and
+// Retry-After when it was rejected by the limits.
+func writeLimitHeaders(w http.ResponseWriter, res ratelimit.Result, p *problem.Problem) {
+	if res.Limit > 0 {
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+	}
+	if d := retryAfter(res, p); d > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds(d)))
+	}
+}
+
+// seconds rounds d up to whole seconds, as used by Retry-After.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func (h *Handlers) HandleGetLimits(w http.ResponseWriter, r *http.Request) {
+	if h.limiter == nil {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeRateLimitingOff, "rate limiting is disabled")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, h.limiter.Config())
+}
+
+func (h *Handlers) HandlePutLimits(w http.ResponseWriter, r *http.Request) {
+	if h.limiter == nil {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeRateLimitingOff, "rate limiting is disabled")
+		return
+	}
+	cfg := ratelimit.Config{}
+	if p := problem.Decode(r.Body, &cfg); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeValidationFailed, err.Error())
+		return
+	}
+	// The change is recorded before it applies, so that no change goes
+	// unaudited.
+	if err := h.dbManager.Audit(r.Context(), audit.ActionLimitsUpdate, cfg); err != nil {
+		slog.ErrorContext(r.Context(), "can not audit the change of the rate limits", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not record the change in the audit log")
+		return
+	}
+	if err := h.limiter.SetConfig(cfg); err != nil {
+		slog.ErrorContext(r.Context(), "rate limits audited but not changed", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not change the rate limits")
+		return
+	}
+	slog.InfoContext(r.Context(), "rate limits changed", "by", audit.Actor(r.Context()))
+	writeJSON(w, r, http.StatusOK, h.limiter.Config())
+}
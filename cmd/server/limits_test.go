@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/config"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func tradeJSON(account string) string {
+	return `{"account":"` + account + `","symbol":"EURUSD","volume":1.0,"open":1.1000,"close":1.1050,"side":"buy"}`
+}
+
+func TestLimits_RateLimitAndBackpressure(t *testing.T) {
+	srv, _ := newAuthServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		statusCode int
+		retryAfter bool
+	}{
+		{name: "no limits by default", method: http.MethodPost, path: "/trades", body: tradeJSON("123"), statusCode: http.StatusOK},
+		{name: "invalid limits", method: http.MethodPut, path: "/admin/limits", body: `{"account":{"rate":1,"burst":0}}`, statusCode: http.StatusBadRequest},
+		{name: "set account limit", method: http.MethodPut, path: "/admin/limits", body: `{"account":{"rate":0.001,"burst":2},"accounts":{"vip":{"rate":0}}}`, statusCode: http.StatusOK},
+		{name: "first of burst", method: http.MethodPost, path: "/trades", body: tradeJSON("123"), statusCode: http.StatusOK},
+		{name: "second of burst", method: http.MethodPost, path: "/trades", body: tradeJSON("123"), statusCode: http.StatusOK},
+		{name: "over the limit", method: http.MethodPost, path: "/trades", body: tradeJSON("123"), statusCode: http.StatusTooManyRequests, retryAfter: true},
+		{name: "other account has its own bucket", method: http.MethodPost, path: "/trades", body: tradeJSON("456"), statusCode: http.StatusOK},
+		{name: "override without limit", method: http.MethodPost, path: "/trades", body: tradeJSON("vip"), statusCode: http.StatusOK},
+		{name: "enable backpressure", method: http.MethodPut, path: "/admin/limits", body: `{"max_pending":6}`, statusCode: http.StatusOK},
+		{name: "below threshold", method: http.MethodPost, path: "/trades", body: tradeJSON("123"), statusCode: http.StatusOK},
+		{name: "queue full", method: http.MethodPost, path: "/trades", body: tradeJSON("123"), statusCode: http.StatusServiceUnavailable, retryAfter: true},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		res := doRequest(t, test.method, srv.URL+test.path, testAdminKey, test.body)
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		if test.retryAfter {
+			if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err != nil || secs < 1 {
+				t.Fatalf("Retry-After = %q", res.Header.Get("Retry-After"))
+			}
+		}
+		if test.statusCode == http.StatusTooManyRequests &&
+			(res.Header.Get("X-RateLimit-Limit") != "2" || res.Header.Get("X-RateLimit-Remaining") != "0") {
+			t.Fatalf("rate limit headers = %v", res.Header)
+		}
+	}
+}
+
+func TestPutLimits_AuditFirst(t *testing.T) {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	dbManager := &dbmanager.Manager{}
+	if err = dbManager.InitDbManager(conn); err != nil {
+		t.Fatalf("init db manager: %v", err)
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	limiter, err := ratelimit.New(ratelimit.Config{})
+	if err != nil {
+		t.Fatalf("new limiter: %v", err)
+	}
+	hs := Handlers{dbManager: dbManager, limiter: limiter}
+
+	tests := []struct {
+		name string
+		// readOnly makes the audit entry fail.
+		readOnly   bool
+		statusCode int
+		maxPending int
+	}{
+		{name: "audit fails", readOnly: true, statusCode: http.StatusInternalServerError},
+		{name: "audited", statusCode: http.StatusOK, maxPending: 6},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if _, err = conn.Exec(fmt.Sprintf("PRAGMA query_only = %t", test.readOnly)); err != nil {
+			t.Fatalf("set query_only: %v", err)
+		}
+		rec := httptest.NewRecorder()
+		hs.HandlePutLimits(rec, httptest.NewRequest(http.MethodPut, "/admin/limits", strings.NewReader(`{"max_pending":6}`)))
+		if rec.Code != test.statusCode {
+			t.Errorf("status = %d; want %d: %s", rec.Code, test.statusCode, rec.Body)
+		}
+		if got := limiter.Config().MaxPending; got != test.maxPending {
+			t.Errorf("max_pending = %d; want %d", got, test.maxPending)
+		}
+	}
+}
+
+func TestReloadLimits(t *testing.T) {
+	cur := ratelimit.Config{
+		Key:      ratelimit.Limit{Rate: 1, Burst: 1},
+		Accounts: map[string]ratelimit.Limit{"vip": {Rate: 0}},
+	}
+	next := reloadLimits(cur, config.Limits{KeyRate: 5, KeyBurst: 10, AccountBurst: 1, MaxPending: 100})
+	if next.Key != (ratelimit.Limit{Rate: 5, Burst: 10}) || next.MaxPending != 100 {
+		t.Errorf("limits = %+v; want those of the configuration", next)
+	}
+	if _, ok := next.Accounts["vip"]; !ok {
+		t.Errorf("overrides = %v; want the vip override kept", next.Accounts)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build load
+
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+var (
+	loadRate     = flag.Float64("load-rate", 2000, "trades per second TestPostTrades_Rate posts")
+	loadDuration = flag.Duration("load-duration", 5*time.Second, "how long TestPostTrades_Rate posts trades")
+	loadClients  = flag.Int("load-clients", 64, "concurrent clients of TestPostTrades_Rate")
+)
+
+// TestPostTrades_Rate posts trades at -load-rate for -load-duration while
+// the worker drains the queue, and fails unless both the posts and the
+// worker keep up with at least 95% of the rate without a single error.
+// It needs a machine comparable to production, so it only builds with the
+// load tag: go test -tags load -run Rate ./cmd/server
+func TestPostTrades_Rate(t *testing.T) {
+	trades := int(*loadRate * loadDuration.Seconds())
+	posted, drained := postTradesUnderLoad(t, trades, *loadClients, *loadRate)
+	ingested, processed := float64(trades)/posted.Seconds(), float64(trades)/drained.Seconds()
+	t.Logf("%d trades posted in %s, %.0f trades/sec; drained in %s, %.0f trades/sec",
+		trades, posted, ingested, drained, processed)
+	if want := 0.95 * *loadRate; ingested < want || processed < want {
+		t.Errorf("posted %.0f and processed %.0f trades/sec; want at least %.0f", ingested, processed, want)
+	}
+}
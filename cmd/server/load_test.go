@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	"gitlab.com/digineat/go-broker-test/internal/config"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/ratelimit"
+	"gitlab.com/digineat/go-broker-test/internal/worker"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openLoadManager opens path with the default database settings, as the
+// server and the worker do.
+func openLoadManager(tb testing.TB, path string) *dbmanager.Manager {
+	cfg := config.Default().DB
+	cfg.DSN = path
+	m := &dbmanager.Manager{}
+	conns, err := cfg.Open(m)
+	if err != nil {
+		tb.Fatalf("open db: %v", err)
+	}
+	tb.Cleanup(func() { conns.Close() })
+	return m
+}
+
+// postTradesUnderLoad posts trades to the handlers from clients goroutines,
+// at rate trades per second or as fast as they go when rate is 0, while the
+// worker's ProcessNext drains the queue. It returns how long the posts took
+// and how long it took until the worker had processed all of them. Any
+// failed request or worker error, including one that found the database
+// busy, fails tb.
+func postTradesUnderLoad(tb testing.TB, trades, clients int, rate float64) (posted, drained time.Duration) {
+	path := filepath.Join(tb.TempDir(), "data.db")
+	server := openLoadManager(tb, path)
+	if err := server.CreateTablesIfNeed(); err != nil {
+		tb.Fatalf("create tables: %v", err)
+	}
+	workerDB := openLoadManager(tb, path)
+
+	limiter, err := ratelimit.New(ratelimit.Config{})
+	if err != nil {
+		tb.Fatalf("new limiter: %v", err)
+	}
+	hs := Handlers{dbManager: server, limiter: limiter}
+	mux := http.NewServeMux()
+	hs.Register(mux, &auth.Guard{})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var errs []error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+
+	start := time.Now()
+	submitted := make(chan struct{})
+	done := make(chan struct{})
+	processed := 0
+	go func() {
+		defer close(done)
+		for {
+			// the queue is only known to be drained when it was found empty
+			// after the last trade was submitted
+			select {
+			case <-submitted:
+				submitted = nil
+			default:
+			}
+			trade, err := worker.ProcessNext(workerDB, clock.System{})
+			if err != nil {
+				fail(fmt.Errorf("worker: %w", err))
+				return
+			}
+			if trade != nil {
+				processed++
+				continue
+			}
+			if submitted == nil {
+				drained = time.Since(start)
+				return
+			}
+			select {
+			case <-submitted:
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				res, err := http.Post(srv.URL+"/trades", "application/json", strings.NewReader(tradeJSON(strconv.Itoa(100+i%10))))
+				if err != nil {
+					fail(err)
+					continue
+				}
+				body, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					fail(fmt.Errorf("POST /trades = %d: %s", res.StatusCode, body))
+				}
+			}
+		}()
+	}
+	for i := range trades {
+		if rate > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(float64(i) / rate * float64(time.Second)))))
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	posted = time.Since(start)
+	close(submitted)
+	<-done
+
+	if err := errors.Join(errs...); err != nil {
+		tb.Fatalf("errors under load: %v", err)
+	}
+	if processed != trades {
+		tb.Fatalf("worker processed %d trades; want %d", processed, trades)
+	}
+	return posted, drained
+}
+
+func TestPostTrades_Load(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	const trades = 1000
+	posted, drained := postTradesUnderLoad(t, trades, 8, 0)
+	t.Logf("%d trades posted in %s, %.0f trades/sec, drained in %s", trades, posted, trades/posted.Seconds(), drained)
+}
+
+func BenchmarkPostTrades(b *testing.B) {
+	b.ReportAllocs()
+	posted, _ := postTradesUnderLoad(b, b.N, 8, 0)
+	b.ReportMetric(float64(b.N)/posted.Seconds(), "trades/sec")
+}
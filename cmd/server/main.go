@@ -1,80 +1,387 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"github.com/go-playground/validator/v10"
 	_ "github.com/mattn/go-sqlite3"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	"gitlab.com/digineat/go-broker-test/internal/calendar"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	"gitlab.com/digineat/go-broker-test/internal/config"
 	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/logging"
 	"gitlab.com/digineat/go-broker-test/internal/model"
-	"log"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/ratelimit"
+	"gitlab.com/digineat/go-broker-test/internal/tlsconfig"
+	"gitlab.com/digineat/go-broker-test/internal/tracing"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata"
 )
 
 func main() {
+	// Command line flags
+	settings := config.Bind(flag.CommandLine, "server", "db", "trading", "limits", "log")
+	traceExporter := flag.String("trace-exporter", tracing.ExporterNone, "trace exporter: none, stdout or otlp")
+	traceEndpoint := flag.String("trace-endpoint", "", "OTLP/HTTP collector endpoint (host:port)")
+	traceInsecure := flag.Bool("trace-insecure", false, "disable TLS for the OTLP exporter")
+	traceFile := flag.String("trace-file", "", "file for the stdout trace exporter (default stdout)")
+	traceSample := flag.Float64("trace-sample-ratio", 1, "fraction of traces to sample")
+	authMode := flag.String("auth", authNone, "authentication: none, or a comma separated list of apikey, jwt and mtls")
+	adminKey := flag.String("admin-key", os.Getenv("BROKER_ADMIN_KEY"), "bootstrap admin API key (<id>.<secret>)")
+	jwksSource := flag.String("jwks", "", "JWKS file path or http(s) URL used to verify bearer tokens")
+	jwksTTL := flag.Duration("jwks-cache-ttl", 10*time.Minute, "how long fetched JWKS keys are cached")
+	jwtIssuer := flag.String("jwt-issuer", "", "required iss claim of bearer tokens")
+	jwtAudience := flag.String("jwt-audience", "", "required aud claim of bearer tokens")
+	jwtScopes := flag.String("jwt-scopes-claim", "scope", "claim holding the granted scopes")
+	jwtAccounts := flag.String("jwt-accounts-claim", "accounts", "claim holding the allowed accounts")
+	jwtLeeway := flag.Duration("jwt-leeway", 30*time.Second, "clock skew tolerated for exp and nbf")
+	certGrants := flag.String("client-cert-grants", "", "JSON file granting scopes and accounts to client certificate subjects")
+	rulesPath := flag.String("rules", "", "JSON file with trade validation rules per account group")
+	calendarPath := flag.String("calendar", "", "JSON file with market sessions and holidays")
+	clockSkew := flag.Duration("clock-skew", 5*time.Second, "how far open_time and close_time may be ahead of the server clock")
+	autoCreateAccounts := flag.Bool("auto-create-accounts", true, "create unknown accounts on their first trade instead of rejecting the trade")
+	grpcAddr := flag.String("grpc-listen", "", "gRPC server listen address, e.g. :9090 (empty disables the gRPC server)")
+	grpcWatchInterval := flag.Duration("grpc-watch-interval", time.Second, "how often WatchAccountStats looks for changed stats")
+	printConfig := parseArgs(os.Args[1:])
 
-	//log.SetOutput(os.Stdout)
-	//
-	//// настраиваем префикс и флаги: время + файл:строка
-	//log.SetFlags(log.LstdFlags | log.Lshortfile)
-	//log.SetPrefix("[MYAPP] ")
+	cfg, err := settings.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		os.Exit(2)
+	}
+	if printConfig {
+		settings.Print(os.Stdout, cfg)
+		return
+	}
 
-	// Command line flags
-	dbPath := flag.String("db", "data.db", "path to SQLite database")
-	listenAddr := flag.String("listen", "8080", "HTTP server listen address")
-	flag.Parse()
+	var logLevel slog.LevelVar
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logLevel.Set(level)
+	logger, err := logging.NewLeveled(os.Stderr, &logLevel, cfg.Log.Format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	model.Lot = cfg.Trading.LotSize
 
-	// Initialize database connection
-	db, err := sql.Open("sqlite3", *dbPath)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: "broker-server",
+		Exporter:    *traceExporter,
+		Endpoint:    *traceEndpoint,
+		Insecure:    *traceInsecure,
+		File:        *traceFile,
+		SampleRatio: *traceSample,
+	})
 	if err != nil {
-		log.Fatalf("Failed to open database connection: %v", err)
+		fatal("can not set up tracing", err)
 	}
-	defer func(db *sql.DB) {
-		err = db.Close()
-		if err != nil {
-			log.Fatalf("Failed to close database connection: %v", err)
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	// Initialize database connections
+	dbManager := dbmanager.Manager{}
+	conns, err := cfg.DB.Open(&dbManager)
+	if err != nil {
+		fatal("failed to open database connection", err)
+	}
+	defer func() {
+		if err := conns.Close(); err != nil {
+			slog.Error("failed to close database connection", "error", err)
 		}
-	}(db)
+	}()
 
 	// Test database connection
-	if err = db.Ping(); err != nil {
-		log.Fatalf("Failed to ping database: %v", err)
+	if err = conns.Ping(); err != nil {
+		fatal("failed to ping database", err)
 	}
 
-	dbManager := dbmanager.Manager{}
-	err = dbManager.InitDbManager(db)
+	err = dbManager.CreateTablesIfNeed()
 	if err != nil {
-		log.Fatalf("Can not init DB manager: %v", err)
-		return
+		fatal("can not create tables", err)
 	}
-	err = dbManager.CreateTablesIfNeed()
+	limiter, err := ratelimit.New(cfg.Limits.RateLimit())
 	if err != nil {
-		log.Fatalf("Can not init DB manager: %v", err)
-		return
+		fatal("invalid rate limits", err)
+	}
+	hs := Handlers{
+		dbManager:  &dbManager,
+		limiter:    limiter,
+		queueDepth: ratelimit.NewDepthGauge(dbManager.CountPendingTrades, 250*time.Millisecond),
+		clock:      clock.System{},
+		clockSkew:  *clockSkew,
+
+		requireAccounts: !*autoCreateAccounts,
+		readyMaxPending: cfg.Server.ReadyMaxPending,
+	}
+	dbManager.SetClock(hs.clock)
+	deps := validation.Deps{Quotes: &dbManager, Now: hs.now, Accounts: &dbManager}
+	if *calendarPath != "" {
+		hs.calendar, err = calendar.Load(*calendarPath)
+		if err != nil {
+			fatal("can not load trading calendar", err)
+		}
+		deps.Calendar = hs.calendar
+		slog.Info("trading calendar loaded", "path", *calendarPath)
+	}
+	if *rulesPath != "" {
+		hs.rules, err = validation.Load(*rulesPath, deps)
+		if err != nil {
+			fatal("can not load trade rules", err)
+		}
+		slog.Info("trade rules loaded", "path", *rulesPath)
+	}
+
+	guard := &auth.Guard{}
+	if *authMode == authNone {
+		slog.Warn("authentication is disabled")
+	} else {
+		var chain auth.Chain
+		for _, mode := range strings.Split(*authMode, ",") {
+			switch strings.TrimSpace(mode) {
+			case authApiKey:
+				chain = append(chain, &auth.ApiKeyAuthenticator{Store: &dbManager})
+			case authJWT:
+				if *jwksSource == "" {
+					fatal("invalid auth mode", errors.New("jwt authentication requires --jwks"))
+				}
+				chain = append(chain, auth.NewJWTAuthenticator(auth.NewKeySet(*jwksSource, *jwksTTL), auth.JWTConfig{
+					Issuer:        *jwtIssuer,
+					Audience:      *jwtAudience,
+					ScopesClaim:   *jwtScopes,
+					AccountsClaim: *jwtAccounts,
+					Leeway:        *jwtLeeway,
+				}))
+			case authMTLS:
+				if cfg.Server.TLSClientCA == "" || *certGrants == "" {
+					fatal("invalid auth mode", errors.New("mtls authentication requires --tls-client-ca and --client-cert-grants"))
+				}
+				certAuth, err := auth.LoadCertGrants(*certGrants)
+				if err != nil {
+					fatal("can not load client certificate grants", err)
+				}
+				chain = append(chain, certAuth)
+			default:
+				fatal("invalid auth mode", fmt.Errorf("unknown mode %q", mode))
+			}
+		}
+		guard.Authn = chain
+		if *adminKey != "" {
+			if err = bootstrapAdminKey(context.Background(), &dbManager, *adminKey); err != nil {
+				fatal("can not register bootstrap admin key", err)
+			}
+		}
 	}
-	hs := Handlers{dbManager: &dbManager}
 
 	// Initialize HTTP server
 	mux := http.NewServeMux()
+	hs.Register(mux, guard)
 
-	mux.HandleFunc("POST /trades", hs.HandlePostTrades)
-	mux.HandleFunc("GET /stats/{acc}", hs.HandleGetStats)
-	mux.HandleFunc("GET /healthz", hs.HandleGetHealth)
+	// the gRPC server shares the certificates of the HTTPS server, so that
+	// it never serves plaintext when HTTP requires TLS
+	var tlsConfig *tls.Config
+	if cfg.Server.TLSCert != "" {
+		certs, err := tlsconfig.New(tlsconfig.Files{
+			Cert:       cfg.Server.TLSCert,
+			Key:        cfg.Server.TLSKey,
+			ClientCA:   cfg.Server.TLSClientCA,
+			ClientAuth: cfg.Server.TLSClientAuth,
+		})
+		if err != nil {
+			fatal("can not load TLS files", err)
+		}
+		tlsConfig = certs.Config()
+	}
+
+	if *grpcAddr != "" {
+		l, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			fatal("can not listen for gRPC", err)
+		}
+		grpcServer := newGRPCServer(&hs, guard, *grpcWatchInterval, tlsConfig)
+		go func() {
+			slog.Info("starting gRPC server", "addr", l.Addr().String(), "tls", tlsConfig != nil)
+			if err := grpcServer.Serve(l); err != nil {
+				fatal("gRPC server failed", err)
+			}
+		}()
+	}
+
+	go settings.Watch(context.Background(), cfg, func(prev, next *config.Config) {
+		level, _ := logging.ParseLevel(next.Log.Level)
+		logLevel.Set(level)
+		next.DB.Apply(conns.Read)
+		if next.Limits != prev.Limits {
+			if err := limiter.SetConfig(reloadLimits(limiter.Config(), next.Limits)); err != nil {
+				slog.Error("can not apply rate limits", "error", err)
+			}
+		}
+	})
 
 	// Start server
-	serverAddr := fmt.Sprintf(":%s", *listenAddr)
-	log.Printf("Starting server on %s", serverAddr)
-	if err = http.ListenAndServe(serverAddr, mux); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	server := &http.Server{
+		Addr:              cfg.Server.Listen,
+		Handler:           RequestID(Tracing(mux)),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	if tlsConfig == nil {
+		slog.Info("starting server", "addr", server.Addr)
+		err = server.ListenAndServe()
+	} else {
+		server.TLSConfig = tlsConfig
+		slog.Info("starting server", "addr", server.Addr, "tls", true, "client_ca", cfg.Server.TLSClientCA)
+		err = server.ListenAndServeTLS("", "")
+	}
+	if err != nil {
+		fatal("server failed", err)
+	}
+}
+
+// parseArgs parses the command line, which is either just flags or
+// "config print" followed by flags to print the configuration they give
+// instead of starting the server.
+func parseArgs(args []string) (printConfig bool) {
+	if len(args) >= 2 && args[0] == "config" && args[1] == "print" {
+		printConfig, args = true, args[2:]
+	}
+	flag.CommandLine.Parse(args)
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected argument %q; the only command is config print\n", flag.Arg(0))
+		os.Exit(2)
 	}
+	return printConfig
 }
 
+// reloadLimits replaces the default limits of cur with those of the
+// configuration and keeps the overrides set through /admin/limits.
+func reloadLimits(cur ratelimit.Config, limits config.Limits) ratelimit.Config {
+	next := limits.RateLimit()
+	next.Keys, next.Accounts = cur.Keys, cur.Accounts
+	return next
+}
+
+// fatal logs err and terminates the process. Only main may call it.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+var accountPattern = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+const (
+	authNone   = "none"
+	authApiKey = "apikey"
+	authJWT    = "jwt"
+	authMTLS   = "mtls"
+)
+
 type Handlers struct {
-	dbManager *dbmanager.Manager
+	dbManager  *dbmanager.Manager
+	limiter    *ratelimit.Limiter
+	queueDepth *ratelimit.DepthGauge
+	rules      *validation.Engine
+	calendar   *calendar.Calendar
+	// clock stamps received trades and is the "now" of time checks; nil
+	// means the system clock.
+	clock clock.Clock
+	// clockSkew is how far client timestamps may be ahead of clock.
+	clockSkew time.Duration
+	// requireAccounts rejects trades for unknown accounts instead of
+	// creating the accounts on their first trade.
+	requireAccounts bool
+	// writable caches the database check of /readyz.
+	writable writableCheck
+	// readyMaxPending is the queue depth at which /readyz fails; 0 means
+	// the backpressure limit.
+	readyMaxPending int
+}
+
+func (h *Handlers) now() time.Time {
+	if h.clock == nil {
+		return time.Now()
+	}
+	return h.clock.Now()
+}
+
+type route struct {
+	pattern string
+	// scope required by the route; public routes have none
+	scope   string
+	handler http.HandlerFunc
+}
+
+// Routes lists every route of the API. openapi.json must describe exactly
+// these routes, which is checked by the tests.
+func (h *Handlers) Routes() []route {
+	return []route{
+		{pattern: "POST /trades", scope: auth.ScopeTradeWrite, handler: h.HandlePostTrades},
+		{pattern: "GET /trades/{id}", scope: auth.ScopeTradeAmend, handler: h.HandleGetTrade},
+		{pattern: "PATCH /trades/{id}", scope: auth.ScopeTradeAmend, handler: h.HandlePatchTrade},
+		{pattern: "POST /trades/{id}/cancel", scope: auth.ScopeTradeAmend, handler: h.HandlePostCancelTrade},
+		{pattern: "POST /accounts", scope: auth.ScopeAdmin, handler: h.HandlePostAccounts},
+		{pattern: "GET /accounts", scope: auth.ScopeAdmin, handler: h.HandleGetAccounts},
+		{pattern: "GET /accounts/{id}", scope: auth.ScopeAdmin, handler: h.HandleGetAccount},
+		{pattern: "PATCH /accounts/{id}", scope: auth.ScopeAdmin, handler: h.HandlePatchAccount},
+		{pattern: "DELETE /accounts/{id}", scope: auth.ScopeAdmin, handler: h.HandleDeleteAccount},
+		{pattern: "POST /groups", scope: auth.ScopeAdmin, handler: h.HandlePostGroups},
+		{pattern: "GET /groups", scope: auth.ScopeAdmin, handler: h.HandleGetGroups},
+		{pattern: "GET /groups/{id}/stats", scope: auth.ScopeStatsRead, handler: h.HandleGetGroupStats},
+		{pattern: "GET /groups/{id}/rebates", scope: auth.ScopeAdmin, handler: h.HandleGetRebateRates},
+		{pattern: "PUT /groups/{id}/rebates", scope: auth.ScopeAdmin, handler: h.HandlePutRebateRates},
+		{pattern: "GET /rebates/payouts", scope: auth.ScopeAdmin, handler: h.HandleGetRebatePayouts},
+		{pattern: "POST /imports", scope: auth.ScopeAdmin, handler: h.HandlePostImports},
+		{pattern: "GET /imports/{id}", scope: auth.ScopeAdmin, handler: h.HandleGetImport},
+		{pattern: "GET /accounts/{acc}/trades.csv", scope: auth.ScopeStatsRead, handler: h.HandleGetTradesCSV},
+		{pattern: "GET /stats.csv", scope: auth.ScopeStatsRead, handler: h.HandleGetStatsCSV},
+		{pattern: "GET /stats/{acc}", scope: auth.ScopeStatsRead, handler: h.HandleGetStats},
+		{pattern: "GET /healthz", handler: h.HandleGetHealth},
+		{pattern: "GET /readyz", handler: h.HandleGetReady},
+		{pattern: "GET /calendar", handler: h.HandleGetCalendar},
+		{pattern: "GET /calendar/{symbol}", handler: h.HandleGetMarketStatus},
+		{pattern: "GET /openapi.json", handler: HandleGetOpenAPI},
+		{pattern: "GET /docs", handler: HandleGetDocs},
+		{pattern: "POST /admin/keys", scope: auth.ScopeAdmin, handler: h.HandlePostApiKeys},
+		{pattern: "GET /admin/keys", scope: auth.ScopeAdmin, handler: h.HandleGetApiKeys},
+		{pattern: "DELETE /admin/keys/{id}", scope: auth.ScopeAdmin, handler: h.HandleDeleteApiKey},
+		{pattern: "GET /admin/audit", scope: auth.ScopeAdmin, handler: h.HandleGetAudit},
+		{pattern: "GET /admin/limits", scope: auth.ScopeAdmin, handler: h.HandleGetLimits},
+		{pattern: "PUT /admin/limits", scope: auth.ScopeAdmin, handler: h.HandlePutLimits},
+	}
+}
+
+// Register adds all routes to mux. Public routes are never authenticated;
+// the others require their scope when guard is enabled, so that with
+// authentication off accounts, groups and imports can still be managed.
+func (h *Handlers) Register(mux *http.ServeMux, guard *auth.Guard) {
+	for _, rt := range h.Routes() {
+		if rt.scope == "" {
+			mux.HandleFunc(rt.pattern, rt.handler)
+			continue
+		}
+		mux.HandleFunc(rt.pattern, guard.Require(rt.scope, rt.handler))
+	}
 }
 
 func (h *Handlers) HandleGetHealth(w http.ResponseWriter, r *http.Request) {
@@ -82,49 +389,77 @@ func (h *Handlers) HandleGetHealth(w http.ResponseWriter, r *http.Request) {
 	// 2. Return health status
 
 	if r.Method != http.MethodGet {
-		http.Error(w, "Метод не разрешён", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "method "+r.Method+" is not allowed")
 		return
 	}
 	err := h.dbManager.Ping()
 	if err != nil {
 		if errors.Is(err, sql.ErrConnDone) {
-			log.Print("Connection closed")
+			slog.ErrorContext(r.Context(), "database connection closed")
 		} else {
-			log.Print(err.Error())
+			slog.ErrorContext(r.Context(), "database ping failed", "error", err)
 		}
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "database is unreachable")
 		return
 	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("StatusOK"))
-
+	w.Write([]byte("OK"))
 }
 
+// IdempotencyKeyHeader names the key a client sends with POST /trades so
+// that it can retry the request: a trade is enqueued once per key and caller.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyPrefix starts the import key of trades submitted with an
+// idempotency key, followed by the actor and the key.
+const idempotencyPrefix = "idem:"
+
 func (h *Handlers) HandlePostTrades(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != http.MethodPost {
-		http.Error(w, "Метод не разрешён", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "method "+r.Method+" is not allowed")
 		return
 	}
 
+	ctx, span := tracing.Tracer().Start(r.Context(), "HandlePostTrades")
+	defer span.End()
+
 	trade := model.Trade{}
 
-	err := json.NewDecoder(r.Body).Decode(&trade)
-	if err != nil {
-		log.Print(err.Error())
-		http.Error(w, "invalid trade data", http.StatusBadRequest)
+	if p := problem.Decode(r.Body, &trade); p != nil {
+		slog.InfoContext(ctx, "invalid trade payload", "error", p)
+		span.SetStatus(codes.Error, "invalid trade payload")
+		problem.Write(w, r, p)
 		return
 	}
 
-	if err = ValidateTrade(&trade); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		if !validRequestID(key) {
+			problem.Write(w, r, problem.Validation(problem.FieldError{Field: IdempotencyKeyHeader, Rule: "header",
+				Message: IdempotencyKeyHeader + " must be 1 to 128 printable ASCII characters", Value: key}))
+			return
+		}
+		trade.ImportKey = idempotencyPrefix + audit.Actor(ctx) + ":" + key
+
+		stored, p := h.findIdempotent(ctx, &trade)
+		if p != nil {
+			span.SetStatus(codes.Error, p.Detail)
+			problem.Write(w, r, p)
+			return
+		}
+		if stored != nil {
+			slog.InfoContext(ctx, "trade submitted again", "trade_id", stored.Id, "account", stored.Account)
+			span.SetAttributes(attribute.Int("trade.id", stored.Id))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 	}
 
-	err = h.dbManager.CreateTrade(&trade)
-	if err != nil {
-		log.Print(err.Error())
-		http.Error(w, "cant create new trade data", http.StatusInternalServerError)
+	limit, p := h.submitTrade(ctx, &trade)
+	writeLimitHeaders(w, limit, p)
+	if p != nil {
+		problem.Write(w, r, p)
 		return
 	}
 
@@ -132,49 +467,175 @@ func (h *Handlers) HandlePostTrades(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (h *Handlers) HandleGetStats(w http.ResponseWriter, r *http.Request) {
+// findIdempotent returns the trade stored before with the idempotency key of
+// trade, or nil for a new key. A retry is answered like the request that
+// stored the trade, before the checks and limits that could otherwise reject
+// it, e.g. as a duplicate of the trade it retries. The retry must submit the
+// trade as it was first submitted, amendments made since notwithstanding;
+// a key reused for another trade is a conflict. Trades for accounts the
+// caller may not access are left to submitTrade to reject.
+func (h *Handlers) findIdempotent(ctx context.Context, trade *model.Trade) (*model.Trade, *problem.Problem) {
+	if !auth.FromContext(ctx).CanAccess(trade.Account) {
+		return nil, nil
+	}
+	stored, err := h.dbManager.FindTradeByImportKey(ctx, trade.ImportKey)
+	if err == nil && stored != nil && stored.Version > 1 {
+		var versions []model.TradeVersion
+		if versions, err = h.dbManager.ListTradeVersions(ctx, stored.Id); err == nil && len(versions) > 0 {
+			first := versions[0]
+			stored.Symbol, stored.Volume, stored.Open, stored.Close, stored.Side = first.Symbol, first.Volume, first.Open, first.Close, first.Side
+			stored.OpenTime, stored.CloseTime = first.OpenTime, first.CloseTime
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "can not look up idempotency key", "account", trade.Account, "error", err)
+		return nil, problem.New(http.StatusInternalServerError, problem.CodeInternal, "can not look up idempotency key")
+	}
+	if stored == nil {
+		return nil, nil
+	}
+	if !sameSubmission(stored, trade) {
+		slog.InfoContext(ctx, "idempotency key reused", "trade_id", stored.Id, "account", trade.Account)
+		return nil, problem.New(http.StatusConflict, problem.CodeConflict,
+			IdempotencyKeyHeader+" was used before with a different trade")
+	}
+	return stored, nil
+}
 
-	if r.Method != http.MethodGet {
-		http.Error(w, "Метод не разрешён", http.StatusMethodNotAllowed)
-		return
+// sameSubmission reports whether a and b carry the same fields a client
+// submits. Times are compared at the precision they are stored with.
+func sameSubmission(a, b *model.Trade) bool {
+	sameTime := func(x, y *time.Time) bool {
+		if x == nil || y == nil {
+			return x == y
+		}
+		return x.Truncate(time.Millisecond).Equal(y.Truncate(time.Millisecond))
 	}
+	return a.Account == b.Account && a.Symbol == b.Symbol && a.Side == b.Side &&
+		a.Volume == b.Volume && a.Open == b.Open && a.Close == b.Close &&
+		sameTime(a.OpenTime, b.OpenTime) && sameTime(a.CloseTime, b.CloseTime)
+}
 
-	re, _ := regexp.Compile(`\/{[a-zA-Z0-9]+}$`)
-	accountNo := re.FindString(r.URL.Path)
+// submitTrade checks a decoded trade like POST /trades does and enqueues
+// it. It returns the rejection, if any, and the rate limit result for the
+// response. Both the HTTP and the gRPC API submit trades through it.
+func (h *Handlers) submitTrade(ctx context.Context, trade *model.Trade) (ratelimit.Result, *problem.Problem) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("trade.account", trade.Account), attribute.String("trade.symbol", trade.Symbol))
+	reject := func(status string, p *problem.Problem) (ratelimit.Result, *problem.Problem) {
+		span.SetStatus(codes.Error, status)
+		return ratelimit.Result{}, p
+	}
 
-	if accountNo == "" {
+	if err := ValidateTrade(trade); err != nil {
+		slog.InfoContext(ctx, "trade validation failed", "account", trade.Account, "error", err)
+		return reject("trade validation failed", problem.FromValidation(err))
+	}
+	now := h.now()
+	if errs := validation.Times(trade, now, h.clockSkew); len(errs) > 0 {
+		slog.InfoContext(ctx, "trade validation failed", "account", trade.Account, "errors", errs)
+		return reject("trade validation failed", problem.Validation(errs...))
+	}
 
-		http.Error(w, "invalid url", http.StatusBadRequest)
-		return
+	if !auth.FromContext(ctx).CanAccess(trade.Account) {
+		slog.InfoContext(ctx, "account not allowed", "account", trade.Account)
+		return reject("account not allowed", problem.New(http.StatusForbidden, problem.CodeForbidden, "account "+trade.Account+" is not allowed"))
+	}
+
+	newAccount, p := h.checkTradeAccount(ctx, trade.Account)
+	if p != nil {
+		return reject("trade rejected for account", p)
+	}
+
+	limit, p := h.allowTrade(ctx, trade.Account)
+	if p != nil {
+		span.SetStatus(codes.Error, "trade rejected by limits")
+		return limit, p
 	}
 
-	account, err := h.dbManager.GetClient(accountNo)
+	violations, err := h.rules.Check(ctx, trade)
 	if err != nil {
-		log.Print(err.Error())
-		http.Error(w, "cant get account data", http.StatusInternalServerError)
-		return
+		slog.ErrorContext(ctx, "can not check trade rules", "account", trade.Account, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "can not check trade rules")
+		return limit, problem.New(http.StatusInternalServerError, problem.CodeInternal, "can not check trade rules")
 	}
-	if account == nil {
-		http.Error(w, "account not found", http.StatusBadRequest)
-		return
+	if len(violations) > 0 {
+		slog.InfoContext(ctx, "trade rejected by rules", "account", trade.Account, "violations", violations)
+		span.SetStatus(codes.Error, "trade rejected by rules")
+		return limit, problem.Validation(violations...)
 	}
 
-	resp, err := json.Marshal(account)
+	var account *model.TradingAccount
+	if newAccount {
+		account = model.NewTradingAccount(trade.Account, now)
+	}
+	trade.RequestId = logging.RequestID(ctx)
+	trade.ReceivedAt = now
+	err = h.dbManager.CreateAccountTrade(ctx, account, trade)
+	if errors.Is(err, dbmanager.ErrDuplicateTrade) {
+		slog.InfoContext(ctx, "trade received again", "account", trade.Account, "import_key", trade.ImportKey)
+		return limit, nil
+	}
 	if err != nil {
-		log.Print(err.Error())
-		http.Error(w, "invalid response", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "can not enqueue trade", "account", trade.Account, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "can not enqueue trade")
+		return limit, problem.New(http.StatusInternalServerError, problem.CodeInternal, "can not enqueue trade")
+	}
+	if newAccount {
+		slog.InfoContext(ctx, "account created on first trade", "account", trade.Account)
+	}
+	h.rules.Record(ctx, trade)
+	span.SetAttributes(attribute.Int("trade.id", trade.Id))
+	slog.InfoContext(ctx, "trade enqueued",
+		"trade_id", trade.Id,
+		"account", trade.Account,
+		"symbol", trade.Symbol,
+		"side", trade.Side,
+		"volume", trade.Volume,
+	)
+	return limit, nil
+}
+
+func (h *Handlers) HandleGetStats(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "method "+r.Method+" is not allowed")
 		return
 	}
 
-	_, err = w.Write(resp)
-	if err != nil {
-		log.Print(err.Error())
-		http.Error(w, "cant create response", http.StatusInternalServerError)
+	account, p := h.accountStats(r.Context(), r.PathValue("acc"))
+	if p != nil {
+		problem.Write(w, r, p)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+
+	writeJSON(w, r, http.StatusOK, account)
+}
+
+// accountStats returns the stats of accountNo, or the problem if the
+// account is invalid, has no stats or the caller may not see it.
+func (h *Handlers) accountStats(ctx context.Context, accountNo string) (*model.Account, *problem.Problem) {
+	if !accountPattern.MatchString(accountNo) {
+		return nil, problem.New(http.StatusBadRequest, problem.CodeInvalidPath, "account must contain only letters and digits")
+	}
+
+	if !auth.FromContext(ctx).CanAccess(accountNo) {
+		return nil, problem.New(http.StatusForbidden, problem.CodeForbidden, "account "+accountNo+" is not allowed")
+	}
+
+	account, err := h.dbManager.GetClient(ctx, accountNo)
+	if err != nil {
+		slog.ErrorContext(ctx, "can not get account", "account", accountNo, "error", err)
+		return nil, problem.New(http.StatusInternalServerError, problem.CodeInternal, "can not get account")
+	}
+	if account == nil {
+		return nil, problem.New(http.StatusNotFound, problem.CodeNotFound, "account "+accountNo+" not found")
+	}
+	return account, nil
 }
 
 func ValidateTrade(t *model.Trade) error {
-	return validator.New().Struct(t)
+	return validation.Struct(t)
 }
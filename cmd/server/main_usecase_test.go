@@ -2,7 +2,10 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -38,10 +41,12 @@ func Test_HandleGetHealth_Request(t *testing.T) {
 		method     string
 		statusCode int
 		disableDb  bool
+		body       string
+		code       string
 	}{
-		{name: "incorrect method", method: http.MethodGet, statusCode: http.StatusOK},
-		{name: "correct method", method: http.MethodPost, statusCode: http.StatusMethodNotAllowed},
-		{name: "db closed on execution", method: http.MethodGet, statusCode: http.StatusInternalServerError, disableDb: true},
+		{name: "incorrect method", method: http.MethodGet, statusCode: http.StatusOK, body: "OK"},
+		{name: "correct method", method: http.MethodPost, statusCode: http.StatusMethodNotAllowed, code: problem.CodeMethodNotAllowed},
+		{name: "db closed on execution", method: http.MethodGet, statusCode: http.StatusInternalServerError, disableDb: true, code: problem.CodeInternal},
 	}
 
 	var db *sql.DB
@@ -72,6 +77,20 @@ func Test_HandleGetHealth_Request(t *testing.T) {
 		if res.StatusCode != test.statusCode {
 			t.Fatalf("ожидался статус %d, получили %d", test.statusCode, res.StatusCode)
 		}
+		if test.body != "" {
+			if body, _ := io.ReadAll(res.Body); string(body) != test.body {
+				t.Errorf("body = %q; want %q", body, test.body)
+			}
+		}
+		if test.code != "" {
+			var p problem.Problem
+			if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if p.Code != test.code {
+				t.Errorf("code = %q; want %q", p.Code, test.code)
+			}
+		}
 		t.Log("--Passed")
 	}
 
@@ -92,6 +111,21 @@ func Test_HandlePostTrades(t *testing.T) {
 		{name: "empty json", method: http.MethodPost,
 			reqJson:    ``,
 			statusCode: http.StatusBadRequest},
+		{name: "empty object", method: http.MethodPost,
+			reqJson:    `{}`,
+			statusCode: http.StatusBadRequest},
+		{name: "empty account", method: http.MethodPost,
+			reqJson:    `{"account":"","symbol":"EURUSD","volume":1.0,"open":1.1000,"close":1.1050,"side":"buy"}`,
+			statusCode: http.StatusBadRequest},
+		{name: "short symbol", method: http.MethodPost,
+			reqJson:    `{"account":"123","symbol":"EURUS","volume":1.0,"open":1.1000,"close":1.1050,"side":"buy"}`,
+			statusCode: http.StatusBadRequest},
+		{name: "zero volume", method: http.MethodPost,
+			reqJson:    `{"account":"123","symbol":"EURUSD","volume":0,"open":1.1000,"close":1.1050,"side":"buy"}`,
+			statusCode: http.StatusBadRequest},
+		{name: "unknown side", method: http.MethodPost,
+			reqJson:    `{"account":"123","symbol":"EURUSD","volume":1.0,"open":1.1000,"close":1.1050,"side":"hold"}`,
+			statusCode: http.StatusBadRequest},
 		{name: "invalid json", method: http.MethodPost,
 			reqJson:    `{"account":"123","symbol":"EURUSD","volume"<invalid_here>1.0,"open":1.1000,"close":1.1050,"side":"buy"}`,
 			statusCode: http.StatusBadRequest},
@@ -141,7 +175,31 @@ func Test_HandlePostTrades(t *testing.T) {
 }
 
 func Test_HandleGetStats(t *testing.T) {
-	//TODO implement
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		statusCode int
+	}{
+		{name: "incorrect method", method: http.MethodPost, path: "/stats/123", statusCode: http.StatusMethodNotAllowed},
+		{name: "without account", method: http.MethodGet, path: "/stats/", statusCode: http.StatusBadRequest},
+	}
+
+	hs := Handlers{dbManager: &dbmanager.Manager{}}
+	for _, test := range tests {
+		t.Log(test.name)
+		req := httptest.NewRequest(test.method, test.path, nil)
+		wrec := httptest.NewRecorder()
+
+		hs.HandleGetStats(wrec, req)
+		res := wrec.Result()
+		defer res.Body.Close()
+
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("ожидался статус %d, получили %d", test.statusCode, res.StatusCode)
+		}
+		t.Log("--Passed")
+	}
 }
 
 func initDb() *sql.DB {
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/logging"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newMemoryManager(t *testing.T) *dbmanager.Manager {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	dbManager := &dbmanager.Manager{}
+	if err = dbManager.InitDbManager(db); err != nil {
+		t.Fatalf("init db manager: %v", err)
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	return dbManager
+}
+
+func claimTrade(t *testing.T, dbManager *dbmanager.Manager) *model.Trade {
+	tx, err := dbManager.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	defer tx.Rollback()
+	trade, err := dbManager.GetTrade(t.Context(), tx, time.Now())
+	if err != nil || trade == nil {
+		t.Fatalf("GetTrade = %v, %v", trade, err)
+	}
+	return trade
+}
+
+func TestRequestID_PropagatedToTrade(t *testing.T) {
+	dbManager := newMemoryManager(t)
+	hs := Handlers{dbManager: dbManager}
+	handler := RequestID(http.HandlerFunc(hs.HandlePostTrades))
+
+	body := `{"account":"123","symbol":"EURUSD","volume":1.0,"open":1.1000,"close":1.1050,"side":"buy"}`
+	req := httptest.NewRequest(http.MethodPost, "/trades", strings.NewReader(body))
+	req.Header.Set(RequestIDHeader, "client-req-42")
+	wrec := httptest.NewRecorder()
+	handler.ServeHTTP(wrec, req)
+
+	if wrec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", wrec.Code, http.StatusOK)
+	}
+	if got := wrec.Header().Get(RequestIDHeader); got != "client-req-42" {
+		t.Errorf("response %s = %q; want client-req-42", RequestIDHeader, got)
+	}
+
+	trade := claimTrade(t, dbManager)
+	if trade.RequestId != "client-req-42" {
+		t.Errorf("trade request id = %q; want client-req-42", trade.RequestId)
+	}
+}
+
+func TestRequestID_Generated(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "missing header"},
+		{name: "control characters", header: "bad\tid"},
+		{name: "too long", header: strings.Repeat("a", maxRequestIDLen+1)},
+	}
+
+	for _, test := range tests {
+		t.Log(test.name)
+		var seen string
+		handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = logging.RequestID(r.Context())
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		if test.header != "" {
+			req.Header.Set(RequestIDHeader, test.header)
+		}
+		wrec := httptest.NewRecorder()
+		handler.ServeHTTP(wrec, req)
+
+		got := wrec.Header().Get(RequestIDHeader)
+		if got == "" || got == test.header || got != seen {
+			t.Fatalf("request id header %q, context %q", got, seen)
+		}
+	}
+}
+
+func TestTracing_TraceContextStoredWithTrade(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	dbManager := newMemoryManager(t)
+	hs := Handlers{dbManager: dbManager}
+	mux := http.NewServeMux()
+	hs.Register(mux, &auth.Guard{})
+	handler := RequestID(Tracing(mux))
+
+	const callerTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	body := `{"account":"123","symbol":"EURUSD","volume":1.0,"open":1.1000,"close":1.1050,"side":"buy"}`
+	req := httptest.NewRequest(http.MethodPost, "/trades", strings.NewReader(body))
+	req.Header.Set(tracing.TraceParentHeader, "00-"+callerTrace+"-00f067aa0ba902b7-01")
+	wrec := httptest.NewRecorder()
+	handler.ServeHTTP(wrec, req)
+	if wrec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", wrec.Code, http.StatusOK)
+	}
+
+	names := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		names[span.Name()] = true
+		if got := span.SpanContext().TraceID().String(); got != callerTrace {
+			t.Errorf("span %s trace id = %s; want %s", span.Name(), got, callerTrace)
+		}
+	}
+	for _, name := range []string{"POST /trades", "HandlePostTrades", "db.insert " + dbmanager.Trades_table} {
+		if !names[name] {
+			t.Errorf("span %q not recorded; got %v", name, names)
+		}
+	}
+
+	// spans are named by route, with the path as an attribute
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/trades/1", nil))
+	spans := recorder.Ended()
+	last := spans[len(spans)-1]
+	attrs := map[string]string{}
+	for _, kv := range last.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if last.Name() != "GET /trades/{id}" || attrs["url.path"] != "/trades/1" || attrs["http.route"] != "/trades/{id}" {
+		t.Errorf("span %q with %v; want GET /trades/{id} for /trades/1", last.Name(), attrs)
+	}
+
+	trade := claimTrade(t, dbManager)
+	if !strings.HasPrefix(trade.TraceParent, "00-"+callerTrace+"-") {
+		t.Errorf("stored traceparent = %q; want trace %s", trade.TraceParent, callerTrace)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/openapi"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadSpec(t *testing.T) *openapi.Document {
+	doc, err := openapi.Load(openAPISpec)
+	if err != nil {
+		t.Fatalf("load openapi.json: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPI_DescribesEveryRoute(t *testing.T) {
+	doc := loadSpec(t)
+	hs := Handlers{}
+
+	var patterns []string
+	for _, rt := range hs.Routes() {
+		patterns = append(patterns, rt.pattern)
+
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		op, ok := doc.Operation(method, path)
+		if !ok {
+			t.Errorf("route %s is not documented", rt.pattern)
+			continue
+		}
+		if op.Scope != rt.scope {
+			t.Errorf("%s: documented scope %q; handler requires %q", rt.pattern, op.Scope, rt.scope)
+		}
+		if (rt.scope != "") != (len(op.Security) > 0) {
+			t.Errorf("%s: documented security %v does not match scope %q", rt.pattern, op.Security, rt.scope)
+		}
+	}
+	sort.Strings(patterns)
+	if ops := doc.Operations(); !slices.Equal(ops, patterns) {
+		t.Errorf("documented operations %v; routes %v", ops, patterns)
+	}
+}
+
+func TestOpenAPI_ResponsesMatchSpec(t *testing.T) {
+	doc := loadSpec(t)
+	srv, dbManager := newAuthServer(t)
+
+	tx, err := dbManager.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	if err = dbManager.UpdateAccount(t.Context(), tx, "123", 500); err != nil {
+		t.Fatalf("update account: %v", err)
+	}
+	if err = dbManager.CommitTx(tx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		specPath   string
+		key        string
+		body       string
+		statusCode int
+	}{
+		{name: "post trade", method: http.MethodPost, path: "/trades", key: testAdminKey, body: tradeJSON("123"), statusCode: http.StatusOK},
+		{name: "post invalid trade", method: http.MethodPost, path: "/trades", key: testAdminKey, body: `{"account":"123"}`, statusCode: http.StatusBadRequest},
+		{name: "post trade with unknown field", method: http.MethodPost, path: "/trades", key: testAdminKey, body: `{"account":"123","colour":"red"}`, statusCode: http.StatusBadRequest},
+		{name: "post trade with trailing data", method: http.MethodPost, path: "/trades", key: testAdminKey, body: tradeJSON("123") + "{}", statusCode: http.StatusBadRequest},
+		{name: "post trade with lowercase symbol", method: http.MethodPost, path: "/trades", key: testAdminKey, body: `{"account":"123","symbol":"eurusd","volume":1,"open":1.1,"close":1.2,"side":"buy"}`, statusCode: http.StatusBadRequest},
+		{name: "post trade unauthenticated", method: http.MethodPost, path: "/trades", body: tradeJSON("123"), statusCode: http.StatusUnauthorized},
+		{name: "stats", method: http.MethodGet, path: "/stats/123", specPath: "/stats/{acc}", key: testAdminKey, statusCode: http.StatusOK},
+		{name: "stats unknown account", method: http.MethodGet, path: "/stats/999", specPath: "/stats/{acc}", key: testAdminKey, statusCode: http.StatusNotFound},
+		{name: "stats invalid account", method: http.MethodGet, path: "/stats/a-b", specPath: "/stats/{acc}", key: testAdminKey, statusCode: http.StatusBadRequest},
+		{name: "healthz", method: http.MethodGet, path: "/healthz", statusCode: http.StatusOK},
+		{name: "readyz", method: http.MethodGet, path: "/readyz", statusCode: http.StatusOK},
+		{name: "openapi", method: http.MethodGet, path: "/openapi.json", statusCode: http.StatusOK},
+		{name: "docs", method: http.MethodGet, path: "/docs", statusCode: http.StatusOK},
+		{name: "issue key", method: http.MethodPost, path: "/admin/keys", key: testAdminKey, body: `{"name":"x","scopes":["stats:read"],"accounts":["123"]}`, statusCode: http.StatusCreated},
+		{name: "issue invalid key", method: http.MethodPost, path: "/admin/keys", key: testAdminKey, body: `{"name":"x"}`, statusCode: http.StatusBadRequest},
+		{name: "list keys", method: http.MethodGet, path: "/admin/keys", key: testAdminKey, statusCode: http.StatusOK},
+		{name: "export audit", method: http.MethodGet, path: "/admin/audit?limit=2", specPath: "/admin/audit", key: testAdminKey, statusCode: http.StatusOK},
+		{name: "export audit invalid range", method: http.MethodGet, path: "/admin/audit?from=0", specPath: "/admin/audit", key: testAdminKey, statusCode: http.StatusBadRequest},
+		{name: "revoke unknown key", method: http.MethodDelete, path: "/admin/keys/nope", specPath: "/admin/keys/{id}", key: testAdminKey, statusCode: http.StatusNotFound},
+		{name: "revoke bootstrap key", method: http.MethodDelete, path: "/admin/keys/0123456789abcdef", specPath: "/admin/keys/{id}", key: testAdminKey, statusCode: http.StatusNoContent},
+		{name: "get limits with revoked key", method: http.MethodGet, path: "/admin/limits", key: testAdminKey, statusCode: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		res := doRequest(t, test.method, srv.URL+test.path, test.key, test.body)
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		specPath := test.specPath
+		if specPath == "" {
+			specPath = test.path
+		}
+		if err = doc.ValidateResponse(test.method, specPath, res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+			t.Fatalf("response does not match spec: %v", err)
+		}
+	}
+}
+
+func TestOpenAPI_LimitsMatchSpec(t *testing.T) {
+	doc := loadSpec(t)
+	srv, _ := newAuthServer(t)
+
+	res := doRequest(t, http.MethodPut, srv.URL+"/admin/limits", testAdminKey,
+		`{"key":{"rate":5,"burst":10},"accounts":{"123":{"rate":1,"burst":1}},"max_pending":100}`)
+	body, _ := io.ReadAll(res.Body)
+	if err := doc.ValidateResponse(http.MethodPut, "/admin/limits", res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+		t.Fatalf("PUT /admin/limits: %v", err)
+	}
+
+	res = doRequest(t, http.MethodGet, srv.URL+"/admin/limits", testAdminKey, "")
+	body, _ = io.ReadAll(res.Body)
+	if err := doc.ValidateResponse(http.MethodGet, "/admin/limits", res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+		t.Fatalf("GET /admin/limits: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		res = doRequest(t, http.MethodPost, srv.URL+"/trades", testAdminKey, tradeJSON("123"))
+	}
+	body, _ = io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %d; want %d", res.StatusCode, http.StatusTooManyRequests)
+	}
+	if err := doc.ValidateResponse(http.MethodPost, "/trades", res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+		t.Fatalf("POST /trades 429: %v", err)
+	}
+}
+
+func TestOpenAPI_ErrorCodes(t *testing.T) {
+	doc := loadSpec(t)
+	var codes []string
+	for _, code := range doc.Components.Schemas["Problem"].Properties["code"].Enum {
+		codes = append(codes, code.(string))
+	}
+	want := slices.Clone(problem.Codes)
+	sort.Strings(codes)
+	sort.Strings(want)
+	if !slices.Equal(codes, want) {
+		t.Errorf("documented error codes %v; want %v", codes, want)
+	}
+}
+
+func TestPostTrades_FieldErrors(t *testing.T) {
+	srv, _ := newAuthServer(t)
+
+	res := doRequest(t, http.MethodPost, srv.URL+"/trades", testAdminKey,
+		`{"account":"12-3","symbol":"EURUSD","volume":0,"open":1.1,"close":1.2,"side":"hold"}`)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d; want %d", res.StatusCode, http.StatusBadRequest)
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	if p.Code != problem.CodeValidationFailed || p.Instance != "/trades" {
+		t.Errorf("problem = %+v", p)
+	}
+	want := []problem.FieldError{
+		{Field: "account", Rule: "alphanum", Message: "account must contain only letters and digits", Value: "12-3"},
+		{Field: "volume", Rule: "gt", Message: "volume must be greater than 0", Value: float64(0)},
+		{Field: "side", Rule: "oneof", Message: "side must be one of buy, sell", Value: "hold"},
+	}
+	if !slices.Equal(p.Errors, want) {
+		t.Errorf("errors = %+v; want %+v", p.Errors, want)
+	}
+}
+
+func TestPostTrades_Rules(t *testing.T) {
+	doc := loadSpec(t)
+	dbManager := newMemoryManager(t)
+	rules, err := validation.Parse([]byte(`{"default":"all","groups":{"all":{"rules":[
+		{"rule":"max_volume","default":5},
+		{"rule":"duplicate","window":"1m"}]}}}`), validation.Deps{Quotes: dbManager})
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	hs := Handlers{dbManager: dbManager, rules: rules}
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		rule       string
+	}{
+		{name: "accepted", body: tradeJSON("123"), statusCode: http.StatusOK},
+		{name: "duplicate", body: tradeJSON("123"), statusCode: http.StatusBadRequest, rule: validation.RuleDuplicate},
+		{name: "too large", body: `{"account":"123","symbol":"EURUSD","volume":6,"open":1.1,"close":1.2,"side":"buy"}`,
+			statusCode: http.StatusBadRequest, rule: validation.RuleMaxVolume},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		rec := httptest.NewRecorder()
+		hs.HandlePostTrades(rec, httptest.NewRequest(http.MethodPost, "/trades", strings.NewReader(test.body)))
+		res := rec.Result()
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if err = doc.ValidateResponse(http.MethodPost, "/trades", res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+			t.Fatalf("response does not match spec: %v", err)
+		}
+		if test.rule == "" {
+			continue
+		}
+		var p problem.Problem
+		if err = json.Unmarshal(body, &p); err != nil {
+			t.Fatalf("decode problem: %v", err)
+		}
+		if len(p.Errors) != 1 || p.Errors[0].Rule != test.rule {
+			t.Errorf("errors = %+v; want rule %s", p.Errors, test.rule)
+		}
+	}
+}
+
+// TestPostTrades_RetryAfterFailure checks that a trade which could not be
+// stored is not taken for a duplicate when the client retries it.
+func TestPostTrades_RetryAfterFailure(t *testing.T) {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	dbManager := &dbmanager.Manager{}
+	if err = dbManager.InitDbManager(conn); err != nil {
+		t.Fatalf("init db manager: %v", err)
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	rules, err := validation.Parse([]byte(`{"default":"all","groups":{"all":{"rules":[{"rule":"duplicate","window":"1m"}]}}}`),
+		validation.Deps{Quotes: dbManager})
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	hs := Handlers{dbManager: dbManager, rules: rules}
+
+	tests := []struct {
+		name string
+		// readOnly makes storing the trade fail.
+		readOnly   bool
+		statusCode int
+	}{
+		{name: "database fails", readOnly: true, statusCode: http.StatusInternalServerError},
+		{name: "retry", statusCode: http.StatusOK},
+		{name: "duplicate of the stored trade", statusCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if _, err = conn.Exec(fmt.Sprintf("PRAGMA query_only = %t", test.readOnly)); err != nil {
+			t.Fatalf("set query_only: %v", err)
+		}
+		rec := httptest.NewRecorder()
+		hs.HandlePostTrades(rec, httptest.NewRequest(http.MethodPost, "/trades", strings.NewReader(tradeJSON("123"))))
+		if rec.Code != test.statusCode {
+			t.Errorf("status = %d; want %d: %s", rec.Code, test.statusCode, rec.Body)
+		}
+	}
+}
+
+func TestPostTrades_Timestamps(t *testing.T) {
+	doc := loadSpec(t)
+	dbManager := newMemoryManager(t)
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	hs := Handlers{dbManager: dbManager, clock: clock.NewFake(now), clockSkew: 5 * time.Second}
+
+	trade := func(openTime, closeTime string) string {
+		return `{"account":"123","symbol":"EURUSD","volume":1,"open":1.1,"close":1.2,"side":"buy",` +
+			`"open_time":"` + openTime + `","close_time":"` + closeTime + `"}`
+	}
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		rules      []string
+	}{
+		{name: "accepted", body: trade("2025-06-02T09:30:00.125Z", "2025-06-02T11:59:59.999Z"), statusCode: http.StatusOK},
+		{name: "within skew", body: trade("2025-06-02T09:30:00.000Z", "2025-06-02T12:00:04.000Z"), statusCode: http.StatusOK},
+		{name: "close in future", body: trade("2025-06-02T09:30:00.000Z", "2025-06-02T12:00:06.000Z"),
+			statusCode: http.StatusBadRequest, rules: []string{validation.RuleNotFuture}},
+		{name: "close before open", body: trade("2025-06-02T09:30:00.000Z", "2025-06-02T09:29:59.999Z"),
+			statusCode: http.StatusBadRequest, rules: []string{validation.RuleAfterOpen}},
+		{name: "not a date-time", body: trade("yesterday", "2025-06-02T09:29:59.999Z"),
+			statusCode: http.StatusBadRequest, rules: []string{"datetime"}},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		rec := httptest.NewRecorder()
+		hs.HandlePostTrades(rec, httptest.NewRequest(http.MethodPost, "/trades", strings.NewReader(test.body)))
+		res := rec.Result()
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if err := doc.ValidateResponse(http.MethodPost, "/trades", res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+			t.Fatalf("response does not match spec: %v", err)
+		}
+		if test.statusCode == http.StatusOK {
+			continue
+		}
+		var p problem.Problem
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Fatalf("decode problem: %v", err)
+		}
+		var rules []string
+		for _, fe := range p.Errors {
+			rules = append(rules, fe.Rule)
+		}
+		if !slices.Equal(rules, test.rules) {
+			t.Errorf("rules = %v; want %v", rules, test.rules)
+		}
+	}
+
+	first := claimTrade(t, dbManager)
+	if first.OpenTime == nil || !first.OpenTime.Equal(time.Date(2025, 6, 2, 9, 30, 0, 125e6, time.UTC)) {
+		t.Errorf("open_time = %v", first.OpenTime)
+	}
+	if first.CloseTime == nil || !first.CloseTime.Equal(time.Date(2025, 6, 2, 11, 59, 59, 999e6, time.UTC)) {
+		t.Errorf("close_time = %v", first.CloseTime)
+	}
+	if !first.ReceivedAt.Equal(now) {
+		t.Errorf("received_at = %v; want %v", first.ReceivedAt, now)
+	}
+	if first.ProcessedAt == nil || first.ProcessedAt.Before(now) {
+		t.Errorf("processed_at = %v", first.ProcessedAt)
+	}
+}
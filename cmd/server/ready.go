@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/health"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HandleGetReady reports whether the server can take trades: the database
+// accepted a write within writableTTL, its schema is the one this version
+// expects and the queue is below the backpressure limit. /healthz only tells
+// that the process is alive.
+func (h *Handlers) HandleGetReady(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var checks []health.Check
+
+	c := health.Check{Name: "database", Ok: true, Detail: "writable"}
+	if err := h.writable.check(ctx, h.dbManager, h.now()); err != nil {
+		c = health.Check{Name: "database", Detail: "not writable: " + err.Error()}
+	}
+	checks = append(checks, c)
+
+	version, err := h.dbManager.GetSchemaVersion(ctx)
+	c = health.Check{Name: "schema", Ok: version == dbmanager.SchemaVersion, Detail: fmt.Sprintf("version %d", version)}
+	switch {
+	case err != nil:
+		c.Detail = "can not read the schema version: " + err.Error()
+	case !c.Ok:
+		c.Detail = fmt.Sprintf("version %d, expected %d; run brokerctl migrate", version, dbmanager.SchemaVersion)
+	}
+	checks = append(checks, c)
+
+	checks = append(checks, h.queueCheck(r))
+
+	report := health.NewReport(checks...)
+	if !report.Ok() {
+		slog.WarnContext(ctx, "server not ready", "checks", report.Checks)
+	}
+	health.Write(w, report.Ok(), report)
+}
+
+// writableTTL is how long /readyz reuses the outcome of the writable check.
+// The check takes the write lock of the database, which frequent probes
+// would otherwise keep taking from the trades.
+const writableTTL = 5 * time.Second
+
+// writableCheck caches the outcome of CheckWritable for writableTTL. Probes
+// arriving while it runs wait for its outcome instead of checking again.
+type writableCheck struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+func (c *writableCheck) check(ctx context.Context, m *dbmanager.Manager, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checked.IsZero() && now.Sub(c.checked) < writableTTL {
+		return c.err
+	}
+	c.err, c.checked = m.CheckWritable(ctx), now
+	return c.err
+}
+
+// queueCheck fails once readyMaxPending trades are pending or, without that
+// threshold, while new trades are rejected by backpressure.
+func (h *Handlers) queueCheck(r *http.Request) health.Check {
+	depth, err := h.dbManager.CountPendingTrades(r.Context())
+	if err != nil {
+		return health.Check{Name: "queue", Detail: "can not count pending trades: " + err.Error()}
+	}
+	maxPending := h.readyMaxPending
+	if maxPending == 0 && h.limiter != nil {
+		maxPending = h.limiter.Config().MaxPending
+	}
+	if maxPending == 0 {
+		return health.Check{Name: "queue", Ok: true, Detail: fmt.Sprintf("%d pending, no limit", depth)}
+	}
+	return health.Check{Name: "queue", Ok: depth < maxPending, Detail: fmt.Sprintf("%d pending of at most %d", depth, maxPending)}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/health"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHandleGetReady(t *testing.T) {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	dbManager := &dbmanager.Manager{}
+	if err = dbManager.InitDbManager(conn); err != nil {
+		t.Fatalf("init db manager: %v", err)
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	for _, account := range []string{"1", "2"} {
+		trade := &model.Trade{Account: account, Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.2, Side: "buy", ReceivedAt: time.Now()}
+		if err = dbManager.CreateTrade(t.Context(), trade); err != nil {
+			t.Fatalf("create trade: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name            string
+		maxPending      int
+		readyMaxPending int
+		schemaVersion   int
+		status          int
+		// failed is the name of the failed check, if any.
+		failed string
+	}{
+		{name: "ready without limits", status: http.StatusOK},
+		{name: "below the backpressure limit", maxPending: 3, status: http.StatusOK},
+		{name: "at the backpressure limit", maxPending: 2, status: http.StatusServiceUnavailable, failed: "queue"},
+		{name: "ready threshold overrides backpressure", maxPending: 2, readyMaxPending: 10, status: http.StatusOK},
+		{name: "over the ready threshold", readyMaxPending: 1, status: http.StatusServiceUnavailable, failed: "queue"},
+		{name: "schema of another version", schemaVersion: dbmanager.SchemaVersion + 1, status: http.StatusServiceUnavailable, failed: "schema"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		version := test.schemaVersion
+		if version == 0 {
+			version = dbmanager.SchemaVersion
+		}
+		if _, err = conn.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+			t.Fatalf("set schema version: %v", err)
+		}
+		limiter, err := ratelimit.New(ratelimit.Config{MaxPending: test.maxPending})
+		if err != nil {
+			t.Fatalf("new limiter: %v", err)
+		}
+		h := Handlers{dbManager: dbManager, limiter: limiter, readyMaxPending: test.readyMaxPending}
+
+		rec := httptest.NewRecorder()
+		h.HandleGetReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != test.status {
+			t.Errorf("status = %d; want %d: %s", rec.Code, test.status, rec.Body)
+		}
+		var report health.Report
+		if err = json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		failed := ""
+		for _, c := range report.Checks {
+			if !c.Ok {
+				failed = c.Name
+			}
+		}
+		if failed != test.failed {
+			t.Errorf("failed check = %q; want %q: %+v", failed, test.failed, report.Checks)
+		}
+	}
+}
+
+func TestHandleGetReady_WritableCached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	conn, err := sql.Open("sqlite3", path+"?_busy_timeout=50")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	dbManager := &dbmanager.Manager{}
+	if err = dbManager.InitDbManager(conn); err != nil {
+		t.Fatalf("init db manager: %v", err)
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	// locker holds the write lock of the database, as a long transaction
+	// of another process would.
+	locker, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer locker.Close()
+	lock, err := locker.Conn(t.Context())
+	if err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	defer lock.Close()
+
+	clk := clock.NewFake(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC))
+	h := &Handlers{dbManager: dbManager, clock: clk}
+	tests := []struct {
+		name    string
+		advance time.Duration
+		locked  bool
+		status  int
+	}{
+		{name: "first probe checks", status: http.StatusOK},
+		{name: "locked within the ttl reuses the result", advance: writableTTL / 2, locked: true, status: http.StatusOK},
+		{name: "locked after the ttl checks again", advance: writableTTL, locked: true, status: http.StatusServiceUnavailable},
+		{name: "failure is reused within the ttl", advance: time.Second, status: http.StatusServiceUnavailable},
+		{name: "unlocked after the ttl", advance: writableTTL, status: http.StatusOK},
+	}
+	locked := false
+	for _, test := range tests {
+		t.Log(test.name)
+		if test.locked != locked {
+			query := "BEGIN IMMEDIATE"
+			if !test.locked {
+				query = "ROLLBACK"
+			}
+			if _, err = lock.ExecContext(t.Context(), query); err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+			locked = test.locked
+		}
+		clk.Advance(test.advance)
+
+		rec := httptest.NewRecorder()
+		h.HandleGetReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != test.status {
+			t.Errorf("status = %d; want %d: %s", rec.Code, test.status, rec.Body)
+		}
+	}
+}
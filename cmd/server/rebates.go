@@ -0,0 +1,129 @@
+package main
+
+import (
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RebateRatesRequest replaces the rates of a group; an empty list removes
+// them.
+type RebateRatesRequest struct {
+	Rates []RebateRateRequest `json:"rates" validate:"unique=Symbol,dive"`
+}
+
+type RebateRateRequest struct {
+	// Symbol is a symbol or "*" for every symbol without a rate of its own.
+	Symbol string  `json:"symbol"  validate:"required,symbol|eq=*"`
+	PerLot float64 `json:"per_lot" validate:"gte=0"`
+}
+
+type RebateRatesResponse struct {
+	Group string             `json:"group"`
+	Rates []model.RebateRate `json:"rates"`
+}
+
+type RebatePayoutsResponse struct {
+	From    time.Time            `json:"from"`
+	To      time.Time            `json:"to"`
+	Payouts []model.RebatePayout `json:"payouts"`
+}
+
+func (h *Handlers) HandleGetRebateRates(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.findGroup(w, r)
+	if !ok {
+		return
+	}
+	rates, err := h.dbManager.RebateRates(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not get rebate rates", "group", id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not get rebate rates")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, RebateRatesResponse{Group: id, Rates: rates})
+}
+
+// HandlePutRebateRates replaces the rebate rates of a group. New rates apply
+// to trades processed from then on.
+func (h *Handlers) HandlePutRebateRates(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.findGroup(w, r)
+	if !ok {
+		return
+	}
+	req := RebateRatesRequest{}
+	if p := problem.Decode(r.Body, &req); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		problem.Write(w, r, problem.FromValidation(err))
+		return
+	}
+	rates := make([]model.RebateRate, 0, len(req.Rates))
+	for _, rate := range req.Rates {
+		rates = append(rates, model.RebateRate{Symbol: rate.Symbol, PerLot: rate.PerLot})
+	}
+	if err := h.dbManager.SetRebateRates(r.Context(), id, rates); err != nil {
+		slog.ErrorContext(r.Context(), "can not set rebate rates", "group", id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not set rebate rates")
+		return
+	}
+	slog.InfoContext(r.Context(), "rebate rates updated", "group", id, "rates", len(rates))
+	h.HandleGetRebateRates(w, r)
+}
+
+// HandleGetRebatePayouts reports the rebates payable to each group for the
+// period [from, to).
+func (h *Handlers) HandleGetRebatePayouts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var errs []problem.FieldError
+	var bounds [2]*time.Time
+	for i, name := range []string{"from", "to"} {
+		value := q.Get(name)
+		if value == "" {
+			errs = append(errs, problem.FieldError{Field: name, Rule: "required", Message: name + " is required"})
+			continue
+		}
+		t, fe := parseTimeParam(name, value)
+		if fe != nil {
+			errs = append(errs, *fe)
+		}
+		bounds[i] = t
+	}
+	from, to := bounds[0], bounds[1]
+	if from != nil && to != nil && !to.After(*from) {
+		errs = append(errs, problem.FieldError{Field: "to", Rule: "after_from", Message: "to must be after from", Value: q.Get("to")})
+	}
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs...))
+		return
+	}
+
+	payouts, err := h.dbManager.RebatePayouts(r.Context(), *from, *to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not sum rebates", "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not report rebates")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, RebatePayoutsResponse{From: *from, To: *to, Payouts: payouts})
+}
+
+// findGroup checks that the group of the {id} path value exists. It writes
+// the error response and reports false when it does not.
+func (h *Handlers) findGroup(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	group, err := h.dbManager.GetAccountGroup(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not get group", "group", id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not get group")
+		return "", false
+	}
+	if group == nil {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "group "+id+" not found")
+		return "", false
+	}
+	return id, true
+}
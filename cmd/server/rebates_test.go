@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRebates_Endpoints(t *testing.T) {
+	doc := loadSpec(t)
+	srv, dbManager := newAuthServer(t)
+
+	for _, body := range []string{`{"id":"ib1"}`, `{"id":"sub1","parent":"ib1"}`} {
+		if res := doRequest(t, http.MethodPost, srv.URL+"/groups", testAdminKey, body); res.StatusCode != http.StatusCreated {
+			t.Fatalf("create group: status %d", res.StatusCode)
+		}
+	}
+	if res := doRequest(t, http.MethodPost, srv.URL+"/accounts", testAdminKey, `{"id":"123","group":"sub1"}`); res.StatusCode != http.StatusCreated {
+		t.Fatalf("create account: status %d", res.StatusCode)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		specPath   string
+		body       string
+		statusCode int
+	}{
+		{name: "set rates", method: http.MethodPut, path: "/groups/ib1/rebates", specPath: "/groups/{id}/rebates",
+			body: `{"rates":[{"symbol":"EURUSD","per_lot":3},{"symbol":"*","per_lot":2}]}`, statusCode: http.StatusOK},
+		{name: "set invalid symbol", method: http.MethodPut, path: "/groups/ib1/rebates", specPath: "/groups/{id}/rebates",
+			body: `{"rates":[{"symbol":"eur","per_lot":3}]}`, statusCode: http.StatusBadRequest},
+		{name: "set negative rate", method: http.MethodPut, path: "/groups/ib1/rebates", specPath: "/groups/{id}/rebates",
+			body: `{"rates":[{"symbol":"*","per_lot":-1}]}`, statusCode: http.StatusBadRequest},
+		{name: "set duplicate symbol", method: http.MethodPut, path: "/groups/ib1/rebates", specPath: "/groups/{id}/rebates",
+			body: `{"rates":[{"symbol":"*","per_lot":1},{"symbol":"*","per_lot":2}]}`, statusCode: http.StatusBadRequest},
+		{name: "set rates of unknown group", method: http.MethodPut, path: "/groups/nope/rebates", specPath: "/groups/{id}/rebates",
+			body: `{"rates":[]}`, statusCode: http.StatusNotFound},
+		{name: "get rates", method: http.MethodGet, path: "/groups/ib1/rebates", specPath: "/groups/{id}/rebates",
+			statusCode: http.StatusOK},
+		{name: "post trade", method: http.MethodPost, path: "/trades", specPath: "/trades",
+			body: tradeJSON("123"), statusCode: http.StatusOK},
+		{name: "payouts without period", method: http.MethodGet, path: "/rebates/payouts", specPath: "/rebates/payouts",
+			statusCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		res := doRequest(t, test.method, srv.URL+test.path, testAdminKey, test.body)
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if err := doc.ValidateResponse(test.method, test.specPath, res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+			t.Fatalf("response does not match spec: %v", err)
+		}
+	}
+
+	// the worker processes the trade
+	processedAt := time.Now().UTC()
+	tx, err := dbManager.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	trade, err := dbManager.GetTrade(t.Context(), tx, processedAt)
+	if err != nil || trade == nil {
+		t.Fatalf("GetTrade = %v, %v", trade, err)
+	}
+	if _, err = dbManager.AccrueRebates(t.Context(), tx, trade, processedAt); err != nil {
+		t.Fatalf("AccrueRebates: %v", err)
+	}
+	if err = dbManager.CommitTx(tx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	res := doRequest(t, http.MethodGet, srv.URL+"/trades/1", testAdminKey, "")
+	body, _ := io.ReadAll(res.Body)
+	if err = doc.ValidateResponse(http.MethodGet, "/trades/{id}", res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+		t.Fatalf("response does not match spec: %v", err)
+	}
+	var got TradeResponse
+	if err = json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("decode trade: %v", err)
+	}
+	if len(got.Rebates) != 1 || got.Rebates[0].Group != "ib1" || got.Rebates[0].Amount != 3 {
+		t.Errorf("rebates = %+v; want 3 for ib1", got.Rebates)
+	}
+
+	from := processedAt.Add(-time.Hour).Format(time.RFC3339)
+	to := processedAt.Add(time.Hour).Format(time.RFC3339)
+	res = doRequest(t, http.MethodGet, srv.URL+"/rebates/payouts?from="+from+"&to="+to, testAdminKey, "")
+	body, _ = io.ReadAll(res.Body)
+	if err = doc.ValidateResponse(http.MethodGet, "/rebates/payouts", res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+		t.Fatalf("response does not match spec: %v", err)
+	}
+	var payouts RebatePayoutsResponse
+	if err = json.Unmarshal(body, &payouts); err != nil {
+		t.Fatalf("decode payouts: %v", err)
+	}
+	if len(payouts.Payouts) != 1 || payouts.Payouts[0].Group != "ib1" || payouts.Payouts[0].Payable != 3 {
+		t.Errorf("payouts = %+v; want 3 payable to ib1", payouts.Payouts)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// TradeResponse is a trade as seen by back office, with its replaced
+// versions when requested.
+type TradeResponse struct {
+	Id          int                    `json:"id"`
+	Version     int                    `json:"version"`
+	Status      string                 `json:"status"`
+	Account     string                 `json:"account"`
+	Symbol      string                 `json:"symbol"`
+	Volume      float64                `json:"volume"`
+	Open        float64                `json:"open"`
+	Close       float64                `json:"close"`
+	Side        string                 `json:"side"`
+	Profit      *float64               `json:"profit,omitempty"`
+	OpenTime    *time.Time             `json:"open_time,omitempty"`
+	CloseTime   *time.Time             `json:"close_time,omitempty"`
+	ReceivedAt  *time.Time             `json:"received_at,omitempty"`
+	ProcessedAt *time.Time             `json:"processed_at,omitempty"`
+	CancelledAt *time.Time             `json:"cancelled_at,omitempty"`
+	Rollovers   int                    `json:"rollovers,omitempty"`
+	History     []TradeVersionResponse `json:"history,omitempty"`
+	Rebates     []model.RebateAccrual  `json:"rebates,omitempty"`
+}
+
+type TradeVersionResponse struct {
+	Version     int        `json:"version"`
+	Status      string     `json:"status"`
+	Symbol      string     `json:"symbol"`
+	Volume      float64    `json:"volume"`
+	Open        float64    `json:"open"`
+	Close       float64    `json:"close"`
+	Side        string     `json:"side"`
+	OpenTime    *time.Time `json:"open_time,omitempty"`
+	CloseTime   *time.Time `json:"close_time,omitempty"`
+	Action      string     `json:"action"`
+	Actor       string     `json:"actor"`
+	Reason      string     `json:"reason"`
+	ChangedAt   time.Time  `json:"changed_at"`
+	ProfitDelta float64    `json:"profit_delta"`
+	TradesDelta int        `json:"trades_delta"`
+}
+
+// AmendTradeRequest sets the fields to correct; fields left out keep their
+// value. The account of a trade cannot be changed.
+type AmendTradeRequest struct {
+	Symbol    *string    `json:"symbol,omitempty"`
+	Volume    *float64   `json:"volume,omitempty"`
+	Open      *float64   `json:"open,omitempty"`
+	Close     *float64   `json:"close,omitempty"`
+	Side      *string    `json:"side,omitempty"`
+	OpenTime  *time.Time `json:"open_time,omitempty"`
+	CloseTime *time.Time `json:"close_time,omitempty"`
+	Reason    string     `json:"reason" validate:"required,max=500"`
+}
+
+type CancelTradeRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+func (h *Handlers) HandleGetTrade(w http.ResponseWriter, r *http.Request) {
+	trade, ok := h.findTrade(w, r)
+	if !ok {
+		return
+	}
+	versions, err := h.dbManager.ListTradeVersions(r.Context(), trade.Id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not list trade versions", "trade_id", trade.Id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not get trade")
+		return
+	}
+	rebates, err := h.dbManager.ListRebateAccruals(r.Context(), trade.Id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not list rebates", "trade_id", trade.Id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not get trade")
+		return
+	}
+	resp := tradeResponse(trade)
+	for _, v := range versions {
+		resp.History = append(resp.History, tradeVersionResponse(v))
+	}
+	if len(rebates) > 0 {
+		resp.Rebates = rebates
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// HandlePatchTrade corrects a trade. If the trade was already processed, the
+// account stats are adjusted by the difference in profit.
+func (h *Handlers) HandlePatchTrade(w http.ResponseWriter, r *http.Request) {
+	prev, ok := h.findTrade(w, r)
+	if !ok {
+		return
+	}
+	req := AmendTradeRequest{}
+	if p := problem.Decode(r.Body, &req); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		problem.Write(w, r, problem.FromValidation(err))
+		return
+	}
+	if req == (AmendTradeRequest{Reason: req.Reason}) {
+		problem.Write(w, r, problem.Validation(problem.FieldError{
+			Rule:    "required",
+			Message: "at least one field must be amended",
+		}))
+		return
+	}
+
+	next := *prev
+	setIf(&next.Symbol, req.Symbol)
+	setIf(&next.Volume, req.Volume)
+	setIf(&next.Open, req.Open)
+	setIf(&next.Close, req.Close)
+	setIf(&next.Side, req.Side)
+	if req.OpenTime != nil {
+		next.OpenTime = req.OpenTime
+	}
+	if req.CloseTime != nil {
+		next.CloseTime = req.CloseTime
+	}
+	if err := ValidateTrade(&next); err != nil {
+		problem.Write(w, r, problem.FromValidation(err))
+		return
+	}
+	now := h.now()
+	if errs := validation.Times(&next, now, h.clockSkew); len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs...))
+		return
+	}
+	if p := h.checkAmendRules(r.Context(), &next); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if !checkChangeable(w, r, prev) {
+		return
+	}
+
+	change, err := h.dbManager.AmendTrade(r.Context(), prev, &next, audit.Actor(r.Context()), req.Reason, now)
+	if !changeApplied(w, r, prev, err) {
+		return
+	}
+	slog.InfoContext(r.Context(), "trade amended", "trade_id", prev.Id, "account", prev.Account,
+		"version", prev.Version+1, "profit_delta", change.ProfitDelta, "by", change.Actor, "reason", change.Reason)
+
+	next.Version = prev.Version + 1
+	writeJSON(w, r, http.StatusOK, tradeResponse(&next))
+}
+
+// checkAmendRules applies the rules of the account group to an amended trade,
+// as to a submitted one, so that a correction cannot bring in a volume,
+// symbol or price the group would reject. The duplicate rule is left out: it
+// guards against a trade being submitted twice, and an amendment may well
+// restate the fields of a trade submitted a moment ago. The market hours
+// rules check the trade at its open_time and close_time, or at the time it
+// was received, not at the time it is corrected.
+func (h *Handlers) checkAmendRules(ctx context.Context, trade *model.Trade) *problem.Problem {
+	violations, err := h.rules.Check(ctx, trade)
+	if err != nil {
+		slog.ErrorContext(ctx, "can not check trade rules", "trade_id", trade.Id, "error", err)
+		return problem.New(http.StatusInternalServerError, problem.CodeInternal, "can not check trade rules")
+	}
+	violations = slices.DeleteFunc(violations, func(fe problem.FieldError) bool {
+		return fe.Rule == validation.RuleDuplicate
+	})
+	if len(violations) > 0 {
+		slog.InfoContext(ctx, "amendment rejected by rules", "trade_id", trade.Id, "violations", violations)
+		return problem.Validation(violations...)
+	}
+	return nil
+}
+
+// HandlePostCancelTrade cancels a trade: a pending trade is removed from the
+// queue, a processed one is reversed in the account stats.
+func (h *Handlers) HandlePostCancelTrade(w http.ResponseWriter, r *http.Request) {
+	prev, ok := h.findTrade(w, r)
+	if !ok {
+		return
+	}
+	req := CancelTradeRequest{}
+	if p := problem.Decode(r.Body, &req); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		problem.Write(w, r, problem.FromValidation(err))
+		return
+	}
+	if !checkChangeable(w, r, prev) {
+		return
+	}
+
+	now := h.now()
+	change, err := h.dbManager.CancelTrade(r.Context(), prev, audit.Actor(r.Context()), req.Reason, now)
+	if !changeApplied(w, r, prev, err) {
+		return
+	}
+	slog.InfoContext(r.Context(), "trade cancelled", "trade_id", prev.Id, "account", prev.Account,
+		"status", change.Status, "profit_delta", change.ProfitDelta, "by", change.Actor, "reason", change.Reason)
+
+	cancelled := *prev
+	cancelled.Version = prev.Version + 1
+	cancelled.Processed = 1
+	cancelled.CancelledAt = &change.ChangedAt
+	writeJSON(w, r, http.StatusOK, tradeResponse(&cancelled))
+}
+
+// findTrade loads the trade of the {id} path value. It writes the error
+// response and reports false when the trade is missing or not accessible.
+func (h *Handlers) findTrade(w http.ResponseWriter, r *http.Request) (*model.Trade, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidPath, "trade id must be a positive integer")
+		return nil, false
+	}
+	trade, p := h.lookupTrade(r.Context(), id)
+	if p != nil {
+		problem.Write(w, r, p)
+		return nil, false
+	}
+	return trade, true
+}
+
+// lookupTrade returns the trade with id, or the problem if there is none or
+// the caller may not see it.
+func (h *Handlers) lookupTrade(ctx context.Context, id int) (*model.Trade, *problem.Problem) {
+	trade, err := h.dbManager.FindTrade(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "can not get trade", "trade_id", id, "error", err)
+		return nil, problem.New(http.StatusInternalServerError, problem.CodeInternal, "can not get trade")
+	}
+	if trade == nil {
+		return nil, problem.New(http.StatusNotFound, problem.CodeNotFound, "trade "+strconv.Itoa(id)+" not found")
+	}
+	if !auth.FromContext(ctx).CanAccess(trade.Account) {
+		return nil, problem.New(http.StatusForbidden, problem.CodeForbidden, "account "+trade.Account+" is not allowed")
+	}
+	return trade, nil
+}
+
+func checkChangeable(w http.ResponseWriter, r *http.Request, trade *model.Trade) bool {
+	if trade.Status() == model.TradeStatusCancelled {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "trade "+strconv.Itoa(trade.Id)+" is cancelled")
+		return false
+	}
+	return true
+}
+
+// changeApplied writes the error response of a failed amendment or
+// cancellation.
+func changeApplied(w http.ResponseWriter, r *http.Request, trade *model.Trade, err error) bool {
+	if errors.Is(err, dbmanager.ErrTradeChanged) {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict,
+			"trade "+strconv.Itoa(trade.Id)+" changed while it was being updated; retry")
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not change trade", "trade_id", trade.Id, "error", err)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "can not change trade")
+		return false
+	}
+	return true
+}
+
+func setIf[T any](dst *T, v *T) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func tradeResponse(t *model.Trade) TradeResponse {
+	resp := TradeResponse{
+		Id:          t.Id,
+		Version:     t.Version,
+		Status:      t.Status(),
+		Account:     t.Account,
+		Symbol:      t.Symbol,
+		Volume:      t.Volume,
+		Open:        t.Open,
+		Close:       t.Close,
+		Side:        t.Side,
+		OpenTime:    t.OpenTime,
+		CloseTime:   t.CloseTime,
+		ProcessedAt: t.ProcessedAt,
+		CancelledAt: t.CancelledAt,
+		Rollovers:   t.Rollovers,
+	}
+	if profit, ok := t.AppliedProfit(); ok {
+		resp.Profit = &profit
+	}
+	if !t.ReceivedAt.IsZero() {
+		resp.ReceivedAt = &t.ReceivedAt
+	}
+	return resp
+}
+
+func tradeVersionResponse(v model.TradeVersion) TradeVersionResponse {
+	return TradeVersionResponse{
+		Version:     v.Version,
+		Status:      v.Status,
+		Symbol:      v.Symbol,
+		Volume:      v.Volume,
+		Open:        v.Open,
+		Close:       v.Close,
+		Side:        v.Side,
+		OpenTime:    v.OpenTime,
+		CloseTime:   v.CloseTime,
+		Action:      v.Action,
+		Actor:       v.Actor,
+		Reason:      v.Reason,
+		ChangedAt:   v.ChangedAt,
+		ProfitDelta: v.ProfitDelta,
+		TradesDelta: v.TradesDelta,
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/ratelimit"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrades_AmendAndCancel(t *testing.T) {
+	doc := loadSpec(t)
+	srv, dbManager := newAuthServer(t)
+
+	for _, account := range []string{"123", "123"} {
+		if res := doRequest(t, http.MethodPost, srv.URL+"/trades", testAdminKey, tradeJSON(account)); res.StatusCode != http.StatusOK {
+			t.Fatalf("post trade: status %d", res.StatusCode)
+		}
+	}
+	// the worker applies the first trade: profit 500
+	tx, err := dbManager.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	trade, err := dbManager.GetTrade(t.Context(), tx, time.Now())
+	if err != nil || trade == nil {
+		t.Fatalf("GetTrade = %v, %v", trade, err)
+	}
+	if err = dbManager.UpdateAccount(t.Context(), tx, trade.Account, trade.Profit()); err != nil {
+		t.Fatalf("update account: %v", err)
+	}
+	if err = dbManager.CommitTx(tx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		specPath   string
+		body       string
+		statusCode int
+		status     string
+		profit     float64
+		trades     int
+	}{
+		{name: "amend processed trade", method: http.MethodPatch, path: "/trades/1", specPath: "/trades/{id}",
+			body: `{"close":1.11,"reason":"mistyped close"}`, statusCode: http.StatusOK, status: model.TradeStatusProcessed, profit: 1000, trades: 1},
+		{name: "amend without reason", method: http.MethodPatch, path: "/trades/1", specPath: "/trades/{id}",
+			body: `{"close":1.12}`, statusCode: http.StatusBadRequest, profit: 1000, trades: 1},
+		{name: "amend nothing", method: http.MethodPatch, path: "/trades/1", specPath: "/trades/{id}",
+			body: `{"reason":"no-op"}`, statusCode: http.StatusBadRequest, profit: 1000, trades: 1},
+		{name: "amend account", method: http.MethodPatch, path: "/trades/1", specPath: "/trades/{id}",
+			body: `{"account":"456","reason":"wrong account"}`, statusCode: http.StatusBadRequest, profit: 1000, trades: 1},
+		{name: "amend to invalid side", method: http.MethodPatch, path: "/trades/1", specPath: "/trades/{id}",
+			body: `{"side":"hold","reason":"typo"}`, statusCode: http.StatusBadRequest, profit: 1000, trades: 1},
+		{name: "amend unknown trade", method: http.MethodPatch, path: "/trades/99", specPath: "/trades/{id}",
+			body: `{"close":1.11,"reason":"x"}`, statusCode: http.StatusNotFound, profit: 1000, trades: 1},
+		{name: "amend invalid id", method: http.MethodPatch, path: "/trades/abc", specPath: "/trades/{id}",
+			body: `{"close":1.11,"reason":"x"}`, statusCode: http.StatusBadRequest, profit: 1000, trades: 1},
+		{name: "cancel pending trade", method: http.MethodPost, path: "/trades/2/cancel", specPath: "/trades/{id}/cancel",
+			body: `{"reason":"client request"}`, statusCode: http.StatusOK, status: model.TradeStatusCancelled, profit: 1000, trades: 1},
+		{name: "cancel processed trade", method: http.MethodPost, path: "/trades/1/cancel", specPath: "/trades/{id}/cancel",
+			body: `{"reason":"duplicate booking"}`, statusCode: http.StatusOK, status: model.TradeStatusCancelled, profit: 0, trades: 0},
+		{name: "cancel twice", method: http.MethodPost, path: "/trades/1/cancel", specPath: "/trades/{id}/cancel",
+			body: `{"reason":"again"}`, statusCode: http.StatusConflict, profit: 0, trades: 0},
+		{name: "amend cancelled trade", method: http.MethodPatch, path: "/trades/1", specPath: "/trades/{id}",
+			body: `{"close":1.2,"reason":"late fix"}`, statusCode: http.StatusConflict, profit: 0, trades: 0},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		res := doRequest(t, test.method, srv.URL+test.path, testAdminKey, test.body)
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if err = doc.ValidateResponse(test.method, test.specPath, res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+			t.Fatalf("response does not match spec: %v", err)
+		}
+		if test.status != "" {
+			var got TradeResponse
+			if err = json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("decode trade: %v", err)
+			}
+			if got.Status != test.status {
+				t.Errorf("trade status = %s; want %s", got.Status, test.status)
+			}
+		}
+		client, err := dbManager.GetClient(t.Context(), "123")
+		if err != nil || client == nil {
+			t.Fatalf("GetClient = %v, %v", client, err)
+		}
+		if client.Trades != test.trades || math.Abs(client.Profit-test.profit) > 0.01 {
+			t.Errorf("stats = %d trades, profit %v; want %d, %v", client.Trades, client.Profit, test.trades, test.profit)
+		}
+	}
+
+	if n, _ := dbManager.CountPendingTrades(t.Context()); n != 0 {
+		t.Errorf("pending trades = %d; want 0", n)
+	}
+
+	res := doRequest(t, http.MethodGet, srv.URL+"/trades/1", testAdminKey, "")
+	body, _ := io.ReadAll(res.Body)
+	if err = doc.ValidateResponse(http.MethodGet, "/trades/{id}", res.StatusCode, res.Header.Get("Content-Type"), body); err != nil {
+		t.Fatalf("response does not match spec: %v", err)
+	}
+	var got TradeResponse
+	if err = json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("decode trade: %v", err)
+	}
+	if got.Version != 3 || len(got.History) != 2 {
+		t.Fatalf("trade = %+v; want version 3 with 2 replaced versions", got)
+	}
+	amend, cancel := got.History[0], got.History[1]
+	if amend.Action != model.TradeActionAmend || amend.Close != 1.105 || amend.Actor != "key:0123456789abcdef" ||
+		amend.Reason != "mistyped close" || math.Abs(amend.ProfitDelta-500) > 0.01 {
+		t.Errorf("amendment = %+v", amend)
+	}
+	if cancel.Action != model.TradeActionCancel || cancel.Close != 1.11 || cancel.TradesDelta != -1 ||
+		math.Abs(cancel.ProfitDelta+1000) > 0.01 {
+		t.Errorf("cancellation = %+v", cancel)
+	}
+}
+
+func TestTrades_AmendChecksRules(t *testing.T) {
+	srv, dbManager := newAuthServer(t, func(hs *Handlers) {
+		rules, err := validation.Parse([]byte(`{"default":"all","groups":{"all":{"rules":[
+			{"rule":"max_volume","default":5},
+			{"rule":"duplicate","window":"1m"}]}}}`), validation.Deps{Quotes: hs.dbManager})
+		if err != nil {
+			t.Fatalf("parse rules: %v", err)
+		}
+		hs.rules = rules
+	})
+	if res := doRequest(t, http.MethodPost, srv.URL+"/trades", testAdminKey, tradeJSON("123")); res.StatusCode != http.StatusOK {
+		t.Fatalf("post trade: status %d", res.StatusCode)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		rule       string
+		volume     float64
+	}{
+		{name: "volume over the cap", body: `{"volume":6,"reason":"client order"}`,
+			statusCode: http.StatusBadRequest, rule: validation.RuleMaxVolume, volume: 1},
+		{name: "same fields as submitted", body: `{"volume":1,"reason":"restated"}`,
+			statusCode: http.StatusOK, volume: 1},
+		{name: "volume under the cap", body: `{"volume":5,"reason":"client order"}`,
+			statusCode: http.StatusOK, volume: 5},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		res := doRequest(t, http.MethodPatch, srv.URL+"/trades/1", testAdminKey, test.body)
+		if res.StatusCode != test.statusCode {
+			t.Fatalf("status = %d; want %d", res.StatusCode, test.statusCode)
+		}
+		if test.rule != "" {
+			var p problem.Problem
+			if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if len(p.Errors) != 1 || p.Errors[0].Rule != test.rule {
+				t.Errorf("errors = %+v; want %s", p.Errors, test.rule)
+			}
+		}
+		trade, err := dbManager.FindTrade(t.Context(), 1)
+		if err != nil || trade == nil {
+			t.Fatalf("FindTrade = %v, %v", trade, err)
+		}
+		if trade.Volume != test.volume {
+			t.Errorf("volume = %v; want %v", trade.Volume, test.volume)
+		}
+	}
+}
+
+func TestTrades_AmendRulesAtTradeTimes(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 3, 8, 15, 0, 0, 0, time.UTC))
+	srv, _ := newAuthServer(t, func(hs *Handlers) {
+		hs.clock = fake
+		rules, err := validation.Parse([]byte(`{"default":"all","groups":{"all":{"rules":[
+			{"rule":"price_band","max_deviation":0.05},
+			{"rule":"trading_hours","timezone":"UTC","days":["mon","tue","wed","thu","fri"],"open":"00:00","close":"24:00"}]}}}`),
+			validation.Deps{Quotes: hs.dbManager, Now: fake.Now})
+		if err != nil {
+			t.Fatalf("parse rules: %v", err)
+		}
+		hs.rules = rules
+	})
+	// Trade 1 has its close mistyped, trade 2 is cancelled before the
+	// amendments and trades 3 and 4 have no times; all are submitted on a
+	// Friday and amended on the Saturday after.
+	for _, body := range []string{
+		`{"account":"123","symbol":"EURUSD","volume":1,"open":11.0,"close":11.05,"side":"buy",
+		  "open_time":"2024-03-08T10:00:00Z","close_time":"2024-03-08T12:00:00Z"}`,
+		`{"account":"123","symbol":"EURUSD","volume":1,"open":10.9,"close":11.0,"side":"buy"}`,
+		`{"account":"123","symbol":"GBPUSD","volume":1,"open":1.25,"close":1.26,"side":"buy"}`,
+		`{"account":"123","symbol":"GBPUSD","volume":1,"open":1.25,"close":1.255,"side":"buy"}`,
+	} {
+		if res := doRequest(t, http.MethodPost, srv.URL+"/trades", testAdminKey, body); res.StatusCode != http.StatusOK {
+			t.Fatalf("post trade: status %d", res.StatusCode)
+		}
+	}
+	if res := doRequest(t, http.MethodPost, srv.URL+"/trades/2/cancel", testAdminKey, `{"reason":"duplicate booking"}`); res.StatusCode != http.StatusOK {
+		t.Fatalf("cancel trade: status %d", res.StatusCode)
+	}
+	fake.Set(time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name       string
+		id         string
+		body       string
+		statusCode int
+		rule       string
+	}{
+		{name: "prices fixed with only the own and a cancelled quote", id: "1",
+			body: `{"open":1.1,"close":1.105,"reason":"mistyped prices"}`, statusCode: http.StatusOK},
+		{name: "closed on the weekend", id: "1", body: `{"close_time":"2024-03-09T10:00:00Z","reason":"late close"}`,
+			statusCode: http.StatusBadRequest, rule: validation.RuleTradingHours},
+		{name: "received on a weekday, amended on the weekend", id: "3", body: `{"volume":2,"reason":"client order"}`,
+			statusCode: http.StatusOK},
+		{name: "close off the quote of another trade", id: "3", body: `{"close":2,"reason":"mistyped close"}`,
+			statusCode: http.StatusBadRequest, rule: validation.RulePriceBand},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		res := doRequest(t, http.MethodPatch, srv.URL+"/trades/"+test.id, testAdminKey, test.body)
+		if res.StatusCode != test.statusCode {
+			body, _ := io.ReadAll(res.Body)
+			t.Fatalf("status = %d; want %d: %s", res.StatusCode, test.statusCode, body)
+		}
+		if test.rule != "" {
+			var p problem.Problem
+			if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if len(p.Errors) != 1 || p.Errors[0].Rule != test.rule {
+				t.Errorf("errors = %+v; want %s", p.Errors, test.rule)
+			}
+		}
+	}
+}
+
+func TestTrades_IdempotencyKey(t *testing.T) {
+	srv, dbManager := newAuthServer(t, func(hs *Handlers) {
+		rules, err := validation.Parse([]byte(`{"default":"all","groups":{"all":{"rules":[
+			{"rule":"duplicate","window":"1m"}]}}}`), validation.Deps{})
+		if err != nil {
+			t.Fatalf("parse rules: %v", err)
+		}
+		hs.rules = rules
+		if hs.limiter, err = ratelimit.New(ratelimit.Config{Account: ratelimit.Limit{Rate: 0.001, Burst: 1}}); err != nil {
+			t.Fatalf("new limiter: %v", err)
+		}
+	})
+	post := func(key, body string) int {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/trades", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req.Header.Set(auth.ApiKeyHeader, testAdminKey)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /trades: %v", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		key        string
+		body       string
+		statusCode int
+	}{
+		{name: "first submission", key: "order-1", body: tradeJSON("123"), statusCode: http.StatusOK},
+		{name: "retry over the rate limit and the duplicate rule", key: "order-1", body: tradeJSON("123"), statusCode: http.StatusOK},
+		{name: "key reused for another trade", key: "order-1", body: tradeJSON("456"), statusCode: http.StatusConflict},
+		{name: "trade amended", method: http.MethodPatch, body: `{"volume":2,"reason":"client order"}`, statusCode: http.StatusOK},
+		{name: "retry of the trade as first submitted", key: "order-1", body: tradeJSON("123"), statusCode: http.StatusOK},
+		{name: "new key", key: "order-2", body: tradeJSON("123"), statusCode: http.StatusTooManyRequests},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		var status int
+		if test.method == http.MethodPatch {
+			status = doRequest(t, test.method, srv.URL+"/trades/1", testAdminKey, test.body).StatusCode
+		} else {
+			status = post(test.key, test.body)
+		}
+		if status != test.statusCode {
+			t.Fatalf("status = %d; want %d", status, test.statusCode)
+		}
+	}
+	if n, err := dbManager.CountPendingTrades(t.Context()); err != nil || n != 1 {
+		t.Errorf("CountPendingTrades = %d, %v; want 1", n, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/health"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// monitor records the progress of the work loops for the health listener.
+type monitor struct {
+	dbManager *dbmanager.Manager
+	// maxPollAge and maxPendingAge are the thresholds as durations, so that
+	// a reload can change them.
+	maxPollAge    atomic.Int64
+	maxPendingAge atomic.Int64
+
+	mu        sync.Mutex
+	started   time.Time
+	lastPoll  *time.Time
+	lastTrade *processedTrade
+}
+
+type processedTrade struct {
+	Id          int       `json:"id"`
+	Account     string    `json:"account"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// workerReport is the body of /healthz and /readyz.
+type workerReport struct {
+	health.Report
+	LastPoll  *time.Time      `json:"last_poll,omitempty"`
+	LastTrade *processedTrade `json:"last_trade,omitempty"`
+	// OldestPendingAge is omitted when no trade is pending or the queue was
+	// not checked.
+	OldestPendingAge *float64 `json:"oldest_pending_age_seconds,omitempty"`
+}
+
+func newMonitor(dbManager *dbmanager.Manager, maxPollAge, maxPendingAge time.Duration) *monitor {
+	m := &monitor{dbManager: dbManager, started: clk.Now()}
+	m.setThresholds(maxPollAge, maxPendingAge)
+	return m
+}
+
+func (m *monitor) setThresholds(maxPollAge, maxPendingAge time.Duration) {
+	m.maxPollAge.Store(int64(maxPollAge))
+	m.maxPendingAge.Store(int64(maxPendingAge))
+}
+
+// polled records a poll that did not fail, and the trade it processed if
+// any.
+func (m *monitor) polled(trade *model.Trade) {
+	now := clk.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastPoll = &now
+	if trade != nil {
+		m.lastTrade = &processedTrade{Id: trade.Id, Account: trade.Account, ProcessedAt: now}
+	}
+}
+
+// report checks that the last successful poll is recent, counting from the
+// start until the first one, and with ready that the oldest pending trade
+// has not waited too long.
+func (m *monitor) report(ctx context.Context, ready bool) workerReport {
+	now := clk.Now()
+	m.mu.Lock()
+	r := workerReport{LastPoll: m.lastPoll, LastTrade: m.lastTrade}
+	since := m.started
+	if m.lastPoll != nil {
+		since = *m.lastPoll
+	}
+	m.mu.Unlock()
+
+	maxPollAge := time.Duration(m.maxPollAge.Load())
+	age := now.Sub(since)
+	checks := []health.Check{{
+		Name:   "poll",
+		Ok:     age <= maxPollAge,
+		Detail: fmt.Sprintf("last successful poll %s ago, at most %s", age.Round(time.Millisecond), maxPollAge),
+	}}
+	if r.LastPoll == nil {
+		checks[0].Detail = fmt.Sprintf("no successful poll in the %s since the start, at most %s", age.Round(time.Millisecond), maxPollAge)
+	}
+	if ready {
+		checks = append(checks, m.queueCheck(ctx, now, &r))
+	}
+	r.Report = health.NewReport(checks...)
+	return r
+}
+
+func (m *monitor) queueCheck(ctx context.Context, now time.Time, r *workerReport) health.Check {
+	depth, err := m.dbManager.QueueDepth(ctx)
+	if err != nil {
+		return health.Check{Name: "queue", Detail: "can not read the queue: " + err.Error()}
+	}
+	if depth.OldestPending == nil {
+		return health.Check{Name: "queue", Ok: true, Detail: "no pending trades"}
+	}
+	age := now.Sub(*depth.OldestPending)
+	seconds := age.Seconds()
+	r.OldestPendingAge = &seconds
+	maxPendingAge := time.Duration(m.maxPendingAge.Load())
+	if maxPendingAge == 0 {
+		return health.Check{Name: "queue", Ok: true, Detail: fmt.Sprintf("%d pending, no limit on their age", depth.Pending)}
+	}
+	return health.Check{
+		Name:   "queue",
+		Ok:     age <= maxPendingAge,
+		Detail: fmt.Sprintf("%d pending, the oldest for %s, at most %s", depth.Pending, age.Round(time.Second), maxPendingAge),
+	}
+}
+
+// handler serves /healthz, which fails when the work loops stopped polling,
+// and /readyz, which also fails when the worker does not keep up with the
+// queue.
+func (m *monitor) handler() http.Handler {
+	mux := http.NewServeMux()
+	serve := func(ready bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			report := m.report(r.Context(), ready)
+			if !report.Ok() {
+				slog.WarnContext(r.Context(), "worker not healthy", "path", r.URL.Path, "checks", report.Checks)
+			}
+			health.Write(w, report.Ok(), report)
+		}
+	}
+	mux.HandleFunc("GET /healthz", serve(false))
+	mux.HandleFunc("GET /readyz", serve(true))
+	return mux
+}
+
+// serveHealth listens on addr and serves the health endpoints in the
+// background.
+func serveHealth(addr string, m *monitor) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: m.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			slog.Error("health listener stopped", "error", err)
+		}
+	}()
+	slog.Info("health listener started", "addr", l.Addr().String())
+	return nil
+}
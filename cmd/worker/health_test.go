@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/worker"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC))
+	defer func(c clock.Clock) { clk = c }(clk)
+	clk = fake
+
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	dbManager := &dbmanager.Manager{}
+	if err = dbManager.InitDbManager(conn); err != nil {
+		t.Fatalf("InitDbManager: %v", err)
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+
+	mon := newMonitor(dbManager, 30*time.Second, 5*time.Minute)
+	srv := httptest.NewServer(mon.handler())
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		// before changes the state of the worker before the request.
+		before func(t *testing.T)
+		path   string
+		status int
+		// lastTrade is the id of the reported last trade, 0 for none.
+		lastTrade int
+		// pendingAge is the reported age of the oldest pending trade in
+		// seconds, 0 for none.
+		pendingAge float64
+	}{
+		{name: "just started", path: "/healthz", status: http.StatusOK},
+		{name: "no poll since the start", before: func(*testing.T) { fake.Advance(31 * time.Second) },
+			path: "/healthz", status: http.StatusServiceUnavailable},
+		{name: "polled an empty queue", before: func(*testing.T) { mon.polled(nil) }, path: "/readyz", status: http.StatusOK},
+		{name: "trade pending for too long", before: func(t *testing.T) {
+			trade := &model.Trade{Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.2, Side: "buy",
+				ReceivedAt: fake.Now().Add(-10 * time.Minute)}
+			if err := dbManager.CreateTrade(t.Context(), trade); err != nil {
+				t.Fatalf("CreateTrade: %v", err)
+			}
+		}, path: "/readyz", status: http.StatusServiceUnavailable, pendingAge: 600},
+		{name: "alive while pending", path: "/healthz", status: http.StatusOK},
+		{name: "trade processed", before: func(t *testing.T) {
+			trade, err := worker.ProcessNext(dbManager, clk)
+			if err != nil || trade == nil {
+				t.Fatalf("ProcessNext = %v, %v; want the pending trade", trade, err)
+			}
+			mon.polled(trade)
+		}, path: "/readyz", status: http.StatusOK, lastTrade: 1},
+		{name: "pending age check disabled", before: func(t *testing.T) {
+			mon.setThresholds(30*time.Second, 0)
+			trade := &model.Trade{Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.2, Side: "buy",
+				ReceivedAt: fake.Now().Add(-time.Hour)}
+			if err := dbManager.CreateTrade(t.Context(), trade); err != nil {
+				t.Fatalf("CreateTrade: %v", err)
+			}
+		}, path: "/readyz", status: http.StatusOK, lastTrade: 1, pendingAge: 3600},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if test.before != nil {
+			test.before(t)
+		}
+		res, err := http.Get(srv.URL + test.path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", test.path, err)
+		}
+		var report workerReport
+		err = json.NewDecoder(res.Body).Decode(&report)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		if res.StatusCode != test.status {
+			t.Errorf("GET %s = %d %+v; want %d", test.path, res.StatusCode, report, test.status)
+		}
+		lastTrade, pendingAge := 0, 0.0
+		if report.LastTrade != nil {
+			lastTrade = report.LastTrade.Id
+		}
+		if report.OldestPendingAge != nil {
+			pendingAge = *report.OldestPendingAge
+		}
+		if lastTrade != test.lastTrade || pendingAge != test.pendingAge {
+			t.Errorf("last trade %d, oldest pending age %v; want %d, %v", lastTrade, pendingAge, test.lastTrade, test.pendingAge)
+		}
+	}
+}
@@ -2,121 +2,168 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"flag"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/calendar"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	"gitlab.com/digineat/go-broker-test/internal/config"
 	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
-	"log"
+	"gitlab.com/digineat/go-broker-test/internal/logging"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/tracing"
+	"gitlab.com/digineat/go-broker-test/internal/worker"
+	"log/slog"
+	"os"
+	"sync/atomic"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// clk stamps claimed trades; tests replace it with a fake clock.
+var clk clock.Clock = clock.System{}
+
 func main() {
 	// Command line flags
-	dbPath := flag.String("db", "data.db", "path to SQLite database")
-	pollInterval := flag.Duration("poll", 100*time.Millisecond, "polling interval")
-	flag.Parse()
-
-	// Initialize database connection
-	db, err := sql.Open("sqlite3", *dbPath)
+	settings := config.Bind(flag.CommandLine, "db", "worker", "trading", "log")
+	traceExporter := flag.String("trace-exporter", tracing.ExporterNone, "trace exporter: none, stdout or otlp")
+	traceEndpoint := flag.String("trace-endpoint", "", "OTLP/HTTP collector endpoint (host:port)")
+	traceInsecure := flag.Bool("trace-insecure", false, "disable TLS for the OTLP exporter")
+	traceFile := flag.String("trace-file", "", "file for the stdout trace exporter (default stdout)")
+	traceSample := flag.Float64("trace-sample-ratio", 1, "fraction of traces to sample")
+	calendarPath := flag.String("calendar", "", "JSON file with market sessions and holidays, to count swap rollovers")
+	printConfig := parseArgs(os.Args[1:])
+
+	cfg, err := settings.Load()
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		os.Exit(2)
+	}
+	if printConfig {
+		settings.Print(os.Stdout, cfg)
+		return
 	}
-	defer func(db *sql.DB) {
-		err = db.Close()
-		if err != nil {
-			log.Fatalf("Failed to close database: %v", err)
-		}
-	}(db)
 
-	// Test database connection
-	if err = db.Ping(); err != nil {
-		log.Fatalf("Failed to ping database: %v", err)
+	var logLevel slog.LevelVar
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logLevel.Set(level)
+	logger, err := logging.NewLeveled(os.Stderr, &logLevel, cfg.Log.Format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	model.Lot = cfg.Trading.LotSize
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: "broker-worker",
+		Exporter:    *traceExporter,
+		Endpoint:    *traceEndpoint,
+		Insecure:    *traceInsecure,
+		File:        *traceFile,
+		SampleRatio: *traceSample,
+	})
+	if err != nil {
+		fatal("can not set up tracing", err)
 	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}()
 
+	// Initialize database connections
 	dbManager := dbmanager.Manager{}
-	err = dbManager.InitDbManager(db)
+	conns, err := cfg.DB.Open(&dbManager)
 	if err != nil {
-		log.Fatalf("Can not init DB manager: %v", err)
-		return
+		fatal("failed to open database", err)
+	}
+	defer func() {
+		if err := conns.Close(); err != nil {
+			slog.Error("failed to close database", "error", err)
+		}
+	}()
+
+	// Test database connection
+	if err = conns.Ping(); err != nil {
+		fatal("failed to ping database", err)
 	}
+
 	err = dbManager.CreateTablesIfNeed()
 	if err != nil {
-		log.Fatalf("Can not init DB manager: %v", err)
-		return
+		fatal("can not create tables", err)
 	}
 
-	log.Printf("Worker started with polling interval: %v", *pollInterval)
-
-	// Main worker loop
-	lot := 100000.0
-	for {
-		// TODO: Write code here
-
-		// при начале транзакции забирается строка из базы trade и помечается как FOR UPDATE
-
-		// creating transaction
-		ctx := context.Background()
-		tx, txErr := dbManager.CreateTx(ctx)
-		if txErr != nil {
-			errRb := dbManager.RollbackTx(tx)
-			if errRb != nil {
-				log.Printf("Failed to rolback transaction")
-				return
-			}
-			log.Printf("Не удалось получить trade: %v", err)
-			return
+	var hooks []worker.Hook
+	if *calendarPath != "" {
+		cal, err := calendar.Load(*calendarPath)
+		if err != nil {
+			fatal("can not load trading calendar", err)
 		}
+		hooks = append(hooks, worker.Rollovers(&dbManager, cal))
+		slog.Info("trading calendar loaded", "path", *calendarPath)
+	}
 
-		trade, tradeErr := dbManager.GetTrade(ctx, tx)
-
-		if tradeErr != nil {
-			errRb := dbManager.RollbackTx(tx)
-			if errRb != nil {
-				log.Printf("Failed to rolback transaction")
-				return
-			}
-			log.Printf("Не удалось получить trade: %v", tradeErr)
-			return
-		}
-		if trade == nil {
-			errRb := dbManager.RollbackTx(tx)
-			if errRb != nil {
-				log.Printf("Failed to rolback transaction")
-				return
-			}
-			time.Sleep(*pollInterval)
-			continue
+	mon := newMonitor(&dbManager, cfg.Worker.MaxPollAge, cfg.Worker.MaxPendingAge)
+	if cfg.Worker.HealthListen != "" {
+		if err = serveHealth(cfg.Worker.HealthListen, mon); err != nil {
+			fatal("can not start the health listener", err)
 		}
+	}
 
-		profit := (trade.Close - trade.Open) * trade.Volume * lot
-		if trade.Side == "sell" {
-			profit = -profit
-		}
+	var poll atomic.Int64
+	poll.Store(int64(cfg.Worker.PollInterval))
+	go settings.Watch(context.Background(), cfg, func(prev, next *config.Config) {
+		level, _ := logging.ParseLevel(next.Log.Level)
+		logLevel.Set(level)
+		next.DB.Apply(conns.Read)
+		poll.Store(int64(next.Worker.PollInterval))
+		mon.setThresholds(next.Worker.MaxPollAge, next.Worker.MaxPendingAge)
+	})
+
+	slog.Info("worker started", "poll_interval", cfg.Worker.PollInterval.String(), "concurrency", cfg.Worker.Concurrency)
+
+	// Every loop claims trades in its own transaction; the worker stops when
+	// any of them fails.
+	stopped := make(chan struct{}, cfg.Worker.Concurrency)
+	for range cfg.Worker.Concurrency {
+		go func() {
+			work(&dbManager, hooks, &poll, mon)
+			stopped <- struct{}{}
+		}()
+	}
+	<-stopped
+}
 
-		err = dbManager.UpdateAccount(ctx, tx, trade.Account, profit)
-		if err != nil {
-			errRb := dbManager.RollbackTx(tx)
-			if errRb != nil {
-				log.Printf("Failed to rolback transaction")
-				return
-			}
-			log.Printf("Не удалось обновить аккаунт: %v", err)
-			return
-		}
+// parseArgs parses the command line, which is either just flags or
+// "config print" followed by flags to print the configuration they give
+// instead of starting the worker.
+func parseArgs(args []string) (printConfig bool) {
+	if len(args) >= 2 && args[0] == "config" && args[1] == "print" {
+		printConfig, args = true, args[2:]
+	}
+	flag.CommandLine.Parse(args)
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected argument %q; the only command is config print\n", flag.Arg(0))
+		os.Exit(2)
+	}
+	return printConfig
+}
 
-		err = dbManager.CommitTx(tx)
-		if err != nil {
-			errRb := dbManager.RollbackTx(tx)
-			if errRb != nil {
-				log.Printf("Failed to rolback transaction")
-				return
-			}
-			log.Printf("Не удалось обновить аккаунт: %v", err)
+// work processes trades with hooks until one fails, sleeping for the poll
+// interval after each of them, and records every successful poll in mon.
+func work(dbManager *dbmanager.Manager, hooks []worker.Hook, poll *atomic.Int64, mon *monitor) {
+	for {
+		trade, err := worker.ProcessNext(dbManager, clk, hooks...)
+		if err == nil {
+			mon.polled(trade)
+		} else if !dbmanager.IsBusy(err) {
 			return
 		}
-
-		// Sleep for the specified interval
-		time.Sleep(*pollInterval)
+		time.Sleep(time.Duration(poll.Load()))
 	}
 }
+
+// fatal logs err and terminates the process. Only main may call it.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
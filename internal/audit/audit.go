@@ -0,0 +1,147 @@
+// Package audit implements the hash chain of the audit log. Each entry
+// commits to its payload and to the entry before it, so modifying, removing
+// or reordering entries breaks the chain from that point on.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	"strings"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionTradeSubmit   = "trade.submit"
+	ActionTradeProcess  = "trade.process"
+	ActionTradeAmend    = "trade.amend"
+	ActionTradeCancel   = "trade.cancel"
+	ActionTradeRequeue  = "trade.requeue"
+	ActionTradeImport   = "trade.import"
+	ActionAccountAdjust = "account.adjust"
+	ActionAccountCreate = "account.create"
+	ActionAccountUpdate = "account.update"
+	ActionGroupCreate   = "group.create"
+	ActionRebatesUpdate = "rebates.update"
+	ActionApiKeyCreate  = "apikey.create"
+	ActionApiKeyRevoke  = "apikey.revoke"
+	ActionLimitsUpdate  = "limits.update"
+)
+
+// Actions lists every action.
+var Actions = []string{
+	ActionTradeSubmit, ActionTradeProcess, ActionTradeAmend, ActionTradeCancel, ActionTradeRequeue, ActionTradeImport,
+	ActionAccountAdjust, ActionAccountCreate, ActionAccountUpdate, ActionGroupCreate, ActionRebatesUpdate,
+	ActionApiKeyCreate, ActionApiKeyRevoke, ActionLimitsUpdate,
+}
+
+// GenesisHash is the previous hash of the first entry.
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// TimeFormat is how entry times are hashed and stored.
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+var ErrBroken = errors.New("audit chain broken")
+
+type Entry struct {
+	Seq         int64           `json:"seq"`
+	At          time.Time       `json:"at"`
+	Actor       string          `json:"actor"`
+	Action      string          `json:"action"`
+	Payload     json.RawMessage `json:"payload"`
+	PayloadHash string          `json:"payload_hash"`
+	PrevHash    string          `json:"prev_hash"`
+	Hash        string          `json:"hash"`
+}
+
+// New returns the entry following prevSeq and prevHash; use 0 and
+// GenesisHash for the first entry. payload is stored as its JSON encoding.
+func New(prevSeq int64, prevHash string, at time.Time, actor, action string, payload any) (Entry, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Entry{}, fmt.Errorf("encode %s payload: %w", action, err)
+	}
+	e := Entry{
+		Seq:         prevSeq + 1,
+		At:          at.UTC().Truncate(time.Millisecond),
+		Actor:       actor,
+		Action:      action,
+		Payload:     data,
+		PayloadHash: sum(data),
+		PrevHash:    prevHash,
+	}
+	e.Hash = e.ComputeHash()
+	return e, nil
+}
+
+// ComputeHash hashes the fields of e other than Payload, which is covered by
+// PayloadHash, and Hash itself.
+func (e *Entry) ComputeHash() string {
+	// A JSON array keeps the fields apart whatever they contain.
+	data, _ := json.Marshal([]any{e.Seq, e.At.UTC().Format(TimeFormat), e.Actor, e.Action, e.PayloadHash, e.PrevHash})
+	return sum(data)
+}
+
+func sum(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// Verifier checks entries one by one, in order, starting with the first
+// entry of the log.
+type Verifier struct {
+	seq  int64
+	hash string
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{hash: GenesisHash}
+}
+
+// Check verifies e against itself and the entries checked before it.
+func (v *Verifier) Check(e Entry) error {
+	switch {
+	case e.Seq != v.seq+1:
+		return fmt.Errorf("%w: entry %d follows entry %d; entries are missing or reordered", ErrBroken, e.Seq, v.seq)
+	case e.PrevHash != v.hash:
+		return fmt.Errorf("%w: entry %d does not link to entry %d", ErrBroken, e.Seq, v.seq)
+	case sum(e.Payload) != e.PayloadHash:
+		return fmt.Errorf("%w: payload of entry %d was modified", ErrBroken, e.Seq)
+	case e.ComputeHash() != e.Hash:
+		return fmt.Errorf("%w: entry %d was modified", ErrBroken, e.Seq)
+	}
+	v.seq, v.hash = e.Seq, e.Hash
+	return nil
+}
+
+// Head returns the sequence number and hash of the last entry checked.
+// Entries removed from the end of the log can only be detected by comparing
+// the head with one recorded earlier.
+func (v *Verifier) Head() (int64, string) {
+	return v.seq, v.hash
+}
+
+type actorKey struct{}
+
+// WithActor sets the actor recorded for changes made with ctx, such as
+// "worker" for background processing.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns the actor set by WithActor, else the subject of the
+// authenticated caller, else "anonymous".
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	if p := auth.FromContext(ctx); p != nil {
+		return p.Subject
+	}
+	return "anonymous"
+}
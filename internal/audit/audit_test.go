@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/auth"
+	"testing"
+	"time"
+)
+
+func chain(t *testing.T, n int) []Entry {
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	entries := make([]Entry, 0, n)
+	seq, hash := int64(0), GenesisHash
+	for i := range n {
+		e, err := New(seq, hash, at.Add(time.Duration(i)*time.Second), "key:bo", ActionTradeSubmit, map[string]any{"trade_id": i + 1})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		entries = append(entries, e)
+		seq, hash = e.Seq, e.Hash
+	}
+	return entries
+}
+
+func TestVerifier(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func([]Entry) []Entry
+		valid  bool
+	}{
+		{name: "intact", tamper: func(es []Entry) []Entry { return es }, valid: true},
+		{name: "payload changed", tamper: func(es []Entry) []Entry {
+			es[1].Payload = []byte(`{"trade_id":99}`)
+			return es
+		}},
+		{name: "payload and its hash changed", tamper: func(es []Entry) []Entry {
+			es[1].Payload = []byte(`{"trade_id":99}`)
+			es[1].PayloadHash = sum(es[1].Payload)
+			return es
+		}},
+		{name: "actor changed", tamper: func(es []Entry) []Entry {
+			es[1].Actor = "key:other"
+			return es
+		}},
+		{name: "entry rehashed", tamper: func(es []Entry) []Entry {
+			es[1].Actor = "key:other"
+			es[1].Hash = es[1].ComputeHash()
+			return es
+		}},
+		{name: "entry removed", tamper: func(es []Entry) []Entry { return append(es[:1], es[2:]...) }},
+		{name: "entries swapped", tamper: func(es []Entry) []Entry {
+			es[1], es[2] = es[2], es[1]
+			return es
+		}},
+		{name: "tail removed", tamper: func(es []Entry) []Entry { return es[:2] }, valid: true},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		v := NewVerifier()
+		var err error
+		for _, e := range test.tamper(chain(t, 3)) {
+			if err = v.Check(e); err != nil {
+				break
+			}
+		}
+		if (err == nil) != test.valid {
+			t.Errorf("err = %v; want valid %v", err, test.valid)
+		}
+		if err != nil && !errors.Is(err, ErrBroken) {
+			t.Errorf("err = %v; want ErrBroken", err)
+		}
+	}
+}
+
+func TestActor(t *testing.T) {
+	ctx := context.Background()
+	if got := Actor(ctx); got != "anonymous" {
+		t.Errorf("Actor() = %q; want anonymous", got)
+	}
+	ctx = auth.WithPrincipal(ctx, &auth.Principal{Subject: "key:abc"})
+	if got := Actor(ctx); got != "key:abc" {
+		t.Errorf("Actor() = %q; want key:abc", got)
+	}
+	if got := Actor(WithActor(ctx, "worker")); got != "worker" {
+		t.Errorf("Actor() = %q; want worker", got)
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"net/http"
+	"strings"
+)
+
+const ApiKeyHeader = "X-API-Key"
+
+// API keys have the form "<id>.<secret>". Only the id and the SHA-256 of the
+// secret are stored.
+const keyIdLen = 16
+
+type KeyStore interface {
+	GetApiKey(ctx context.Context, id string) (*model.ApiKey, error)
+}
+
+// GenerateApiKey returns a new key id, the full token to hand to the client
+// and the hash to store.
+func GenerateApiKey() (id, token, hash string, err error) {
+	b := make([]byte, keyIdLen/2+32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	id = hex.EncodeToString(b[:keyIdLen/2])
+	secret := base64.RawURLEncoding.EncodeToString(b[keyIdLen/2:])
+	return id, id + "." + secret, HashSecret(secret), nil
+}
+
+// ParseApiKey splits a token into its id and secret.
+func ParseApiKey(token string) (id, secret string, err error) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", ErrInvalidCredentials
+	}
+	return id, secret, nil
+}
+
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+type ApiKeyAuthenticator struct {
+	Store KeyStore
+}
+
+// Authenticate accepts the key either in the X-API-Key header or as
+// "Authorization: ApiKey <key>".
+func (a *ApiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := r.Header.Get(ApiKeyHeader)
+	if token == "" {
+		scheme, value, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "ApiKey") {
+			return nil, ErrNoCredentials
+		}
+		token = strings.TrimSpace(value)
+	}
+
+	id, secret, err := ParseApiKey(token)
+	if err != nil {
+		return nil, err
+	}
+	key, err := a.Store.GetApiKey(r.Context(), id)
+	if err != nil {
+		return nil, fmt.Errorf("look up api key: %w", err)
+	}
+	if key == nil || key.RevokedAt != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(key.Hash)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{Subject: "key:" + key.Id, Scopes: key.Scopes, Accounts: key.Accounts, AllAccounts: len(key.Accounts) == 0}, nil
+}
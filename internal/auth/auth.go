@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	ScopeTradeWrite = "trade:write"
+	ScopeStatsRead  = "stats:read"
+	ScopeTradeAmend = "trade:amend"
+	ScopeAdmin      = "admin"
+)
+
+var Scopes = []string{ScopeTradeWrite, ScopeStatsRead, ScopeTradeAmend, ScopeAdmin}
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Subject identifies the caller, e.g. the API key id.
+	Subject string
+	Scopes  []string
+	// Accounts the caller may act on, unless AllAccounts allows every
+	// account.
+	Accounts    []string
+	AllAccounts bool
+}
+
+// HasScope reports whether the principal was granted scope. Admins have
+// every scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// CanAccess reports whether the principal may act on account. A nil
+// principal means authentication is disabled and everything is allowed.
+func (p *Principal) CanAccess(account string) bool {
+	return p.Unrestricted() || slices.Contains(p.Accounts, account)
+}
+
+// Unrestricted reports whether the principal may act on every account.
+func (p *Principal) Unrestricted() bool {
+	return p == nil || p.AllAccounts || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// Authenticator resolves the caller of a request. It returns
+// ErrNoCredentials when the request carries none it understands.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries each authenticator in turn and uses the first one that finds
+// credentials it understands.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+func (c Chain) Challenge() string {
+	challenges := make([]string, 0, len(c))
+	for _, a := range c {
+		challenges = append(challenges, challenge(a))
+	}
+	return strings.Join(challenges, ", ")
+}
+
+// challenge returns the WWW-Authenticate value for a.
+func challenge(a Authenticator) string {
+	if c, ok := a.(interface{ Challenge() string }); ok {
+		return c.Challenge()
+	}
+	return `ApiKey realm="broker"`
+}
+
+type ctxKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the principal of the request, or nil when
+// authentication is disabled.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(ctxKey{}).(*Principal)
+	return p
+}
+
+// ValidScope reports whether scope is one of the known scopes.
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type memStore map[string]*model.ApiKey
+
+func (s memStore) GetApiKey(_ context.Context, id string) (*model.ApiKey, error) {
+	return s[id], nil
+}
+
+func newStore(t *testing.T, scopes, accounts []string) (memStore, string) {
+	id, token, hash, err := GenerateApiKey()
+	if err != nil {
+		t.Fatalf("GenerateApiKey: %v", err)
+	}
+	return memStore{id: {Id: id, Hash: hash, Scopes: scopes, Accounts: accounts}}, token
+}
+
+func TestPrincipal(t *testing.T) {
+	var none *Principal
+	if !none.CanAccess("any") {
+		t.Error("nil principal must allow every account")
+	}
+
+	bound := &Principal{Scopes: []string{ScopeTradeWrite}, Accounts: []string{"123"}}
+	if !bound.CanAccess("123") || bound.CanAccess("456") || bound.Unrestricted() {
+		t.Error("bound principal must only access its accounts")
+	}
+	if !bound.HasScope(ScopeTradeWrite) || bound.HasScope(ScopeStatsRead) {
+		t.Error("unexpected scope check result")
+	}
+
+	unbound := &Principal{Scopes: []string{ScopeTradeWrite}}
+	if unbound.CanAccess("123") || unbound.Unrestricted() {
+		t.Error("principal without accounts must not access any account")
+	}
+
+	admin := &Principal{Scopes: []string{ScopeAdmin}, Accounts: []string{"123"}}
+	if !admin.HasScope(ScopeStatsRead) || !admin.CanAccess("456") || !admin.Unrestricted() {
+		t.Error("admin must have every scope and account")
+	}
+}
+
+func TestApiKeyAuthenticator(t *testing.T) {
+	store, token := newStore(t, []string{ScopeTradeWrite}, []string{"123"})
+	id, _, _ := ParseApiKey(token)
+	authn := &ApiKeyAuthenticator{Store: store}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		err    error
+	}{
+		{name: "x-api-key header", header: ApiKeyHeader, value: token},
+		{name: "authorization header", header: "Authorization", value: "ApiKey " + token},
+		{name: "no credentials", err: ErrNoCredentials},
+		{name: "bearer scheme", header: "Authorization", value: "Bearer " + token, err: ErrNoCredentials},
+		{name: "malformed", header: ApiKeyHeader, value: "garbage", err: ErrInvalidCredentials},
+		{name: "wrong secret", header: ApiKeyHeader, value: id + ".wrong", err: ErrInvalidCredentials},
+		{name: "unknown id", header: ApiKeyHeader, value: "ffff.secret", err: ErrInvalidCredentials},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		p, err := authn.Authenticate(req)
+		if err != test.err {
+			t.Fatalf("err = %v; want %v", err, test.err)
+		}
+		if err == nil && (p.Subject != "key:"+id || !p.CanAccess("123") || p.CanAccess("456")) {
+			t.Fatalf("unexpected principal %+v", p)
+		}
+	}
+
+	now := time.Now()
+	store[id].RevokedAt = &now
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(ApiKeyHeader, token)
+	if _, err := authn.Authenticate(req); err != ErrInvalidCredentials {
+		t.Errorf("revoked key: err = %v; want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestGuard_Require(t *testing.T) {
+	store, token := newStore(t, []string{ScopeStatsRead}, nil)
+	guard := &Guard{Authn: &ApiKeyAuthenticator{Store: store}}
+
+	var seen *Principal
+	handler := guard.Require(ScopeStatsRead, func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	})
+	tradeHandler := guard.Require(ScopeTradeWrite, func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		token      string
+		statusCode int
+	}{
+		{name: "missing key", handler: handler, statusCode: http.StatusUnauthorized},
+		{name: "valid key", handler: handler, token: token, statusCode: http.StatusOK},
+		{name: "missing scope", handler: tradeHandler, token: token, statusCode: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.token != "" {
+			req.Header.Set(ApiKeyHeader, test.token)
+		}
+		wrec := httptest.NewRecorder()
+		test.handler(wrec, req)
+		if wrec.Code != test.statusCode {
+			t.Fatalf("status = %d; want %d", wrec.Code, test.statusCode)
+		}
+	}
+	if seen == nil || !seen.HasScope(ScopeStatsRead) {
+		t.Errorf("principal not stored in context: %+v", seen)
+	}
+
+	var disabled *Guard
+	if disabled.Enabled() {
+		t.Error("nil guard must be disabled")
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// CertGrant gives the clients presenting a certificate with Subject the
+// scopes and accounts of a principal:
+//
+//	[
+//	  {"subject": "CN=algo-1,O=Acme", "scopes": ["trade:write", "stats:read"], "accounts": ["123"]},
+//	  {"subject": "CN=ops", "scopes": ["admin"]}
+//	]
+//
+// Subject is written like x509 prints it, most specific attribute first.
+type CertGrant struct {
+	Subject  string   `json:"subject"`
+	Scopes   []string `json:"scopes"`
+	Accounts []string `json:"accounts,omitempty"`
+}
+
+// CertAuthenticator maps verified TLS client certificates to principals by
+// their subject. The TLS server must verify the certificates against the
+// client CA; requests without a verified certificate carry no credentials.
+type CertAuthenticator struct {
+	grants map[string]CertGrant
+}
+
+func NewCertAuthenticator(grants []CertGrant) (*CertAuthenticator, error) {
+	a := &CertAuthenticator{grants: make(map[string]CertGrant, len(grants))}
+	for i, g := range grants {
+		if g.Subject == "" {
+			return nil, fmt.Errorf("grants[%d]: subject is required", i)
+		}
+		if _, ok := a.grants[g.Subject]; ok {
+			return nil, fmt.Errorf("grants[%d]: subject %q is granted twice", i, g.Subject)
+		}
+		for _, scope := range g.Scopes {
+			if !ValidScope(scope) {
+				return nil, fmt.Errorf("grants[%d]: unknown scope %q", i, scope)
+			}
+		}
+		a.grants[g.Subject] = g
+	}
+	return a, nil
+}
+
+// LoadCertGrants reads the JSON list of grants at path.
+func LoadCertGrants(path string) (*CertAuthenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read client certificate grants: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var grants []CertGrant
+	if err = dec.Decode(&grants); err != nil {
+		return nil, fmt.Errorf("%s: decode client certificate grants: %w", path, err)
+	}
+	a, err := NewCertAuthenticator(grants)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return a, nil
+}
+
+// Authenticate maps the leaf of the verified client certificate chain to
+// the grant of its subject, or of its common name alone.
+func (a *CertAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	g, ok := a.grant(cert)
+	if !ok {
+		return nil, fmt.Errorf("%w: no grant for certificate subject %q", ErrInvalidCredentials, cert.Subject.String())
+	}
+	return &Principal{Subject: "cert:" + g.Subject, Scopes: g.Scopes, Accounts: g.Accounts, AllAccounts: len(g.Accounts) == 0}, nil
+}
+
+func (a *CertAuthenticator) grant(cert *x509.Certificate) (CertGrant, bool) {
+	if g, ok := a.grants[cert.Subject.String()]; ok {
+		return g, true
+	}
+	if cert.Subject.CommonName == "" {
+		return CertGrant{}, false
+	}
+	g, ok := a.grants["CN="+cert.Subject.CommonName]
+	return g, ok
+}
+
+func (a *CertAuthenticator) Challenge() string {
+	return `ClientCertificate realm="broker"`
+}
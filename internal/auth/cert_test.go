@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCertAuthenticator(t *testing.T) {
+	a, err := NewCertAuthenticator([]CertGrant{
+		{Subject: "CN=algo-1,O=Acme", Scopes: []string{ScopeTradeWrite}, Accounts: []string{"123"}},
+		{Subject: "CN=ops", Scopes: []string{ScopeAdmin}},
+	})
+	if err != nil {
+		t.Fatalf("NewCertAuthenticator: %v", err)
+	}
+	request := func(subject *pkix.Name) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if subject != nil {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: *subject}}}}
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		subject *pkix.Name
+		want    string
+		err     error
+	}{
+		{name: "no client certificate", err: ErrNoCredentials},
+		{name: "full subject", subject: &pkix.Name{CommonName: "algo-1", Organization: []string{"Acme"}}, want: "cert:CN=algo-1,O=Acme"},
+		{name: "common name", subject: &pkix.Name{CommonName: "ops", Organization: []string{"Acme"}}, want: "cert:CN=ops"},
+		{name: "other organization", subject: &pkix.Name{CommonName: "algo-1", Organization: []string{"Evil"}}, err: ErrInvalidCredentials},
+		{name: "unknown subject", subject: &pkix.Name{CommonName: "intruder"}, err: ErrInvalidCredentials},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		p, err := a.Authenticate(request(test.subject))
+		if !errors.Is(err, test.err) {
+			t.Fatalf("Authenticate error = %v; want %v", err, test.err)
+		}
+		if err == nil && p.Subject != test.want {
+			t.Errorf("subject = %q; want %q", p.Subject, test.want)
+		}
+	}
+
+	p, _ := a.Authenticate(request(&pkix.Name{CommonName: "algo-1", Organization: []string{"Acme"}}))
+	if !p.HasScope(ScopeTradeWrite) || p.HasScope(ScopeAdmin) || !slices.Equal(p.Accounts, []string{"123"}) {
+		t.Errorf("principal = %+v; want the grant of algo-1", p)
+	}
+}
+
+func TestLoadCertGrants(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data string
+		err  bool
+	}{
+		{name: "valid", data: `[{"subject":"CN=algo-1","scopes":["trade:write"],"accounts":["123"]}]`},
+		{name: "unknown scope", data: `[{"subject":"CN=algo-1","scopes":["trade:delete"]}]`, err: true},
+		{name: "missing subject", data: `[{"scopes":["admin"]}]`, err: true},
+		{name: "subject granted twice", data: `[{"subject":"CN=ops","scopes":["admin"]},{"subject":"CN=ops","scopes":[]}]`, err: true},
+		{name: "unknown field", data: `[{"subject":"CN=ops","roles":["admin"]}]`, err: true},
+	}
+	for i, test := range tests {
+		t.Log(test.name)
+		path := filepath.Join(dir, "grants"+string(rune('a'+i))+".json")
+		if err := os.WriteFile(path, []byte(test.data), 0o644); err != nil {
+			t.Fatalf("write grants: %v", err)
+		}
+		if _, err := LoadCertGrants(path); (err != nil) != test.err {
+			t.Errorf("LoadCertGrants = %v; want error %v", err, test.err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval limits how often an unknown kid forces a reload.
+const minRefreshInterval = 10 * time.Second
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet is a cached JSON Web Key Set loaded from a file or an http(s) URL.
+// Keys are reloaded once TTL has passed, or earlier when a token refers to a
+// kid that is not in the cache. One caller loads the set at a time, without
+// holding the lock, so tokens signed with cached keys are checked while a
+// reload is under way.
+type KeySet struct {
+	Source string
+	TTL    time.Duration
+	Client *http.Client
+
+	now     func() time.Time
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	// loading is closed when the load under way, if any, completes; err is
+	// the error of the last load.
+	loading chan struct{}
+	err     error
+}
+
+func NewKeySet(source string, ttl time.Duration) *KeySet {
+	return &KeySet{Source: source, TTL: ttl, Client: &http.Client{Timeout: 10 * time.Second}, now: time.Now}
+}
+
+// Key returns the public key for kid. An empty kid matches the only key of
+// a single-key set. Callers that need a reload while another one loads the
+// set wait for its result.
+func (s *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	stale := s.keys == nil || now.Sub(s.fetched) >= s.TTL
+	if !stale && s.lookup(kid) == nil && now.Sub(s.fetched) >= minRefreshInterval {
+		stale = true
+	}
+	if stale {
+		if wait := s.loading; wait != nil {
+			s.mu.Unlock()
+			select {
+			case <-wait:
+				s.mu.Lock()
+			case <-ctx.Done():
+				s.mu.Lock()
+				return nil, ctx.Err()
+			}
+		} else {
+			s.reload(ctx, now)
+		}
+	}
+
+	if key := s.lookup(kid); key != nil {
+		return key, nil
+	}
+	if s.keys == nil {
+		return nil, s.err
+	}
+	return nil, ErrUnknownKey
+}
+
+// reload loads the set without holding the lock, which is held when it is
+// called and when it returns.
+func (s *KeySet) reload(ctx context.Context, now time.Time) {
+	done := make(chan struct{})
+	s.loading = done
+	s.mu.Unlock()
+	// the waiting callers share the load, which a cancelled request of its
+	// caller must not fail
+	keys, err := s.load(context.WithoutCancel(ctx))
+	s.mu.Lock()
+	s.loading = nil
+	close(done)
+
+	s.err = err
+	if err == nil {
+		s.keys, s.fetched = keys, now
+	} else if s.keys != nil {
+		// keep serving the last good set while the source is unavailable
+		s.fetched = now.Add(minRefreshInterval - s.TTL)
+	}
+}
+
+func (s *KeySet) lookup(kid string) crypto.PublicKey {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key
+		}
+	}
+	return s.keys[kid]
+}
+
+func (s *KeySet) load(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(s.Source, "http://") || strings.HasPrefix(s.Source, "https://") {
+		data, err = s.fetch(ctx)
+	} else {
+		data, err = os.ReadFile(s.Source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load jwks: %w", err)
+	}
+	return ParseJWKS(data)
+}
+
+func (s *KeySet) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS decodes the RSA and EC signing keys of a JWK Set. Keys of other
+// types or meant for encryption are skipped.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsa()
+		case "EC":
+			key, err = k.ecdsa()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks contains no usable keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) rsa() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA exponent")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jwk) ecdsa() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("point is not on curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
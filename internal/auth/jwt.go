@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AllAccountsClaim in the accounts claim of a token allows every account.
+const AllAccountsClaim = "*"
+
+type JWTConfig struct {
+	// Issuer and Audience must match the iss and aud claims when set.
+	Issuer   string
+	Audience string
+	// ScopesClaim holds the granted scopes, as a space separated string or
+	// an array. Scopes unknown to the broker are ignored.
+	ScopesClaim string
+	// AccountsClaim holds the accounts the token may act on, or "*" for
+	// every account. A token without it may act on no account, unless it
+	// has the admin scope.
+	AccountsClaim string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+type JWTAuthenticator struct {
+	Keys   *KeySet
+	Config JWTConfig
+	parser *jwt.Parser
+}
+
+func NewJWTAuthenticator(keys *KeySet, cfg JWTConfig) *JWTAuthenticator {
+	if cfg.ScopesClaim == "" {
+		cfg.ScopesClaim = "scope"
+	}
+	if cfg.AccountsClaim == "" {
+		cfg.AccountsClaim = "accounts"
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	return &JWTAuthenticator{Keys: keys, Config: cfg, parser: jwt.NewParser(opts...)}
+}
+
+// Authenticate validates an "Authorization: Bearer" token against the key
+// set and maps its claims to a principal.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	scheme, raw, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(strings.TrimSpace(raw), claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.Keys.Key(r.Context(), kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	sub, _ := claims.GetSubject()
+	p := &Principal{Subject: "jwt:" + sub}
+	for _, account := range stringsClaim(claims[a.Config.AccountsClaim]) {
+		if account == AllAccountsClaim {
+			p.AllAccounts = true
+			continue
+		}
+		p.Accounts = append(p.Accounts, account)
+	}
+	for _, scope := range stringsClaim(claims[a.Config.ScopesClaim]) {
+		if ValidScope(scope) {
+			p.Scopes = append(p.Scopes, scope)
+		}
+	}
+	return p, nil
+}
+
+func (a *JWTAuthenticator) Challenge() string {
+	return `Bearer realm="broker"`
+}
+
+// stringsClaim accepts both "a b c" and ["a","b","c"].
+func stringsClaim(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func b64(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatalf("marshal jwks: %v", err)
+	}
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64(key.N), "e": b64(big.NewInt(int64(key.E)))}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(key.X), "y": b64(key.Y)}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return s
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("rsa-1", rsaKey), ecJWK("ec-1", ecKey))
+	authn := NewJWTAuthenticator(NewKeySet(path, time.Hour), JWTConfig{Issuer: "portal", Audience: "broker"})
+
+	now := time.Now()
+	claims := func(mod func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub":      "alice",
+			"iss":      "portal",
+			"aud":      "broker",
+			"exp":      now.Add(time.Hour).Unix(),
+			"nbf":      now.Add(-time.Minute).Unix(),
+			"scope":    "openid trade:write stats:read",
+			"accounts": []string{"123"},
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{name: "rsa token", token: sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(nil))},
+		{name: "ec token", token: sign(t, jwt.SigningMethodES256, "ec-1", ecKey, claims(nil))},
+		{name: "expired", token: sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(func(c jwt.MapClaims) {
+			c["exp"] = now.Add(-time.Minute).Unix()
+		})), err: ErrInvalidCredentials},
+		{name: "missing exp", token: sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(func(c jwt.MapClaims) {
+			delete(c, "exp")
+		})), err: ErrInvalidCredentials},
+		{name: "not yet valid", token: sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(func(c jwt.MapClaims) {
+			c["nbf"] = now.Add(time.Hour).Unix()
+		})), err: ErrInvalidCredentials},
+		{name: "wrong audience", token: sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(func(c jwt.MapClaims) {
+			c["aud"] = "billing"
+		})), err: ErrInvalidCredentials},
+		{name: "wrong issuer", token: sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(func(c jwt.MapClaims) {
+			c["iss"] = "evil"
+		})), err: ErrInvalidCredentials},
+		{name: "unknown kid", token: sign(t, jwt.SigningMethodRS256, "rsa-2", otherKey, claims(nil)), err: ErrInvalidCredentials},
+		{name: "forged signature", token: sign(t, jwt.SigningMethodRS256, "rsa-1", otherKey, claims(nil)), err: ErrInvalidCredentials},
+		{name: "hmac token", token: sign(t, jwt.SigningMethodHS256, "rsa-1", []byte("secret"), claims(nil)), err: ErrInvalidCredentials},
+		{name: "garbage", token: "not.a.jwt", err: ErrInvalidCredentials},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+		p, err := authn.Authenticate(req)
+		if !errors.Is(err, test.err) || (test.err == nil && err != nil) {
+			t.Fatalf("err = %v; want %v", err, test.err)
+		}
+		if err != nil {
+			continue
+		}
+		if p.Subject != "jwt:alice" || !p.HasScope(ScopeTradeWrite) || !p.HasScope(ScopeStatsRead) ||
+			p.HasScope(ScopeAdmin) || !p.CanAccess("123") || p.CanAccess("456") {
+			t.Fatalf("unexpected principal %+v", p)
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		accounts any
+		all      bool
+	}{
+		{name: "no accounts claim"},
+		{name: "all accounts", accounts: "*", all: true},
+	} {
+		t.Log(test.name)
+		token := sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(func(c jwt.MapClaims) {
+			delete(c, "accounts")
+			if test.accounts != nil {
+				c["accounts"] = test.accounts
+			}
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		p, err := authn.Authenticate(req)
+		if err != nil {
+			t.Fatalf("err = %v", err)
+		}
+		if p.Unrestricted() != test.all || p.CanAccess("123") != test.all {
+			t.Errorf("principal %+v: unrestricted %v; want %v", p, p.Unrestricted(), test.all)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(ApiKeyHeader, "id.secret")
+	if _, err = authn.Authenticate(req); err != ErrNoCredentials {
+		t.Errorf("api key request: err = %v; want %v", err, ErrNoCredentials)
+	}
+}
+
+func TestKeySet_RefreshOnUnknownKid(t *testing.T) {
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, ecJWK("k1", first))
+	now := time.Now()
+	keys := NewKeySet(path, time.Hour)
+	keys.now = func() time.Time { return now }
+
+	if _, err = keys.Key(t.Context(), ""); err != nil {
+		t.Fatalf("single key lookup without kid: %v", err)
+	}
+
+	// rotated keys are not fetched again until minRefreshInterval passed
+	writeJWKS(t, path, ecJWK("k1", first), ecJWK("k2", second))
+	if _, err = keys.Key(t.Context(), "k2"); err != ErrUnknownKey {
+		t.Fatalf("k2 before refresh: err = %v; want %v", err, ErrUnknownKey)
+	}
+	now = now.Add(minRefreshInterval)
+	if _, err = keys.Key(t.Context(), "k2"); err != nil {
+		t.Fatalf("k2 after refresh: %v", err)
+	}
+
+	// a broken source keeps the cached keys
+	if err = os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err = keys.Key(t.Context(), "k1"); err != nil {
+		t.Fatalf("k1 with broken source: %v", err)
+	}
+}
+
+func TestKeySet_URL(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{ecJWK("k1", key)}})
+	}))
+	defer srv.Close()
+
+	if _, err = NewKeySet(srv.URL, time.Minute).Key(t.Context(), "k1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+}
+
+func TestKeySet_ConcurrentReload(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{ecJWK("k1", key)}})
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	now := time.Now()
+	keys := NewKeySet(srv.URL, time.Hour)
+	keys.now = func() time.Time { return now }
+	if _, err = keys.Key(t.Context(), "k1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+
+	// unknown kids reload the set, which hangs, once
+	now = now.Add(minRefreshInterval)
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys.Key(t.Context(), "k2")
+		}()
+	}
+	for fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// while the cached keys still check tokens
+	got := make(chan error)
+	go func() {
+		_, err := keys.Key(t.Context(), "k1")
+		got <- err
+	}()
+	select {
+	case err = <-got:
+		if err != nil {
+			t.Errorf("k1 during a reload: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("k1 blocked by a reload")
+	}
+
+	release <- struct{}{}
+	wg.Wait()
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetched %d times; want 2", n)
+	}
+}
+
+func TestChain(t *testing.T) {
+	store, token := newStore(t, []string{ScopeStatsRead}, nil)
+	chain := Chain{&ApiKeyAuthenticator{Store: store}, NewJWTAuthenticator(NewKeySet("missing.json", time.Minute), JWTConfig{})}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(ApiKeyHeader, token)
+	if _, err := chain.Authenticate(req); err != nil {
+		t.Errorf("api key through chain: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := chain.Authenticate(req); err != ErrNoCredentials {
+		t.Errorf("empty request: err = %v; want %v", err, ErrNoCredentials)
+	}
+	if got := chain.Challenge(); got != `ApiKey realm="broker", Bearer realm="broker"` {
+		t.Errorf("Challenge() = %q", got)
+	}
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"log/slog"
+	"net/http"
+)
+
+// Guard protects routes with an Authenticator. A Guard without one lets every
+// request through, which keeps authentication optional.
+type Guard struct {
+	Authn Authenticator
+}
+
+func (g *Guard) Enabled() bool {
+	return g != nil && g.Authn != nil
+}
+
+// Require authenticates the request and checks that the caller holds scope
+// before calling next. The principal is available via FromContext.
+func (g *Guard) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	if !g.Enabled() {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := g.Authn.Authenticate(r)
+		if err != nil {
+			if errors.Is(err, ErrNoCredentials) || errors.Is(err, ErrInvalidCredentials) {
+				slog.InfoContext(r.Context(), "authentication failed", "error", err)
+				w.Header().Set("WWW-Authenticate", challenge(g.Authn))
+				problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "missing or invalid credentials")
+				return
+			}
+			slog.ErrorContext(r.Context(), "authentication error", "error", err)
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeAuthUnavailable, "authentication unavailable")
+			return
+		}
+		if !p.HasScope(scope) {
+			slog.InfoContext(r.Context(), "missing scope", "subject", p.Subject, "scope", scope)
+			problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "scope "+scope+" is required")
+			return
+		}
+		next(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	}
+}
@@ -0,0 +1,240 @@
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// horizon bounds the search for the next session, so a market without any
+// session in sight reports no next open instead of scanning forever.
+const horizon = 31
+
+var ErrUnknownSymbol = errors.New("symbol has no market")
+
+// Session is a trading window on each of Days, as offsets from local
+// midnight. Open is before Close; sessions spanning midnight are written as
+// two sessions, which the calendar joins.
+type Session struct {
+	Days  []time.Weekday
+	Open  time.Duration
+	Close time.Duration
+}
+
+// Market is a set of weekly sessions in one time zone, with holidays on which
+// it stays closed all day.
+type Market struct {
+	Name     string
+	Location *time.Location
+	Sessions []Session
+	// Holidays maps local dates (YYYY-MM-DD) to the holiday name.
+	Holidays map[string]string
+	// Rollover is the local time of the daily swap rollover; HasRollover is
+	// false for markets without one.
+	Rollover    time.Duration
+	HasRollover bool
+}
+
+// Calendar maps symbols to markets. Symbols without a market of their own use
+// the default market, if any.
+type Calendar struct {
+	markets  map[string]*Market
+	symbols  map[string]string
+	fallback string
+}
+
+func New(markets []*Market, symbols map[string]string, fallback string) *Calendar {
+	c := &Calendar{markets: make(map[string]*Market, len(markets)), symbols: symbols, fallback: fallback}
+	for _, m := range markets {
+		c.markets[m.Name] = m
+	}
+	return c
+}
+
+// Market returns the market symbol is traded on.
+func (c *Calendar) Market(symbol string) (*Market, error) {
+	name, ok := c.symbols[symbol]
+	if !ok {
+		name = c.fallback
+	}
+	m, ok := c.markets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+	}
+	return m, nil
+}
+
+// Markets returns all markets, sorted by name.
+func (c *Calendar) Markets() []*Market {
+	markets := make([]*Market, 0, len(c.markets))
+	for _, m := range c.markets {
+		markets = append(markets, m)
+	}
+	sort.Slice(markets, func(i, j int) bool { return markets[i].Name < markets[j].Name })
+	return markets
+}
+
+// IsOpen reports whether symbol is tradable at.
+func (c *Calendar) IsOpen(symbol string, at time.Time) (bool, error) {
+	m, err := c.Market(symbol)
+	if err != nil {
+		return false, err
+	}
+	return m.IsOpen(at), nil
+}
+
+// Rollovers counts the rollovers of the market of symbol in (from, to].
+func (c *Calendar) Rollovers(symbol string, from, to time.Time) (int, error) {
+	m, err := c.Market(symbol)
+	if err != nil {
+		return 0, err
+	}
+	return m.Rollovers(from, to), nil
+}
+
+// Status describes a market at a given time. NextOpen and NextClose are
+// zero when no session starts within a month.
+type Status struct {
+	Market       string
+	Open         bool
+	Holiday      string
+	NextOpen     time.Time
+	NextClose    time.Time
+	NextRollover time.Time
+}
+
+func (c *Calendar) Status(symbol string, at time.Time) (Status, error) {
+	m, err := c.Market(symbol)
+	if err != nil {
+		return Status{}, err
+	}
+	return m.Status(at), nil
+}
+
+type interval struct {
+	start, end time.Time
+}
+
+func (m *Market) IsOpen(at time.Time) bool {
+	// Sessions never cross midnight, so only the sessions of the day matter.
+	for _, iv := range m.intervals(at, 1) {
+		if !at.Before(iv.start) && at.Before(iv.end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Market) Status(at time.Time) Status {
+	s := Status{Market: m.Name, Holiday: m.Holidays[at.In(m.Location).Format(time.DateOnly)]}
+	if cur, ok := m.current(at); ok {
+		s.Open = true
+		s.NextClose = cur.end
+		if next, ok := m.next(cur.end); ok {
+			s.NextOpen = next.start
+		}
+	} else if next, ok := m.next(at); ok {
+		s.NextOpen, s.NextClose = next.start, next.end
+	}
+	s.NextRollover, _ = m.NextRollover(at)
+	return s
+}
+
+// NextRollover returns the first rollover after at. A rollover takes place on
+// days the market is open just before the rollover time, so there is none
+// over weekends and holidays.
+func (m *Market) NextRollover(at time.Time) (time.Time, bool) {
+	if !m.HasRollover {
+		return time.Time{}, false
+	}
+	for day := range horizon + 1 {
+		d := localDay(at, day, m.Location)
+		r := wallClock(d, m.Rollover, m.Location)
+		if r.After(at) && m.IsOpen(r.Add(-time.Nanosecond)) {
+			return r, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Rollovers counts the rollovers in (from, to], e.g. the nights a position
+// held over that period accrues swap for.
+func (m *Market) Rollovers(from, to time.Time) int {
+	n := 0
+	for {
+		r, ok := m.NextRollover(from)
+		if !ok || r.After(to) {
+			return n
+		}
+		n++
+		from = r
+	}
+}
+
+// current returns the joined session containing at. Sessions joined across
+// days, like a trading week, end within the horizon.
+func (m *Market) current(at time.Time) (interval, bool) {
+	for _, iv := range m.intervals(at.AddDate(0, 0, -1), horizon+2) {
+		if !at.Before(iv.start) && at.Before(iv.end) {
+			return iv, true
+		}
+	}
+	return interval{}, false
+}
+
+// next returns the first joined session starting at or after at.
+func (m *Market) next(at time.Time) (interval, bool) {
+	for _, iv := range m.intervals(at.AddDate(0, 0, -1), horizon+1) {
+		if !iv.start.Before(at) {
+			return iv, true
+		}
+	}
+	return interval{}, false
+}
+
+// intervals lists the sessions of days local days starting with the day of
+// from, skipping holidays and joining sessions that touch.
+func (m *Market) intervals(from time.Time, days int) []interval {
+	var out []interval
+	for day := range days {
+		d := localDay(from, day, m.Location)
+		if _, holiday := m.Holidays[d.Format(time.DateOnly)]; holiday {
+			continue
+		}
+		var today []interval
+		for _, s := range m.Sessions {
+			if slices.Contains(s.Days, d.Weekday()) {
+				today = append(today, interval{wallClock(d, s.Open, m.Location), wallClock(d, s.Close, m.Location)})
+			}
+		}
+		sort.Slice(today, func(i, j int) bool { return today[i].start.Before(today[j].start) })
+		for _, iv := range today {
+			if n := len(out); n > 0 && !iv.start.After(out[n-1].end) {
+				if iv.end.After(out[n-1].end) {
+					out[n-1].end = iv.end
+				}
+				continue
+			}
+			out = append(out, iv)
+		}
+	}
+	return out
+}
+
+// localDay returns noon of the local date days after the date of t. Noon
+// exists on every date, unlike midnight in some zones on DST change days.
+func localDay(t time.Time, days int, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day()+days, 12, 0, 0, 0, loc)
+}
+
+// wallClock returns the instant offset after midnight on the local date of
+// day. Offsets are wall clock times, so a 09:00 session opens at 09:00 on DST
+// change days too; 24:00 is the next midnight.
+func wallClock(day time.Time, offset time.Duration, loc *time.Location) time.Time {
+	h := int(offset / time.Hour)
+	min := int(offset % time.Hour / time.Minute)
+	return time.Date(day.Year(), day.Month(), day.Day(), h, min, 0, 0, loc)
+}
@@ -0,0 +1,215 @@
+package calendar
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCalendar = `{
+  "default": "fx",
+  "symbols": {"JPNIDX": "tse", "DAXEUR": "xetra"},
+  "markets": {
+    "fx": {
+      "timezone": "America/New_York",
+      "rollover": "17:00",
+      "sessions": [
+        {"days": ["sun"], "open": "17:00", "close": "24:00"},
+        {"days": ["mon", "tue", "wed", "thu"], "open": "00:00", "close": "24:00"},
+        {"days": ["fri"], "open": "00:00", "close": "17:00"}
+      ],
+      "holidays": [{"date": "2024-12-25", "name": "Christmas Day"}]
+    },
+    "tse": {
+      "timezone": "Asia/Tokyo",
+      "sessions": [
+        {"days": ["mon", "tue", "wed", "thu", "fri"], "open": "09:00", "close": "11:30"},
+        {"days": ["mon", "tue", "wed", "thu", "fri"], "open": "12:30", "close": "15:00"}
+      ]
+    },
+    "xetra": {
+      "timezone": "Europe/Berlin",
+      "sessions": [{"days": ["mon", "tue", "wed", "thu", "fri"], "open": "09:00", "close": "17:30"}]
+    }
+  }
+}`
+
+func load(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("load location %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestCalendar_IsOpen(t *testing.T) {
+	c, err := Parse([]byte(testCalendar))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	ny, tokyo, berlin := load(t, "America/New_York"), load(t, "Asia/Tokyo"), load(t, "Europe/Berlin")
+
+	tests := []struct {
+		name   string
+		symbol string
+		at     time.Time
+		open   bool
+	}{
+		{name: "fx wednesday", symbol: "EURUSD", at: time.Date(2024, 3, 6, 3, 0, 0, 0, ny), open: true},
+		{name: "fx saturday", symbol: "EURUSD", at: time.Date(2024, 3, 9, 12, 0, 0, 0, ny), open: false},
+		{name: "fx friday close", symbol: "EURUSD", at: time.Date(2024, 3, 8, 17, 0, 0, 0, ny), open: false},
+		{name: "fx sunday open", symbol: "EURUSD", at: time.Date(2024, 3, 10, 17, 0, 0, 0, ny), open: true},
+		{name: "fx christmas", symbol: "EURUSD", at: time.Date(2024, 12, 25, 12, 0, 0, 0, ny), open: false},
+		{name: "tse morning", symbol: "JPNIDX", at: time.Date(2024, 3, 6, 10, 0, 0, 0, tokyo), open: true},
+		{name: "tse lunch break", symbol: "JPNIDX", at: time.Date(2024, 3, 6, 12, 0, 0, 0, tokyo), open: false},
+		{name: "tse afternoon", symbol: "JPNIDX", at: time.Date(2024, 3, 6, 12, 30, 0, 0, tokyo), open: true},
+		// Berlin switches to CEST on 2024-03-31: 09:00 local is 08:00 UTC
+		// on Friday and 07:00 UTC on Monday.
+		{name: "xetra open before DST", symbol: "DAXEUR", at: time.Date(2024, 3, 29, 8, 0, 0, 0, time.UTC), open: true},
+		{name: "xetra closed before DST", symbol: "DAXEUR", at: time.Date(2024, 3, 29, 7, 30, 0, 0, time.UTC), open: false},
+		{name: "xetra open after DST", symbol: "DAXEUR", at: time.Date(2024, 4, 1, 7, 0, 0, 0, time.UTC), open: true},
+		{name: "xetra closed after DST", symbol: "DAXEUR", at: time.Date(2024, 4, 1, 15, 30, 0, 0, time.UTC), open: false},
+		{name: "xetra local close", symbol: "DAXEUR", at: time.Date(2024, 4, 1, 17, 29, 0, 0, berlin), open: true},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		open, err := c.IsOpen(test.symbol, test.at)
+		if err != nil {
+			t.Fatalf("IsOpen: %v", err)
+		}
+		if open != test.open {
+			t.Errorf("IsOpen(%s, %s) = %v; want %v", test.symbol, test.at, open, test.open)
+		}
+	}
+
+	noDefault := New(c.Markets(), map[string]string{}, "")
+	if _, err = noDefault.IsOpen("EURUSD", time.Now()); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("IsOpen without default market = %v; want ErrUnknownSymbol", err)
+	}
+}
+
+func TestMarket_Status(t *testing.T) {
+	c, err := Parse([]byte(testCalendar))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	ny, tokyo := load(t, "America/New_York"), load(t, "Asia/Tokyo")
+	fx, _ := c.Market("EURUSD")
+	tse, _ := c.Market("JPNIDX")
+
+	tests := []struct {
+		name         string
+		market       *Market
+		at           time.Time
+		open         bool
+		holiday      string
+		nextOpen     time.Time
+		nextClose    time.Time
+		nextRollover time.Time
+	}{
+		{
+			// The sessions of the week join into one, closing on Friday.
+			name: "fx midweek", market: fx, at: time.Date(2024, 3, 6, 12, 0, 0, 0, ny), open: true,
+			nextClose:    time.Date(2024, 3, 8, 17, 0, 0, 0, ny),
+			nextOpen:     time.Date(2024, 3, 10, 17, 0, 0, 0, ny),
+			nextRollover: time.Date(2024, 3, 6, 17, 0, 0, 0, ny),
+		},
+		{
+			// US DST starts on Sunday 2024-03-10 at 02:00: the week opens at
+			// 17:00 EDT, 21:00 UTC instead of 22:00 UTC.
+			name: "fx weekend across DST", market: fx, at: time.Date(2024, 3, 9, 12, 0, 0, 0, ny), open: false,
+			nextOpen:     time.Date(2024, 3, 10, 21, 0, 0, 0, time.UTC),
+			nextClose:    time.Date(2024, 3, 15, 21, 0, 0, 0, time.UTC),
+			nextRollover: time.Date(2024, 3, 11, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			// US DST ends on Sunday 2024-11-03.
+			name: "fx weekend across DST end", market: fx, at: time.Date(2024, 11, 2, 12, 0, 0, 0, ny), open: false,
+			nextOpen:     time.Date(2024, 11, 3, 22, 0, 0, 0, time.UTC),
+			nextClose:    time.Date(2024, 11, 8, 22, 0, 0, 0, time.UTC),
+			nextRollover: time.Date(2024, 11, 4, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "fx christmas", market: fx, at: time.Date(2024, 12, 25, 12, 0, 0, 0, ny), open: false, holiday: "Christmas Day",
+			nextOpen:     time.Date(2024, 12, 26, 0, 0, 0, 0, ny),
+			nextClose:    time.Date(2024, 12, 27, 17, 0, 0, 0, ny),
+			nextRollover: time.Date(2024, 12, 26, 17, 0, 0, 0, ny),
+		},
+		{
+			name: "tse lunch", market: tse, at: time.Date(2024, 3, 6, 12, 0, 0, 0, tokyo), open: false,
+			nextOpen:  time.Date(2024, 3, 6, 12, 30, 0, 0, tokyo),
+			nextClose: time.Date(2024, 3, 6, 15, 0, 0, 0, tokyo),
+		},
+		{
+			name: "tse friday afternoon", market: tse, at: time.Date(2024, 3, 8, 14, 0, 0, 0, tokyo), open: true,
+			nextClose: time.Date(2024, 3, 8, 15, 0, 0, 0, tokyo),
+			nextOpen:  time.Date(2024, 3, 11, 9, 0, 0, 0, tokyo),
+		},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		s := test.market.Status(test.at)
+		if s.Open != test.open || s.Holiday != test.holiday {
+			t.Errorf("open = %v, holiday = %q; want %v, %q", s.Open, s.Holiday, test.open, test.holiday)
+		}
+		if !s.NextOpen.Equal(test.nextOpen) {
+			t.Errorf("next open = %s; want %s", s.NextOpen, test.nextOpen)
+		}
+		if !s.NextClose.Equal(test.nextClose) {
+			t.Errorf("next close = %s; want %s", s.NextClose, test.nextClose)
+		}
+		if !s.NextRollover.Equal(test.nextRollover) {
+			t.Errorf("next rollover = %s; want %s", s.NextRollover, test.nextRollover)
+		}
+	}
+}
+
+func TestMarket_Rollovers(t *testing.T) {
+	c, err := Parse([]byte(testCalendar))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	ny := load(t, "America/New_York")
+	fx, _ := c.Market("EURUSD")
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int
+	}{
+		{name: "one night", from: time.Date(2024, 3, 6, 12, 0, 0, 0, ny), to: time.Date(2024, 3, 7, 12, 0, 0, 0, ny), want: 1},
+		{name: "same day", from: time.Date(2024, 3, 6, 9, 0, 0, 0, ny), to: time.Date(2024, 3, 6, 16, 0, 0, 0, ny), want: 0},
+		{name: "over the weekend", from: time.Date(2024, 3, 8, 12, 0, 0, 0, ny), to: time.Date(2024, 3, 11, 12, 0, 0, 0, ny), want: 1},
+		{name: "over christmas", from: time.Date(2024, 12, 24, 12, 0, 0, 0, ny), to: time.Date(2024, 12, 27, 12, 0, 0, 0, ny), want: 2},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if got := fx.Rollovers(test.from, test.to); got != test.want {
+			t.Errorf("Rollovers = %d; want %d", got, test.want)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		calendar string
+		err      string
+	}{
+		{name: "missing default", calendar: `{"default":"x","markets":{}}`, err: `default market "x"`},
+		{name: "symbol of unknown market", calendar: `{"symbols":{"EURUSD":"x"},"markets":{}}`, err: `market "x" is not defined`},
+		{name: "bad timezone", calendar: `{"markets":{"a":{"timezone":"Mars/Base","sessions":[]}}}`, err: "invalid timezone"},
+		{name: "session across midnight", calendar: `{"markets":{"a":{"timezone":"UTC","sessions":[{"days":["mon"],"open":"22:00","close":"02:00"}]}}}`, err: "open must be before close"},
+		{name: "bad day", calendar: `{"markets":{"a":{"timezone":"UTC","sessions":[{"days":["xyz"],"open":"09:00","close":"17:00"}]}}}`, err: "invalid day"},
+		{name: "bad holiday", calendar: `{"markets":{"a":{"timezone":"UTC","sessions":[],"holidays":[{"date":"25.12.2024"}]}}}`, err: "invalid holiday date"},
+		{name: "bad rollover", calendar: `{"markets":{"a":{"timezone":"UTC","rollover":"24:00","sessions":[]}}}`, err: "invalid rollover"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		_, err := Parse([]byte(test.calendar))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Parse = %v; want error containing %q", err, test.err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config is the calendar file:
+//
+//	{
+//	  "default": "fx",
+//	  "symbols": {"DAXEUR": "xetra"},
+//	  "markets": {
+//	    "fx": {
+//	      "timezone": "America/New_York",
+//	      "rollover": "17:00",
+//	      "sessions": [
+//	        {"days": ["sun"], "open": "17:00", "close": "24:00"},
+//	        {"days": ["mon", "tue", "wed", "thu"], "open": "00:00", "close": "24:00"},
+//	        {"days": ["fri"], "open": "00:00", "close": "17:00"}
+//	      ],
+//	      "holidays": [{"date": "2025-12-25", "name": "Christmas Day"}]
+//	    }
+//	  }
+//	}
+type Config struct {
+	Default string                  `json:"default,omitempty"`
+	Symbols map[string]string       `json:"symbols,omitempty"`
+	Markets map[string]MarketConfig `json:"markets"`
+}
+
+type MarketConfig struct {
+	Timezone string          `json:"timezone"`
+	Rollover string          `json:"rollover,omitempty"`
+	Sessions []SessionConfig `json:"sessions"`
+	Holidays []HolidayConfig `json:"holidays,omitempty"`
+}
+
+type SessionConfig struct {
+	Days  []string `json:"days"`
+	Open  string   `json:"open"`
+	Close string   `json:"close"`
+}
+
+type HolidayConfig struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+func Load(path string) (*Calendar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read calendar: %w", err)
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func Parse(data []byte) (*Calendar, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("decode calendar: %w", err)
+	}
+	return cfg.Build()
+}
+
+// Build validates cfg and creates the calendar.
+func (cfg Config) Build() (*Calendar, error) {
+	if _, ok := cfg.Markets[cfg.Default]; cfg.Default != "" && !ok {
+		return nil, fmt.Errorf("default market %q is not defined", cfg.Default)
+	}
+	for symbol, market := range cfg.Symbols {
+		if _, ok := cfg.Markets[market]; !ok {
+			return nil, fmt.Errorf("symbol %s: market %q is not defined", symbol, market)
+		}
+	}
+	markets := make([]*Market, 0, len(cfg.Markets))
+	for name, mc := range cfg.Markets {
+		m, err := mc.build(name)
+		if err != nil {
+			return nil, fmt.Errorf("market %s: %w", name, err)
+		}
+		markets = append(markets, m)
+	}
+	return New(markets, cfg.Symbols, cfg.Default), nil
+}
+
+func (mc MarketConfig) build(name string) (*Market, error) {
+	loc, err := time.LoadLocation(mc.Timezone)
+	if err != nil || mc.Timezone == "" {
+		return nil, fmt.Errorf("invalid timezone %q", mc.Timezone)
+	}
+	m := &Market{Name: name, Location: loc, Holidays: make(map[string]string, len(mc.Holidays))}
+	if mc.Rollover != "" {
+		if m.Rollover, err = ParseClock(mc.Rollover); err != nil || m.Rollover >= 24*time.Hour {
+			return nil, fmt.Errorf("invalid rollover %q", mc.Rollover)
+		}
+		m.HasRollover = true
+	}
+	for i, sc := range mc.Sessions {
+		s, err := sc.build()
+		if err != nil {
+			return nil, fmt.Errorf("sessions[%d]: %w", i, err)
+		}
+		m.Sessions = append(m.Sessions, s)
+	}
+	for _, h := range mc.Holidays {
+		if _, err := time.Parse(time.DateOnly, h.Date); err != nil {
+			return nil, fmt.Errorf("invalid holiday date %q", h.Date)
+		}
+		m.Holidays[h.Date] = h.Name
+	}
+	return m, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseWeekday parses a three letter day name such as "mon".
+func ParseWeekday(s string) (time.Weekday, error) {
+	wd, ok := weekdays[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("invalid day %q", s)
+	}
+	return wd, nil
+}
+
+// FormatWeekday is the inverse of ParseWeekday.
+func FormatWeekday(d time.Weekday) string {
+	return strings.ToLower(d.String()[:3])
+}
+
+func (sc SessionConfig) build() (Session, error) {
+	if len(sc.Days) == 0 {
+		return Session{}, errors.New("days are required")
+	}
+	s := Session{}
+	for _, day := range sc.Days {
+		wd, err := ParseWeekday(day)
+		if err != nil {
+			return Session{}, err
+		}
+		s.Days = append(s.Days, wd)
+	}
+	var err error
+	if s.Open, err = ParseClock(sc.Open); err != nil {
+		return Session{}, fmt.Errorf("open: %w", err)
+	}
+	if s.Close, err = ParseClock(sc.Close); err != nil {
+		return Session{}, fmt.Errorf("close: %w", err)
+	}
+	if s.Open >= s.Close {
+		return Session{}, errors.New("open must be before close; split sessions spanning midnight")
+	}
+	return s, nil
+}
+
+// ParseClock parses "HH:MM" into an offset from midnight; "24:00" is the end
+// of the day.
+func ParseClock(s string) (time.Duration, error) {
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// FormatClock is the inverse of ParseClock.
+func FormatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
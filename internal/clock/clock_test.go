@@ -0,0 +1,22 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+	if !c.Now().Equal(start) {
+		t.Fatalf("Now() = %v; want %v", c.Now(), start)
+	}
+	c.Advance(1500 * time.Millisecond)
+	if want := start.Add(1500 * time.Millisecond); !c.Now().Equal(want) {
+		t.Errorf("after Advance, Now() = %v; want %v", c.Now(), want)
+	}
+	c.Set(start)
+	if !c.Now().Equal(start) {
+		t.Errorf("after Set, Now() = %v; want %v", c.Now(), start)
+	}
+}
@@ -0,0 +1,298 @@
+// Package config holds the settings shared by the server and the worker.
+// Every setting has a default, which a YAML file overrides, which
+// environment variables override, which command line flags override in
+// turn. A running process reloads the file and the environment on SIGHUP
+// and applies the settings marked as reloadable.
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/logging"
+	"gitlab.com/digineat/go-broker-test/internal/ratelimit"
+	"gitlab.com/digineat/go-broker-test/internal/tlsconfig"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the configuration file:
+//
+//	server:
+//	  listen: 127.0.0.1:8080
+//	  read_header_timeout: 10s
+//	  tls_cert: /etc/broker/server.pem
+//	  tls_key: /etc/broker/server.key
+//	db:
+//	  dsn: /data/data.db
+//	  max_open_conns: 4
+//	worker:
+//	  concurrency: 2
+//	  poll_interval: 100ms
+//	  health_listen: :8081
+//	trading:
+//	  lot_size: 100000
+//	limits:
+//	  key_rate: 50
+//	  key_burst: 100
+//	log:
+//	  level: info
+//	  format: json
+type Config struct {
+	Server  Server  `yaml:"server"`
+	DB      DB      `yaml:"db"`
+	Worker  Worker  `yaml:"worker"`
+	Trading Trading `yaml:"trading"`
+	Limits  Limits  `yaml:"limits"`
+	Log     Log     `yaml:"log"`
+
+	// sources maps the key of every setting to where its value came from.
+	sources map[string]string
+}
+
+type Server struct {
+	// Listen is the host:port of the HTTP server; a bare port listens on
+	// all interfaces.
+	Listen            string        `yaml:"listen"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	// WriteTimeout is 0 by default, as exports stream for as long as they
+	// take.
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// TLSCert and TLSKey are PEM files; the server speaks HTTPS when they
+	// are set.
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+	// TLSClientCA is the bundle client certificates are verified against;
+	// TLSClientAuth is require or optional.
+	TLSClientCA   string `yaml:"tls_client_ca"`
+	TLSClientAuth string `yaml:"tls_client_auth"`
+	// ReadyMaxPending is the queue depth at which /readyz fails; 0 means
+	// limits.max_pending.
+	ReadyMaxPending int `yaml:"ready_max_pending"`
+}
+
+type DB struct {
+	// DSN is the SQLite database file, optionally with connection
+	// parameters such as data.db?_busy_timeout=5000, which take precedence
+	// over the settings below.
+	DSN         string        `yaml:"dsn"`
+	JournalMode string        `yaml:"journal_mode"`
+	Synchronous string        `yaml:"synchronous"`
+	BusyTimeout time.Duration `yaml:"busy_timeout"`
+	// BusyRetries and BusyRetryDelay retry writes that still find the
+	// database locked after BusyTimeout, with a random backoff.
+	BusyRetries    int           `yaml:"busy_retries"`
+	BusyRetryDelay time.Duration `yaml:"busy_retry_delay"`
+	// SingleWriter writes through one connection and reads through a
+	// separate pool, which the settings below size.
+	SingleWriter    bool          `yaml:"single_writer"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type Worker struct {
+	// Concurrency is the number of trades the worker processes at once.
+	Concurrency  int           `yaml:"concurrency"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// HealthListen is the host:port of the health listener; empty disables
+	// it.
+	HealthListen string `yaml:"health_listen"`
+	// MaxPollAge is how long ago the last successful poll may be before the
+	// worker is reported unhealthy.
+	MaxPollAge time.Duration `yaml:"max_poll_age"`
+	// MaxPendingAge is how long the oldest pending trade may wait before
+	// the worker is reported not ready; 0 disables the check.
+	MaxPendingAge time.Duration `yaml:"max_pending_age"`
+}
+
+type Trading struct {
+	// LotSize is the number of units in a volume of 1.
+	LotSize float64 `yaml:"lot_size"`
+}
+
+// Limits are the default rate limits of POST /trades; overrides for single
+// keys and accounts are managed through /admin/limits.
+type Limits struct {
+	KeyRate      float64 `yaml:"key_rate"`
+	KeyBurst     int     `yaml:"key_burst"`
+	AccountRate  float64 `yaml:"account_rate"`
+	AccountBurst int     `yaml:"account_burst"`
+	MaxPending   int     `yaml:"max_pending"`
+}
+
+type Log struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// Default returns the configuration used when nothing is set.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Listen:            ":8080",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			TLSClientAuth:     tlsconfig.ClientAuthRequire,
+		},
+		DB: DB{
+			DSN:            "data.db",
+			JournalMode:    "wal",
+			Synchronous:    "normal",
+			BusyTimeout:    5 * time.Second,
+			BusyRetries:    5,
+			BusyRetryDelay: 20 * time.Millisecond,
+			SingleWriter:   true,
+			MaxIdleConns:   2,
+		},
+		Worker:  Worker{Concurrency: 1, PollInterval: 100 * time.Millisecond, MaxPollAge: 30 * time.Second, MaxPendingAge: 5 * time.Minute},
+		Trading: Trading{LotSize: 100000},
+		Limits:  Limits{KeyBurst: 1, AccountBurst: 1},
+		Log:     Log{Level: "info", Format: logging.FormatJSON},
+	}
+}
+
+// Validate checks every setting and reports all invalid ones.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(key string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	check("server.listen", validAddr(c.Server.Listen))
+	check("server.read_header_timeout", nonNegative(c.Server.ReadHeaderTimeout))
+	check("server.read_timeout", nonNegative(c.Server.ReadTimeout))
+	check("server.write_timeout", nonNegative(c.Server.WriteTimeout))
+	check("server.idle_timeout", nonNegative(c.Server.IdleTimeout))
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		check("server.tls_cert", errors.New("must be set together with server.tls_key"))
+	}
+	if c.Server.TLSClientCA != "" && c.Server.TLSCert == "" {
+		check("server.tls_client_ca", errors.New("requires server.tls_cert"))
+	}
+	if a := c.Server.TLSClientAuth; a != tlsconfig.ClientAuthRequire && a != tlsconfig.ClientAuthOptional {
+		check("server.tls_client_auth", fmt.Errorf("invalid client auth %q, expected require or optional", a))
+	}
+	check("server.ready_max_pending", atLeast(c.Server.ReadyMaxPending, 0))
+	if c.DB.DSN == "" {
+		check("db.dsn", errors.New("must not be empty"))
+	}
+	if !slices.Contains(journalModes, strings.ToLower(c.DB.JournalMode)) {
+		check("db.journal_mode", fmt.Errorf("invalid journal mode %q, expected one of %s", c.DB.JournalMode, strings.Join(journalModes, ", ")))
+	}
+	if !slices.Contains(synchronousLevels, strings.ToLower(c.DB.Synchronous)) {
+		check("db.synchronous", fmt.Errorf("invalid synchronous level %q, expected one of %s", c.DB.Synchronous, strings.Join(synchronousLevels, ", ")))
+	}
+	check("db.busy_timeout", nonNegative(c.DB.BusyTimeout))
+	check("db.busy_retries", atLeast(c.DB.BusyRetries, 0))
+	check("db.busy_retry_delay", nonNegative(c.DB.BusyRetryDelay))
+	check("db.max_open_conns", atLeast(c.DB.MaxOpenConns, 0))
+	check("db.max_idle_conns", atLeast(c.DB.MaxIdleConns, 0))
+	check("db.conn_max_lifetime", nonNegative(c.DB.ConnMaxLifetime))
+	check("worker.concurrency", atLeast(c.Worker.Concurrency, 1))
+	if c.Worker.PollInterval <= 0 {
+		check("worker.poll_interval", errors.New("must be positive"))
+	}
+	if c.Worker.HealthListen != "" {
+		check("worker.health_listen", validAddr(c.Worker.HealthListen))
+	}
+	if c.Worker.MaxPollAge <= c.Worker.PollInterval {
+		check("worker.max_poll_age", errors.New("must be longer than worker.poll_interval"))
+	}
+	check("worker.max_pending_age", nonNegative(c.Worker.MaxPendingAge))
+	if !(c.Trading.LotSize > 0) {
+		check("trading.lot_size", errors.New("must be positive"))
+	}
+	check("limits", c.Limits.RateLimit().Validate())
+	_, err := logging.ParseLevel(c.Log.Level)
+	check("log.level", err)
+	if f := strings.ToLower(c.Log.Format); f != logging.FormatJSON && f != logging.FormatText {
+		check("log.format", fmt.Errorf("invalid log format %q", c.Log.Format))
+	}
+	return errors.Join(errs...)
+}
+
+// RateLimit returns the limits without overrides for single keys and
+// accounts.
+func (l Limits) RateLimit() ratelimit.Config {
+	return ratelimit.Config{
+		Key:        ratelimit.Limit{Rate: l.KeyRate, Burst: l.KeyBurst},
+		Account:    ratelimit.Limit{Rate: l.AccountRate, Burst: l.AccountBurst},
+		MaxPending: l.MaxPending,
+	}
+}
+
+var (
+	journalModes      = []string{"wal", "delete", "truncate", "persist", "memory", "off"}
+	synchronousLevels = []string{"off", "normal", "full", "extra"}
+)
+
+// Open opens the database and sets m up to use it.
+func (d DB) Open(m *dbmanager.Manager) (*dbmanager.Conns, error) {
+	conns, err := dbmanager.Open(d.DSN, dbmanager.Options{
+		JournalMode:  d.JournalMode,
+		Synchronous:  d.Synchronous,
+		BusyTimeout:  d.BusyTimeout,
+		SingleWriter: d.SingleWriter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.Apply(conns.Read)
+	if err = m.InitDbManager(conns.Write); err != nil {
+		conns.Close()
+		return nil, err
+	}
+	m.SetReadDB(conns.Read)
+	m.SetBusyRetry(d.BusyRetries, d.BusyRetryDelay)
+	return conns, nil
+}
+
+// Apply sets the connection pool of db, the read pool of Open.
+func (d DB) Apply(db *sql.DB) {
+	db.SetMaxOpenConns(d.MaxOpenConns)
+	db.SetMaxIdleConns(d.MaxIdleConns)
+	db.SetConnMaxLifetime(d.ConnMaxLifetime)
+}
+
+// normalizeListen turns a bare port, which --listen used to take, into an
+// address on all interfaces.
+func normalizeListen(addr string) string {
+	if addr != "" && !strings.Contains(addr, ":") {
+		return ":" + addr
+	}
+	return addr
+}
+
+func validAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q, expected host:port", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+func nonNegative(d time.Duration) error {
+	if d < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+func atLeast(n, min int) error {
+	if n < min {
+		return fmt.Errorf("must be at least %d", min)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	file := write("broker.yaml", `
+server:
+  listen: 127.0.0.1:9000
+  read_timeout: 5s
+db:
+  dsn: /data/broker.db
+worker:
+  concurrency: 4
+log:
+  level: debug
+`)
+
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		args  []string
+		check func(c *Config) bool
+		// sources are the expected sources of some settings.
+		sources map[string]string
+		err     string
+	}{
+		{name: "defaults",
+			check: func(c *Config) bool {
+				return c.Server.Listen == ":8080" && c.DB.DSN == "data.db" && c.Worker.PollInterval == 100*time.Millisecond
+			},
+			sources: map[string]string{"server.listen": "default"}},
+		{name: "file", file: file,
+			check: func(c *Config) bool {
+				return c.Server.Listen == "127.0.0.1:9000" && c.Server.ReadTimeout == 5*time.Second &&
+					c.Server.IdleTimeout == 2*time.Minute && c.Worker.Concurrency == 4
+			},
+			sources: map[string]string{"server.read_timeout": "file " + file, "server.idle_timeout": "default"}},
+		{name: "env overrides file", file: file,
+			env: map[string]string{"BROKER_DB_DSN": "env.db", "BROKER_LIMITS_KEY_RATE": "2.5"},
+			check: func(c *Config) bool {
+				return c.DB.DSN == "env.db" && c.Limits.KeyRate == 2.5 && c.Log.Level == "debug"
+			},
+			sources: map[string]string{"db.dsn": "env BROKER_DB_DSN", "log.level": "file " + file}},
+		{name: "flags override env", file: file, env: map[string]string{"BROKER_DB_DSN": "env.db"},
+			args: []string{"--db", "flag.db", "--concurrency", "2"},
+			check: func(c *Config) bool {
+				return c.DB.DSN == "flag.db" && c.Worker.Concurrency == 2
+			},
+			sources: map[string]string{"db.dsn": "flag --db", "worker.concurrency": "flag --concurrency"}},
+		{name: "bare port listens on all interfaces", args: []string{"--listen", "8081"},
+			check: func(c *Config) bool { return c.Server.Listen == ":8081" }},
+		{name: "config file from environment", env: map[string]string{EnvFile: file},
+			check: func(c *Config) bool { return c.Worker.Concurrency == 4 }},
+		{name: "invalid settings are reported together",
+			env: map[string]string{"BROKER_WORKER_CONCURRENCY": "0", "BROKER_LOG_FORMAT": "xml"},
+			err: "worker.concurrency: must be at least 1\nlog.format: invalid log format \"xml\""},
+		{name: "invalid env value", env: map[string]string{"BROKER_WORKER_POLL_INTERVAL": "often"},
+			err: "BROKER_WORKER_POLL_INTERVAL: invalid duration \"often\""},
+		{name: "invalid limits", args: []string{"--key-rate", "5", "--key-burst", "0"},
+			err: "limits: key: burst must be at least 1"},
+		{name: "invalid listen address", args: []string{"--listen", "localhost:http"},
+			err: "server.listen: invalid port \"http\""},
+		{name: "tls certificate without key", args: []string{"--tls-cert", "server.pem", "--tls-client-auth", "never"},
+			err: "server.tls_cert: must be set together with server.tls_key\nserver.tls_client_auth: invalid client auth \"never\""},
+		{name: "health listener port", args: []string{"--health-listen", "8081"},
+			check: func(c *Config) bool { return c.Worker.HealthListen == ":8081" }},
+		{name: "poll age not above the poll interval", args: []string{"--poll", "1m", "--max-poll-age", "30s", "--max-pending-age", "-1s"},
+			err: "worker.max_poll_age: must be longer than worker.poll_interval\nworker.max_pending_age: must not be negative"},
+		{name: "sqlite tuning", args: []string{"--db-journal-mode", "WAL", "--db-single-writer=false", "--db-busy-timeout", "1s"},
+			env: map[string]string{"BROKER_DB_SYNCHRONOUS": "full"},
+			check: func(c *Config) bool {
+				return c.DB.JournalMode == "WAL" && !c.DB.SingleWriter && c.DB.BusyTimeout == time.Second && c.DB.Synchronous == "full"
+			},
+			sources: map[string]string{"db.single_writer": "flag --db-single-writer", "db.busy_retries": "default"}},
+		{name: "invalid sqlite tuning", args: []string{"--db-journal-mode", "fast", "--db-synchronous", "sometimes"},
+			err: "db.journal_mode: invalid journal mode \"fast\", expected one of wal, delete, truncate, persist, memory, off\n" +
+				"db.synchronous: invalid synchronous level \"sometimes\""},
+		{name: "invalid boolean", env: map[string]string{"BROKER_DB_SINGLE_WRITER": "maybe"},
+			err: "BROKER_DB_SINGLE_WRITER: invalid boolean \"maybe\""},
+		{name: "unknown setting in file", file: write("unknown.yaml", "server:\n  port: 8080\n"),
+			err: "field port not found"},
+		{name: "empty file", file: write("empty.yaml", ""),
+			check: func(c *Config) bool { return c.DB.DSN == "data.db" }},
+		{name: "missing file", file: filepath.Join(dir, "missing.yaml"), err: "read config"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if path, ok := test.env[EnvFile]; ok {
+			t.Setenv(EnvFile, path)
+		}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		l := Bind(fs, "server", "db", "worker", "limits", "log")
+		l.getenv = func(name string) string { return test.env[name] }
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatalf("parse flags: %v", err)
+		}
+		if test.file != "" {
+			l.Path = test.file
+		}
+		c, err := l.Load()
+		os.Unsetenv(EnvFile)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Load error = %v; want %q", err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if test.check != nil && !test.check(c) {
+			t.Errorf("config = %+v", c)
+		}
+		for key, want := range test.sources {
+			if c.sources[key] != want {
+				t.Errorf("source of %s = %q; want %q", key, c.sources[key], want)
+			}
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broker.yaml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+	}
+	write("server:\n  listen: :8080\nworker:\n  poll_interval: 1s\n")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := Bind(fs, "db", "worker", "log")
+	l.getenv = func(string) string { return "" }
+	l.Path = path
+	cur, err := l.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	write("server:\n  listen: :9090\ndb:\n  dsn: other.db\nworker:\n  poll_interval: 2s\nlog:\n  level: debug\n")
+	next, restart, err := l.Reload(cur)
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if next.Worker.PollInterval != 2*time.Second || next.Log.Level != "debug" {
+		t.Errorf("reloadable settings = %v, %q; want 2s, debug", next.Worker.PollInterval, next.Log.Level)
+	}
+	if next.DB.DSN != "data.db" || next.sources["db.dsn"] != "default" || next.Server.Listen != ":8080" {
+		t.Errorf("restart-only settings = %q (%s), %q; want the current ones", next.DB.DSN, next.sources["db.dsn"], next.Server.Listen)
+	}
+	// server.listen changed too, but the process does not use it.
+	if strings.Join(restart, ",") != "db.dsn" {
+		t.Errorf("restart = %v; want [db.dsn]", restart)
+	}
+
+	write("worker:\n  poll_interval: -1s\n")
+	if _, _, err = l.Reload(next); err == nil {
+		t.Error("Reload accepted an invalid configuration")
+	}
+}
+
+func TestPrint(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := Bind(fs, "worker")
+	l.getenv = func(name string) string {
+		if name == "BROKER_WORKER_CONCURRENCY" {
+			return "3"
+		}
+		return ""
+	}
+	if err := fs.Parse([]string{"--poll", "1s"}); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+	c, err := l.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var out strings.Builder
+	if err = l.Print(&out, c); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	want := "KEY                     VALUE  SOURCE\n" +
+		"worker.concurrency      3      env BROKER_WORKER_CONCURRENCY\n" +
+		"worker.poll_interval    1s     flag --poll\n" +
+		"worker.health_listen           default\n" +
+		"worker.max_poll_age     30s    default\n" +
+		"worker.max_pending_age  5m0s   default\n"
+	if out.String() != want {
+		t.Errorf("Print = %q; want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,367 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// EnvFile names the environment variable with the default of --config.
+const EnvFile = "BROKER_CONFIG"
+
+// envPrefix starts the environment variable of every setting, followed by
+// its key in upper case with dots replaced by underscores, e.g.
+// BROKER_DB_MAX_OPEN_CONNS.
+const envPrefix = "BROKER_"
+
+// Sources of a setting, followed by the file, variable or flag that set it.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+type setting struct {
+	// key is the section and name of the setting in the file.
+	key   string
+	flag  string
+	usage string
+	// reload marks settings that a running process changes on SIGHUP; the
+	// others keep their value until a restart.
+	reload bool
+	// field points to the setting in c.
+	field func(c *Config) any
+}
+
+var settings = []setting{
+	{key: "server.listen", flag: "listen", usage: "HTTP server listen address: host:port, or a port to listen on all interfaces",
+		field: func(c *Config) any { return &c.Server.Listen }},
+	{key: "server.read_header_timeout", flag: "read-header-timeout", usage: "time allowed to read request headers (0 disables)",
+		field: func(c *Config) any { return &c.Server.ReadHeaderTimeout }},
+	{key: "server.read_timeout", flag: "read-timeout", usage: "time allowed to read a whole request (0 disables)",
+		field: func(c *Config) any { return &c.Server.ReadTimeout }},
+	{key: "server.write_timeout", flag: "write-timeout", usage: "time allowed to write a response (0 disables)",
+		field: func(c *Config) any { return &c.Server.WriteTimeout }},
+	{key: "server.idle_timeout", flag: "idle-timeout", usage: "how long idle keep-alive connections stay open (0 disables)",
+		field: func(c *Config) any { return &c.Server.IdleTimeout }},
+	{key: "server.tls_cert", flag: "tls-cert", usage: "PEM certificate chain of the server; enables HTTPS",
+		field: func(c *Config) any { return &c.Server.TLSCert }},
+	{key: "server.tls_key", flag: "tls-key", usage: "PEM private key of --tls-cert",
+		field: func(c *Config) any { return &c.Server.TLSKey }},
+	{key: "server.tls_client_ca", flag: "tls-client-ca", usage: "PEM bundle of the CAs client certificates are verified against",
+		field: func(c *Config) any { return &c.Server.TLSClientCA }},
+	{key: "server.tls_client_auth", flag: "tls-client-auth", usage: "with --tls-client-ca: require a client certificate, or verify it when optional",
+		field: func(c *Config) any { return &c.Server.TLSClientAuth }},
+	{key: "server.ready_max_pending", flag: "ready-max-pending", usage: "pending trades at which /readyz fails (0 is --max-pending)",
+		field: func(c *Config) any { return &c.Server.ReadyMaxPending }},
+	{key: "db.dsn", flag: "db", usage: "path to SQLite database, optionally with connection parameters",
+		field: func(c *Config) any { return &c.DB.DSN }},
+	{key: "db.journal_mode", flag: "db-journal-mode", usage: "SQLite journal mode: wal, delete, truncate, persist, memory or off",
+		field: func(c *Config) any { return &c.DB.JournalMode }},
+	{key: "db.synchronous", flag: "db-synchronous", usage: "SQLite synchronous level: off, normal, full or extra",
+		field: func(c *Config) any { return &c.DB.Synchronous }},
+	{key: "db.busy_timeout", flag: "db-busy-timeout", usage: "how long a connection waits for the database lock",
+		field: func(c *Config) any { return &c.DB.BusyTimeout }},
+	{key: "db.busy_retries", flag: "db-busy-retries", usage: "times a write is retried once the busy timeout expired",
+		field: func(c *Config) any { return &c.DB.BusyRetries }},
+	{key: "db.busy_retry_delay", flag: "db-busy-retry-delay", usage: "upper bound of the random wait before the first retry, doubled for every further one",
+		field: func(c *Config) any { return &c.DB.BusyRetryDelay }},
+	{key: "db.single_writer", flag: "db-single-writer", usage: "write through one connection and read through a separate read-only pool",
+		field: func(c *Config) any { return &c.DB.SingleWriter }},
+	{key: "db.max_open_conns", flag: "db-max-open-conns", usage: "maximum open database connections for reads (0 is unlimited)", reload: true,
+		field: func(c *Config) any { return &c.DB.MaxOpenConns }},
+	{key: "db.max_idle_conns", flag: "db-max-idle-conns", usage: "maximum idle database connections", reload: true,
+		field: func(c *Config) any { return &c.DB.MaxIdleConns }},
+	{key: "db.conn_max_lifetime", flag: "db-conn-max-lifetime", usage: "how long a database connection is reused (0 is forever)", reload: true,
+		field: func(c *Config) any { return &c.DB.ConnMaxLifetime }},
+	{key: "worker.concurrency", flag: "concurrency", usage: "number of trades processed at once",
+		field: func(c *Config) any { return &c.Worker.Concurrency }},
+	{key: "worker.poll_interval", flag: "poll", usage: "polling interval", reload: true,
+		field: func(c *Config) any { return &c.Worker.PollInterval }},
+	{key: "worker.health_listen", flag: "health-listen", usage: "health listener address, host:port or a port (empty disables)",
+		field: func(c *Config) any { return &c.Worker.HealthListen }},
+	{key: "worker.max_poll_age", flag: "max-poll-age", usage: "time since the last successful poll after which the worker is unhealthy", reload: true,
+		field: func(c *Config) any { return &c.Worker.MaxPollAge }},
+	{key: "worker.max_pending_age", flag: "max-pending-age", usage: "wait of the oldest pending trade after which the worker is not ready (0 disables)", reload: true,
+		field: func(c *Config) any { return &c.Worker.MaxPendingAge }},
+	{key: "trading.lot_size", flag: "lot-size", usage: "number of units in a volume of 1",
+		field: func(c *Config) any { return &c.Trading.LotSize }},
+	{key: "limits.key_rate", flag: "key-rate", usage: "trades per second allowed per API key or token subject (0 disables)", reload: true,
+		field: func(c *Config) any { return &c.Limits.KeyRate }},
+	{key: "limits.key_burst", flag: "key-burst", usage: "burst size of the per-key limit", reload: true,
+		field: func(c *Config) any { return &c.Limits.KeyBurst }},
+	{key: "limits.account_rate", flag: "account-rate", usage: "trades per second allowed per account (0 disables)", reload: true,
+		field: func(c *Config) any { return &c.Limits.AccountRate }},
+	{key: "limits.account_burst", flag: "account-burst", usage: "burst size of the per-account limit", reload: true,
+		field: func(c *Config) any { return &c.Limits.AccountBurst }},
+	{key: "limits.max_pending", flag: "max-pending", usage: "reject trades with 503 when this many are pending (0 disables)", reload: true,
+		field: func(c *Config) any { return &c.Limits.MaxPending }},
+	{key: "log.level", flag: "log-level", usage: "log level: debug, info, warn or error", reload: true,
+		field: func(c *Config) any { return &c.Log.Level }},
+	{key: "log.format", flag: "log-format", usage: "log format: json or text",
+		field: func(c *Config) any { return &c.Log.Format }},
+}
+
+// Loader reads the configuration of a process from its file, the
+// environment and the flags bound to it.
+type Loader struct {
+	// Path is the YAML file; empty means none.
+	Path string
+	// sections are those the process uses; only their settings get flags
+	// and are printed.
+	sections []string
+	// flags holds the values of the flags given on the command line by key.
+	flags  map[string]string
+	getenv func(string) string
+}
+
+// Bind adds --config and a flag for every setting of sections to fs.
+func Bind(fs *flag.FlagSet, sections ...string) *Loader {
+	l := &Loader{sections: sections, flags: map[string]string{}, getenv: os.Getenv}
+	fs.StringVar(&l.Path, "config", os.Getenv(EnvFile), "YAML configuration file (default $"+EnvFile+")")
+	def := Default()
+	for _, s := range l.settings() {
+		fs.Var(&flagValue{setting: s, values: l.flags, def: format(s.field(def))}, s.flag, s.usage)
+	}
+	return l
+}
+
+func (l *Loader) settings() []setting {
+	var out []setting
+	for _, s := range settings {
+		if slices.Contains(l.sections, section(s.key)) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Load builds and validates the configuration.
+func (l *Loader) Load() (*Config, error) {
+	c := Default()
+	c.sources = make(map[string]string, len(settings))
+	for _, s := range settings {
+		c.sources[s.key] = SourceDefault
+	}
+	if l.Path != "" {
+		if err := c.readFile(l.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, s := range settings {
+		name := envName(s.key)
+		v := l.getenv(name)
+		if v == "" {
+			continue
+		}
+		if err := parse(s.field(c), v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		c.sources[s.key] = SourceEnv + " " + name
+	}
+	for _, s := range l.settings() {
+		if v, ok := l.flags[s.key]; ok {
+			parse(s.field(c), v)
+			c.sources[s.key] = SourceFlag + " --" + s.flag
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	c.Server.Listen = normalizeListen(c.Server.Listen)
+	c.Worker.HealthListen = normalizeListen(c.Worker.HealthListen)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// readFile applies the settings of the YAML file at path to c.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err = dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var present map[string]map[string]yaml.Node
+	if err = yaml.Unmarshal(data, &present); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for sec, keys := range present {
+		for name := range keys {
+			c.sources[sec+"."+name] = SourceFile + " " + path
+		}
+	}
+	return nil
+}
+
+// Reload loads the configuration again for a process running with cur.
+// Settings that need a restart keep their current value; those that
+// changed in the file, the environment or the flags are returned.
+func (l *Loader) Reload(cur *Config) (*Config, []string, error) {
+	next, err := l.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	var restart []string
+	for _, s := range settings {
+		if s.reload || format(s.field(cur)) == format(s.field(next)) {
+			continue
+		}
+		reflect.ValueOf(s.field(next)).Elem().Set(reflect.ValueOf(s.field(cur)).Elem())
+		next.sources[s.key] = cur.sources[s.key]
+		if slices.Contains(l.sections, section(s.key)) {
+			restart = append(restart, s.key)
+		}
+	}
+	return next, restart, nil
+}
+
+// Watch reloads the configuration on every SIGHUP until ctx is done and
+// passes the previous and the new configuration to apply. An invalid
+// configuration is logged and ignored, so the process keeps the last valid
+// one.
+func (l *Loader) Watch(ctx context.Context, cfg *Config, apply func(prev, next *Config)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		next, restart, err := l.Reload(cfg)
+		if err != nil {
+			slog.Error("configuration not reloaded", "error", err)
+			continue
+		}
+		for _, key := range restart {
+			slog.Warn("setting changed, restart required", "key", key)
+		}
+		apply(cfg, next)
+		cfg = next
+		slog.Info("configuration reloaded", "path", l.Path)
+	}
+}
+
+// Print writes the effective value and the source of the settings the
+// process uses.
+func (l *Loader) Print(w io.Writer, c *Config) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, s := range l.settings() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.key, format(s.field(c)), c.sources[s.key])
+	}
+	return tw.Flush()
+}
+
+func section(key string) string {
+	sec, _, _ := strings.Cut(key, ".")
+	return sec
+}
+
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// parse sets the setting v points to from its text form.
+func parse(v any, s string) error {
+	switch v := v.(type) {
+	case *string:
+		*v = s
+	case *int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		*v = n
+	case *float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		*v = f
+	case *bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		*v = b
+	case *time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		*v = d
+	default:
+		panic(fmt.Sprintf("config: unsupported setting type %T", v))
+	}
+	return nil
+}
+
+// format returns the text form of the setting v points to.
+func format(v any) string {
+	switch v := v.(type) {
+	case *string:
+		return *v
+	case *int:
+		return strconv.Itoa(*v)
+	case *float64:
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	case *bool:
+		return strconv.FormatBool(*v)
+	case *time.Duration:
+		return v.String()
+	}
+	panic(fmt.Sprintf("config: unsupported setting type %T", v))
+}
+
+// flagValue records a flag given on the command line, so that it overrides
+// the file and the environment when the configuration is loaded.
+type flagValue struct {
+	setting setting
+	values  map[string]string
+	def     string
+}
+
+func (f *flagValue) String() string {
+	return f.def
+}
+
+func (f *flagValue) Set(s string) error {
+	if err := parse(f.setting.field(Default()), s); err != nil {
+		return err
+	}
+	f.values[f.setting.key] = s
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be given as --flag without a value.
+func (f *flagValue) IsBoolFlag() bool {
+	_, ok := f.setting.field(Default()).(*bool)
+	return ok
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"time"
+)
+
+const Accounts_table = "accounts"
+
+var (
+	ErrAccountExists = errors.New("account already exists")
+	ErrAccountClosed = errors.New("account is closed")
+)
+
+func (m *Manager) CreateAccounts() error {
+	schemaSQL := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]s (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    currency TEXT NOT NULL,
+    account_group TEXT NOT NULL DEFAULT '',
+    leverage INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS %[1]s_status_idx ON %[1]s (status, id);
+`, Accounts_table)
+	_, err := m.db.Exec(schemaSQL)
+	return err
+}
+
+// CreateTradingAccount stores a new account. It returns ErrAccountExists if
+// the id is taken.
+func (m *Manager) CreateTradingAccount(ctx context.Context, a *model.TradingAccount) error {
+	return m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		created, err := m.insertTradingAccount(ctx, tx, a)
+		if err != nil {
+			return err
+		}
+		if !created {
+			return fmt.Errorf("%s: %w", a.Id, ErrAccountExists)
+		}
+		return nil
+	})
+}
+
+// EnsureTradingAccount returns the account with the id of a, creating it
+// from a if there is none.
+func (m *Manager) EnsureTradingAccount(ctx context.Context, a *model.TradingAccount) (account *model.TradingAccount, err error) {
+	err = m.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := m.insertTradingAccount(ctx, tx, a); err != nil {
+			return err
+		}
+		account, err = scanTradingAccount(tx.QueryRowContext(ctx, selectTradingAccount+` WHERE id = ?`, a.Id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// insertTradingAccount reports false, without error, when the id is taken.
+func (m *Manager) insertTradingAccount(ctx context.Context, tx *sql.Tx, a *model.TradingAccount) (bool, error) {
+	reqSQL := fmt.Sprintf(`
+INSERT INTO %s (id, name, currency, account_group, leverage, status, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(id) DO NOTHING
+`, Accounts_table)
+	res, err := tx.ExecContext(ctx, reqSQL,
+		a.Id, a.Name, a.Currency, a.Group, a.Leverage, a.Status, formatTime(&a.CreatedAt), formatTime(&a.UpdatedAt))
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	return true, m.appendAudit(ctx, tx, audit.ActionAccountCreate, a)
+}
+
+// UpdateTradingAccount stores a. Closed accounts can not be changed; for
+// them ErrAccountClosed is returned.
+func (m *Manager) UpdateTradingAccount(ctx context.Context, a *model.TradingAccount) error {
+	return m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		reqSQL := fmt.Sprintf(`
+UPDATE %s SET name = ?, currency = ?, account_group = ?, leverage = ?, status = ?, updated_at = ?
+ WHERE id = ? AND status <> ?
+`, Accounts_table)
+		res, err := tx.ExecContext(ctx, reqSQL,
+			a.Name, a.Currency, a.Group, a.Leverage, a.Status, formatTime(&a.UpdatedAt), a.Id, model.AccountStatusClosed)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("%s: %w", a.Id, ErrAccountClosed)
+		}
+		return m.appendAudit(ctx, tx, audit.ActionAccountUpdate, a)
+	})
+}
+
+// GetTradingAccount returns the account with the given id, or nil if there
+// is none.
+func (m *Manager) GetTradingAccount(ctx context.Context, id string) (*model.TradingAccount, error) {
+	a, err := scanTradingAccount(m.reader().QueryRowContext(ctx, selectTradingAccount+` WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return a, err
+}
+
+// ListTradingAccounts returns the accounts with the given status, or all
+// accounts if status is empty, ordered by id.
+func (m *Manager) ListTradingAccounts(ctx context.Context, status string) ([]model.TradingAccount, error) {
+	rows, err := m.reader().QueryContext(ctx, selectTradingAccount+` WHERE ? IN ('', status) ORDER BY id`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []model.TradingAccount{}
+	for rows.Next() {
+		a, err := scanTradingAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *a)
+	}
+	return accounts, rows.Err()
+}
+
+var selectTradingAccount = fmt.Sprintf(`
+SELECT id, name, currency, account_group, leverage, status, created_at, updated_at FROM %s`, Accounts_table)
+
+func scanTradingAccount(row rowScanner) (*model.TradingAccount, error) {
+	var a model.TradingAccount
+	var createdAt, updatedAt string
+	if err := row.Scan(&a.Id, &a.Name, &a.Currency, &a.Group, &a.Leverage, &a.Status, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if a.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, fmt.Errorf("account %s: invalid created_at %q", a.Id, createdAt)
+	}
+	if a.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt); err != nil {
+		return nil, fmt.Errorf("account %s: invalid updated_at %q", a.Id, updatedAt)
+	}
+	return &a, nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTradingAccounts(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	account := model.TradingAccount{Id: "A1", Name: "Alice", Currency: "EUR", Group: "retail", Leverage: 100,
+		Status: model.AccountStatusActive, CreatedAt: at, UpdatedAt: at}
+	if err := m.CreateTradingAccount(t.Context(), &account); err != nil {
+		t.Fatalf("CreateTradingAccount: %v", err)
+	}
+	if err := m.CreateTradingAccount(t.Context(), &account); !errors.Is(err, ErrAccountExists) {
+		t.Errorf("CreateTradingAccount twice = %v; want ErrAccountExists", err)
+	}
+
+	// ensuring an existing account keeps it as it is
+	got, err := m.EnsureTradingAccount(t.Context(), &model.TradingAccount{Id: "A1", Name: "A1", Currency: "USD",
+		Leverage: 1, Status: model.AccountStatusActive, CreatedAt: at, UpdatedAt: at})
+	if err != nil || *got != account {
+		t.Errorf("EnsureTradingAccount = %+v, %v; want %+v", got, err, account)
+	}
+	if _, err = m.EnsureTradingAccount(t.Context(), &model.TradingAccount{Id: "B2", Name: "B2", Currency: "USD",
+		Leverage: 1, Status: model.AccountStatusActive, CreatedAt: at, UpdatedAt: at}); err != nil {
+		t.Fatalf("EnsureTradingAccount: %v", err)
+	}
+
+	account.Status, account.UpdatedAt = model.AccountStatusClosed, at.Add(time.Hour)
+	if err = m.UpdateTradingAccount(t.Context(), &account); err != nil {
+		t.Fatalf("UpdateTradingAccount: %v", err)
+	}
+	account.Status = model.AccountStatusActive
+	if err = m.UpdateTradingAccount(t.Context(), &account); !errors.Is(err, ErrAccountClosed) {
+		t.Errorf("UpdateTradingAccount of closed account = %v; want ErrAccountClosed", err)
+	}
+
+	if got, err = m.GetTradingAccount(t.Context(), "A1"); err != nil || got.Status != model.AccountStatusClosed ||
+		!got.UpdatedAt.Equal(at.Add(time.Hour)) {
+		t.Errorf("GetTradingAccount = %+v, %v", got, err)
+	}
+	if got, err = m.GetTradingAccount(t.Context(), "Z9"); got != nil || err != nil {
+		t.Errorf("GetTradingAccount of unknown account = %+v, %v; want nil, nil", got, err)
+	}
+
+	tests := []struct {
+		status string
+		ids    []string
+	}{
+		{status: "", ids: []string{"A1", "B2"}},
+		{status: model.AccountStatusActive, ids: []string{"B2"}},
+		{status: model.AccountStatusClosed, ids: []string{"A1"}},
+		{status: model.AccountStatusFrozen},
+	}
+	for _, test := range tests {
+		t.Log("list " + test.status)
+		accounts, err := m.ListTradingAccounts(t.Context(), test.status)
+		if err != nil {
+			t.Fatalf("ListTradingAccounts: %v", err)
+		}
+		var ids []string
+		for _, a := range accounts {
+			ids = append(ids, a.Id)
+		}
+		if !slices.Equal(ids, test.ids) {
+			t.Errorf("ids = %v; want %v", ids, test.ids)
+		}
+	}
+
+	// creations and updates are audited, but not the no-op ensure
+	var actions []string
+	entries, err := m.ListAudit(t.Context(), 1, 10)
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	want := []string{audit.ActionAccountCreate, audit.ActionAccountCreate, audit.ActionAccountUpdate}
+	if !slices.Equal(actions, want) {
+		t.Errorf("audit actions = %v; want %v", actions, want)
+	}
+}
+
+func TestCreateAccountTrade(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	newTrade := func(key string) *model.Trade {
+		return &model.Trade{Account: "C3", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.2, Side: "buy",
+			ReceivedAt: at, ImportKey: key}
+	}
+	if err := m.CreateTrade(t.Context(), newTrade("k1")); err != nil {
+		t.Fatalf("CreateTrade: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		err  error
+		// exists tells whether the account exists afterwards.
+		exists bool
+	}{
+		{name: "duplicate trade creates no account", key: "k1", err: ErrDuplicateTrade},
+		{name: "account created with the trade", key: "k2", exists: true},
+		{name: "existing account kept", key: "k3", exists: true},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		account := model.NewTradingAccount("C3", at)
+		trade := newTrade(test.key)
+		if err := m.CreateAccountTrade(t.Context(), account, trade); !errors.Is(err, test.err) {
+			t.Fatalf("CreateAccountTrade = %v; want %v", err, test.err)
+		}
+		if test.err == nil && trade.Id == 0 {
+			t.Error("trade id not set")
+		}
+		got, err := m.GetTradingAccount(t.Context(), "C3")
+		if err != nil {
+			t.Fatalf("GetTradingAccount: %v", err)
+		}
+		if (got != nil) != test.exists {
+			t.Errorf("account = %+v; want exists %v", got, test.exists)
+		}
+	}
+}
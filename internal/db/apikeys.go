@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"strings"
+	"time"
+)
+
+const ApiKeys_table = "api_keys"
+
+func (m *Manager) CreateApiKeys() error {
+	schemaSQL := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    accounts TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+`, ApiKeys_table)
+	_, err := m.db.Exec(schemaSQL)
+	return err
+}
+
+func (m *Manager) CreateApiKey(ctx context.Context, key *model.ApiKey) error {
+	reqSQL := fmt.Sprintf(`
+INSERT INTO %s (id, name, hash, scopes, accounts, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+`, ApiKeys_table)
+	return m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		_, err = tx.ExecContext(ctx, reqSQL,
+			key.Id, key.Name, key.Hash, strings.Join(key.Scopes, " "), strings.Join(key.Accounts, " "), key.CreatedAt.UTC())
+		if err != nil {
+			return err
+		}
+		err = m.appendAudit(ctx, tx, audit.ActionApiKeyCreate, map[string]any{
+			"id":       key.Id,
+			"name":     key.Name,
+			"scopes":   key.Scopes,
+			"accounts": key.Accounts,
+		})
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// GetApiKey returns the key with the given id, or nil if there is none.
+func (m *Manager) GetApiKey(ctx context.Context, id string) (*model.ApiKey, error) {
+	reqSQL := fmt.Sprintf(`
+SELECT id, name, hash, scopes, accounts, created_at, revoked_at FROM %s WHERE id = ?
+`, ApiKeys_table)
+	key, err := scanApiKey(m.reader().QueryRowContext(ctx, reqSQL, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return key, err
+}
+
+func (m *Manager) ListApiKeys(ctx context.Context) ([]model.ApiKey, error) {
+	reqSQL := fmt.Sprintf(`
+SELECT id, name, hash, scopes, accounts, created_at, revoked_at FROM %s ORDER BY created_at, rowid
+`, ApiKeys_table)
+	rows, err := m.reader().QueryContext(ctx, reqSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.ApiKey{}
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeApiKey marks the key as revoked. It reports false when no active key
+// with that id exists.
+func (m *Manager) RevokeApiKey(ctx context.Context, id string, at time.Time) (bool, error) {
+	reqSQL := fmt.Sprintf(`
+UPDATE %s SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL
+`, ApiKeys_table)
+	revoked := false
+	err := m.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, reqSQL, at.UTC(), id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			revoked = false
+			return err
+		}
+		revoked = true
+		return m.appendAudit(ctx, tx, audit.ActionApiKeyRevoke, map[string]any{"id": id})
+	})
+	return revoked && err == nil, err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanApiKey(row rowScanner) (*model.ApiKey, error) {
+	var key model.ApiKey
+	var scopes, accounts string
+	var revokedAt sql.NullTime
+	if err := row.Scan(&key.Id, &key.Name, &key.Hash, &scopes, &accounts, &key.CreatedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.Accounts = strings.Fields(accounts)
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"time"
+)
+
+const Audit_table = "audit_log"
+
+// CreateAuditLog creates the audit log. Triggers reject updates and
+// deletes; changes made around them are caught by audit.Verifier.
+func (m *Manager) CreateAuditLog() error {
+	schemaSQL := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]s (
+    seq INTEGER PRIMARY KEY,
+    at TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    payload_hash TEXT NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL
+);
+CREATE TRIGGER IF NOT EXISTS %[1]s_no_update BEFORE UPDATE ON %[1]s
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+CREATE TRIGGER IF NOT EXISTS %[1]s_no_delete BEFORE DELETE ON %[1]s
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+`, Audit_table)
+	_, err := m.db.Exec(schemaSQL)
+	return err
+}
+
+// appendAudit records action in tx, so the entry is committed together with
+// the change it describes. tx must already hold the write lock, i.e. have
+// made its change, so that no other writer can append in between.
+func (m *Manager) appendAudit(ctx context.Context, tx *sql.Tx, action string, payload any) error {
+	prevSeq, prevHash := int64(0), audit.GenesisHash
+	err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT seq, hash FROM %s ORDER BY seq DESC LIMIT 1`, Audit_table)).
+		Scan(&prevSeq, &prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("read audit head: %w", err)
+	}
+	e, err := audit.New(prevSeq, prevHash, m.now(), audit.Actor(ctx), action, payload)
+	if err != nil {
+		return err
+	}
+	reqSQL := fmt.Sprintf(`
+INSERT INTO %s (seq, at, actor, action, payload, payload_hash, prev_hash, hash)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`, Audit_table)
+	_, err = tx.ExecContext(ctx, reqSQL,
+		e.Seq, e.At.Format(audit.TimeFormat), e.Actor, e.Action, string(e.Payload), e.PayloadHash, e.PrevHash, e.Hash)
+	if err != nil {
+		return fmt.Errorf("append audit entry: %w", err)
+	}
+	return nil
+}
+
+// Audit records an action that changes state outside the database, such as
+// the rate limits.
+func (m *Manager) Audit(ctx context.Context, action string, payload any) error {
+	return m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		// An empty write takes the write lock before the head is read.
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE 0`, Audit_table)); err != nil {
+			return err
+		}
+		return m.appendAudit(ctx, tx, action, payload)
+	})
+}
+
+// ListAudit returns up to limit entries starting with sequence number from.
+func (m *Manager) ListAudit(ctx context.Context, from int64, limit int) ([]audit.Entry, error) {
+	entries := []audit.Entry{}
+	err := m.scanAudit(ctx, from, limit, func(e audit.Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// VerifyAudit checks the whole audit log and returns its head, the sequence
+// number and hash of the last entry.
+func (m *Manager) VerifyAudit(ctx context.Context) (int64, string, error) {
+	v := audit.NewVerifier()
+	err := m.scanAudit(ctx, 1, -1, v.Check)
+	seq, hash := v.Head()
+	return seq, hash, err
+}
+
+func (m *Manager) scanAudit(ctx context.Context, from int64, limit int, fn func(audit.Entry) error) error {
+	reqSQL := fmt.Sprintf(`
+SELECT seq, at, actor, action, payload, payload_hash, prev_hash, hash
+  FROM %s WHERE seq >= ? ORDER BY seq LIMIT ?
+`, Audit_table)
+	rows, err := m.reader().QueryContext(ctx, reqSQL, from, limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e audit.Entry
+		var at, payload string
+		if err = rows.Scan(&e.Seq, &at, &e.Actor, &e.Action, &payload, &e.PayloadHash, &e.PrevHash, &e.Hash); err != nil {
+			return err
+		}
+		if e.At, err = time.Parse(audit.TimeFormat, at); err != nil {
+			return fmt.Errorf("%w: entry %d has an invalid time %q", audit.ErrBroken, e.Seq, at)
+		}
+		e.Payload = []byte(payload)
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAudit_RecordsChangesInChain(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	ctx := audit.WithActor(t.Context(), "key:bo")
+	now := time.Now()
+
+	if err := m.CreateApiKey(ctx, &model.ApiKey{Id: "k1", Name: "algo", Hash: "h", Scopes: []string{"trade:write"}, CreatedAt: now}); err != nil {
+		t.Fatalf("CreateApiKey: %v", err)
+	}
+	trade := model.Trade{Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: "buy"}
+	if err := m.CreateTrade(ctx, &trade); err != nil {
+		t.Fatalf("CreateTrade: %v", err)
+	}
+	processTrade(t, m)
+	prev := findTrade(t, m, trade.Id)
+	if _, err := m.CancelTrade(ctx, prev, "key:bo", "duplicate", now); err != nil {
+		t.Fatalf("CancelTrade: %v", err)
+	}
+	if revoked, err := m.RevokeApiKey(ctx, "k1", now); err != nil || !revoked {
+		t.Fatalf("RevokeApiKey = %v, %v", revoked, err)
+	}
+	if err := m.Audit(ctx, audit.ActionLimitsUpdate, map[string]any{"max_pending": 10}); err != nil {
+		t.Fatalf("Audit: %v", err)
+	}
+	// a failed change leaves no entry
+	if _, err := m.CancelTrade(ctx, prev, "key:bo", "again", now); !errors.Is(err, ErrTradeChanged) {
+		t.Fatalf("CancelTrade stale = %v", err)
+	}
+
+	entries, err := m.ListAudit(t.Context(), 1, 100)
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	want := []string{
+		audit.ActionApiKeyCreate, audit.ActionTradeSubmit, audit.ActionTradeProcess, audit.ActionAccountAdjust,
+		audit.ActionTradeCancel, audit.ActionApiKeyRevoke, audit.ActionLimitsUpdate,
+	}
+	if !slices.Equal(actions, want) {
+		t.Fatalf("actions = %v; want %v", actions, want)
+	}
+	if entries[0].Actor != "key:bo" || entries[2].Actor != "anonymous" {
+		t.Errorf("actors = %q, %q", entries[0].Actor, entries[2].Actor)
+	}
+
+	seq, head, err := m.VerifyAudit(t.Context())
+	if err != nil || seq != int64(len(want)) || head != entries[len(entries)-1].Hash {
+		t.Fatalf("VerifyAudit = %d, %s, %v", seq, head, err)
+	}
+}
+
+func TestAudit_DetectsTampering(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+	}{
+		{name: "payload modified", sql: `UPDATE audit_log SET payload = '{"account":"123","trades_delta":1,"profit_delta":1e9}' WHERE seq = 3`},
+		{name: "actor modified", sql: `UPDATE audit_log SET actor = 'someone' WHERE seq = 2`},
+		{name: "entry deleted", sql: `DELETE FROM audit_log WHERE seq = 2`},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		m := newTestManager(t)
+		if err := m.CreateTablesIfNeed(); err != nil {
+			t.Fatalf("CreateTablesIfNeed: %v", err)
+		}
+		for range 2 {
+			trade := model.Trade{Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: "buy"}
+			if err := m.CreateTrade(context.Background(), &trade); err != nil {
+				t.Fatalf("CreateTrade: %v", err)
+			}
+		}
+		processTrade(t, m)
+
+		if _, err := m.db.Exec(test.sql); err == nil {
+			t.Fatalf("%s: not rejected by the triggers", test.sql)
+		}
+		// someone with write access to the file can drop the triggers
+		if _, err := m.db.Exec(`DROP TRIGGER audit_log_no_update; DROP TRIGGER audit_log_no_delete`); err != nil {
+			t.Fatalf("drop triggers: %v", err)
+		}
+		if _, err := m.db.Exec(test.sql); err != nil {
+			t.Fatalf("%s: %v", test.sql, err)
+		}
+		if _, _, err := m.VerifyAudit(t.Context()); !errors.Is(err, audit.ErrBroken) {
+			t.Errorf("VerifyAudit = %v; want ErrBroken", err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"time"
+)
+
+// EachTrade calls fn with the trades of account, or of all accounts if it is
+// empty, in id order. Rows are read one at a time, so the result set can be
+// of any size. When from or to is set, only trades processed in [from, to)
+// are included.
+func (m *Manager) EachTrade(ctx context.Context, account string, from, to *time.Time, fn func(*model.Trade) error) error {
+	reqSQL := fmt.Sprintf(`
+SELECT %s FROM %s
+ WHERE (? = '' OR account = ?)
+   AND (? IS NULL OR processed_at >= ?)
+   AND (? IS NULL OR processed_at < ?)
+ ORDER BY id
+`, tradeColumns, Trades_table)
+	fromArg, toArg := formatTime(from), formatTime(to)
+	rows, err := m.reader().QueryContext(ctx, reqSQL, account, account, fromArg, fromArg, toArg, toArg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		trade, err := scanTrade(rows)
+		if err != nil {
+			return err
+		}
+		if err = fn(trade); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachClient calls fn with the stats of every account in account order.
+func (m *Manager) EachClient(ctx context.Context, fn func(model.Account) error) error {
+	reqSQL := fmt.Sprintf(`SELECT account, trades, profit FROM %s ORDER BY account`, Clients_table)
+	rows, err := m.reader().QueryContext(ctx, reqSQL)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var client model.Account
+		if err = rows.Scan(&client.AccountId, &client.Trades, &client.Profit); err != nil {
+			return err
+		}
+		if err = fn(client); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
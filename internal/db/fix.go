@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/fix"
+)
+
+const (
+	FixSessions_table = "fix_sessions"
+	FixMessages_table = "fix_messages"
+)
+
+func (m *Manager) CreateFixSessions() error {
+	schemaSQL := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]s (
+    id TEXT PRIMARY KEY,
+    next_sender INTEGER NOT NULL,
+    next_target INTEGER NOT NULL,
+    updated_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS %[2]s (
+    session_id TEXT NOT NULL,
+    seq INTEGER NOT NULL,
+    raw TEXT NOT NULL,
+    PRIMARY KEY (session_id, seq)
+);
+`, FixSessions_table, FixMessages_table)
+	_, err := m.db.Exec(schemaSQL)
+	return err
+}
+
+// FixSession returns the next sequence numbers of a FIX session, 1 and 1 for
+// a session never seen before.
+func (m *Manager) FixSession(ctx context.Context, id string) (nextSender, nextTarget int, err error) {
+	reqSQL := fmt.Sprintf(`SELECT next_sender, next_target FROM %s WHERE id = ?`, FixSessions_table)
+	err = m.reader().QueryRowContext(ctx, reqSQL, id).Scan(&nextSender, &nextTarget)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 1, 1, nil
+	}
+	return nextSender, nextTarget, err
+}
+
+func (m *Manager) SetFixSeqNums(ctx context.Context, id string, nextSender, nextTarget int) error {
+	return m.setFixSeqNums(ctx, m.db, id, nextSender, nextTarget)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (m *Manager) setFixSeqNums(ctx context.Context, db execer, id string, nextSender, nextTarget int) error {
+	now := m.now()
+	reqSQL := fmt.Sprintf(`
+INSERT INTO %s (id, next_sender, next_target, updated_at) VALUES (?, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET next_sender = excluded.next_sender, next_target = excluded.next_target,
+    updated_at = excluded.updated_at
+`, FixSessions_table)
+	_, err := db.ExecContext(ctx, reqSQL, id, nextSender, nextTarget, formatTime(&now))
+	return err
+}
+
+// SaveFixMessage stores a sent message for resends and moves the next
+// sender sequence number past it.
+func (m *Manager) SaveFixMessage(ctx context.Context, id string, seq int, raw []byte) error {
+	return m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		reqSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (session_id, seq, raw) VALUES (?, ?, ?)`, FixMessages_table)
+		if _, err = tx.ExecContext(ctx, reqSQL, id, seq, string(raw)); err != nil {
+			return err
+		}
+		now := m.now()
+		reqSQL = fmt.Sprintf(`
+INSERT INTO %s (id, next_sender, next_target, updated_at) VALUES (?, ?, 1, ?)
+ON CONFLICT(id) DO UPDATE SET next_sender = excluded.next_sender, updated_at = excluded.updated_at
+`, FixSessions_table)
+		if _, err = tx.ExecContext(ctx, reqSQL, id, seq+1, formatTime(&now)); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// FixMessages returns the stored messages of a session with from <= seq <= to.
+func (m *Manager) FixMessages(ctx context.Context, id string, from, to int) ([]fix.StoredMessage, error) {
+	reqSQL := fmt.Sprintf(`
+SELECT seq, raw FROM %s WHERE session_id = ? AND seq BETWEEN ? AND ? ORDER BY seq
+`, FixMessages_table)
+	rows, err := m.reader().QueryContext(ctx, reqSQL, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var msgs []fix.StoredMessage
+	for rows.Next() {
+		var msg fix.StoredMessage
+		var raw string
+		if err = rows.Scan(&msg.Seq, &raw); err != nil {
+			return nil, err
+		}
+		msg.Raw = []byte(raw)
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+// ResetFixSession starts a session over, as asked by a logon with
+// ResetSeqNumFlag.
+func (m *Manager) ResetFixSession(ctx context.Context, id string) error {
+	return m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE session_id = ?`, FixMessages_table), id); err != nil {
+			return err
+		}
+		return m.setFixSeqNums(ctx, tx, id, 1, 1)
+	})
+}
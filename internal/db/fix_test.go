@@ -0,0 +1,49 @@
+package db
+
+import (
+	"gitlab.com/digineat/go-broker-test/internal/fix"
+	"reflect"
+	"testing"
+)
+
+func TestFixSessions(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	const id = "FIX.4.4:BROKER->VENUE"
+	seqs := func(wantSender, wantTarget int) {
+		t.Helper()
+		nextSender, nextTarget, err := m.FixSession(t.Context(), id)
+		if err != nil || nextSender != wantSender || nextTarget != wantTarget {
+			t.Errorf("FixSession = %d, %d, %v; want %d, %d", nextSender, nextTarget, err, wantSender, wantTarget)
+		}
+	}
+
+	seqs(1, 1)
+	if err := m.SaveFixMessage(t.Context(), id, 1, []byte("first")); err != nil {
+		t.Fatalf("SaveFixMessage: %v", err)
+	}
+	seqs(2, 1)
+	if err := m.SetFixSeqNums(t.Context(), id, 3, 5); err != nil {
+		t.Fatalf("SetFixSeqNums: %v", err)
+	}
+	if err := m.SaveFixMessage(t.Context(), id, 3, []byte("third")); err != nil {
+		t.Fatalf("SaveFixMessage: %v", err)
+	}
+	seqs(4, 5)
+
+	msgs, err := m.FixMessages(t.Context(), id, 1, 10)
+	want := []fix.StoredMessage{{Seq: 1, Raw: []byte("first")}, {Seq: 3, Raw: []byte("third")}}
+	if err != nil || !reflect.DeepEqual(msgs, want) {
+		t.Errorf("FixMessages = %q, %v; want %q", msgs, err, want)
+	}
+
+	if err = m.ResetFixSession(t.Context(), id); err != nil {
+		t.Fatalf("ResetFixSession: %v", err)
+	}
+	seqs(1, 1)
+	if msgs, err = m.FixMessages(t.Context(), id, 1, 10); err != nil || len(msgs) != 0 {
+		t.Errorf("FixMessages after reset = %q, %v; want none", msgs, err)
+	}
+}
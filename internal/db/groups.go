@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"time"
+)
+
+const (
+	AccountGroups_table     = "account_groups"
+	AccountGroupPaths_table = "account_group_paths"
+)
+
+var (
+	ErrGroupExists   = errors.New("group already exists")
+	ErrGroupNotFound = errors.New("group not found")
+)
+
+// CreateAccountGroups creates the group tree. The closure table holds a row
+// for every group and each of its ancestors, including the group itself at
+// depth 0, so a subtree is a single indexed lookup.
+func (m *Manager) CreateAccountGroups() error {
+	schemaSQL := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]s (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    parent_id TEXT,
+    created_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS %[2]s (
+    ancestor TEXT NOT NULL,
+    descendant TEXT NOT NULL,
+    depth INTEGER NOT NULL,
+    PRIMARY KEY (ancestor, descendant)
+);
+CREATE INDEX IF NOT EXISTS %[2]s_descendant_idx ON %[2]s (descendant);
+`, AccountGroups_table, AccountGroupPaths_table)
+	_, err := m.db.Exec(schemaSQL)
+	return err
+}
+
+// CreateAccountGroup adds g below its parent. It returns ErrGroupExists if
+// the id is taken and ErrGroupNotFound if the parent does not exist.
+// Groups cannot be moved, so the stats of a subtree never change
+// retroactively.
+func (m *Manager) CreateAccountGroup(ctx context.Context, g *model.AccountGroup) error {
+	return m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		reqSQL := fmt.Sprintf(`
+INSERT INTO %s (id, name, parent_id, created_at) VALUES (?, ?, ?, ?)
+ON CONFLICT(id) DO NOTHING
+`, AccountGroups_table)
+		res, err := tx.ExecContext(ctx, reqSQL, g.Id, g.Name, sql.NullString{String: g.Parent, Valid: g.Parent != ""},
+			formatTime(&g.CreatedAt))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("%s: %w", g.Id, ErrGroupExists)
+		}
+
+		reqSQL = fmt.Sprintf(`
+INSERT INTO %[1]s (ancestor, descendant, depth)
+SELECT ?, ?, 0
+UNION ALL
+SELECT ancestor, ?, depth + 1 FROM %[1]s WHERE descendant = ?
+`, AccountGroupPaths_table)
+		res, err = tx.ExecContext(ctx, reqSQL, g.Id, g.Id, g.Id, g.Parent)
+		if err != nil {
+			return err
+		}
+		// Only the group itself was added when the parent has no paths.
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 1 && g.Parent != "" {
+			return fmt.Errorf("parent %s: %w", g.Parent, ErrGroupNotFound)
+		}
+
+		return m.appendAudit(ctx, tx, audit.ActionGroupCreate, g)
+	})
+}
+
+// GetAccountGroup returns the group with the given id, or nil if there is
+// none.
+func (m *Manager) GetAccountGroup(ctx context.Context, id string) (*model.AccountGroup, error) {
+	g, err := scanAccountGroup(m.reader().QueryRowContext(ctx, selectAccountGroup+` WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return g, err
+}
+
+// ListAccountGroups returns all groups ordered by id.
+func (m *Manager) ListAccountGroups(ctx context.Context) ([]model.AccountGroup, error) {
+	rows, err := m.reader().QueryContext(ctx, selectAccountGroup+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []model.AccountGroup{}
+	for rows.Next() {
+		g, err := scanAccountGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *g)
+	}
+	return groups, rows.Err()
+}
+
+var selectAccountGroup = fmt.Sprintf(`
+SELECT id, name, COALESCE(parent_id, ''), created_at FROM %s`, AccountGroups_table)
+
+func scanAccountGroup(row rowScanner) (*model.AccountGroup, error) {
+	var g model.AccountGroup
+	var createdAt string
+	if err := row.Scan(&g.Id, &g.Name, &g.Parent, &createdAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if g.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, fmt.Errorf("group %s: invalid created_at %q", g.Id, createdAt)
+	}
+	return &g, nil
+}
+
+// GroupStats aggregates the trades processed in [from, to) by accounts of
+// the group and of all groups below it. A trade counts for the group its
+// account was in when it was processed; cancelled trades are left out and
+// amended ones count with their current values.
+func (m *Manager) GroupStats(ctx context.Context, id string, from, to *time.Time) (*model.GroupStats, error) {
+	// processed_at is stored in UTC with a fixed format, so it compares as text.
+	reqSQL := fmt.Sprintf(`
+SELECT COUNT(DISTINCT t.account), COUNT(t.id), COALESCE(SUM(t.volume), 0),
+       COALESCE(SUM((t.close - t.open) * t.volume * ? * CASE t.side WHEN 'sell' THEN -1 ELSE 1 END), 0)
+  FROM %s p
+  JOIN %s t ON t.group_id = p.descendant
+ WHERE p.ancestor = ?
+   AND t.processed = 1 AND t.cancelled_at IS NULL
+   AND (? IS NULL OR t.processed_at >= ?)
+   AND (? IS NULL OR t.processed_at < ?)
+`, AccountGroupPaths_table, Trades_table)
+	stats := model.GroupStats{Group: id, From: from, To: to}
+	fromArg, toArg := formatTime(from), formatTime(to)
+	err := m.reader().QueryRowContext(ctx, reqSQL, model.Lot, id, fromArg, fromArg, toArg, toArg).
+		Scan(&stats.Accounts, &stats.Trades, &stats.Volume, &stats.Profit)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
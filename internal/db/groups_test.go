@@ -0,0 +1,107 @@
+package db
+
+import (
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGroupStats(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	// master
+	// ├── ib1
+	// │   └── sub1
+	// └── ib2
+	for _, g := range []model.AccountGroup{
+		{Id: "master", Name: "Master"},
+		{Id: "ib1", Name: "IB 1", Parent: "master"},
+		{Id: "sub1", Name: "Sub-IB 1", Parent: "ib1"},
+		{Id: "ib2", Name: "IB 2", Parent: "master"},
+	} {
+		g.CreatedAt = at
+		if err := m.CreateAccountGroup(t.Context(), &g); err != nil {
+			t.Fatalf("CreateAccountGroup(%s): %v", g.Id, err)
+		}
+	}
+	if err := m.CreateAccountGroup(t.Context(), &model.AccountGroup{Id: "ib1", CreatedAt: at}); !errors.Is(err, ErrGroupExists) {
+		t.Errorf("CreateAccountGroup of existing group = %v; want ErrGroupExists", err)
+	}
+	if err := m.CreateAccountGroup(t.Context(), &model.AccountGroup{Id: "ib3", Parent: "nope", CreatedAt: at}); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("CreateAccountGroup below unknown parent = %v; want ErrGroupNotFound", err)
+	}
+	if g, err := m.GetAccountGroup(t.Context(), "ib3"); g != nil || err != nil {
+		t.Errorf("GetAccountGroup(ib3) = %+v, %v; want nil, nil", g, err)
+	}
+
+	accounts := map[string]*model.TradingAccount{
+		"A": {Id: "A", Name: "A", Currency: "USD", Group: "sub1", Leverage: 1, Status: model.AccountStatusActive, CreatedAt: at, UpdatedAt: at},
+		"B": {Id: "B", Name: "B", Currency: "USD", Group: "ib2", Leverage: 1, Status: model.AccountStatusActive, CreatedAt: at, UpdatedAt: at},
+	}
+	for _, a := range accounts {
+		if err := m.CreateTradingAccount(t.Context(), a); err != nil {
+			t.Fatalf("CreateTradingAccount: %v", err)
+		}
+	}
+	enqueue := func(account string) {
+		trade := model.Trade{Account: account, Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: "buy"}
+		if err := m.CreateTrade(t.Context(), &trade); err != nil {
+			t.Fatalf("CreateTrade: %v", err)
+		}
+	}
+
+	// each trade makes a profit of 500
+	enqueue("A")
+	enqueue("B")
+	enqueue("B")
+	processTradeAt(t, m, at)
+	processTradeAt(t, m, at.Add(time.Hour))
+	third := processTradeAt(t, m, at.Add(2*time.Hour))
+	if _, err := m.CancelTrade(t.Context(), third, "key:bo", "duplicate", at.Add(3*time.Hour)); err != nil {
+		t.Fatalf("CancelTrade: %v", err)
+	}
+
+	// moving A to ib2 leaves its earlier trade with sub1
+	accounts["A"].Group = "ib2"
+	if err := m.UpdateTradingAccount(t.Context(), accounts["A"]); err != nil {
+		t.Fatalf("UpdateTradingAccount: %v", err)
+	}
+	enqueue("A")
+	if trade := processTradeAt(t, m, at.Add(4*time.Hour)); trade.Group != "ib2" {
+		t.Errorf("trade group = %q; want ib2", trade.Group)
+	}
+
+	from, to := at.Add(30*time.Minute), at.Add(4*time.Hour)
+	tests := []struct {
+		group    string
+		from, to *time.Time
+		accounts int
+		trades   int
+	}{
+		{group: "master", accounts: 2, trades: 3},
+		{group: "ib1", accounts: 1, trades: 1},
+		{group: "sub1", accounts: 1, trades: 1},
+		{group: "ib2", accounts: 2, trades: 2},
+		{group: "master", from: &from, accounts: 2, trades: 2},
+		{group: "master", from: &from, to: &to, accounts: 1, trades: 1},
+		{group: "ib1", from: &from},
+		{group: "nope"},
+	}
+	for _, test := range tests {
+		t.Log(test.group, test.from, test.to)
+		stats, err := m.GroupStats(t.Context(), test.group, test.from, test.to)
+		if err != nil {
+			t.Fatalf("GroupStats: %v", err)
+		}
+		if stats.Accounts != test.accounts || stats.Trades != test.trades || stats.Volume != float64(test.trades) ||
+			math.Abs(stats.Profit-500*float64(test.trades)) > 0.01 {
+			t.Errorf("stats = %+v; want %d accounts, %d trades", stats, test.accounts, test.trades)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// SchemaVersion is the version of the schema CreateTablesIfNeed creates,
+// stored as the user_version of the database. Increase it with every change
+// to the tables.
+const SchemaVersion = 1
+
+// GetSchemaVersion returns the schema version of the database, 0 when it
+// was never migrated by a version that records it.
+func (m *Manager) GetSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := m.reader().QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+func (m *Manager) setSchemaVersion() error {
+	_, err := m.db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, SchemaVersion))
+	return err
+}
+
+// CheckWritable starts a write on the queue and rolls it back. It fails
+// when the database is read-only or another connection holds the write
+// lock for longer than the busy timeout.
+func (m *Manager) CheckWritable(ctx context.Context) error {
+	tx, err := m.beginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET id = id WHERE 0`, Trades_table))
+	return err
+}
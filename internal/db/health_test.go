@@ -0,0 +1,42 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestHealthChecks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	open := func(dsn string) *Manager {
+		conn, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			t.Fatalf("open db: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		m := &Manager{}
+		if err = m.InitDbManager(conn); err != nil {
+			t.Fatalf("InitDbManager: %v", err)
+		}
+		return m
+	}
+
+	m := open(path)
+	if version, err := m.GetSchemaVersion(t.Context()); err != nil || version != 0 {
+		t.Errorf("GetSchemaVersion of a new database = %d, %v; want 0", version, err)
+	}
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	if version, err := m.GetSchemaVersion(t.Context()); err != nil || version != SchemaVersion {
+		t.Errorf("GetSchemaVersion = %d, %v; want %d", version, err, SchemaVersion)
+	}
+	if err := m.CheckWritable(t.Context()); err != nil {
+		t.Errorf("CheckWritable: %v", err)
+	}
+
+	readOnly := open("file:" + path + "?mode=ro")
+	if err := readOnly.CheckWritable(t.Context()); err == nil {
+		t.Error("CheckWritable of a read-only database succeeded")
+	}
+}
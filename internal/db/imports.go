@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"go.opentelemetry.io/otel/attribute"
+	"strings"
+)
+
+const (
+	Imports_table      = "imports"
+	ImportErrors_table = "import_errors"
+)
+
+func (m *Manager) CreateImports() error {
+	schemaSQL := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]s (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    status TEXT NOT NULL,
+    mode TEXT NOT NULL,
+    dry_run INTEGER NOT NULL,
+    source TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    rows INTEGER NOT NULL DEFAULT 0,
+    imported INTEGER NOT NULL DEFAULT 0,
+    duplicates INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    finished_at TEXT
+);
+CREATE TABLE IF NOT EXISTS %[2]s (
+    job_id INTEGER NOT NULL,
+    line INTEGER NOT NULL,
+    field TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    message TEXT NOT NULL,
+    value TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS %[2]s_job_idx ON %[2]s (job_id, line);
+`, Imports_table, ImportErrors_table)
+	_, err := m.db.Exec(schemaSQL)
+	return err
+}
+
+// CreateImportJob records a new job and sets its id.
+func (m *Manager) CreateImportJob(ctx context.Context, job *model.ImportJob) error {
+	reqSQL := fmt.Sprintf(`
+INSERT INTO %s (status, mode, dry_run, source, actor, created_at) VALUES (?, ?, ?, ?, ?, ?)
+`, Imports_table)
+	var res sql.Result
+	err := m.retryBusy(ctx, func() (err error) {
+		res, err = m.db.ExecContext(ctx, reqSQL,
+			job.Status, job.Mode, job.DryRun, job.Source, job.Actor, formatTime(&job.CreatedAt))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	job.Id = int(id)
+	return err
+}
+
+// SaveImportJob stores the progress of job and adds errs to its errors.
+func (m *Manager) SaveImportJob(ctx context.Context, job *model.ImportJob, errs []model.ImportError) error {
+	return m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		reqSQL := fmt.Sprintf(`
+UPDATE %s SET status = ?, rows = ?, imported = ?, duplicates = ?, failed = ?, error = ?, finished_at = ?
+ WHERE id = ?
+`, Imports_table)
+		_, err = tx.ExecContext(ctx, reqSQL,
+			job.Status, job.Rows, job.Imported, job.Duplicates, job.Failed, job.Error, formatTime(job.FinishedAt), job.Id)
+		if err != nil {
+			return err
+		}
+		insertSQL := fmt.Sprintf(`
+INSERT INTO %s (job_id, line, field, rule, message, value) VALUES (?, ?, ?, ?, ?, ?)
+`, ImportErrors_table)
+		for _, e := range errs {
+			if _, err = tx.ExecContext(ctx, insertSQL, job.Id, e.Line, e.Field, e.Rule, e.Message, e.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetImportJob returns the job with the given id, or nil if there is none.
+func (m *Manager) GetImportJob(ctx context.Context, id int) (*model.ImportJob, error) {
+	reqSQL := fmt.Sprintf(`
+SELECT id, status, mode, dry_run, source, actor, rows, imported, duplicates, failed, error, created_at, finished_at
+  FROM %s WHERE id = ?
+`, Imports_table)
+	var job model.ImportJob
+	var createdAt, finishedAt sql.NullString
+	err := m.reader().QueryRowContext(ctx, reqSQL, id).Scan(
+		&job.Id, &job.Status, &job.Mode, &job.DryRun, &job.Source, &job.Actor,
+		&job.Rows, &job.Imported, &job.Duplicates, &job.Failed, &job.Error, &createdAt, &finishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if created, err := parseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("import %d: %w", job.Id, err)
+	} else if created != nil {
+		job.CreatedAt = *created
+	}
+	if err = scanTimes(timeColumn{finishedAt, &job.FinishedAt}); err != nil {
+		return nil, fmt.Errorf("import %d: %w", job.Id, err)
+	}
+	return &job, nil
+}
+
+// ListImportErrors returns the row errors of a job in line order.
+func (m *Manager) ListImportErrors(ctx context.Context, id int) ([]model.ImportError, error) {
+	reqSQL := fmt.Sprintf(`
+SELECT line, field, rule, message, value FROM %s WHERE job_id = ? ORDER BY line, rowid
+`, ImportErrors_table)
+	rows, err := m.reader().QueryContext(ctx, reqSQL, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	errs := []model.ImportError{}
+	for rows.Next() {
+		var e model.ImportError
+		if err = rows.Scan(&e.Line, &e.Field, &e.Rule, &e.Message, &e.Value); err != nil {
+			return nil, err
+		}
+		errs = append(errs, e)
+	}
+	return errs, rows.Err()
+}
+
+// ExistingImportKeys returns which of keys are the import keys of stored
+// trades.
+func (m *Manager) ExistingImportKeys(ctx context.Context, keys []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	if len(keys) == 0 {
+		return existing, nil
+	}
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	reqSQL := fmt.Sprintf(`SELECT import_key FROM %s WHERE import_key IN (?%s)`,
+		Trades_table, strings.Repeat(", ?", len(keys)-1))
+	rows, err := m.reader().QueryContext(ctx, reqSQL, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		existing[key] = true
+	}
+	return existing, rows.Err()
+}
+
+// ImportTrades stores the trades whose import key is not stored yet, in one
+// transaction, and returns how many it stored. In enqueue mode they are
+// queued for the worker like submitted trades. In apply mode they are stored
+// as processed at the time they were closed, or opened if the close time is
+// not known, and added to the account stats right away; no rebates are
+// accrued for them, as rebates of historical trades have been paid already.
+func (m *Manager) ImportTrades(ctx context.Context, job *model.ImportJob, trades []*model.Trade) (n int, err error) {
+	ctx, span := startSpan(ctx, "db.import "+Trades_table,
+		attribute.Int("import.id", job.Id), attribute.Int("import.batch", len(trades)))
+	defer func() { endSpan(span, err) }()
+
+	now := m.now()
+	apply := job.Mode == model.ImportModeApply
+	reqSQL := fmt.Sprintf(`
+INSERT INTO %[1]s (
+    account, symbol, volume, open, close, side, open_time, close_time, received_at,
+    processed, processed_at, group_id, import_key
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+    CASE WHEN ? THEN (SELECT NULLIF(account_group, '') FROM %[2]s WHERE id = ?) END,
+    ?
+)
+ON CONFLICT(import_key) WHERE import_key IS NOT NULL DO NOTHING
+RETURNING id
+`, Trades_table, Accounts_table)
+
+	var ids []int
+	err = m.inTx(ctx, func(tx *sql.Tx) error {
+		ids = nil
+		var accounts []string
+		profits := map[string]float64{}
+		counts := map[string]int{}
+		for _, trade := range trades {
+			trade.Id, trade.ReceivedAt = 0, now
+			if apply {
+				trade.Processed, trade.ProcessedAt = 1, trade.CloseTime
+				if trade.ProcessedAt == nil {
+					trade.ProcessedAt = trade.OpenTime
+				}
+			}
+			err := tx.QueryRowContext(ctx, reqSQL,
+				trade.Account, trade.Symbol, trade.Volume, trade.Open, trade.Close, trade.Side,
+				formatTime(trade.OpenTime), formatTime(trade.CloseTime), formatTime(&trade.ReceivedAt),
+				trade.Processed, formatTime(trade.ProcessedAt), apply, trade.Account, trade.ImportKey,
+			).Scan(&trade.Id)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			trade.Version = 1
+			ids = append(ids, trade.Id)
+			if apply {
+				if _, seen := counts[trade.Account]; !seen {
+					accounts = append(accounts, trade.Account)
+				}
+				counts[trade.Account]++
+				profits[trade.Account] += trade.Profit()
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		err := m.appendAudit(ctx, tx, audit.ActionTradeImport, map[string]any{
+			"import_id": job.Id,
+			"mode":      job.Mode,
+			"trade_ids": ids,
+		})
+		if err != nil {
+			return err
+		}
+		for _, account := range accounts {
+			if err = m.adjustClient(ctx, tx, account, counts[account], profits[account]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
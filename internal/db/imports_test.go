@@ -0,0 +1,121 @@
+package db
+
+import (
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestImportTrades(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	if err := m.CreateAccountGroup(t.Context(), &model.AccountGroup{Id: "ib1", CreatedAt: at}); err != nil {
+		t.Fatalf("CreateAccountGroup: %v", err)
+	}
+	account := model.TradingAccount{Id: "A", Name: "A", Currency: "USD", Group: "ib1", Leverage: 1,
+		Status: model.AccountStatusActive, CreatedAt: at, UpdatedAt: at}
+	if err := m.CreateTradingAccount(t.Context(), &account); err != nil {
+		t.Fatalf("CreateTradingAccount: %v", err)
+	}
+
+	closed := at.Add(-30 * 24 * time.Hour)
+	imported := func(mode string, keys ...string) []*model.Trade {
+		var trades []*model.Trade
+		for _, key := range keys {
+			trades = append(trades, &model.Trade{Account: "A", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: "buy",
+				CloseTime: &closed, ImportKey: key})
+		}
+		job := model.ImportJob{Status: model.ImportStatusRunning, Mode: mode, Source: "history.csv", Actor: "ops", CreatedAt: at}
+		if err := m.CreateImportJob(t.Context(), &job); err != nil {
+			t.Fatalf("CreateImportJob: %v", err)
+		}
+		if _, err := m.ImportTrades(t.Context(), &job, trades); err != nil {
+			t.Fatalf("ImportTrades: %v", err)
+		}
+		return trades
+	}
+
+	queued := imported(model.ImportModeEnqueue, "id:1", "id:2")
+	if n, err := m.CountPendingTrades(t.Context()); err != nil || n != 2 {
+		t.Errorf("CountPendingTrades = %d, %v; want 2", n, err)
+	}
+	// id:2 was imported before and id:4 appears twice
+	applied := imported(model.ImportModeApply, "id:2", "id:3", "id:4", "id:4")
+	if applied[0].Id != 0 || applied[3].Id != 0 || applied[1].Id == 0 || applied[2].Id == 0 {
+		t.Errorf("stored trades %d, %d, %d, %d; want only the second and third", applied[0].Id, applied[1].Id, applied[2].Id, applied[3].Id)
+	}
+	trade := findTrade(t, m, applied[1].Id)
+	if trade.Status() != model.TradeStatusProcessed || trade.Group != "ib1" || trade.ProcessedAt == nil || !trade.ProcessedAt.Equal(closed) {
+		t.Errorf("applied trade = %+v; want processed in ib1 when it was closed", trade)
+	}
+	if trade = findTrade(t, m, queued[0].Id); trade.Status() != model.TradeStatusPending || trade.Group != "" {
+		t.Errorf("queued trade = %+v; want pending", trade)
+	}
+	client, err := m.GetClient(t.Context(), "A")
+	if err != nil || client == nil || client.Trades != 2 || math.Abs(client.Profit-2*applied[1].Profit()) > 1e-9 {
+		t.Errorf("GetClient = %+v, %v; want 2 trades", client, err)
+	}
+
+	existing, err := m.ExistingImportKeys(t.Context(), []string{"id:1", "id:3", "id:5"})
+	if want := map[string]bool{"id:1": true, "id:3": true}; err != nil || !reflect.DeepEqual(existing, want) {
+		t.Errorf("ExistingImportKeys = %v, %v; want %v", existing, err, want)
+	}
+
+	entries, err := m.ListAudit(t.Context(), 1, 100)
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	var actions []string
+	for _, e := range entries[2:] {
+		actions = append(actions, e.Action)
+	}
+	want := []string{audit.ActionTradeImport, audit.ActionTradeImport, audit.ActionAccountAdjust}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("audit actions = %v; want %v", actions, want)
+	}
+}
+
+func TestImportJobs(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	job := model.ImportJob{Status: model.ImportStatusRunning, Mode: model.ImportModeApply, DryRun: true,
+		Source: "history.csv", Actor: "ops", CreatedAt: at}
+	if err := m.CreateImportJob(t.Context(), &job); err != nil || job.Id == 0 {
+		t.Fatalf("CreateImportJob = %d, %v", job.Id, err)
+	}
+
+	job.Rows, job.Imported, job.Failed = 3, 1, 2
+	errs := []model.ImportError{
+		{Line: 4, Field: "side", Rule: "oneof", Message: "side must be one of [buy sell]", Value: "hold"},
+		{Line: 2, Field: "volume", Rule: "number", Message: "volume must be a number", Value: "x"},
+	}
+	if err := m.SaveImportJob(t.Context(), &job, errs); err != nil {
+		t.Fatalf("SaveImportJob: %v", err)
+	}
+	finished := at.Add(time.Minute)
+	job.Status, job.FinishedAt = model.ImportStatusCompleted, &finished
+	if err := m.SaveImportJob(t.Context(), &job, nil); err != nil {
+		t.Fatalf("SaveImportJob: %v", err)
+	}
+
+	got, err := m.GetImportJob(t.Context(), job.Id)
+	if err != nil || !reflect.DeepEqual(got, &job) {
+		t.Errorf("GetImportJob = %+v, %v; want %+v", got, err, job)
+	}
+	gotErrs, err := m.ListImportErrors(t.Context(), job.Id)
+	if err != nil || !reflect.DeepEqual(gotErrs, []model.ImportError{errs[1], errs[0]}) {
+		t.Errorf("ListImportErrors = %+v, %v; want them by line", gotErrs, err)
+	}
+	if got, err = m.GetImportJob(t.Context(), job.Id+1); got != nil || err != nil {
+		t.Errorf("GetImportJob of unknown job = %+v, %v; want nil, nil", got, err)
+	}
+}
@@ -5,16 +5,29 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
 	"gitlab.com/digineat/go-broker-test/internal/model"
-	"log"
+	"gitlab.com/digineat/go-broker-test/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"time"
 )
 
 const Trades_table = "trades_q"
 const Clients_table = "clients"
 
 type Manager struct {
-	db  *sql.DB
-	ctx context.Context
+	db    *sql.DB
+	ctx   context.Context
+	clock clock.Clock
+	// read serves queries outside transactions when set.
+	read *sql.DB
+	// busyRetries and busyDelay configure retryBusy.
+	busyRetries int
+	busyDelay   time.Duration
 }
 
 //account	string	must not be empty
@@ -38,6 +51,19 @@ func (m *Manager) InitDbManager(db *sql.DB) error {
 	return nil
 }
 
+// SetClock sets the clock used to time audit entries; the default is the
+// system clock.
+func (m *Manager) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+func (m *Manager) now() time.Time {
+	if m.clock == nil {
+		return time.Now()
+	}
+	return m.clock.Now()
+}
+
 func (m *Manager) CreateTablesIfNeed() error {
 	err := m.CreateTradesQ()
 	if err != nil {
@@ -48,26 +74,172 @@ func (m *Manager) CreateTablesIfNeed() error {
 	if err != nil {
 		return errors.New(fmt.Sprintf("Can not create Clients table: %v", err))
 	}
-	return nil
+
+	err = m.CreateApiKeys()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can not create ApiKeys table: %v", err))
+	}
+
+	err = m.CreateTradeVersions()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can not create TradeVersions table: %v", err))
+	}
+
+	err = m.CreateAuditLog()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can not create AuditLog table: %v", err))
+	}
+
+	err = m.CreateAccounts()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can not create Accounts table: %v", err))
+	}
+
+	err = m.CreateAccountGroups()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can not create AccountGroups table: %v", err))
+	}
+
+	err = m.CreateRebates()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can not create Rebates tables: %v", err))
+	}
+
+	err = m.CreateImports()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can not create Imports tables: %v", err))
+	}
+
+	err = m.CreateFixSessions()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can not create FixSessions tables: %v", err))
+	}
+	return m.setSchemaVersion()
 }
 
-func (m *Manager) CreateTradesQ() error {
-	schemaSQL := fmt.Sprintf(`
+func tradesQSchema(table string) string {
+	return fmt.Sprintf(`
 CREATE TABLE IF NOT EXISTS %s (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
-	account STRING UNIQUE,
+	account TEXT NOT NULL,
 	symbol VARCHAR(50),
 	volume FLOAT,
     open FLOAT,
     close FLOAT,
     side VARCHAR(50),
-    processed INTEGER DEFAULT(0)
+    processed INTEGER DEFAULT(0),
+    request_id TEXT,
+    traceparent TEXT,
+    open_time TEXT,
+    close_time TEXT,
+    received_at TEXT,
+    processed_at TEXT,
+    version INTEGER NOT NULL DEFAULT 1,
+    cancelled_at TEXT,
+    group_id TEXT,
+    import_key TEXT,
+    rollovers INTEGER NOT NULL DEFAULT 0
 );
-`, Trades_table)
-	if _, err := m.db.Exec(schemaSQL); err != nil {
+`, table)
+}
+
+func (m *Manager) CreateTradesQ() error {
+	if _, err := m.db.Exec(tradesQSchema(Trades_table)); err != nil {
 		return err
 	}
-	return nil
+	if err := m.addColumnIfMissing(Trades_table, "request_id", "TEXT"); err != nil {
+		return err
+	}
+	if err := m.addColumnIfMissing(Trades_table, "traceparent", "TEXT"); err != nil {
+		return err
+	}
+	for _, column := range []string{"open_time", "close_time", "received_at", "processed_at", "cancelled_at", "group_id", "import_key"} {
+		if err := m.addColumnIfMissing(Trades_table, column, "TEXT"); err != nil {
+			return err
+		}
+	}
+	if err := m.addColumnIfMissing(Trades_table, "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := m.addColumnIfMissing(Trades_table, "rollovers", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := m.dropUniqueTradeAccount(); err != nil {
+		return err
+	}
+	if _, err := m.db.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_processed_idx ON %[1]s (processed)`, Trades_table)); err != nil {
+		return err
+	}
+	if _, err := m.db.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_symbol_idx ON %[1]s (symbol, id)`, Trades_table)); err != nil {
+		return err
+	}
+	if _, err := m.db.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_group_idx ON %[1]s (group_id, processed_at)`, Trades_table)); err != nil {
+		return err
+	}
+	_, err := m.db.Exec(fmt.Sprintf(
+		`CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_import_key_idx ON %[1]s (import_key) WHERE import_key IS NOT NULL`, Trades_table))
+	return err
+}
+
+// dropUniqueTradeAccount rebuilds queues created by older versions, where
+// trades_q.account was UNIQUE and an account could only ever have one trade.
+func (m *Manager) dropUniqueTradeAccount() error {
+	var unique int
+	err := m.db.QueryRow(fmt.Sprintf(
+		`SELECT COUNT(*) FROM pragma_index_list('%s') WHERE "unique" = 1 AND origin = 'u'`, Trades_table,
+	)).Scan(&unique)
+	if err != nil || unique == 0 {
+		return err
+	}
+
+	slog.Info("rebuilding table without unique account", "table", Trades_table)
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tmp := Trades_table + "_rebuild"
+	columns := "id, account, symbol, volume, open, close, side, processed, request_id, traceparent, " +
+		"open_time, close_time, received_at, processed_at, version, cancelled_at, group_id, import_key, rollovers"
+	stmts := []string{
+		tradesQSchema(tmp),
+		fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s`, tmp, columns, columns, Trades_table),
+		fmt.Sprintf(`DROP TABLE %s`, Trades_table),
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, tmp, Trades_table),
+	}
+	for _, stmt := range stmts {
+		if _, err = tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// addColumnIfMissing upgrades tables created by older versions in place.
+func (m *Manager) addColumnIfMissing(table, column, definition string) error {
+	rows, err := m.db.Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	slog.Info("adding missing column", "table", table, "column", column)
+	_, err = m.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
 }
 
 func (m *Manager) CreateClients() error {
@@ -87,62 +259,95 @@ CREATE TABLE IF NOT EXISTS %s (
 	return nil
 }
 
-func (m *Manager) CreateTrade(trade *model.Trade) error {
+// ErrDuplicateTrade is returned by CreateTrade for a trade whose ImportKey
+// was stored before.
+var ErrDuplicateTrade = errors.New("duplicate trade")
 
-	tx, err := m.db.BeginTx(m.ctx, nil)
-	if err != nil {
-		return err
-	}
+// CreateTrade enqueues trade. The trace context of ctx is stored with the row
+// so the worker can continue the trace when it applies the trade.
+func (m *Manager) CreateTrade(ctx context.Context, trade *model.Trade) error {
+	return m.CreateAccountTrade(ctx, nil, trade)
+}
+
+// CreateAccountTrade enqueues trade like CreateTrade and, in the same
+// transaction, creates account unless it exists, so an account is never
+// left without the trade that created it. A nil account creates none.
+func (m *Manager) CreateAccountTrade(ctx context.Context, account *model.TradingAccount, trade *model.Trade) (err error) {
+	ctx, span := startSpan(ctx, "db.insert "+Trades_table)
+	defer func() { endSpan(span, err) }()
 
+	trade.TraceParent = tracing.Inject(ctx)
 	reqSQL := fmt.Sprintf(`
 INSERT INTO %s (
-    account, symbol, volume, open, close, side
+    account, symbol, volume, open, close, side, request_id, traceparent, open_time, close_time, received_at, import_key
 ) VALUES (
-     ?, ?, ?, ?, ?, ?
+     ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, '')
  )
+ON CONFLICT(import_key) WHERE import_key IS NOT NULL DO NOTHING
+RETURNING id
 `, Trades_table)
-	if _, err = tx.Exec(reqSQL,
-		trade.Account, trade.Symbol, trade.Volume, trade.Open, trade.Close, trade.Side); err != nil {
-		err = tx.Rollback()
+	return m.inTx(ctx, func(tx *sql.Tx) error {
+		if account != nil {
+			if _, err := m.insertTradingAccount(ctx, tx, account); err != nil {
+				return err
+			}
+		}
+		err := tx.QueryRowContext(ctx, reqSQL,
+			trade.Account, trade.Symbol, trade.Volume, trade.Open, trade.Close, trade.Side, trade.RequestId, trade.TraceParent,
+			formatTime(trade.OpenTime), formatTime(trade.CloseTime), formatTime(&trade.ReceivedAt), trade.ImportKey,
+		).Scan(&trade.Id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDuplicateTrade
+		}
 		if err != nil {
 			return err
 		}
-		return err
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
-	return nil
+		span.SetAttributes(attribute.Int("trade.id", trade.Id))
+		return m.appendAudit(ctx, tx, audit.ActionTradeSubmit, map[string]any{
+			"trade_id":   trade.Id,
+			"account":    trade.Account,
+			"symbol":     trade.Symbol,
+			"volume":     trade.Volume,
+			"open":       trade.Open,
+			"close":      trade.Close,
+			"side":       trade.Side,
+			"open_time":  trade.OpenTime,
+			"close_time": trade.CloseTime,
+			"request_id": trade.RequestId,
+		})
+	})
 }
 
-func (m *Manager) GetClient(tradeNo string) (*model.Trade, error) {
+// GetClient returns the statistics of account, or nil if no trade of the
+// account has been processed yet.
+func (m *Manager) GetClient(ctx context.Context, account string) (*model.Account, error) {
 
 	reqSQL := fmt.Sprintf(`
-SELECT * FROM %s WHERE account = "?"
-`, Trades_table)
-	row := m.db.QueryRow(reqSQL, tradeNo)
+SELECT account, trades, profit FROM %s WHERE account = ?
+`, Clients_table)
+	row := m.reader().QueryRowContext(ctx, reqSQL, account)
 
-	var trade model.Trade
-	if err := row.Scan(&trade.Account, &trade.Symbol, &trade.Volume, &trade.Open, &trade.Close, &trade.Side); err != nil {
+	var client model.Account
+	if err := row.Scan(&client.AccountId, &client.Trades, &client.Profit); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Println(err)
+			slog.DebugContext(ctx, "client not found", "account", account)
 			return nil, nil
 		}
-		log.Fatal(err)
-		return nil, err
+		return nil, fmt.Errorf("scan client %s: %w", account, err)
 	}
 
-	return &trade, nil
+	return &client, nil
 }
 
-func (m *Manager) GetTrade(ctx context.Context, tx *sql.Tx) (*model.Trade, error) {
+// GetTrade claims the oldest pending trade, marking it processed at now and
+// recording the current group of its account. It returns nil when the queue
+// is empty.
+func (m *Manager) GetTrade(ctx context.Context, tx *sql.Tx, now time.Time) (*model.Trade, error) {
 
-	var trade model.Trade
 	reqSQL := fmt.Sprintf(`
-UPDATE %s
-   SET processed = 1
+UPDATE %[1]s
+   SET processed = 1, processed_at = ?,
+       group_id = (SELECT NULLIF(account_group, '') FROM %[3]s WHERE %[3]s.id = %[1]s.account)
  WHERE id = (
 	 SELECT id
 	   FROM trades_q
@@ -150,33 +355,199 @@ UPDATE %s
 	  ORDER BY id
 	  LIMIT 1
  )
-RETURNING account, side, volume, open, close, processed;
-`, Trades_table)
-	err := tx.QueryRowContext(ctx, reqSQL).Scan(
+RETURNING %[2]s;
+`, Trades_table, tradeColumns, Accounts_table)
+	trade, err := scanTrade(tx.QueryRowContext(ctx, reqSQL, formatTime(&now)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = m.appendAudit(ctx, tx, audit.ActionTradeProcess, map[string]any{
+		"trade_id": trade.Id,
+		"account":  trade.Account,
+		"version":  trade.Version,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+// SetRollovers records the number of swap rollovers the trade with the given
+// id was held over, in the transaction that processes it.
+func (m *Manager) SetRollovers(ctx context.Context, tx *sql.Tx, id, rollovers int) error {
+	reqSQL := fmt.Sprintf(`UPDATE %s SET rollovers = ? WHERE id = ?`, Trades_table)
+	_, err := tx.ExecContext(ctx, reqSQL, rollovers, id)
+	return err
+}
+
+// FindTrade returns the trade with the given id, or nil if there is none.
+func (m *Manager) FindTrade(ctx context.Context, id int) (*model.Trade, error) {
+	reqSQL := fmt.Sprintf(`SELECT %s FROM %s WHERE id = ?`, tradeColumns, Trades_table)
+	trade, err := scanTrade(m.reader().QueryRowContext(ctx, reqSQL, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return trade, err
+}
+
+// FindTradeByImportKey returns the trade stored with importKey, or nil if
+// there is none.
+func (m *Manager) FindTradeByImportKey(ctx context.Context, importKey string) (*model.Trade, error) {
+	reqSQL := fmt.Sprintf(`SELECT %s FROM %s WHERE import_key = ?`, tradeColumns, Trades_table)
+	trade, err := scanTrade(m.reader().QueryRowContext(ctx, reqSQL, importKey))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return trade, err
+}
+
+// tradeColumns are the columns scanTrade reads.
+const tradeColumns = `id, account, symbol, side, volume, open, close, processed,
+       COALESCE(request_id, ''), COALESCE(traceparent, ''),
+       open_time, close_time, received_at, processed_at, version, cancelled_at,
+       COALESCE(group_id, ''), rollovers`
+
+func scanTrade(row rowScanner) (*model.Trade, error) {
+	var trade model.Trade
+	var openTime, closeTime, receivedAt, processedAt, cancelledAt sql.NullString
+	err := row.Scan(
+		&trade.Id,
 		&trade.Account,
+		&trade.Symbol,
 		&trade.Side,
 		&trade.Volume,
 		&trade.Open,
 		&trade.Close,
 		&trade.Processed,
+		&trade.RequestId,
+		&trade.TraceParent,
+		&openTime,
+		&closeTime,
+		&receivedAt,
+		&processedAt,
+		&trade.Version,
+		&cancelledAt,
+		&trade.Group,
+		&trade.Rollovers,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if err = scanTimes(
+		timeColumn{openTime, &trade.OpenTime},
+		timeColumn{closeTime, &trade.CloseTime},
+		timeColumn{processedAt, &trade.ProcessedAt},
+		timeColumn{cancelledAt, &trade.CancelledAt},
+	); err != nil {
+		return nil, fmt.Errorf("trade %d: %w", trade.Id, err)
+	}
+	if received, err := parseTime(receivedAt); err != nil {
+		return nil, fmt.Errorf("trade %d: %w", trade.Id, err)
+	} else if received != nil {
+		trade.ReceivedAt = *received
+	}
+	return &trade, nil
+}
+
+func (m *Manager) UpdateAccount(ctx context.Context, tx *sql.Tx, account string, profit float64) (err error) {
+	ctx, span := startSpan(ctx, "db.update "+Clients_table,
+		attribute.String("trade.account", account), attribute.Float64("trade.profit", profit))
+	defer func() { endSpan(span, err) }()
 
-	return &trade, err
+	return m.adjustClient(ctx, tx, account, 1, profit)
 }
 
-func (m *Manager) UpdateAccount(ctx context.Context, tx *sql.Tx, account string, profit float64) error {
+// adjustClient adds trades and profit to the stats of account.
+func (m *Manager) adjustClient(ctx context.Context, tx *sql.Tx, account string, trades int, profit float64) error {
 	reqSQL := fmt.Sprintf(`
 INSERT INTO %s(account, trades, profit) VALUES( ?, ?, ?)
 ON CONFLICT(account) DO UPDATE SET trades = trades + ?, profit = profit + ?;`, Clients_table)
-	_, err := tx.ExecContext(ctx, reqSQL, account, 1, profit, 1, profit)
-	return err
+	if _, err := tx.ExecContext(ctx, reqSQL, account, trades, profit, trades, profit); err != nil {
+		return err
+	}
+	return m.appendAudit(ctx, tx, audit.ActionAccountAdjust, map[string]any{
+		"account":      account,
+		"trades_delta": trades,
+		"profit_delta": profit,
+	})
+}
+
+// CountPendingTrades returns the number of queued trades not yet processed.
+func (m *Manager) CountPendingTrades(ctx context.Context) (int, error) {
+	var n int
+	reqSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE processed = 0`, Trades_table)
+	err := m.reader().QueryRowContext(ctx, reqSQL).Scan(&n)
+	return n, err
+}
+
+// LastQuote returns the close price of the latest trade in symbol that is not
+// cancelled, other than the trade with id except. ok is false when there is
+// no such trade.
+func (m *Manager) LastQuote(ctx context.Context, symbol string, except int) (price float64, ok bool, err error) {
+	reqSQL := fmt.Sprintf(`
+SELECT close FROM %s
+ WHERE symbol = ? AND id != ? AND cancelled_at IS NULL
+ ORDER BY id DESC LIMIT 1`, Trades_table)
+	err = m.reader().QueryRowContext(ctx, reqSQL, symbol, except).Scan(&price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("last quote of %s: %w", symbol, err)
+	}
+	return price, true, nil
+}
+
+// TimeFormat is how timestamps are stored: UTC with milliseconds, so that
+// they sort as text.
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// formatTime converts t for storage; nil and zero times are stored as NULL.
+func formatTime(t *time.Time) any {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(TimeFormat)
+}
+
+func parseTime(s sql.NullString) (*time.Time, error) {
+	if !s.Valid || s.String == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s.String)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q: %w", s.String, err)
+	}
+	return &t, nil
+}
+
+type timeColumn struct {
+	value sql.NullString
+	dest  **time.Time
+}
+
+func scanTimes(columns ...timeColumn) error {
+	for _, c := range columns {
+		t, err := parseTime(c.value)
+		if err != nil {
+			return err
+		}
+		*c.dest = t
+	}
+	return nil
 }
 
 //TODO export tx as interface
 
+// CreateTx begins a transaction for the worker. Only its begin is retried
+// while the database is busy; a busy error later fails the poll, and the
+// trade is processed on the next one.
 func (m *Manager) CreateTx(ctx context.Context) (*sql.Tx, error) {
 
-	return m.db.BeginTx(ctx, &sql.TxOptions{
+	return m.beginTx(ctx, &sql.TxOptions{
 		Isolation: sql.LevelSerializable,
 	})
 }
@@ -188,3 +559,18 @@ func (m *Manager) CommitTx(tx *sql.Tx) error {
 func (m *Manager) RollbackTx(tx *sql.Tx) error {
 	return tx.Rollback()
 }
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, attribute.String("db.system.name", "sqlite"))...),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
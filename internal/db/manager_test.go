@@ -0,0 +1,63 @@
+package db
+
+import (
+	"database/sql"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+
+	m := &Manager{}
+	if err = m.InitDbManager(conn); err != nil {
+		t.Fatalf("InitDbManager: %v", err)
+	}
+	return m
+}
+
+func TestCreateTradesQ_UpgradesLegacyTable(t *testing.T) {
+	m := newTestManager(t)
+	legacy := `
+CREATE TABLE trades_q (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account STRING UNIQUE,
+	symbol VARCHAR(50),
+	volume FLOAT,
+    open FLOAT,
+    close FLOAT,
+    side VARCHAR(50),
+    processed INTEGER DEFAULT(0)
+);
+INSERT INTO trades_q (account, symbol, volume, open, close, side) VALUES ('123', 'EURUSD', 1, 1.1, 1.2, 'buy');`
+	if _, err := m.db.Exec(legacy); err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+
+	trade := model.Trade{Account: "123", Symbol: "EURUSD", Volume: 2, Open: 1.1, Close: 1.0, Side: "sell", RequestId: "r2"}
+	if err := m.CreateTrade(t.Context(), &trade); err != nil {
+		t.Fatalf("second trade for the same account: %v", err)
+	}
+	if trade.Id != 2 {
+		t.Errorf("trade id = %d; want 2", trade.Id)
+	}
+	if n, err := m.CountPendingTrades(t.Context()); err != nil || n != 2 {
+		t.Errorf("CountPendingTrades = %d, %v; want 2", n, err)
+	}
+
+	// running the upgrade again must be a no-op
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed again: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"time"
+)
+
+// QueueDepth counts the queued trades by status.
+func (m *Manager) QueueDepth(ctx context.Context) (*model.QueueDepth, error) {
+	reqSQL := fmt.Sprintf(`
+SELECT COALESCE(SUM(processed = 0), 0),
+       COALESCE(SUM(processed = 1 AND cancelled_at IS NULL), 0),
+       COALESCE(SUM(cancelled_at IS NOT NULL), 0),
+       MIN(CASE WHEN processed = 0 THEN received_at END)
+  FROM %s
+`, Trades_table)
+	var depth model.QueueDepth
+	var oldest sql.NullString
+	err := m.reader().QueryRowContext(ctx, reqSQL).Scan(&depth.Pending, &depth.Processed, &depth.Cancelled, &oldest)
+	if err != nil {
+		return nil, err
+	}
+	if depth.OldestPending, err = parseTime(oldest); err != nil {
+		return nil, err
+	}
+	return &depth, nil
+}
+
+// StuckTrades returns at most limit pending trades received before before,
+// oldest first. Trades queued by versions that did not record the time of
+// receipt are always included.
+func (m *Manager) StuckTrades(ctx context.Context, before time.Time, limit int) ([]*model.Trade, error) {
+	reqSQL := fmt.Sprintf(`
+SELECT %s FROM %s
+ WHERE processed = 0 AND (received_at IS NULL OR received_at < ?)
+ ORDER BY id LIMIT ?
+`, tradeColumns, Trades_table)
+	rows, err := m.reader().QueryContext(ctx, reqSQL, formatTime(&before), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var trades []*model.Trade
+	for rows.Next() {
+		trade, err := scanTrade(rows)
+		if err != nil {
+			return nil, err
+		}
+		trades = append(trades, trade)
+	}
+	return trades, rows.Err()
+}
+
+// RequeueTrade puts prev, a processed trade as read by FindTrade, back on
+// the queue so that the worker processes it again. Its profit is taken out
+// of the account stats and its rebates are reversed until then.
+func (m *Manager) RequeueTrade(ctx context.Context, prev *model.Trade, actor, reason string, at time.Time) (*model.TradeVersion, error) {
+	change := newTradeVersion(prev, model.TradeActionRequeue, actor, reason, at)
+	change.ProfitDelta = -prev.Profit()
+	change.TradesDelta = -1
+	err := m.changeTrade(ctx, prev.Account, change, nil, audit.ActionTradeRequeue, map[string]any{}, fmt.Sprintf(`
+UPDATE %s
+   SET processed = 0, processed_at = NULL, group_id = NULL, rollovers = 0, version = version + 1
+ WHERE id = ? AND version = ? AND processed = 1 AND cancelled_at IS NULL
+`, Trades_table),
+		prev.Id, prev.Version)
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// StatsDrift compares the stats of every account with the trades processed
+// for it and returns the accounts where they differ.
+func (m *Manager) StatsDrift(ctx context.Context) ([]model.StatsDrift, error) {
+	return m.statsDrift(ctx, m.db)
+}
+
+// RebuildStats recomputes the stats of every account from its processed
+// trades. Each account that drifted is adjusted like a processed trade
+// would, and returned.
+func (m *Manager) RebuildStats(ctx context.Context) ([]model.StatsDrift, error) {
+	var drifts []model.StatsDrift
+	err := m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		if drifts, err = m.statsDrift(ctx, tx); err != nil {
+			return err
+		}
+		for _, d := range drifts {
+			if err = m.adjustClient(ctx, tx, d.Account, d.WantTrades-d.Trades, d.WantProfit-d.Profit); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return drifts, nil
+}
+
+func (m *Manager) statsDrift(ctx context.Context, q queryer) ([]model.StatsDrift, error) {
+	// clients.account has numeric affinity, so it is cast to match the
+	// accounts of the trades. Summing in another order than the stats were
+	// built gives rounding differences far below a cent.
+	reqSQL := fmt.Sprintf(`
+WITH want AS (
+    SELECT account, COUNT(*) AS trades,
+           SUM((close - open) * volume * ? * CASE side WHEN 'sell' THEN -1 ELSE 1 END) AS profit
+      FROM %[1]s
+     WHERE processed = 1 AND cancelled_at IS NULL
+     GROUP BY account
+), accounts AS (
+    SELECT account FROM want UNION SELECT CAST(account AS TEXT) FROM %[2]s
+)
+SELECT a.account, COALESCE(c.trades, 0), COALESCE(c.profit, 0), COALESCE(w.trades, 0), COALESCE(w.profit, 0)
+  FROM accounts a
+  LEFT JOIN %[2]s c ON c.account = a.account
+  LEFT JOIN want w ON w.account = a.account
+ WHERE COALESCE(c.trades, 0) != COALESCE(w.trades, 0)
+    OR ABS(COALESCE(c.profit, 0) - COALESCE(w.profit, 0)) > 0.000001
+ ORDER BY a.account
+`, Trades_table, Clients_table)
+	rows, err := q.QueryContext(ctx, reqSQL, model.Lot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var drifts []model.StatsDrift
+	for rows.Next() {
+		var d model.StatsDrift
+		if err = rows.Scan(&d.Account, &d.Trades, &d.Profit, &d.WantTrades, &d.WantProfit); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, d)
+	}
+	return drifts, rows.Err()
+}
+
+// IntegrityCheck runs the SQLite integrity check and returns the problems it
+// finds, none when the database is sound.
+func (m *Manager) IntegrityCheck(ctx context.Context) ([]string, error) {
+	rows, err := m.reader().QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err = rows.Scan(&msg); err != nil {
+			return nil, err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	return problems, rows.Err()
+}
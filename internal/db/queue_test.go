@@ -0,0 +1,97 @@
+package db
+
+import (
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestQueueMaintenance(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	for i, account := range []string{"123", "123", "456"} {
+		trade := model.Trade{Account: account, Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: "buy",
+			ReceivedAt: at.Add(time.Duration(i) * time.Minute)}
+		if err := m.CreateTrade(t.Context(), &trade); err != nil {
+			t.Fatalf("CreateTrade: %v", err)
+		}
+	}
+	processTrade(t, m)
+	if _, err := m.CancelTrade(t.Context(), findTrade(t, m, 2), "ops", "duplicate", at); err != nil {
+		t.Fatalf("CancelTrade: %v", err)
+	}
+
+	depth, err := m.QueueDepth(t.Context())
+	if err != nil || depth.Pending != 1 || depth.Processed != 1 || depth.Cancelled != 1 ||
+		depth.OldestPending == nil || !depth.OldestPending.Equal(at.Add(2*time.Minute)) {
+		t.Fatalf("QueueDepth = %+v, %v", depth, err)
+	}
+	stuck, err := m.StuckTrades(t.Context(), at.Add(2*time.Minute), 10)
+	if err != nil || len(stuck) != 0 {
+		t.Errorf("StuckTrades before receipt = %v, %v; want none", stuck, err)
+	}
+	if stuck, err = m.StuckTrades(t.Context(), at.Add(time.Hour), 10); err != nil || len(stuck) != 1 || stuck[0].Id != 3 {
+		t.Errorf("StuckTrades = %v, %v; want trade 3", stuck, err)
+	}
+
+	// a requeued trade leaves the stats until it is processed again
+	change, err := m.RequeueTrade(t.Context(), findTrade(t, m, 1), "ops", "wrong group", at)
+	if err != nil || change.Action != model.TradeActionRequeue || change.TradesDelta != -1 {
+		t.Fatalf("RequeueTrade = %+v, %v", change, err)
+	}
+	requeued := findTrade(t, m, 1)
+	if requeued.Status() != model.TradeStatusPending || requeued.Version != 2 || requeued.ProcessedAt != nil {
+		t.Errorf("requeued trade = %+v", requeued)
+	}
+	if client, _ := m.GetClient(t.Context(), "123"); client.Trades != 0 || math.Abs(client.Profit) > 0.01 {
+		t.Errorf("after requeue, client = %+v; want no trades", client)
+	}
+	if _, err = m.RequeueTrade(t.Context(), findTrade(t, m, 2), "ops", "again", at); !errors.Is(err, ErrTradeChanged) {
+		t.Errorf("requeue cancelled trade: err = %v; want ErrTradeChanged", err)
+	}
+	if trade := processTrade(t, m); trade.Id != 1 {
+		t.Errorf("processed trade %d; want the requeued trade 1", trade.Id)
+	}
+
+	if drifts, err := m.StatsDrift(t.Context()); err != nil || len(drifts) != 0 {
+		t.Fatalf("StatsDrift = %+v, %v; want none", drifts, err)
+	}
+	if _, err = m.db.Exec(`UPDATE clients SET trades = 5, profit = 1 WHERE account = '123'`); err != nil {
+		t.Fatalf("corrupt stats: %v", err)
+	}
+	if _, err = m.db.Exec(`INSERT INTO clients (account, trades, profit) VALUES ('789', 1, 10)`); err != nil {
+		t.Fatalf("corrupt stats: %v", err)
+	}
+	want := []model.StatsDrift{
+		{Account: "123", Trades: 5, Profit: 1, WantTrades: 1, WantProfit: 500},
+		{Account: "789", Trades: 1, Profit: 10},
+	}
+	drifts, err := m.RebuildStats(t.Context())
+	if err != nil || len(drifts) != len(want) {
+		t.Fatalf("RebuildStats = %+v, %v; want %+v", drifts, err, want)
+	}
+	for i, d := range drifts {
+		if d.Account != want[i].Account || d.Trades != want[i].Trades || d.WantTrades != want[i].WantTrades ||
+			math.Abs(d.WantProfit-want[i].WantProfit) > 0.01 {
+			t.Errorf("drift %d = %+v; want %+v", i, d, want[i])
+		}
+	}
+	if drifts, err = m.StatsDrift(t.Context()); err != nil || len(drifts) != 0 {
+		t.Errorf("StatsDrift after rebuild = %+v, %v; want none", drifts, err)
+	}
+	if client, _ := m.GetClient(t.Context(), "123"); client.Trades != 1 || math.Abs(client.Profit-500) > 0.01 {
+		t.Errorf("rebuilt client = %+v; want 1 trade, profit 500", client)
+	}
+
+	if problems, err := m.IntegrityCheck(t.Context()); err != nil || len(problems) != 0 {
+		t.Errorf("IntegrityCheck = %v, %v", problems, err)
+	}
+	if _, _, err = m.VerifyAudit(t.Context()); err != nil {
+		t.Errorf("VerifyAudit: %v", err)
+	}
+}
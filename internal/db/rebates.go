@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"time"
+)
+
+const (
+	RebateRates_table    = "rebate_rates"
+	RebateAccruals_table = "rebate_accruals"
+)
+
+func (m *Manager) CreateRebates() error {
+	schemaSQL := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]s (
+    group_id TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    per_lot FLOAT NOT NULL,
+    PRIMARY KEY (group_id, symbol)
+);
+CREATE TABLE IF NOT EXISTS %[2]s (
+    trade_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    group_id TEXT NOT NULL,
+    account TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    lots FLOAT NOT NULL,
+    rate FLOAT NOT NULL,
+    amount FLOAT NOT NULL,
+    accrued_at TEXT NOT NULL,
+    reversed_at TEXT,
+    PRIMARY KEY (trade_id, version, group_id)
+);
+CREATE INDEX IF NOT EXISTS %[2]s_accrued_idx ON %[2]s (accrued_at);
+CREATE INDEX IF NOT EXISTS %[2]s_reversed_idx ON %[2]s (reversed_at);
+`, RebateRates_table, RebateAccruals_table)
+	_, err := m.db.Exec(schemaSQL)
+	return err
+}
+
+// SetRebateRates replaces the rebate rates of a group.
+func (m *Manager) SetRebateRates(ctx context.Context, group string, rates []model.RebateRate) error {
+	return m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE group_id = ?`, RebateRates_table), group); err != nil {
+			return err
+		}
+		reqSQL := fmt.Sprintf(`INSERT INTO %s (group_id, symbol, per_lot) VALUES (?, ?, ?)`, RebateRates_table)
+		for _, r := range rates {
+			if _, err = tx.ExecContext(ctx, reqSQL, group, r.Symbol, r.PerLot); err != nil {
+				return err
+			}
+		}
+		err = m.appendAudit(ctx, tx, audit.ActionRebatesUpdate, map[string]any{"group": group, "rates": rates})
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// RebateRates returns the rebate rates of a group ordered by symbol.
+func (m *Manager) RebateRates(ctx context.Context, group string) ([]model.RebateRate, error) {
+	reqSQL := fmt.Sprintf(`SELECT symbol, per_lot FROM %s WHERE group_id = ? ORDER BY symbol`, RebateRates_table)
+	rows, err := m.reader().QueryContext(ctx, reqSQL, group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []model.RebateRate{}
+	for rows.Next() {
+		var r model.RebateRate
+		if err = rows.Scan(&r.Symbol, &r.PerLot); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// AccrueRebates books the rebates of a processed trade in tx: every group
+// from the trade's group up to the root that has a rate for the symbol earns
+// that rate on the volume. A version of a trade accrues only once, so
+// processing it again changes nothing.
+func (m *Manager) AccrueRebates(ctx context.Context, tx *sql.Tx, trade *model.Trade, at time.Time) ([]model.RebateAccrual, error) {
+	if trade.Group == "" {
+		return nil, nil
+	}
+	reqSQL := fmt.Sprintf(`
+INSERT INTO %[1]s (trade_id, version, group_id, account, symbol, lots, rate, amount, accrued_at)
+SELECT @trade, @version, r.group_id, @account, @symbol, @lots, r.per_lot, @lots * r.per_lot, @at
+  FROM %[2]s p
+  JOIN %[3]s r ON r.group_id = p.ancestor
+ WHERE p.descendant = @group
+   AND r.symbol = COALESCE(
+       (SELECT symbol FROM %[3]s WHERE group_id = p.ancestor AND symbol = @symbol), @any)
+ON CONFLICT (trade_id, version, group_id) DO NOTHING
+RETURNING group_id, rate, amount
+`, RebateAccruals_table, AccountGroupPaths_table, RebateRates_table)
+	at = at.UTC().Truncate(time.Millisecond)
+	rows, err := tx.QueryContext(ctx, reqSQL,
+		sql.Named("trade", trade.Id), sql.Named("version", trade.Version), sql.Named("account", trade.Account),
+		sql.Named("symbol", trade.Symbol), sql.Named("lots", trade.Volume), sql.Named("at", formatTime(&at)),
+		sql.Named("group", trade.Group), sql.Named("any", model.AnySymbol))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accruals []model.RebateAccrual
+	for rows.Next() {
+		a := model.RebateAccrual{TradeId: trade.Id, Version: trade.Version, Account: trade.Account,
+			Symbol: trade.Symbol, Lots: trade.Volume, AccruedAt: at}
+		if err = rows.Scan(&a.Group, &a.Rate, &a.Amount); err != nil {
+			return nil, err
+		}
+		accruals = append(accruals, a)
+	}
+	return accruals, rows.Err()
+}
+
+// reverseRebates reverses the accruals of one version of a trade.
+func (m *Manager) reverseRebates(ctx context.Context, tx *sql.Tx, tradeId, version int, at time.Time) error {
+	reqSQL := fmt.Sprintf(`
+UPDATE %s SET reversed_at = ? WHERE trade_id = ? AND version = ? AND reversed_at IS NULL
+`, RebateAccruals_table)
+	_, err := tx.ExecContext(ctx, reqSQL, formatTime(&at), tradeId, version)
+	return err
+}
+
+// ListRebateAccruals returns the accruals of a trade, oldest version first.
+func (m *Manager) ListRebateAccruals(ctx context.Context, tradeId int) ([]model.RebateAccrual, error) {
+	reqSQL := fmt.Sprintf(`
+SELECT trade_id, version, group_id, account, symbol, lots, rate, amount, accrued_at, reversed_at
+  FROM %s WHERE trade_id = ? ORDER BY version, group_id
+`, RebateAccruals_table)
+	rows, err := m.reader().QueryContext(ctx, reqSQL, tradeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accruals := []model.RebateAccrual{}
+	for rows.Next() {
+		var a model.RebateAccrual
+		var accruedAt, reversedAt sql.NullString
+		err = rows.Scan(&a.TradeId, &a.Version, &a.Group, &a.Account, &a.Symbol, &a.Lots, &a.Rate, &a.Amount,
+			&accruedAt, &reversedAt)
+		if err != nil {
+			return nil, err
+		}
+		var accrued *time.Time
+		if err = scanTimes(timeColumn{accruedAt, &accrued}, timeColumn{reversedAt, &a.ReversedAt}); err != nil {
+			return nil, fmt.Errorf("rebate of trade %d: %w", a.TradeId, err)
+		}
+		if accrued != nil {
+			a.AccruedAt = *accrued
+		}
+		accruals = append(accruals, a)
+	}
+	return accruals, rows.Err()
+}
+
+// RebatePayouts sums the rebates of every group over [from, to): accruals
+// booked in the period less reversals booked in it, so a closed period is
+// never changed by later amendments or cancellations.
+func (m *Manager) RebatePayouts(ctx context.Context, from, to time.Time) ([]model.RebatePayout, error) {
+	reqSQL := fmt.Sprintf(`
+SELECT group_id,
+       COUNT(DISTINCT CASE WHEN accrued_at >= @from AND accrued_at < @to THEN trade_id END),
+       SUM(CASE WHEN accrued_at >= @from AND accrued_at < @to THEN lots ELSE 0 END) -
+       SUM(CASE WHEN reversed_at >= @from AND reversed_at < @to THEN lots ELSE 0 END),
+       SUM(CASE WHEN accrued_at >= @from AND accrued_at < @to THEN amount ELSE 0 END),
+       SUM(CASE WHEN reversed_at >= @from AND reversed_at < @to THEN amount ELSE 0 END)
+  FROM %s
+ WHERE (accrued_at >= @from AND accrued_at < @to) OR (reversed_at >= @from AND reversed_at < @to)
+ GROUP BY group_id
+ ORDER BY group_id
+`, RebateAccruals_table)
+	rows, err := m.reader().QueryContext(ctx, reqSQL, sql.Named("from", formatTime(&from)), sql.Named("to", formatTime(&to)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payouts := []model.RebatePayout{}
+	for rows.Next() {
+		var p model.RebatePayout
+		if err = rows.Scan(&p.Group, &p.Trades, &p.Lots, &p.Accrued, &p.Reversed); err != nil {
+			return nil, err
+		}
+		p.Payable = p.Accrued - p.Reversed
+		payouts = append(payouts, p)
+	}
+	return payouts, rows.Err()
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"math"
+	"testing"
+	"time"
+)
+
+// processWithRebates claims the oldest pending trade and accrues its rebates
+// as the worker does.
+func processWithRebates(t *testing.T, m *Manager, now time.Time) (*model.Trade, []model.RebateAccrual) {
+	tx, err := m.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	defer tx.Rollback()
+	trade, err := m.GetTrade(t.Context(), tx, now)
+	if err != nil || trade == nil {
+		t.Fatalf("GetTrade = %v, %v", trade, err)
+	}
+	accruals, err := m.AccrueRebates(t.Context(), tx, trade, now)
+	if err != nil {
+		t.Fatalf("AccrueRebates: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	return trade, accruals
+}
+
+func TestRebates(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	for _, g := range []model.AccountGroup{{Id: "master"}, {Id: "ib1", Parent: "master"}, {Id: "sub1", Parent: "ib1"}} {
+		g.CreatedAt = at
+		if err := m.CreateAccountGroup(t.Context(), &g); err != nil {
+			t.Fatalf("CreateAccountGroup: %v", err)
+		}
+	}
+	// sub1 earns nothing, ib1 3 per EURUSD lot and 2 otherwise, master 1
+	if err := m.SetRebateRates(t.Context(), "ib1", []model.RebateRate{{Symbol: "EURUSD", PerLot: 3}, {Symbol: model.AnySymbol, PerLot: 2}}); err != nil {
+		t.Fatalf("SetRebateRates: %v", err)
+	}
+	if err := m.SetRebateRates(t.Context(), "master", []model.RebateRate{{Symbol: model.AnySymbol, PerLot: 1}}); err != nil {
+		t.Fatalf("SetRebateRates: %v", err)
+	}
+	if rates, err := m.RebateRates(t.Context(), "ib1"); err != nil || len(rates) != 2 || rates[0].Symbol != model.AnySymbol {
+		t.Errorf("RebateRates = %+v, %v", rates, err)
+	}
+	account := model.TradingAccount{Id: "A", Name: "A", Currency: "USD", Group: "sub1", Leverage: 1,
+		Status: model.AccountStatusActive, CreatedAt: at, UpdatedAt: at}
+	if err := m.CreateTradingAccount(t.Context(), &account); err != nil {
+		t.Fatalf("CreateTradingAccount: %v", err)
+	}
+	for _, trade := range []model.Trade{
+		{Account: "A", Symbol: "EURUSD", Volume: 2, Open: 1.1, Close: 1.105, Side: "buy"},
+		{Account: "A", Symbol: "GBPUSD", Volume: 1, Open: 1.3, Close: 1.305, Side: "buy"},
+	} {
+		if err := m.CreateTrade(t.Context(), &trade); err != nil {
+			t.Fatalf("CreateTrade: %v", err)
+		}
+	}
+
+	first, accruals := processWithRebates(t, m, at)
+	if len(accruals) != 2 || accruals[0].Amount+accruals[1].Amount != 8 {
+		t.Errorf("accruals = %+v; want 2 for master and 6 for ib1", accruals)
+	}
+	processWithRebates(t, m, at.Add(time.Minute))
+
+	// accruing a trade version again changes nothing
+	tx, err := m.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	if accruals, err = m.AccrueRebates(t.Context(), tx, first, at.Add(time.Hour)); err != nil || len(accruals) != 0 {
+		t.Errorf("AccrueRebates again = %+v, %v; want none", accruals, err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	// the next period amends the first trade to 3 lots and cancels the second
+	amendAt := at.Add(90 * time.Minute)
+	next := *findTrade(t, m, 1)
+	next.Volume = 3
+	if _, err = m.AmendTrade(t.Context(), findTrade(t, m, 1), &next, "key:bo", "volume", amendAt); err != nil {
+		t.Fatalf("AmendTrade: %v", err)
+	}
+	if _, err = m.CancelTrade(t.Context(), findTrade(t, m, 2), "key:bo", "duplicate", amendAt); err != nil {
+		t.Fatalf("CancelTrade: %v", err)
+	}
+	list, err := m.ListRebateAccruals(t.Context(), 1)
+	if err != nil || len(list) != 4 || list[0].ReversedAt == nil || list[2].Version != 2 || list[2].ReversedAt != nil {
+		t.Errorf("ListRebateAccruals = %+v, %v; want version 1 reversed and version 2 accrued", list, err)
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		payouts  []model.RebatePayout
+	}{
+		{name: "first period", from: at, to: at.Add(time.Hour), payouts: []model.RebatePayout{
+			{Group: "ib1", Trades: 2, Lots: 3, Accrued: 8, Payable: 8},
+			{Group: "master", Trades: 2, Lots: 3, Accrued: 3, Payable: 3},
+		}},
+		{name: "second period", from: at.Add(time.Hour), to: at.Add(2 * time.Hour), payouts: []model.RebatePayout{
+			{Group: "ib1", Trades: 1, Lots: 0, Accrued: 9, Reversed: 8, Payable: 1},
+			{Group: "master", Trades: 1, Lots: 0, Accrued: 3, Reversed: 3, Payable: 0},
+		}},
+		{name: "both periods", from: at, to: at.Add(2 * time.Hour), payouts: []model.RebatePayout{
+			{Group: "ib1", Trades: 2, Lots: 3, Accrued: 17, Reversed: 8, Payable: 9},
+			{Group: "master", Trades: 2, Lots: 3, Accrued: 6, Reversed: 3, Payable: 3},
+		}},
+		{name: "empty period", from: at.Add(-time.Hour), to: at},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		payouts, err := m.RebatePayouts(t.Context(), test.from, test.to)
+		if err != nil {
+			t.Fatalf("RebatePayouts: %v", err)
+		}
+		if len(payouts) != len(test.payouts) {
+			t.Fatalf("payouts = %+v; want %+v", payouts, test.payouts)
+		}
+		for i, p := range payouts {
+			want := test.payouts[i]
+			if p.Group != want.Group || p.Trades != want.Trades || math.Abs(p.Lots-want.Lots) > 1e-9 ||
+				math.Abs(p.Accrued-want.Accrued) > 1e-9 || math.Abs(p.Reversed-want.Reversed) > 1e-9 ||
+				math.Abs(p.Payable-want.Payable) > 1e-9 {
+				t.Errorf("payout = %+v; want %+v", p, want)
+			}
+		}
+	}
+}
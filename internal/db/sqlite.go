@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/mattn/go-sqlite3"
+	"math/rand/v2"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options tune the SQLite connections opened by Open.
+type Options struct {
+	// JournalMode is the journal_mode pragma, e.g. wal, which lets readers
+	// go on while a write is in progress.
+	JournalMode string
+	// Synchronous is the synchronous pragma: off, normal, full or extra.
+	Synchronous string
+	// BusyTimeout is how long a connection waits for the lock of another
+	// one before failing with SQLITE_BUSY.
+	BusyTimeout time.Duration
+	// SingleWriter sends all writes through one connection and reads
+	// through a separate read-only pool, so that writers of one process
+	// queue up in Go instead of competing for the database lock.
+	SingleWriter bool
+}
+
+// Conns are the connection pools of a database. Read is Write when reads
+// and writes share one pool.
+type Conns struct {
+	Write *sql.DB
+	Read  *sql.DB
+}
+
+// Open opens the database at dsn with o. Settings given as connection
+// parameters of dsn, e.g. data.db?_busy_timeout=1000, take precedence.
+// Transactions take the write lock when they begin, so a transaction never
+// fails half way because another process started writing. An in-memory
+// database only exists for its connection and is never split in two pools.
+func Open(dsn string, o Options) (*Conns, error) {
+	params := url.Values{}
+	params.Set("_txlock", "immediate")
+	if o.JournalMode != "" {
+		params.Set("_journal_mode", o.JournalMode)
+	}
+	if o.Synchronous != "" {
+		params.Set("_synchronous", o.Synchronous)
+	}
+	if o.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(o.BusyTimeout.Milliseconds(), 10))
+	}
+	write, err := sql.Open("sqlite3", withParams(dsn, params))
+	if err != nil {
+		return nil, err
+	}
+	if !o.SingleWriter || inMemory(dsn) {
+		return &Conns{Write: write, Read: write}, nil
+	}
+	write.SetMaxOpenConns(1)
+	write.SetMaxIdleConns(1)
+	// the writer switches the journal mode before any reader connects
+	if err = write.Ping(); err != nil {
+		write.Close()
+		return nil, err
+	}
+
+	params = url.Values{}
+	params.Set("_query_only", "1")
+	if o.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(o.BusyTimeout.Milliseconds(), 10))
+	}
+	read, err := sql.Open("sqlite3", withParams(dsn, params))
+	if err != nil {
+		write.Close()
+		return nil, err
+	}
+	return &Conns{Write: write, Read: read}, nil
+}
+
+func (c *Conns) Ping() error {
+	if err := c.Write.Ping(); err != nil {
+		return err
+	}
+	return c.Read.Ping()
+}
+
+func (c *Conns) Close() error {
+	err := c.Write.Close()
+	if c.Read != c.Write {
+		err = errors.Join(err, c.Read.Close())
+	}
+	return err
+}
+
+// withParams appends params to the connection parameters of dsn. The
+// driver uses the first value of a parameter, so those of dsn win.
+func withParams(dsn string, params url.Values) string {
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + params.Encode()
+	}
+	return dsn + "?" + params.Encode()
+}
+
+func inMemory(dsn string) bool {
+	return strings.HasPrefix(dsn, ":memory:") || strings.HasPrefix(dsn, "file::memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+// IsBusy reports whether err comes from another connection holding the
+// database lock.
+func IsBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// SetBusyRetry makes writes that find the database locked for longer than
+// the busy timeout try again up to retries times. The first retry waits
+// between delay/2 and delay, and every further one twice as long, so that
+// processes that collided do not collide again.
+func (m *Manager) SetBusyRetry(retries int, delay time.Duration) {
+	m.busyRetries, m.busyDelay = retries, delay
+}
+
+// SetReadDB sends the queries outside transactions to db, typically the
+// Read pool of Open. By default they use the database of InitDbManager.
+func (m *Manager) SetReadDB(db *sql.DB) {
+	m.read = db
+}
+
+// reader is the pool for queries that do not write.
+func (m *Manager) reader() *sql.DB {
+	if m.read != nil {
+		return m.read
+	}
+	return m.db
+}
+
+// inTx runs fn in a transaction on the writer and commits it. When the
+// database stays locked for longer than the busy timeout, at the begin, in a
+// statement or at the commit, the transaction is rolled back and fn runs
+// again, so fn must set anything it returns through its closure on every
+// run.
+func (m *Manager) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return m.retryBusy(ctx, func() error {
+		tx, err := m.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err = fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// beginTx begins a transaction on the writer, retrying while the database
+// is busy. Busy errors later in the transaction are returned; use inTx for
+// transactions that are retried as a whole.
+func (m *Manager) beginTx(ctx context.Context, opts *sql.TxOptions) (tx *sql.Tx, err error) {
+	err = m.retryBusy(ctx, func() error {
+		tx, err = m.db.BeginTx(ctx, opts)
+		return err
+	})
+	return tx, err
+}
+
+func (m *Manager) retryBusy(ctx context.Context, fn func() error) error {
+	err := fn()
+	delay := m.busyDelay
+	for attempt := 0; attempt < m.busyRetries && IsBusy(err); attempt++ {
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay/2 + rand.N(delay/2+1)):
+		}
+		delay *= 2
+		err = fn()
+	}
+	return err
+}
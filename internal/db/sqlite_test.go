@@ -0,0 +1,219 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testOptions = Options{JournalMode: "wal", Synchronous: "normal", BusyTimeout: 5 * time.Second, SingleWriter: true}
+
+// openManager opens path as the server and the worker do.
+func openManager(t *testing.T, path string, o Options) (*Manager, *Conns) {
+	conns, err := Open(path, o)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { conns.Close() })
+	m := &Manager{}
+	if err = m.InitDbManager(conns.Write); err != nil {
+		t.Fatalf("InitDbManager: %v", err)
+	}
+	m.SetReadDB(conns.Read)
+	m.SetBusyRetry(5, 20*time.Millisecond)
+	return m, conns
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	tests := []struct {
+		name string
+		dsn  string
+		// journalMode and busyTimeout are the expected pragmas of the
+		// writer.
+		journalMode string
+		busyTimeout int
+	}{
+		{name: "options", dsn: path, journalMode: "wal", busyTimeout: 5000},
+		{name: "parameters of the dsn win", dsn: path + "?_busy_timeout=1000", journalMode: "wal", busyTimeout: 1000},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		m, conns := openManager(t, test.dsn, testOptions)
+		var journalMode string
+		var busyTimeout int
+		if err := conns.Write.QueryRow(`PRAGMA journal_mode`).Scan(&journalMode); err != nil {
+			t.Fatalf("journal_mode: %v", err)
+		}
+		if err := conns.Write.QueryRow(`PRAGMA busy_timeout`).Scan(&busyTimeout); err != nil {
+			t.Fatalf("busy_timeout: %v", err)
+		}
+		if journalMode != test.journalMode || busyTimeout != test.busyTimeout {
+			t.Errorf("journal_mode %s, busy_timeout %d; want %s, %d", journalMode, busyTimeout, test.journalMode, test.busyTimeout)
+		}
+		if err := m.CreateTablesIfNeed(); err != nil {
+			t.Fatalf("CreateTablesIfNeed: %v", err)
+		}
+		if _, err := conns.Read.Exec(`DELETE FROM trades_q`); err == nil {
+			t.Error("write through the read pool succeeded")
+		}
+	}
+
+	conns, err := Open(":memory:", testOptions)
+	if err != nil {
+		t.Fatalf("Open in memory: %v", err)
+	}
+	defer conns.Close()
+	if conns.Read != conns.Write {
+		t.Error("in-memory database split into two pools")
+	}
+}
+
+// TestInTx_Busy writes while another process holds the write lock. The
+// transaction begins without the lock, so its first write is the statement
+// that finds the database busy, and the whole transaction is run again.
+func TestInTx_Busy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	m, _ := openManager(t, path+"?_txlock=deferred&_busy_timeout=10", testOptions)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	other, _ := openManager(t, path, testOptions)
+	tx, err := other.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("CreateTx: %v", err)
+	}
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		time.Sleep(50 * time.Millisecond)
+		tx.Rollback()
+	}()
+
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	runs := 0
+	err = m.inTx(t.Context(), func(tx *sql.Tx) error {
+		runs++
+		created, err := m.insertTradingAccount(t.Context(), tx, &model.TradingAccount{Id: "A", Status: model.AccountStatusActive,
+			CreatedAt: at, UpdatedAt: at})
+		if err == nil && !created {
+			err = errors.New("account exists")
+		}
+		return err
+	})
+	<-released
+	if err != nil || runs < 2 {
+		t.Errorf("inTx = %v after %d runs; want success after a retry", err, runs)
+	}
+	if a, err := m.GetTradingAccount(t.Context(), "A"); err != nil || a == nil {
+		t.Errorf("GetTradingAccount = %+v, %v; want the account", a, err)
+	}
+}
+
+// TestOpen_Contention ingests trades from several connections, as the
+// server does under load, while another process drains the queue.
+func TestOpen_Contention(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	const trades = 2000
+	path := filepath.Join(t.TempDir(), "data.db")
+	server, _ := openManager(t, path, testOptions)
+	if err := server.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	worker, _ := openManager(t, path, testOptions)
+
+	var errs []error
+	var mu sync.Mutex
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+	ctx := t.Context()
+	var submit sync.WaitGroup
+	next := make(chan int)
+	for range 8 {
+		submit.Add(1)
+		go func() {
+			defer submit.Done()
+			for i := range next {
+				trade := &model.Trade{Account: "acc" + string(rune('a'+i%10)), Symbol: "EURUSD", Volume: 1,
+					Open: 1.1, Close: 1.2, Side: "buy", ReceivedAt: time.Now()}
+				if err := server.CreateTrade(ctx, trade); err != nil {
+					fail(err)
+				}
+				if _, err := server.CountPendingTrades(ctx); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	submitted := make(chan struct{})
+	var drain sync.WaitGroup
+	for range 2 {
+		drain.Add(1)
+		go func() {
+			defer drain.Done()
+			for {
+				claimed, err := claimNext(ctx, worker)
+				if err != nil {
+					fail(err)
+					return
+				}
+				if !claimed {
+					select {
+					case <-submitted:
+						return
+					case <-time.After(time.Millisecond):
+					}
+				}
+			}
+		}()
+	}
+
+	start := time.Now()
+	for i := range trades {
+		next <- i
+	}
+	close(next)
+	submit.Wait()
+	t.Logf("%d trades submitted in %s", trades, time.Since(start))
+	close(submitted)
+	drain.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("errors under load: %v", err)
+	}
+	depth, err := server.QueueDepth(ctx)
+	if err != nil {
+		t.Fatalf("QueueDepth: %v", err)
+	}
+	if depth.Pending != 0 || depth.Processed != trades {
+		t.Errorf("queue = %+v; want all %d trades processed", depth, trades)
+	}
+}
+
+// claimNext processes the oldest pending trade as the worker does.
+func claimNext(ctx context.Context, m *Manager) (bool, error) {
+	tx, err := m.CreateTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	trade, err := m.GetTrade(ctx, tx, time.Now())
+	if err != nil || trade == nil {
+		return false, err
+	}
+	if err = m.UpdateAccount(ctx, tx, trade.Account, trade.Profit()); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
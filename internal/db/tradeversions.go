@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"time"
+)
+
+const TradeVersions_table = "trade_versions"
+
+// ErrTradeChanged is returned when a trade was claimed, amended or cancelled
+// by someone else since it was read.
+var ErrTradeChanged = errors.New("trade changed concurrently")
+
+func (m *Manager) CreateTradeVersions() error {
+	schemaSQL := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    trade_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    symbol VARCHAR(50),
+    volume FLOAT,
+    open FLOAT,
+    close FLOAT,
+    side VARCHAR(50),
+    open_time TEXT,
+    close_time TEXT,
+    status TEXT NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    changed_at TEXT NOT NULL,
+    profit_delta FLOAT NOT NULL DEFAULT 0,
+    trades_delta INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (trade_id, version)
+);
+`, TradeVersions_table)
+	_, err := m.db.Exec(schemaSQL)
+	return err
+}
+
+// AmendTrade replaces prev, as read by FindTrade, with next. When prev was
+// already processed, the account stats are adjusted by the difference in
+// profit. prev is kept as a version recording actor, reason and at.
+func (m *Manager) AmendTrade(ctx context.Context, prev, next *model.Trade, actor, reason string, at time.Time) (*model.TradeVersion, error) {
+	change := newTradeVersion(prev, model.TradeActionAmend, actor, reason, at)
+	if prev.Status() == model.TradeStatusProcessed {
+		change.ProfitDelta = next.Profit() - prev.Profit()
+	}
+	payload := map[string]any{
+		"symbol":     next.Symbol,
+		"volume":     next.Volume,
+		"open":       next.Open,
+		"close":      next.Close,
+		"side":       next.Side,
+		"open_time":  next.OpenTime,
+		"close_time": next.CloseTime,
+	}
+	amended := *next
+	amended.Version = prev.Version + 1
+	amended.Group = prev.Group
+	err := m.changeTrade(ctx, prev.Account, change, &amended, audit.ActionTradeAmend, payload, fmt.Sprintf(`
+UPDATE %s
+   SET symbol = ?, volume = ?, open = ?, close = ?, side = ?, open_time = ?, close_time = ?, version = version + 1
+ WHERE id = ? AND version = ? AND processed = ? AND cancelled_at IS NULL
+`, Trades_table),
+		next.Symbol, next.Volume, next.Open, next.Close, next.Side, formatTime(next.OpenTime), formatTime(next.CloseTime),
+		prev.Id, prev.Version, prev.Processed)
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// CancelTrade cancels prev, as read by FindTrade. A pending trade is taken
+// off the queue; a processed one is reversed in the account stats.
+func (m *Manager) CancelTrade(ctx context.Context, prev *model.Trade, actor, reason string, at time.Time) (*model.TradeVersion, error) {
+	change := newTradeVersion(prev, model.TradeActionCancel, actor, reason, at)
+	if prev.Status() == model.TradeStatusProcessed {
+		change.ProfitDelta = -prev.Profit()
+		change.TradesDelta = -1
+	}
+	// Marking the trade processed keeps the worker from claiming it.
+	err := m.changeTrade(ctx, prev.Account, change, nil, audit.ActionTradeCancel, map[string]any{}, fmt.Sprintf(`
+UPDATE %s
+   SET processed = 1, cancelled_at = ?, version = version + 1
+ WHERE id = ? AND version = ? AND processed = ? AND cancelled_at IS NULL
+`, Trades_table),
+		formatTime(&at), prev.Id, prev.Version, prev.Processed)
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// changeTrade runs the update of a trade, which must match exactly one row,
+// and records change with its adjustment of the account stats in the same
+// transaction. The rebates of a processed trade are reversed and, if next is
+// not nil, accrued again for the new version. The change is logged as
+// auditAction, with payload holding the new values.
+func (m *Manager) changeTrade(ctx context.Context, account string, change *model.TradeVersion, next *model.Trade,
+	auditAction string, payload map[string]any, updateSQL string, args ...any) (err error) {
+	ctx, span := startSpan(ctx, "db.update "+Trades_table)
+	defer func() { endSpan(span, err) }()
+
+	return m.inTx(ctx, func(tx *sql.Tx) (err error) {
+		res, err := tx.ExecContext(ctx, updateSQL, args...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("trade %d: %w", change.TradeId, ErrTradeChanged)
+		}
+
+		if change.ProfitDelta != 0 || change.TradesDelta != 0 {
+			reqSQL := fmt.Sprintf(`UPDATE %s SET trades = trades + ?, profit = profit + ? WHERE account = ?`, Clients_table)
+			if _, err = tx.ExecContext(ctx, reqSQL, change.TradesDelta, change.ProfitDelta, account); err != nil {
+				return err
+			}
+		}
+
+		if change.Status == model.TradeStatusProcessed {
+			if err = m.reverseRebates(ctx, tx, change.TradeId, change.Version, change.ChangedAt); err != nil {
+				return err
+			}
+			if next != nil {
+				if _, err = m.AccrueRebates(ctx, tx, next, change.ChangedAt); err != nil {
+					return err
+				}
+			}
+		}
+
+		reqSQL := fmt.Sprintf(`
+INSERT INTO %s (
+    trade_id, version, symbol, volume, open, close, side, open_time, close_time,
+    status, action, actor, reason, changed_at, profit_delta, trades_delta
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`, TradeVersions_table)
+		_, err = tx.ExecContext(ctx, reqSQL,
+			change.TradeId, change.Version, change.Symbol, change.Volume, change.Open, change.Close, change.Side,
+			formatTime(change.OpenTime), formatTime(change.CloseTime),
+			change.Status, change.Action, change.Actor, change.Reason, formatTime(&change.ChangedAt),
+			change.ProfitDelta, change.TradesDelta)
+		if err != nil {
+			return err
+		}
+
+		payload["trade_id"] = change.TradeId
+		payload["account"] = account
+		payload["version"] = change.Version + 1
+		payload["reason"] = change.Reason
+		payload["profit_delta"] = change.ProfitDelta
+		payload["trades_delta"] = change.TradesDelta
+		return m.appendAudit(ctx, tx, auditAction, payload)
+	})
+}
+
+func newTradeVersion(prev *model.Trade, action, actor, reason string, at time.Time) *model.TradeVersion {
+	return &model.TradeVersion{
+		TradeId:   prev.Id,
+		Version:   prev.Version,
+		Symbol:    prev.Symbol,
+		Volume:    prev.Volume,
+		Open:      prev.Open,
+		Close:     prev.Close,
+		Side:      prev.Side,
+		OpenTime:  prev.OpenTime,
+		CloseTime: prev.CloseTime,
+		Status:    prev.Status(),
+		Action:    action,
+		Actor:     actor,
+		Reason:    reason,
+		ChangedAt: at.UTC(),
+	}
+}
+
+// ListTradeVersions returns the replaced versions of a trade, oldest first.
+func (m *Manager) ListTradeVersions(ctx context.Context, tradeId int) ([]model.TradeVersion, error) {
+	reqSQL := fmt.Sprintf(`
+SELECT trade_id, version, symbol, volume, open, close, side, open_time, close_time,
+       status, action, actor, reason, changed_at, profit_delta, trades_delta
+  FROM %s WHERE trade_id = ? ORDER BY version
+`, TradeVersions_table)
+	rows, err := m.reader().QueryContext(ctx, reqSQL, tradeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []model.TradeVersion{}
+	for rows.Next() {
+		var v model.TradeVersion
+		var openTime, closeTime, changedAt sql.NullString
+		err = rows.Scan(&v.TradeId, &v.Version, &v.Symbol, &v.Volume, &v.Open, &v.Close, &v.Side, &openTime, &closeTime,
+			&v.Status, &v.Action, &v.Actor, &v.Reason, &changedAt, &v.ProfitDelta, &v.TradesDelta)
+		if err != nil {
+			return nil, err
+		}
+		var changed *time.Time
+		if err = scanTimes(
+			timeColumn{openTime, &v.OpenTime},
+			timeColumn{closeTime, &v.CloseTime},
+			timeColumn{changedAt, &changed},
+		); err != nil {
+			return nil, fmt.Errorf("trade %d version %d: %w", v.TradeId, v.Version, err)
+		}
+		if changed != nil {
+			v.ChangedAt = *changed
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"testing"
+	"time"
+)
+
+// processTrade does what the worker does with the oldest pending trade.
+func processTrade(t *testing.T, m *Manager) *model.Trade {
+	return processTradeAt(t, m, time.Now())
+}
+
+func processTradeAt(t *testing.T, m *Manager, now time.Time) *model.Trade {
+	tx, err := m.CreateTx(t.Context())
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	defer tx.Rollback()
+	trade, err := m.GetTrade(t.Context(), tx, now)
+	if err != nil || trade == nil {
+		t.Fatalf("GetTrade = %v, %v", trade, err)
+	}
+	if err = m.UpdateAccount(t.Context(), tx, trade.Account, trade.Profit()); err != nil {
+		t.Fatalf("UpdateAccount: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	return trade
+}
+
+func findTrade(t *testing.T, m *Manager, id int) *model.Trade {
+	trade, err := m.FindTrade(t.Context(), id)
+	if err != nil || trade == nil {
+		t.Fatalf("FindTrade(%d) = %v, %v", id, trade, err)
+	}
+	return trade
+}
+
+func TestAmendAndCancelTrade(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("CreateTablesIfNeed: %v", err)
+	}
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	for range 2 {
+		trade := model.Trade{Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: "buy"}
+		if err := m.CreateTrade(t.Context(), &trade); err != nil {
+			t.Fatalf("CreateTrade: %v", err)
+		}
+	}
+	processTrade(t, m)
+
+	// correcting the close price of the processed trade moves its profit
+	// from 500 to 1000
+	prev := findTrade(t, m, 1)
+	next := *prev
+	next.Close = 1.11
+	change, err := m.AmendTrade(t.Context(), prev, &next, "key:bo", "mistyped close", at)
+	if err != nil {
+		t.Fatalf("AmendTrade: %v", err)
+	}
+	if d := change.ProfitDelta; d < 499.99 || d > 500.01 {
+		t.Errorf("profit delta = %v; want 500", d)
+	}
+	if client, _ := m.GetClient(t.Context(), "123"); client.Trades != 1 || client.Profit < 999.99 || client.Profit > 1000.01 {
+		t.Errorf("after amend, client = %+v; want 1 trade, profit 1000", client)
+	}
+
+	// the stale version can not be amended again
+	if _, err = m.AmendTrade(t.Context(), prev, &next, "key:bo", "again", at); !errors.Is(err, ErrTradeChanged) {
+		t.Errorf("amending stale trade: err = %v; want ErrTradeChanged", err)
+	}
+
+	amended := findTrade(t, m, 1)
+	if amended.Version != 2 || amended.Close != 1.11 {
+		t.Errorf("amended trade = %+v", amended)
+	}
+	if _, err = m.CancelTrade(t.Context(), amended, "key:bo", "duplicate booking", at.Add(time.Minute)); err != nil {
+		t.Fatalf("CancelTrade: %v", err)
+	}
+	if client, _ := m.GetClient(t.Context(), "123"); client.Trades != 0 || client.Profit < -0.01 || client.Profit > 0.01 {
+		t.Errorf("after cancel, client = %+v; want no trades, no profit", client)
+	}
+
+	// a pending trade is simply taken off the queue
+	pending := findTrade(t, m, 2)
+	change, err = m.CancelTrade(t.Context(), pending, "key:bo", "client request", at)
+	if err != nil {
+		t.Fatalf("CancelTrade pending: %v", err)
+	}
+	if change.Status != model.TradeStatusPending || change.ProfitDelta != 0 || change.TradesDelta != 0 {
+		t.Errorf("pending cancel change = %+v", change)
+	}
+	if n, _ := m.CountPendingTrades(t.Context()); n != 0 {
+		t.Errorf("pending trades after cancel = %d; want 0", n)
+	}
+	if cancelled := findTrade(t, m, 2); cancelled.Status() != model.TradeStatusCancelled {
+		t.Errorf("status = %s; want cancelled", cancelled.Status())
+	}
+
+	versions, err := m.ListTradeVersions(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("ListTradeVersions: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("versions = %+v; want 2", versions)
+	}
+	first, second := versions[0], versions[1]
+	if first.Version != 1 || first.Action != model.TradeActionAmend || first.Close != 1.105 ||
+		first.Actor != "key:bo" || first.Reason != "mistyped close" || !first.ChangedAt.Equal(at) {
+		t.Errorf("first version = %+v", first)
+	}
+	if second.Version != 2 || second.Action != model.TradeActionCancel || second.Close != 1.11 || second.TradesDelta != -1 {
+		t.Errorf("second version = %+v", second)
+	}
+}
@@ -0,0 +1,194 @@
+// Package export writes trades and account stats as CSV for spreadsheets.
+// Numbers are written the same way whatever the locale, with a dot as the
+// decimal separator and no grouping, and times in RFC 3339 in a chosen
+// time zone. Rows are written as they are produced, so exports of any size
+// run in constant memory.
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	// time zones must not depend on the zoneinfo of the host
+	_ "time/tzdata"
+)
+
+var ErrUnknownColumn = errors.New("unknown column")
+
+// Format holds the settings applied to every value of an export.
+type Format struct {
+	// Location is the time zone times are converted to; nil means UTC.
+	Location *time.Location
+}
+
+// Float formats v with as many digits as needed to read it back exactly,
+// like the JSON API does.
+func (f Format) Float(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (f Format) Int(v int) string {
+	return strconv.Itoa(v)
+}
+
+// Time formats t in the time zone of f; nil and zero times are empty.
+func (f Format) Time(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	loc := f.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// Text returns s, quoted with a leading apostrophe when a spreadsheet would
+// otherwise evaluate it as a formula.
+func (f Format) Text(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// Column is one exportable field of rows of type T.
+type Column[T any] struct {
+	Name  string
+	Value func(f Format, row T) string
+}
+
+// Table lists the columns that can be exported for rows of type T, in their
+// default order.
+type Table[T any] []Column[T]
+
+// Names returns the names of all columns.
+func (t Table[T]) Names() []string {
+	names := make([]string, len(t))
+	for i, c := range t {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Select returns the named columns in the given order, or all columns when
+// names is empty.
+func (t Table[T]) Select(names []string) ([]Column[T], error) {
+	if len(names) == 0 {
+		return t, nil
+	}
+	columns := make([]Column[T], 0, len(names))
+	for _, name := range names {
+		i := t.index(name)
+		if i < 0 {
+			return nil, fmt.Errorf("%w %q; choose from %s", ErrUnknownColumn, name, strings.Join(t.Names(), ", "))
+		}
+		columns = append(columns, t[i])
+	}
+	return columns, nil
+}
+
+func (t Table[T]) index(name string) int {
+	for i, c := range t {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseColumns splits a comma separated list of column names.
+func ParseColumns(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Writer writes rows of type T as CSV with CRLF line endings, as spreadsheet
+// programs expect.
+type Writer[T any] struct {
+	csv     *csv.Writer
+	columns []Column[T]
+	format  Format
+	record  []string
+}
+
+// NewWriter writes the header line of columns and returns the writer for
+// the rows. With bom set, the output starts with a UTF-8 byte order mark so
+// that Excel detects the encoding.
+func NewWriter[T any](w io.Writer, columns []Column[T], format Format, bom bool) (*Writer[T], error) {
+	if bom {
+		if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+			return nil, err
+		}
+	}
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.Name
+	}
+	if err := cw.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer[T]{csv: cw, columns: columns, format: format, record: header}, nil
+}
+
+func (w *Writer[T]) Write(row T) error {
+	for i, c := range w.columns {
+		w.record[i] = c.Value(w.format, row)
+	}
+	return w.csv.Write(w.record)
+}
+
+// Flush writes buffered rows and returns the first error of any write.
+func (w *Writer[T]) Flush() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// Trades are the columns of a trade export. profit is the applied profit of
+// the trade, with the digits of the JSON API, and empty where the JSON API
+// leaves it out.
+var Trades = Table[*model.Trade]{
+	{"id", func(f Format, t *model.Trade) string { return f.Int(t.Id) }},
+	{"account", func(f Format, t *model.Trade) string { return f.Text(t.Account) }},
+	{"symbol", func(f Format, t *model.Trade) string { return f.Text(t.Symbol) }},
+	{"side", func(f Format, t *model.Trade) string { return f.Text(t.Side) }},
+	{"volume", func(f Format, t *model.Trade) string { return f.Float(t.Volume) }},
+	{"open", func(f Format, t *model.Trade) string { return f.Float(t.Open) }},
+	{"close", func(f Format, t *model.Trade) string { return f.Float(t.Close) }},
+	{"profit", func(f Format, t *model.Trade) string {
+		profit, ok := t.AppliedProfit()
+		if !ok {
+			return ""
+		}
+		return f.Float(profit)
+	}},
+	{"status", func(f Format, t *model.Trade) string { return t.Status() }},
+	{"version", func(f Format, t *model.Trade) string { return f.Int(t.Version) }},
+	{"group", func(f Format, t *model.Trade) string { return f.Text(t.Group) }},
+	{"open_time", func(f Format, t *model.Trade) string { return f.Time(t.OpenTime) }},
+	{"close_time", func(f Format, t *model.Trade) string { return f.Time(t.CloseTime) }},
+	{"received_at", func(f Format, t *model.Trade) string { return f.Time(&t.ReceivedAt) }},
+	{"processed_at", func(f Format, t *model.Trade) string { return f.Time(t.ProcessedAt) }},
+	{"cancelled_at", func(f Format, t *model.Trade) string { return f.Time(t.CancelledAt) }},
+}
+
+// Stats are the columns of an account stats export, as returned by
+// GET /stats/{acc}.
+var Stats = Table[model.Account]{
+	{"account", func(f Format, a model.Account) string { return f.Text(a.AccountId) }},
+	{"trades", func(f Format, a model.Account) string { return f.Int(a.Trades) }},
+	{"profit", func(f Format, a model.Account) string { return f.Float(a.Profit) }},
+}
@@ -0,0 +1,78 @@
+package export
+
+import (
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	at := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "small float", got: Format{}.Float(0.0000001), want: "0.0000001"},
+		{name: "large float", got: Format{}.Float(1234567.5), want: "1234567.5"},
+		{name: "negative float", got: Format{}.Float(-500), want: "-500"},
+		{name: "utc time", got: Format{}.Time(&at), want: "2025-06-02T12:00:00.000Z"},
+		{name: "converted time", got: Format{Location: berlin}.Time(&at), want: "2025-06-02T14:00:00.000+02:00"},
+		{name: "no time", got: Format{}.Time(nil), want: ""},
+		{name: "plain text", got: Format{}.Text("EURUSD"), want: "EURUSD"},
+		{name: "formula", got: Format{}.Text("=HYPERLINK(\"x\")"), want: "'=HYPERLINK(\"x\")"},
+		{name: "minus formula", got: Format{}.Text("-1+2"), want: "'-1+2"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if test.got != test.want {
+			t.Errorf("got %q; want %q", test.got, test.want)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	if _, err := Trades.Select([]string{"id", "bogus"}); !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("Select with unknown column = %v; want ErrUnknownColumn", err)
+	}
+	columns, err := Trades.Select(ParseColumns(" profit, id ,,side"))
+	if err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+
+	var b strings.Builder
+	w, err := NewWriter(&b, columns, Format{}, true)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	cancelled := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	trades := []*model.Trade{
+		{Id: 1, Volume: 1, Open: 1.1, Close: 1.105, Side: "buy", Processed: 1},
+		{Id: 2, Volume: 0.5, Open: 1.1, Close: 1.105, Side: "sell", Processed: 1},
+		{Id: 3, Volume: 1, Open: 1.1, Close: 1.105, Side: "buy"},
+		{Id: 4, Volume: 1, Open: 1.1, Close: 1.105, Side: "buy", Processed: 1, CancelledAt: &cancelled},
+	}
+	for _, trade := range trades {
+		if err = w.Write(trade); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	want := "\uFEFFprofit,id,side\r\n" +
+		Format{}.Float(trades[0].Profit()) + ",1,buy\r\n" +
+		Format{}.Float(trades[1].Profit()) + ",2,sell\r\n" +
+		",3,buy\r\n" +
+		",4,buy\r\n"
+	if b.String() != want {
+		t.Errorf("csv = %q; want %q", b.String(), want)
+	}
+}
@@ -0,0 +1,8 @@
+package fix
+
+import "time"
+
+// SetHeartbeatUnit shortens the unit of HeartBtInt for tests.
+func SetHeartbeatUnit(a *Acceptor, unit time.Duration) {
+	a.heartbeatUnit = unit
+}
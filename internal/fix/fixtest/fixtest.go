@@ -0,0 +1,140 @@
+// Package fixtest provides a scripted FIX initiator for testing acceptors.
+package fixtest
+
+import (
+	"bufio"
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/fix"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Timeout bounds every read of an Initiator.
+const Timeout = 5 * time.Second
+
+// Initiator is the counterparty side of a session. It sends the messages a
+// test scripts and reads the answers, failing the test on anything
+// unexpected; it keeps no state apart from the next sequence number to
+// send.
+type Initiator struct {
+	t    testing.TB
+	conn net.Conn
+	r    *bufio.Reader
+
+	// SenderCompID is ours, TargetCompID the acceptor's.
+	SenderCompID string
+	TargetCompID string
+	// NextSeq is the sequence number of the next message sent.
+	NextSeq int
+}
+
+// Dial connects to the acceptor at addr. The connection is closed when the
+// test ends.
+func Dial(t testing.TB, addr, sender, target string) *Initiator {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial %s: %v", addr, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &Initiator{t: t, conn: conn, r: bufio.NewReader(conn), SenderCompID: sender, TargetCompID: target, NextSeq: 1}
+}
+
+// Send stamps msg with the header and the next sequence number and writes
+// it.
+func (i *Initiator) Send(msg *fix.Message) *fix.Message {
+	i.t.Helper()
+	i.SendSeq(i.NextSeq, msg)
+	i.NextSeq++
+	return msg
+}
+
+// SendSeq writes msg with sequence number seq, leaving NextSeq alone; tests
+// use it to skip or repeat sequence numbers.
+func (i *Initiator) SendSeq(seq int, msg *fix.Message) {
+	i.t.Helper()
+	msg.Set(fix.TagSenderCompID, i.SenderCompID).Set(fix.TagTargetCompID, i.TargetCompID).
+		Set(fix.TagMsgSeqNum, strconv.Itoa(seq)).Set(fix.TagSendingTime, time.Now().UTC().Format(fix.TimeFormat))
+	i.WriteRaw(msg.Encode())
+}
+
+// WriteRaw writes raw as it is.
+func (i *Initiator) WriteRaw(raw []byte) {
+	i.t.Helper()
+	if _, err := i.conn.Write(raw); err != nil {
+		i.t.Fatalf("write: %v", err)
+	}
+}
+
+// Logon sends a logon with heartBtInt and expects the acceptor's logon.
+func (i *Initiator) Logon(heartBtInt int, reset bool) *fix.Message {
+	i.t.Helper()
+	logon := fix.NewMessage(fix.MsgLogon).Set(fix.TagEncryptMethod, "0").Set(fix.TagHeartBtInt, strconv.Itoa(heartBtInt))
+	if reset {
+		logon.Set(fix.TagResetSeqNumFlag, "Y")
+	}
+	i.Send(logon)
+	return i.Expect(fix.MsgLogon)
+}
+
+// Read returns the next message from the acceptor.
+func (i *Initiator) Read() *fix.Message {
+	i.t.Helper()
+	msg, err := i.read()
+	if err != nil {
+		i.t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func (i *Initiator) read() (*fix.Message, error) {
+	i.conn.SetReadDeadline(time.Now().Add(Timeout))
+	raw, err := fix.ReadMessage(i.r)
+	if err != nil {
+		return nil, err
+	}
+	return fix.Parse(raw)
+}
+
+// Expect reads the next message and fails the test unless it has msgType.
+func (i *Initiator) Expect(msgType string) *fix.Message {
+	i.t.Helper()
+	msg := i.Read()
+	if msg.Type() != msgType {
+		i.t.Fatalf("received %s; want MsgType %s", msg, msgType)
+	}
+	return msg
+}
+
+// ExpectClosed fails the test unless the acceptor closes the connection
+// without sending anything more.
+func (i *Initiator) ExpectClosed() {
+	i.t.Helper()
+	msg, err := i.read()
+	if err == nil {
+		i.t.Fatalf("received %s; want the connection closed", msg)
+	}
+	if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			i.t.Fatalf("connection still open after %s", Timeout)
+		}
+	}
+}
+
+// Logout sends a logout and expects the acceptor's logout and the
+// connection closed.
+func (i *Initiator) Logout() {
+	i.t.Helper()
+	i.Send(fix.NewMessage(fix.MsgLogout))
+	i.Expect(fix.MsgLogout)
+	i.ExpectClosed()
+}
+
+// Close closes the connection without logging out.
+func (i *Initiator) Close() {
+	i.conn.Close()
+}
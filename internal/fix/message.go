@@ -0,0 +1,312 @@
+// Package fix implements the session layer of FIX 4.4 for an acceptor:
+// framing and checksums, logon, heartbeats and test requests, sequence
+// numbers with gap detection and resend requests, and the persistence of
+// session state so that a restart resumes the session where it stopped.
+// Application messages are passed to an Application; the package knows
+// nothing about trades.
+package fix
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// BeginString is the only protocol version accepted.
+const BeginString = "FIX.4.4"
+
+const soh = '\x01'
+
+// Tags used by the session layer and the trade messages.
+const (
+	TagAccount                 = 1
+	TagBeginSeqNo              = 7
+	TagBeginString             = 8
+	TagBodyLength              = 9
+	TagCheckSum                = 10
+	TagEndSeqNo                = 16
+	TagExecID                  = 17
+	TagLastPx                  = 31
+	TagLastQty                 = 32
+	TagMsgSeqNum               = 34
+	TagMsgType                 = 35
+	TagNewSeqNo                = 36
+	TagPossDupFlag             = 43
+	TagRefSeqNum               = 45
+	TagSenderCompID            = 49
+	TagSendingTime             = 52
+	TagSide                    = 54
+	TagSymbol                  = 55
+	TagTargetCompID            = 56
+	TagText                    = 58
+	TagTransactTime            = 60
+	TagEncryptMethod           = 98
+	TagHeartBtInt              = 108
+	TagTestReqID               = 112
+	TagOrigSendingTime         = 122
+	TagGapFillFlag             = 123
+	TagResetSeqNumFlag         = 141
+	TagExecType                = 150
+	TagRefTagID                = 371
+	TagRefMsgType              = 372
+	TagSessionRejectReason     = 373
+	TagBusinessRejectRefID     = 379
+	TagBusinessRejectReason    = 380
+	TagNoSides                 = 552
+	TagTradeReportID           = 571
+	TagTradeReportRejectReason = 751
+	TagTradeReportType         = 856
+	TagTrdRptStatus            = 939
+)
+
+// Message types.
+const (
+	MsgHeartbeat             = "0"
+	MsgTestRequest           = "1"
+	MsgResendRequest         = "2"
+	MsgReject                = "3"
+	MsgSequenceReset         = "4"
+	MsgLogout                = "5"
+	MsgExecutionReport       = "8"
+	MsgLogon                 = "A"
+	MsgTradeCaptureReport    = "AE"
+	MsgTradeCaptureReportAck = "AR"
+	MsgBusinessMessageReject = "j"
+)
+
+// IsAdmin reports whether msgType is a session level message. Session
+// messages are never resent; a gap fill takes their place.
+func IsAdmin(msgType string) bool {
+	switch msgType {
+	case MsgHeartbeat, MsgTestRequest, MsgResendRequest, MsgReject, MsgSequenceReset, MsgLogout, MsgLogon:
+		return true
+	}
+	return false
+}
+
+// TimeFormat is the UTCTimestamp format with milliseconds.
+const TimeFormat = "20060102-15:04:05.000"
+
+// ParseTime parses a UTCTimestamp with or without fractional seconds.
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range []string{TimeFormat, "20060102-15:04:05", "20060102-15:04:05.000000"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UTCTimestamp %q", s)
+}
+
+type Field struct {
+	Tag   int
+	Value string
+}
+
+// Message is a FIX message without BeginString, BodyLength and CheckSum,
+// which are added by Encode and checked by Parse. Fields keep their order,
+// so repeating groups can be read in sequence.
+type Message struct {
+	Fields []Field
+}
+
+func NewMessage(msgType string) *Message {
+	return &Message{Fields: []Field{{TagMsgType, msgType}}}
+}
+
+func (m *Message) Type() string {
+	return m.Get(TagMsgType)
+}
+
+// Get returns the value of the first field with tag, or "".
+func (m *Message) Get(tag int) string {
+	v, _ := m.Lookup(tag)
+	return v
+}
+
+func (m *Message) Lookup(tag int) (string, bool) {
+	for _, f := range m.Fields {
+		if f.Tag == tag {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// Int returns the value of tag as an integer; a missing field is an error.
+func (m *Message) Int(tag int) (int, error) {
+	v, ok := m.Lookup(tag)
+	if !ok {
+		return 0, fmt.Errorf("missing tag %d", tag)
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("tag %d: %q is not an integer", tag, v)
+	}
+	return n, nil
+}
+
+func (m *Message) SeqNum() int {
+	n, _ := m.Int(TagMsgSeqNum)
+	return n
+}
+
+// PossDup reports whether the message is a resend.
+func (m *Message) PossDup() bool {
+	return m.Get(TagPossDupFlag) == "Y"
+}
+
+// Set replaces the value of the first field with tag, or adds the field.
+func (m *Message) Set(tag int, value string) *Message {
+	for i, f := range m.Fields {
+		if f.Tag == tag {
+			m.Fields[i].Value = value
+			return m
+		}
+	}
+	return m.Add(tag, value)
+}
+
+// Add appends a field, also when one with the same tag exists, as in
+// repeating groups.
+func (m *Message) Add(tag int, value string) *Message {
+	m.Fields = append(m.Fields, Field{tag, value})
+	return m
+}
+
+// headerTags are written first, in this order, whatever the order they were
+// set in.
+var headerTags = []int{TagMsgType, TagSenderCompID, TagTargetCompID, TagMsgSeqNum, TagPossDupFlag, TagSendingTime, TagOrigSendingTime}
+
+func isHeader(tag int) bool {
+	for _, t := range headerTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode returns the message on the wire.
+func (m *Message) Encode() []byte {
+	var body bytes.Buffer
+	write := func(tag int, value string) {
+		body.WriteString(strconv.Itoa(tag))
+		body.WriteByte('=')
+		body.WriteString(value)
+		body.WriteByte(soh)
+	}
+	for _, tag := range headerTags {
+		if v, ok := m.Lookup(tag); ok {
+			write(tag, v)
+		}
+	}
+	for _, f := range m.Fields {
+		if !isHeader(f.Tag) {
+			write(f.Tag, f.Value)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "8=%s%c9=%d%c", BeginString, soh, body.Len(), soh)
+	out.Write(body.Bytes())
+	fmt.Fprintf(&out, "10=%03d%c", checksum(out.Bytes()), soh)
+	return out.Bytes()
+}
+
+func checksum(b []byte) int {
+	sum := 0
+	for _, c := range b {
+		sum += int(c)
+	}
+	return sum % 256
+}
+
+// String shows the message with | for the field separator, for logs.
+func (m *Message) String() string {
+	return string(bytes.ReplaceAll(m.Encode(), []byte{soh}, []byte{'|'}))
+}
+
+var ErrGarbled = errors.New("garbled message")
+
+// Parse checks the framing, body length and checksum of raw and returns its
+// fields.
+func Parse(raw []byte) (*Message, error) {
+	fields, err := split(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 4 || fields[0].Tag != TagBeginString || fields[1].Tag != TagBodyLength ||
+		fields[2].Tag != TagMsgType || fields[len(fields)-1].Tag != TagCheckSum {
+		return nil, fmt.Errorf("%w: must start with 8, 9 and 35 and end with 10", ErrGarbled)
+	}
+	if fields[0].Value != BeginString {
+		return nil, fmt.Errorf("%w: BeginString %q, expected %s", ErrGarbled, fields[0].Value, BeginString)
+	}
+	header := bytes.Index(raw, []byte{soh})
+	header += bytes.IndexByte(raw[header+1:], soh) + 2
+	trailer := bytes.LastIndex(raw[:len(raw)-1], []byte{soh}) + 1
+	if length, err := strconv.Atoi(fields[1].Value); err != nil || length != trailer-header {
+		return nil, fmt.Errorf("%w: BodyLength %s, body is %d bytes", ErrGarbled, fields[1].Value, trailer-header)
+	}
+	if sum := fmt.Sprintf("%03d", checksum(raw[:trailer])); sum != fields[len(fields)-1].Value {
+		return nil, fmt.Errorf("%w: CheckSum %s, computed %s", ErrGarbled, fields[len(fields)-1].Value, sum)
+	}
+	return &Message{Fields: fields[2 : len(fields)-1]}, nil
+}
+
+func split(raw []byte) ([]Field, error) {
+	if len(raw) == 0 || raw[len(raw)-1] != soh {
+		return nil, fmt.Errorf("%w: must end with SOH", ErrGarbled)
+	}
+	var fields []Field
+	for _, part := range bytes.Split(raw[:len(raw)-1], []byte{soh}) {
+		tag, value, ok := bytes.Cut(part, []byte{'='})
+		n, err := strconv.Atoi(string(tag))
+		if !ok || err != nil || n <= 0 {
+			return nil, fmt.Errorf("%w: field %q", ErrGarbled, part)
+		}
+		fields = append(fields, Field{n, string(value)})
+	}
+	return fields, nil
+}
+
+// maxBodyLength bounds the memory a peer can make a read allocate.
+const maxBodyLength = 1 << 20
+
+// ReadMessage reads the bytes of one message from r, using BodyLength to
+// find its end. The message is not checked; see Parse.
+func ReadMessage(r *bufio.Reader) ([]byte, error) {
+	begin, err := r.ReadBytes(soh)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(begin, []byte("8=")) {
+		return nil, fmt.Errorf("%w: expected BeginString, got %q", ErrGarbled, begin)
+	}
+	length, err := r.ReadBytes(soh)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	n, err := strconv.Atoi(string(bytes.TrimPrefix(length[:len(length)-1], []byte("9="))))
+	if !bytes.HasPrefix(length, []byte("9=")) || err != nil || n < 0 || n > maxBodyLength {
+		return nil, fmt.Errorf("%w: expected BodyLength, got %q", ErrGarbled, length)
+	}
+	// body and "10=nnn<SOH>"
+	rest := make([]byte, n+7)
+	if _, err = io.ReadFull(r, rest); err != nil {
+		return nil, unexpected(err)
+	}
+	raw := append(append(begin, length...), rest...)
+	return raw, nil
+}
+
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
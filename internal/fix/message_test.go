@@ -0,0 +1,84 @@
+package fix
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeParse(t *testing.T) {
+	msg := NewMessage(MsgTradeCaptureReport).
+		Add(TagNoSides, "1").Add(TagSide, "1").Add(TagAccount, "123").
+		Set(TagMsgSeqNum, "7").Set(TagSenderCompID, "VENUE").Set(TagTargetCompID, "BROKER")
+	raw := msg.Encode()
+	want := "8=FIX.4.4|9=47|35=AE|49=VENUE|56=BROKER|34=7|552=1|54=1|1=123|10="
+	if got := strings.ReplaceAll(string(raw), "\x01", "|"); !strings.HasPrefix(got, want) {
+		t.Errorf("Encode = %s, want header first: %s", got, want)
+	}
+
+	parsed, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if parsed.Type() != MsgTradeCaptureReport || parsed.SeqNum() != 7 || parsed.Get(TagAccount) != "123" {
+		t.Errorf("Parse = %s", parsed)
+	}
+	if !bytes.Equal(parsed.Encode(), raw) {
+		t.Errorf("encoding the parsed message = %s, want %s", parsed, msg)
+	}
+}
+
+func TestParse_Garbled(t *testing.T) {
+	good := string(NewMessage(MsgHeartbeat).Set(TagMsgSeqNum, "1").Encode())
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "wrong checksum", raw: good[:len(good)-4] + "999\x01"},
+		{name: "wrong body length", raw: strings.Replace(good, "9=", "9=1", 1)},
+		{name: "other version", raw: strings.Replace(good, "FIX.4.4", "FIX.4.2", 1)},
+		{name: "no SOH at the end", raw: good[:len(good)-1]},
+		{name: "field without tag", raw: strings.Replace(good, "35=0", "=0", 1)},
+		{name: "no MsgType", raw: "8=FIX.4.4\x019=5\x0134=1\x0110=000\x01"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if _, err := Parse([]byte(test.raw)); !errors.Is(err, ErrGarbled) {
+			t.Errorf("Parse error = %v, want ErrGarbled", err)
+		}
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	first := NewMessage(MsgHeartbeat).Set(TagMsgSeqNum, "1").Encode()
+	second := NewMessage(MsgTestRequest).Set(TagMsgSeqNum, "2").Set(TagTestReqID, "x").Encode()
+	r := bufio.NewReader(bytes.NewReader(append(append([]byte{}, first...), second[:20]...)))
+
+	raw, err := ReadMessage(r)
+	if err != nil || !bytes.Equal(raw, first) {
+		t.Errorf("ReadMessage = %q, %v; want %q", raw, err, first)
+	}
+	if _, err = ReadMessage(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadMessage of a cut message error = %v, want ErrUnexpectedEOF", err)
+	}
+	r = bufio.NewReader(strings.NewReader("8=FIX.4.4\x019=99999999\x01"))
+	if _, err = ReadMessage(r); !errors.Is(err, ErrGarbled) {
+		t.Errorf("ReadMessage of a huge message error = %v, want ErrGarbled", err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2025, 6, 2, 12, 30, 5, 250e6, time.UTC)
+	for _, s := range []string{"20250602-12:30:05.250", "20250602-12:30:05.250000"} {
+		if got, err := ParseTime(s); err != nil || !got.Equal(want) {
+			t.Errorf("ParseTime(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseTime("2025-06-02T12:30:05Z"); err == nil {
+		t.Error("ParseTime accepted an RFC 3339 time")
+	}
+}
@@ -0,0 +1,578 @@
+package fix
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SessionID names a session from the acceptor's side: SenderCompID is ours,
+// TargetCompID the counterparty's.
+type SessionID struct {
+	SenderCompID string
+	TargetCompID string
+}
+
+func (id SessionID) String() string {
+	return BeginString + ":" + id.SenderCompID + "->" + id.TargetCompID
+}
+
+// StoredMessage is a sent application message kept for resends.
+type StoredMessage struct {
+	Seq int
+	Raw []byte
+}
+
+// Store persists the sequence numbers of sessions and the application
+// messages sent, so that a restarted acceptor continues its sessions and can
+// answer resend requests; *db.Manager implements it.
+type Store interface {
+	// FixSession returns the next sequence numbers of a session; a new
+	// session starts at 1 and 1.
+	FixSession(ctx context.Context, id string) (nextSender, nextTarget int, err error)
+	SetFixSeqNums(ctx context.Context, id string, nextSender, nextTarget int) error
+	// SaveFixMessage stores a message sent with sequence number seq and sets
+	// the next sender sequence number to seq+1.
+	SaveFixMessage(ctx context.Context, id string, seq int, raw []byte) error
+	// FixMessages returns the stored messages with from <= seq <= to in
+	// sequence order.
+	FixMessages(ctx context.Context, id string, from, to int) ([]StoredMessage, error)
+	// ResetFixSession drops the stored messages and starts both sequences
+	// at 1 again.
+	ResetFixSession(ctx context.Context, id string) error
+}
+
+// Application handles the application messages of all sessions.
+type Application interface {
+	// FromApp handles msg, received in sequence. The reply, if not nil, is
+	// sent to the counterparty. An error drops the connection without
+	// accepting msg, so that the counterparty sends it again after it
+	// reconnects.
+	FromApp(ctx context.Context, id SessionID, msg *Message) (reply *Message, err error)
+}
+
+// Acceptor accepts FIX sessions from known counterparties. Each
+// counterparty has one session, which may be connected once at a time.
+type Acceptor struct {
+	SenderCompID string
+	// TargetCompIDs are the counterparties allowed to log on.
+	TargetCompIDs []string
+	Store         Store
+	App           Application
+	// Clock stamps sent messages; nil means the system clock.
+	Clock clock.Clock
+	// LogonTimeout is how long a new connection may take to log on; zero
+	// means 10 seconds.
+	LogonTimeout time.Duration
+
+	// heartbeatUnit is the unit of HeartBtInt, shortened by tests.
+	heartbeatUnit time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+	active   map[string]*session
+	closed   bool
+	// quit is closed by Close, for connections that have not logged on
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (a *Acceptor) now() time.Time {
+	if a.Clock == nil {
+		return time.Now()
+	}
+	return a.Clock.Now()
+}
+
+// Serve accepts connections on l until Close is called.
+func (a *Acceptor) Serve(l net.Listener) error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return net.ErrClosed
+	}
+	a.listener = l
+	if a.quit == nil {
+		a.quit = make(chan struct{})
+	}
+	quit := a.quit
+	a.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			a.mu.Lock()
+			closed := a.closed
+			a.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.handle(conn, quit)
+		}()
+	}
+}
+
+// Close stops accepting connections, logs out every session and waits for
+// their connections to close.
+func (a *Acceptor) Close() error {
+	a.mu.Lock()
+	if a.quit != nil && !a.closed {
+		close(a.quit)
+	}
+	a.closed = true
+	var err error
+	if a.listener != nil {
+		err = a.listener.Close()
+	}
+	for _, s := range a.active {
+		s.stop()
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+	return err
+}
+
+// session is a logged on connection. Only the goroutine running the
+// connection uses it, apart from stop.
+type session struct {
+	a      *Acceptor
+	id     SessionID
+	key    string
+	conn   net.Conn
+	writer *bufio.Writer
+	log    *slog.Logger
+
+	nextSender, nextTarget int
+	heartbeat              time.Duration
+	// resendTo is the highest sequence number seen ahead of nextTarget
+	// while a resend is pending, else 0.
+	resendTo int
+
+	lastSent, lastReceived time.Time
+	testRequest            string
+	testRequestAt          time.Time
+
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+func (s *session) stop() {
+	s.quitOnce.Do(func() { close(s.quit) })
+}
+
+// errLoggedOut ends a session that logged out in an orderly way.
+var errLoggedOut = errors.New("logged out")
+
+func (a *Acceptor) handle(conn net.Conn, quit <-chan struct{}) {
+	defer conn.Close()
+	log := slog.With("remote_addr", conn.RemoteAddr().String())
+
+	done := make(chan struct{})
+	defer close(done)
+	msgs := make(chan *Message)
+	readErr := make(chan error, 1)
+	go func() {
+		br := bufio.NewReader(conn)
+		for {
+			raw, err := ReadMessage(br)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			msg, err := Parse(raw)
+			if err != nil {
+				// a garbled message is ignored; its sequence number will
+				// be found missing
+				log.Warn("ignoring garbled FIX message", "error", err)
+				continue
+			}
+			select {
+			case msgs <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	timeout := a.LogonTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	var logon *Message
+	select {
+	case logon = <-msgs:
+	case err := <-readErr:
+		log.Info("connection closed before logon", "error", err)
+		return
+	case <-time.After(timeout):
+		log.Warn("no logon received", "timeout", timeout)
+		return
+	case <-quit:
+		return
+	}
+
+	s, err := a.logon(conn, logon, log)
+	if err != nil {
+		log.Warn("logon rejected", "error", err)
+		return
+	}
+	defer func() {
+		a.mu.Lock()
+		delete(a.active, s.key)
+		a.mu.Unlock()
+	}()
+	err = s.run(msgs, readErr)
+	switch {
+	case errors.Is(err, errLoggedOut):
+		s.log.Info("FIX session logged out")
+	default:
+		s.log.Warn("FIX session disconnected", "error", err)
+	}
+}
+
+// logon checks the first message of a connection and answers it. Logons
+// that do not identify a known session are dropped without an answer.
+func (a *Acceptor) logon(conn net.Conn, msg *Message, log *slog.Logger) (*session, error) {
+	if msg.Type() != MsgLogon {
+		return nil, fmt.Errorf("first message is %q, not a logon", msg.Type())
+	}
+	id := SessionID{SenderCompID: msg.Get(TagTargetCompID), TargetCompID: msg.Get(TagSenderCompID)}
+	if id.SenderCompID != a.SenderCompID || !slices.Contains(a.TargetCompIDs, id.TargetCompID) {
+		return nil, fmt.Errorf("unknown session %s", id)
+	}
+	heartBtInt, err := msg.Int(TagHeartBtInt)
+	if err != nil || heartBtInt < 0 {
+		return nil, fmt.Errorf("invalid HeartBtInt %q", msg.Get(TagHeartBtInt))
+	}
+	unit := a.heartbeatUnit
+	if unit == 0 {
+		unit = time.Second
+	}
+	s := &session{
+		a:         a,
+		id:        id,
+		key:       id.String(),
+		conn:      conn,
+		writer:    bufio.NewWriter(conn),
+		log:       log.With("fix_session", id.String()),
+		heartbeat: time.Duration(heartBtInt) * unit,
+		quit:      make(chan struct{}),
+	}
+
+	a.mu.Lock()
+	if a.active == nil {
+		a.active = map[string]*session{}
+	}
+	_, taken := a.active[s.key]
+	closed := a.closed
+	if !taken && !closed {
+		a.active[s.key] = s
+	}
+	a.mu.Unlock()
+	if taken {
+		return nil, fmt.Errorf("session %s is already logged on", id)
+	}
+	if closed {
+		return nil, net.ErrClosed
+	}
+	// from here on the caller removes s from active
+	fail := func(err error) (*session, error) {
+		a.mu.Lock()
+		delete(a.active, s.key)
+		a.mu.Unlock()
+		return nil, err
+	}
+
+	ctx := context.Background()
+	reset := msg.Get(TagResetSeqNumFlag) == "Y"
+	if reset {
+		if err = a.Store.ResetFixSession(ctx, s.key); err != nil {
+			return fail(err)
+		}
+	}
+	if s.nextSender, s.nextTarget, err = a.Store.FixSession(ctx, s.key); err != nil {
+		return fail(err)
+	}
+	seq := msg.SeqNum()
+	if seq < s.nextTarget {
+		text := fmt.Sprintf("MsgSeqNum too low, expecting %d but received %d", s.nextTarget, seq)
+		_ = s.send(ctx, NewMessage(MsgLogout).Set(TagText, text))
+		return fail(errors.New(text))
+	}
+
+	reply := NewMessage(MsgLogon).Set(TagEncryptMethod, "0").Set(TagHeartBtInt, strconv.Itoa(heartBtInt))
+	if reset {
+		reply.Set(TagResetSeqNumFlag, "Y")
+	}
+	if err = s.send(ctx, reply); err != nil {
+		return fail(err)
+	}
+	s.lastReceived = time.Now()
+	if err = s.accept(ctx, seq); err != nil {
+		return fail(err)
+	}
+	s.log.Info("FIX session logged on", "heartbeat", s.heartbeat, "next_sender", s.nextSender, "next_target", s.nextTarget)
+	return s, nil
+}
+
+// accept moves past the received sequence number seq: in sequence it is
+// consumed, ahead of it the missing messages are requested.
+func (s *session) accept(ctx context.Context, seq int) error {
+	if seq > s.nextTarget {
+		if s.resendTo == 0 {
+			s.log.Info("FIX sequence gap, requesting resend", "expected", s.nextTarget, "received", seq)
+			err := s.send(ctx, NewMessage(MsgResendRequest).
+				Set(TagBeginSeqNo, strconv.Itoa(s.nextTarget)).Set(TagEndSeqNo, "0"))
+			if err != nil {
+				return err
+			}
+		}
+		s.resendTo = max(s.resendTo, seq)
+		return nil
+	}
+	return s.setNextTarget(ctx, seq+1)
+}
+
+func (s *session) setNextTarget(ctx context.Context, next int) error {
+	if err := s.a.Store.SetFixSeqNums(ctx, s.key, s.nextSender, next); err != nil {
+		return err
+	}
+	s.nextTarget = next
+	if s.resendTo != 0 && s.nextTarget > s.resendTo {
+		s.resendTo = 0
+	}
+	return nil
+}
+
+func (s *session) run(msgs <-chan *Message, readErr <-chan error) error {
+	ctx := context.Background()
+	var tick <-chan time.Time
+	if s.heartbeat > 0 {
+		ticker := time.NewTicker(max(s.heartbeat/4, time.Millisecond))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case msg := <-msgs:
+			s.lastReceived = time.Now()
+			s.testRequest = ""
+			if err := s.receive(ctx, msg); err != nil {
+				return err
+			}
+		case err := <-readErr:
+			return err
+		case <-tick:
+			if err := s.checkHeartbeat(ctx); err != nil {
+				return err
+			}
+		case <-s.quit:
+			_ = s.send(ctx, NewMessage(MsgLogout).Set(TagText, "acceptor shutting down"))
+			return errLoggedOut
+		}
+	}
+}
+
+// checkHeartbeat sends a heartbeat when nothing was sent for an interval,
+// and a test request when nothing was received for a little longer. A peer
+// that does not answer the test request within another interval is
+// disconnected.
+func (s *session) checkHeartbeat(ctx context.Context) error {
+	now := time.Now()
+	if s.testRequest != "" {
+		if now.Sub(s.testRequestAt) >= s.heartbeat {
+			return fmt.Errorf("no answer to test request %s", s.testRequest)
+		}
+	} else if now.Sub(s.lastReceived) >= s.heartbeat+s.heartbeat/5 {
+		s.testRequest, s.testRequestAt = strconv.FormatInt(now.UnixMilli(), 10), now
+		if err := s.send(ctx, NewMessage(MsgTestRequest).Set(TagTestReqID, s.testRequest)); err != nil {
+			return err
+		}
+	}
+	if now.Sub(s.lastSent) >= s.heartbeat {
+		return s.send(ctx, NewMessage(MsgHeartbeat))
+	}
+	return nil
+}
+
+func (s *session) receive(ctx context.Context, msg *Message) error {
+	if msg.Get(TagSenderCompID) != s.id.TargetCompID || msg.Get(TagTargetCompID) != s.id.SenderCompID {
+		_ = s.send(ctx, NewMessage(MsgLogout).Set(TagText, "CompID problem"))
+		return fmt.Errorf("message for session %s->%s", msg.Get(TagSenderCompID), msg.Get(TagTargetCompID))
+	}
+	// a sequence reset in reset mode ignores the sequence number
+	if msg.Type() == MsgSequenceReset && msg.Get(TagGapFillFlag) != "Y" {
+		return s.sequenceReset(ctx, msg)
+	}
+
+	seq, err := msg.Int(TagMsgSeqNum)
+	if err != nil {
+		return err
+	}
+	switch {
+	case seq > s.nextTarget:
+		// dropped; it comes again with the resend
+		return s.accept(ctx, seq)
+	case seq < s.nextTarget:
+		if msg.PossDup() {
+			return nil
+		}
+		text := fmt.Sprintf("MsgSeqNum too low, expecting %d but received %d", s.nextTarget, seq)
+		_ = s.send(ctx, NewMessage(MsgLogout).Set(TagText, text))
+		return errors.New(text)
+	}
+
+	switch msg.Type() {
+	case MsgHeartbeat, MsgReject:
+		if msg.Type() == MsgReject {
+			s.log.Warn("FIX message rejected by counterparty", "ref_seq_num", msg.Get(TagRefSeqNum), "text", msg.Get(TagText))
+		}
+	case MsgTestRequest:
+		if err = s.send(ctx, NewMessage(MsgHeartbeat).Set(TagTestReqID, msg.Get(TagTestReqID))); err != nil {
+			return err
+		}
+	case MsgResendRequest:
+		if err = s.resend(ctx, msg); err != nil {
+			return err
+		}
+	case MsgSequenceReset:
+		return s.sequenceReset(ctx, msg)
+	case MsgLogout:
+		if err = s.setNextTarget(ctx, seq+1); err != nil {
+			return err
+		}
+		_ = s.send(ctx, NewMessage(MsgLogout))
+		return errLoggedOut
+	case MsgLogon:
+		if err = s.reject(ctx, msg, "logon received in session"); err != nil {
+			return err
+		}
+	default:
+		reply, err := s.a.App.FromApp(ctx, s.id, msg)
+		if err != nil {
+			return fmt.Errorf("handle %s %d: %w", msg.Type(), seq, err)
+		}
+		if reply != nil {
+			if err = s.send(ctx, reply); err != nil {
+				return err
+			}
+		}
+	}
+	return s.setNextTarget(ctx, seq+1)
+}
+
+// sequenceReset moves the expected sequence number forward; it never moves
+// back.
+func (s *session) sequenceReset(ctx context.Context, msg *Message) error {
+	next, err := msg.Int(TagNewSeqNo)
+	if err != nil || next < s.nextTarget {
+		return s.reject(ctx, msg, fmt.Sprintf("NewSeqNo %q is below the expected %d", msg.Get(TagNewSeqNo), s.nextTarget))
+	}
+	return s.setNextTarget(ctx, next)
+}
+
+// reject answers msg with a session level reject.
+func (s *session) reject(ctx context.Context, msg *Message, text string) error {
+	s.log.Warn("rejecting FIX message", "seq", msg.Get(TagMsgSeqNum), "msg_type", msg.Type(), "reason", text)
+	return s.send(ctx, NewMessage(MsgReject).
+		Set(TagRefSeqNum, msg.Get(TagMsgSeqNum)).Set(TagRefMsgType, msg.Type()).Set(TagText, text))
+}
+
+// resend answers a resend request: stored application messages are sent
+// again as possible duplicates, session messages are replaced by gap fills.
+func (s *session) resend(ctx context.Context, req *Message) error {
+	begin, err := req.Int(TagBeginSeqNo)
+	if err != nil {
+		return s.reject(ctx, req, err.Error())
+	}
+	end, err := req.Int(TagEndSeqNo)
+	if err != nil {
+		return s.reject(ctx, req, err.Error())
+	}
+	last := s.nextSender - 1
+	if end == 0 || end > last {
+		end = last
+	}
+	if begin < 1 || begin > end {
+		return nil
+	}
+	stored, err := s.a.Store.FixMessages(ctx, s.key, begin, end)
+	if err != nil {
+		return err
+	}
+	s.log.Info("FIX resend requested", "begin", begin, "end", end, "stored", len(stored))
+
+	now := s.a.now().UTC().Format(TimeFormat)
+	gapFrom := begin
+	gapFill := func(next int) error {
+		if gapFrom >= next {
+			return nil
+		}
+		fill := NewMessage(MsgSequenceReset).
+			Set(TagSenderCompID, s.id.SenderCompID).Set(TagTargetCompID, s.id.TargetCompID).
+			Set(TagMsgSeqNum, strconv.Itoa(gapFrom)).Set(TagPossDupFlag, "Y").Set(TagSendingTime, now).
+			Set(TagGapFillFlag, "Y").Set(TagNewSeqNo, strconv.Itoa(next))
+		return s.write(fill.Encode())
+	}
+	for _, m := range stored {
+		if err = gapFill(m.Seq); err != nil {
+			return err
+		}
+		msg, err := Parse(m.Raw)
+		if err != nil {
+			return fmt.Errorf("stored message %d: %w", m.Seq, err)
+		}
+		msg.Set(TagPossDupFlag, "Y").Set(TagOrigSendingTime, msg.Get(TagSendingTime)).Set(TagSendingTime, now)
+		if err = s.write(msg.Encode()); err != nil {
+			return err
+		}
+		gapFrom = m.Seq + 1
+	}
+	return gapFill(end + 1)
+}
+
+// send stamps msg with the header of the session and the next sequence
+// number, stores it, and writes it. The sequence number is stored before
+// the message is written, so it is never used twice.
+func (s *session) send(ctx context.Context, msg *Message) error {
+	seq := s.nextSender
+	msg.Set(TagSenderCompID, s.id.SenderCompID).Set(TagTargetCompID, s.id.TargetCompID).
+		Set(TagMsgSeqNum, strconv.Itoa(seq)).Set(TagSendingTime, s.a.now().UTC().Format(TimeFormat))
+	raw := msg.Encode()
+	var err error
+	if IsAdmin(msg.Type()) {
+		err = s.a.Store.SetFixSeqNums(ctx, s.key, seq+1, s.nextTarget)
+	} else {
+		err = s.a.Store.SaveFixMessage(ctx, s.key, seq, raw)
+	}
+	if err != nil {
+		return err
+	}
+	s.nextSender = seq + 1
+	return s.write(raw)
+}
+
+// writeTimeout bounds how long a peer that does not read can block the
+// session.
+const writeTimeout = 10 * time.Second
+
+func (s *session) write(raw []byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := s.writer.Write(raw); err != nil {
+		return err
+	}
+	s.lastSent = time.Now()
+	return s.writer.Flush()
+}
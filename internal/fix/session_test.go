@@ -0,0 +1,320 @@
+package fix_test
+
+import (
+	"context"
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/fix"
+	"gitlab.com/digineat/go-broker-test/internal/fix/fixtest"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore keeps sessions in memory.
+type memStore struct {
+	mu       sync.Mutex
+	seqs     map[string][2]int
+	messages map[string]map[int][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{seqs: map[string][2]int{}, messages: map[string]map[int][]byte{}}
+}
+
+func (s *memStore) FixSession(ctx context.Context, id string) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seqs, ok := s.seqs[id]; ok {
+		return seqs[0], seqs[1], nil
+	}
+	return 1, 1, nil
+}
+
+func (s *memStore) SetFixSeqNums(ctx context.Context, id string, nextSender, nextTarget int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seqs[id] = [2]int{nextSender, nextTarget}
+	return nil
+}
+
+func (s *memStore) SaveFixMessage(ctx context.Context, id string, seq int, raw []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.messages[id] == nil {
+		s.messages[id] = map[int][]byte{}
+	}
+	s.messages[id][seq] = raw
+	nextTarget := 1
+	if seqs, ok := s.seqs[id]; ok {
+		nextTarget = seqs[1]
+	}
+	s.seqs[id] = [2]int{seq + 1, nextTarget}
+	return nil
+}
+
+func (s *memStore) FixMessages(ctx context.Context, id string, from, to int) ([]fix.StoredMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var msgs []fix.StoredMessage
+	for seq := from; seq <= to; seq++ {
+		if raw, ok := s.messages[id][seq]; ok {
+			msgs = append(msgs, fix.StoredMessage{Seq: seq, Raw: raw})
+		}
+	}
+	return msgs, nil
+}
+
+func (s *memStore) ResetFixSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.messages, id)
+	s.seqs[id] = [2]int{1, 1}
+	return nil
+}
+
+// echoApp answers every application message with a BusinessMessageReject
+// carrying its Text, and records the texts. A message with Text "fail"
+// fails.
+type echoApp struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (a *echoApp) FromApp(ctx context.Context, id fix.SessionID, msg *fix.Message) (*fix.Message, error) {
+	if msg.Get(fix.TagText) == "fail" {
+		return nil, errors.New("failed")
+	}
+	a.mu.Lock()
+	a.texts = append(a.texts, msg.Get(fix.TagText))
+	a.mu.Unlock()
+	return fix.NewMessage(fix.MsgBusinessMessageReject).Set(fix.TagRefSeqNum, msg.Get(fix.TagMsgSeqNum)).
+		Set(fix.TagText, msg.Get(fix.TagText)), nil
+}
+
+func (a *echoApp) received() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.texts...)
+}
+
+const sessionKey = "FIX.4.4:BROKER->VENUE"
+
+// startAcceptor serves an acceptor for the session BROKER-VENUE on a
+// loopback port and returns its address.
+func startAcceptor(t *testing.T, store fix.Store, app fix.Application) (*fix.Acceptor, string) {
+	t.Helper()
+	a := &fix.Acceptor{SenderCompID: "BROKER", TargetCompIDs: []string{"VENUE"}, Store: store, App: app,
+		LogonTimeout: time.Second}
+	fix.SetHeartbeatUnit(a, 10*time.Millisecond)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- a.Serve(l) }()
+	t.Cleanup(func() {
+		a.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return a, l.Addr().String()
+}
+
+func appMessage(text string) *fix.Message {
+	return fix.NewMessage("U1").Set(fix.TagText, text)
+}
+
+func TestAcceptor_Logon(t *testing.T) {
+	store := newMemStore()
+	_, addr := startAcceptor(t, store, &echoApp{})
+
+	tests := []struct {
+		name   string
+		sender string
+		target string
+		first  *fix.Message
+	}{
+		{name: "unknown counterparty", sender: "OTHER", target: "BROKER",
+			first: fix.NewMessage(fix.MsgLogon).Set(fix.TagHeartBtInt, "30")},
+		{name: "wrong acceptor", sender: "VENUE", target: "ELSE",
+			first: fix.NewMessage(fix.MsgLogon).Set(fix.TagHeartBtInt, "30")},
+		{name: "no HeartBtInt", sender: "VENUE", target: "BROKER",
+			first: fix.NewMessage(fix.MsgLogon)},
+		{name: "not a logon", sender: "VENUE", target: "BROKER",
+			first: fix.NewMessage(fix.MsgHeartbeat)},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		i := fixtest.Dial(t, addr, test.sender, test.target)
+		i.Send(test.first)
+		i.ExpectClosed()
+	}
+
+	t.Log("one connection per session")
+	first := fixtest.Dial(t, addr, "VENUE", "BROKER")
+	logon := first.Logon(30, false)
+	if logon.Get(fix.TagHeartBtInt) != "30" || logon.SeqNum() != 1 {
+		t.Errorf("logon reply = %s", logon)
+	}
+	second := fixtest.Dial(t, addr, "VENUE", "BROKER")
+	second.NextSeq = 2
+	second.Send(fix.NewMessage(fix.MsgLogon).Set(fix.TagHeartBtInt, "30"))
+	second.ExpectClosed()
+	first.Logout()
+
+	t.Log("sequence number too low")
+	i := fixtest.Dial(t, addr, "VENUE", "BROKER")
+	i.Send(fix.NewMessage(fix.MsgLogon).Set(fix.TagHeartBtInt, "30"))
+	if logout := i.Expect(fix.MsgLogout); logout.Get(fix.TagText) != "MsgSeqNum too low, expecting 3 but received 1" {
+		t.Errorf("logout = %s", logout)
+	}
+	i.ExpectClosed()
+
+	t.Log("reset")
+	i = fixtest.Dial(t, addr, "VENUE", "BROKER")
+	if logon = i.Logon(30, true); logon.SeqNum() != 1 || logon.Get(fix.TagResetSeqNumFlag) != "Y" {
+		t.Errorf("logon reply = %s", logon)
+	}
+	i.Logout()
+}
+
+func TestAcceptor_Heartbeats(t *testing.T) {
+	_, addr := startAcceptor(t, newMemStore(), &echoApp{})
+	i := fixtest.Dial(t, addr, "VENUE", "BROKER")
+	// a heartbeat interval of 50ms
+	i.Logon(5, false)
+
+	i.Send(fix.NewMessage(fix.MsgTestRequest).Set(fix.TagTestReqID, "ping"))
+	if hb := i.Expect(fix.MsgHeartbeat); hb.Get(fix.TagTestReqID) != "ping" {
+		t.Errorf("answer to test request = %s", hb)
+	}
+	// the acceptor sends heartbeats while the initiator is quiet, then a
+	// test request, and disconnects when it is not answered
+	for {
+		msg := i.Read()
+		if msg.Type() == fix.MsgTestRequest {
+			break
+		}
+		if msg.Type() != fix.MsgHeartbeat {
+			t.Fatalf("received %s; want heartbeats and a test request", msg)
+		}
+	}
+	i.ExpectClosed()
+}
+
+func TestAcceptor_SequenceGap(t *testing.T) {
+	store := newMemStore()
+	app := &echoApp{}
+	_, addr := startAcceptor(t, store, app)
+	i := fixtest.Dial(t, addr, "VENUE", "BROKER")
+	i.Logon(30, false)
+
+	i.Send(appMessage("a"))
+	i.Expect(fix.MsgBusinessMessageReject)
+	// 3 is lost
+	i.NextSeq++
+	i.Send(appMessage("c"))
+	req := i.Expect(fix.MsgResendRequest)
+	if req.Get(fix.TagBeginSeqNo) != "3" || req.Get(fix.TagEndSeqNo) != "0" {
+		t.Errorf("resend request = %s", req)
+	}
+	i.Send(appMessage("d"))
+
+	i.SendSeq(3, appMessage("b").Set(fix.TagPossDupFlag, "Y"))
+	i.Expect(fix.MsgBusinessMessageReject)
+	i.SendSeq(4, appMessage("c").Set(fix.TagPossDupFlag, "Y"))
+	i.Expect(fix.MsgBusinessMessageReject)
+	// a duplicate of what was received is ignored
+	i.SendSeq(2, appMessage("a").Set(fix.TagPossDupFlag, "Y"))
+	// 5 is skipped with a gap fill
+	i.SendSeq(5, fix.NewMessage(fix.MsgSequenceReset).Set(fix.TagGapFillFlag, "Y").Set(fix.TagNewSeqNo, "6").
+		Set(fix.TagPossDupFlag, "Y"))
+	i.Send(appMessage("e"))
+	i.Expect(fix.MsgBusinessMessageReject)
+
+	if got, want := app.received(), []string{"a", "b", "c", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("application received %v; want %v", got, want)
+	}
+
+	t.Log("an application error disconnects without accepting the message")
+	i.Send(appMessage("fail"))
+	i.ExpectClosed()
+	if _, nextTarget, _ := store.FixSession(t.Context(), sessionKey); nextTarget != 7 {
+		t.Errorf("next target = %d, want 7", nextTarget)
+	}
+}
+
+func TestAcceptor_Resend(t *testing.T) {
+	store := newMemStore()
+	_, addr := startAcceptor(t, store, &echoApp{})
+	i := fixtest.Dial(t, addr, "VENUE", "BROKER")
+	i.Logon(30, false)
+	// acceptor messages: 1 logon, 2 and 3 answers, 4 heartbeat, 5 answer
+	i.Send(appMessage("a"))
+	i.Expect(fix.MsgBusinessMessageReject)
+	i.Send(appMessage("b"))
+	i.Expect(fix.MsgBusinessMessageReject)
+	i.Send(fix.NewMessage(fix.MsgTestRequest).Set(fix.TagTestReqID, "x"))
+	i.Expect(fix.MsgHeartbeat)
+	i.Send(appMessage("c"))
+	i.Expect(fix.MsgBusinessMessageReject)
+	i.Close()
+
+	// the session continues after a reconnect, and a restart of the
+	// acceptor, from the store
+	_, addr = startAcceptor(t, store, &echoApp{})
+	i = fixtest.Dial(t, addr, "VENUE", "BROKER")
+	i.NextSeq = 6
+	if logon := i.Logon(30, false); logon.SeqNum() != 6 {
+		t.Errorf("logon reply = %s; want MsgSeqNum 6", logon)
+	}
+
+	i.Send(fix.NewMessage(fix.MsgResendRequest).Set(fix.TagBeginSeqNo, "1").Set(fix.TagEndSeqNo, "0"))
+	var got []string
+	for range 4 {
+		msg := i.Read()
+		if !msg.PossDup() {
+			t.Errorf("resent %s without PossDupFlag", msg)
+		}
+		switch msg.Type() {
+		case fix.MsgSequenceReset:
+			got = append(got, msg.Get(fix.TagMsgSeqNum)+"-"+msg.Get(fix.TagNewSeqNo))
+		case fix.MsgBusinessMessageReject:
+			if msg.Get(fix.TagOrigSendingTime) == "" {
+				t.Errorf("resent %s without OrigSendingTime", msg)
+			}
+			got = append(got, msg.Get(fix.TagMsgSeqNum)+":"+msg.Get(fix.TagText))
+		}
+	}
+	// the logon in the store is session level, and so is the answer to the
+	// test request
+	if want := []string{"1-2", "2:a", "3:b", "4-5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resent %v; want %v", got, want)
+	}
+	if msg := i.Read(); msg.SeqNum() != 5 || msg.Get(fix.TagText) != "c" {
+		t.Errorf("resent %s; want 5:c", msg)
+	}
+	// and the gap fill for the logon of this connection
+	if msg := i.Expect(fix.MsgSequenceReset); msg.SeqNum() != 6 || msg.Get(fix.TagNewSeqNo) != "7" {
+		t.Errorf("resent %s; want 6-7", msg)
+	}
+	i.Logout()
+}
+
+func TestAcceptor_Close(t *testing.T) {
+	a, addr := startAcceptor(t, newMemStore(), &echoApp{})
+	i := fixtest.Dial(t, addr, "VENUE", "BROKER")
+	i.Logon(30, false)
+	garbled := appMessage("x").Encode()
+	garbled[len(garbled)-2]++
+	i.WriteRaw(garbled)
+
+	go a.Close()
+	if logout := i.Expect(fix.MsgLogout); logout.Get(fix.TagText) != "acceptor shutting down" {
+		t.Errorf("logout = %s", logout)
+	}
+	i.ExpectClosed()
+}
@@ -0,0 +1,54 @@
+// Package health reports the readiness of the server and the worker as
+// JSON, so that probes get the reason along with the status code.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check is the outcome of one dependency check.
+type Check struct {
+	Name   string `json:"name"`
+	Ok     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report is the body of a readiness response. It is unavailable when any
+// of its checks failed.
+type Report struct {
+	Status string  `json:"status"`
+	Checks []Check `json:"checks"`
+}
+
+func NewReport(checks ...Check) Report {
+	r := Report{Status: StatusOK, Checks: checks}
+	for _, c := range checks {
+		if !c.Ok {
+			r.Status = StatusUnavailable
+		}
+	}
+	return r
+}
+
+func (r Report) Ok() bool {
+	return r.Status == StatusOK
+}
+
+// Write sends v, a Report or a struct embedding one, with 200 when ok and
+// 503 otherwise.
+func Write(w http.ResponseWriter, ok bool, v any) {
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,35 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		status int
+		want   string
+	}{
+		{name: "all checks pass", checks: []Check{{Name: "database", Ok: true}}, status: http.StatusOK, want: StatusOK},
+		{name: "one check fails", checks: []Check{{Name: "database", Ok: true}, {Name: "queue", Detail: "too deep"}},
+			status: http.StatusServiceUnavailable, want: StatusUnavailable},
+		{name: "no checks", status: http.StatusOK, want: StatusOK},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		report := NewReport(test.checks...)
+		rec := httptest.NewRecorder()
+		Write(rec, report.Ok(), report)
+		if rec.Code != test.status {
+			t.Errorf("status = %d; want %d", rec.Code, test.status)
+		}
+		var got Report
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Status != test.want || len(got.Checks) != len(test.checks) {
+			t.Errorf("body = %s, %v; want status %s", rec.Body, err, test.want)
+		}
+	}
+}
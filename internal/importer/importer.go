@@ -0,0 +1,432 @@
+// Package importer loads historical trades from CSV files. Every row is
+// checked with the rules trades submitted through the API are checked with,
+// and rows that fail are reported by line number instead of stopping the
+// import. Rows are read and stored in batches, so memory grows with the
+// number of accounts in a file but not with the number of rows, and a row
+// imported before is recognised and skipped, so a file can safely be
+// imported again after an interrupted run.
+package importer
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"gitlab.com/digineat/go-broker-test/internal/validation"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields of a trade that can be read from a file. ExternalId is the id of
+// the trade in the system it is imported from; when mapped it identifies
+// the trade for deduplication.
+const (
+	FieldExternalId = "external_id"
+	FieldAccount    = "account"
+	FieldSymbol     = "symbol"
+	FieldSide       = "side"
+	FieldVolume     = "volume"
+	FieldOpen       = "open"
+	FieldClose      = "close"
+	FieldOpenTime   = "open_time"
+	FieldCloseTime  = "close_time"
+)
+
+// Fields lists every field; the optional ones need no column.
+var Fields = []string{
+	FieldExternalId, FieldAccount, FieldSymbol, FieldSide, FieldVolume, FieldOpen, FieldClose, FieldOpenTime, FieldCloseTime,
+}
+
+var optional = map[string]bool{FieldExternalId: true, FieldOpenTime: true, FieldCloseTime: true}
+
+// Rules of the row errors found while parsing, before validation.
+const (
+	RuleNumber   = "number"
+	RuleDatetime = "datetime"
+	RuleColumns  = "columns"
+	// RuleRequired reports a trade without open_time and close_time in
+	// apply mode, which books trades at the time they were closed.
+	RuleRequired = "required"
+)
+
+// BatchSize is the number of rows stored per transaction.
+const BatchSize = 500
+
+// MaxErrors is the number of row errors kept per job; later ones are only
+// counted.
+const MaxErrors = 1000
+
+var (
+	ErrUnknownField  = errors.New("unknown field")
+	ErrMissingColumn = errors.New("missing column")
+)
+
+// Mapping maps a field to the header of its column. Fields not in the
+// mapping are read from the column named like the field.
+type Mapping map[string]string
+
+// ParseMapping parses a comma separated list of field=header pairs, e.g.
+// "account=Login,symbol=Instrument".
+func ParseMapping(s string) (Mapping, error) {
+	m := Mapping{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		field, header, ok := strings.Cut(pair, "=")
+		field, header = strings.TrimSpace(field), strings.TrimSpace(header)
+		if !ok || header == "" {
+			return nil, fmt.Errorf("mapping %q must be field=header", pair)
+		}
+		if !isField(field) {
+			return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownField, field, strings.Join(Fields, ", "))
+		}
+		if _, dup := m[field]; dup {
+			return nil, fmt.Errorf("field %q is mapped twice", field)
+		}
+		m[field] = header
+	}
+	return m, nil
+}
+
+func isField(name string) bool {
+	for _, f := range Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Header returns the header of the column field is read from.
+func (m Mapping) Header(field string) string {
+	if header, ok := m[field]; ok {
+		return header
+	}
+	return field
+}
+
+// Row is a data row of a file. Trade is set when the row is valid, Errors
+// otherwise.
+type Row struct {
+	Line   int
+	Trade  *model.Trade
+	Errors []model.ImportError
+}
+
+// Reader reads trades from CSV. The first row is the header; columns are
+// matched by header, ignoring case, and columns not mapped are ignored.
+type Reader struct {
+	csv     *csv.Reader
+	columns map[string]int
+	now     time.Time
+}
+
+// NewReader reads the header of r. now is the time open_time and close_time
+// must not be after.
+func NewReader(r io.Reader, mapping Mapping, now time.Time) (*Reader, error) {
+	br := bufio.NewReader(r)
+	// Spreadsheets save CSV with a byte order mark.
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\uFEFF" {
+		br.Discard(3)
+	}
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: the file is empty", ErrMissingColumn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	var missing []string
+	for _, field := range Fields {
+		want := mapping.Header(field)
+		found := false
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), want) {
+				columns[field], found = i, true
+				break
+			}
+		}
+		if !found && !optional[field] {
+			missing = append(missing, want)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingColumn, strings.Join(missing, ", "))
+	}
+	return &Reader{csv: cr, columns: columns, now: now}, nil
+}
+
+// Next returns the next row, or io.EOF after the last one. Other errors
+// mean the file is not valid CSV and reading can not go on.
+func (r *Reader) Next() (*Row, error) {
+	record, err := r.csv.Read()
+	if err != nil {
+		return nil, err
+	}
+	line, _ := r.csv.FieldPos(0)
+	row := &Row{Line: line}
+
+	value := func(field string) string {
+		i, ok := r.columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	for _, field := range Fields {
+		if i, ok := r.columns[field]; ok && i >= len(record) {
+			row.Errors = append(row.Errors, model.ImportError{
+				Line:    line,
+				Field:   field,
+				Rule:    RuleColumns,
+				Message: fmt.Sprintf("the row has %d columns, %s is column %d", len(record), field, i+1),
+			})
+		}
+	}
+	if len(row.Errors) > 0 {
+		return row, nil
+	}
+
+	trade := &model.Trade{
+		Account: value(FieldAccount),
+		Symbol:  value(FieldSymbol),
+		Side:    value(FieldSide),
+	}
+	parsed := map[string]bool{}
+	number := func(field string, dst *float64) {
+		s := value(field)
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			row.Errors = append(row.Errors, model.ImportError{
+				Line: line, Field: field, Rule: RuleNumber, Message: field + " must be a number", Value: s,
+			})
+			return
+		}
+		*dst, parsed[field] = v, true
+	}
+	number(FieldVolume, &trade.Volume)
+	number(FieldOpen, &trade.Open)
+	number(FieldClose, &trade.Close)
+	datetime := func(field string, dst **time.Time) {
+		s := value(field)
+		if s == "" {
+			return
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			row.Errors = append(row.Errors, model.ImportError{
+				Line: line, Field: field, Rule: RuleDatetime, Message: field + " must be an RFC 3339 time", Value: s,
+			})
+			return
+		}
+		*dst = &t
+	}
+	datetime(FieldOpenTime, &trade.OpenTime)
+	datetime(FieldCloseTime, &trade.CloseTime)
+
+	// A number that could not be parsed is zero and would also fail its
+	// validation; it is reported once.
+	var errs []problem.FieldError
+	if err := validation.Struct(trade); err != nil {
+		for _, fe := range problem.FromValidation(err).Errors {
+			if isNumber(fe.Field) && !parsed[fe.Field] {
+				continue
+			}
+			errs = append(errs, fe)
+		}
+	}
+	errs = append(errs, validation.Times(trade, r.now, 0)...)
+	for _, fe := range errs {
+		row.Errors = append(row.Errors, model.ImportError{
+			Line: line, Field: fe.Field, Rule: fe.Rule, Message: fe.Message, Value: fmt.Sprint(fe.Value),
+		})
+	}
+	if len(row.Errors) > 0 {
+		return row, nil
+	}
+
+	trade.ImportKey = importKey(value(FieldExternalId), trade)
+	row.Trade = trade
+	return row, nil
+}
+
+func isNumber(field string) bool {
+	return field == FieldVolume || field == FieldOpen || field == FieldClose
+}
+
+// importKey identifies the trade by its external id, or else by the
+// fingerprint of its fields.
+func importKey(externalId string, t *model.Trade) string {
+	if externalId != "" {
+		return "id:" + externalId
+	}
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		t.Account, t.Symbol, t.Side,
+		strconv.FormatFloat(t.Volume, 'g', -1, 64),
+		strconv.FormatFloat(t.Open, 'g', -1, 64),
+		strconv.FormatFloat(t.Close, 'g', -1, 64),
+		formatTime(t.OpenTime), formatTime(t.CloseTime),
+	}, "\x1f")))
+	return "fp:" + hex.EncodeToString(sum[:])
+}
+
+// Store keeps imported trades, their accounts and the progress of jobs;
+// *db.Manager implements it.
+type Store interface {
+	validation.AccountStore
+	// EnsureTradingAccount creates the account a, unless it exists.
+	EnsureTradingAccount(ctx context.Context, a *model.TradingAccount) (*model.TradingAccount, error)
+	// ImportTrades stores the trades of job whose import key is new and
+	// returns how many it stored.
+	ImportTrades(ctx context.Context, job *model.ImportJob, trades []*model.Trade) (int, error)
+	// ExistingImportKeys returns which of keys belong to stored trades.
+	ExistingImportKeys(ctx context.Context, keys []string) (map[string]bool, error)
+	// SaveImportJob stores the counters and status of job and adds errs to
+	// its row errors.
+	SaveImportJob(ctx context.Context, job *model.ImportJob, errs []model.ImportError) error
+}
+
+// Run imports the rows of r into store, saving the progress of job after
+// every batch. The account of every row is checked like that of a submitted
+// trade: it must be active, and exist unless autoCreate creates unknown
+// accounts with their first row. A dry run only counts what would be
+// imported. When Run returns, job is completed, or failed with the error
+// also returned; batches stored before a failure stay stored.
+func Run(ctx context.Context, store Store, job *model.ImportJob, r *Reader, autoCreate bool, now func() time.Time) error {
+	err := run(ctx, store, job, r, autoCreate, now)
+	finished := now()
+	job.FinishedAt = &finished
+	job.Status = model.ImportStatusCompleted
+	if err != nil {
+		job.Status, job.Error = model.ImportStatusFailed, err.Error()
+	}
+	if saveErr := store.SaveImportJob(context.WithoutCancel(ctx), job, nil); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+func run(ctx context.Context, store Store, job *model.ImportJob, r *Reader, autoCreate bool, now func() time.Time) error {
+	// accounts holds the rejection of every account checked, nil for those
+	// accepted.
+	accounts := map[string]*problem.FieldError{}
+	checkAccount := func(account string) (*problem.FieldError, error) {
+		if fe, ok := accounts[account]; ok {
+			return fe, nil
+		}
+		missing, fe, err := validation.Account(ctx, store, account, autoCreate)
+		if err != nil {
+			return nil, err
+		}
+		if missing && !job.DryRun {
+			if _, err = store.EnsureTradingAccount(ctx, model.NewTradingAccount(account, now())); err != nil {
+				return nil, err
+			}
+		}
+		accounts[account] = fe
+		return fe, nil
+	}
+
+	kept := 0
+	for done := false; !done; {
+		var batch []*model.Trade
+		var errs []model.ImportError
+		for len(batch) < BatchSize {
+			row, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				done = true
+				break
+			}
+			if err != nil {
+				return err
+			}
+			job.Rows++
+			if row.Trade != nil && job.Mode == model.ImportModeApply && row.Trade.CloseTime == nil && row.Trade.OpenTime == nil {
+				row.Errors = append(row.Errors, model.ImportError{
+					Line: row.Line, Field: FieldCloseTime, Rule: RuleRequired,
+					Message: "close_time or open_time is required to apply a trade",
+				})
+			} else if row.Trade != nil {
+				fe, err := checkAccount(row.Trade.Account)
+				if err != nil {
+					return err
+				}
+				if fe != nil {
+					row.Errors = append(row.Errors, model.ImportError{
+						Line: row.Line, Field: fe.Field, Rule: fe.Rule, Message: fe.Message, Value: row.Trade.Account,
+					})
+				}
+			}
+			if len(row.Errors) > 0 {
+				job.Failed++
+				if n := min(len(row.Errors), MaxErrors-kept); n > 0 {
+					errs = append(errs, row.Errors[:n]...)
+					kept += n
+				}
+				continue
+			}
+			batch = append(batch, row.Trade)
+		}
+
+		if len(batch) > 0 {
+			imported, err := importBatch(ctx, store, job, batch)
+			if err != nil {
+				return err
+			}
+			job.Imported += imported
+			job.Duplicates += len(batch) - imported
+		}
+		if err := store.SaveImportJob(ctx, job, errs); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importBatch stores batch, or in a dry run counts the trades neither
+// stored nor repeated earlier in the batch. A dry run keeps no keys across
+// batches, so it does not recognise a row repeating one of an earlier batch,
+// which the import itself counts as a duplicate.
+func importBatch(ctx context.Context, store Store, job *model.ImportJob, batch []*model.Trade) (int, error) {
+	if !job.DryRun {
+		return store.ImportTrades(ctx, job, batch)
+	}
+	keys := make([]string, len(batch))
+	for i, t := range batch {
+		keys[i] = t.ImportKey
+	}
+	existing, err := store.ExistingImportKeys(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	imported := 0
+	for _, key := range keys {
+		if !existing[key] {
+			imported++
+		}
+		existing[key] = true
+	}
+	return imported, nil
+}
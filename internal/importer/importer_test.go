@@ -0,0 +1,279 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+
+func TestParseMapping(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Mapping
+		err  bool
+	}{
+		{name: "empty", in: "", want: Mapping{}},
+		{name: "pairs", in: "account=Login, symbol = Instrument", want: Mapping{"account": "Login", "symbol": "Instrument"}},
+		{name: "unknown field", in: "login=Login", err: true},
+		{name: "no header", in: "account=", err: true},
+		{name: "mapped twice", in: "account=Login,account=Id", err: true},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		got, err := ParseMapping(test.in)
+		if (err != nil) != test.err {
+			t.Errorf("ParseMapping(%q) error = %v", test.in, err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseMapping(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func readAll(t *testing.T, r *Reader) []*Row {
+	t.Helper()
+	var rows []*Row
+	for {
+		row, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestReader(t *testing.T) {
+	file := "\uFEFFTicket,Login,Instrument,side,volume,open,close,open_time\n" +
+		"T1,123,EURUSD,buy,1,1.1,1.105,2025-06-01T10:00:00Z\n" +
+		"\n" +
+		"T2,\"12\n3\",eurusd,hold,-1,x,1.1,\n" +
+		"T3,456,GBPUSD,sell,0.5,1.3,1.29,2025-07-01T00:00:00Z\n" +
+		"T4,456\n"
+	r, err := NewReader(strings.NewReader(file), Mapping{"external_id": "Ticket", "account": "Login", "symbol": "Instrument"}, now)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	rows := readAll(t, r)
+	if len(rows) != 4 {
+		t.Fatalf("read %d rows, want 4", len(rows))
+	}
+
+	openTime := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	want := &model.Trade{Account: "123", Symbol: "EURUSD", Side: "buy", Volume: 1, Open: 1.1, Close: 1.105, OpenTime: &openTime, ImportKey: "id:T1"}
+	if rows[0].Line != 2 || !reflect.DeepEqual(rows[0].Trade, want) {
+		t.Errorf("row 1 = line %d %+v, want line 2 %+v", rows[0].Line, rows[0].Trade, want)
+	}
+
+	rules := func(row *Row) []string {
+		var got []string
+		for _, e := range row.Errors {
+			if e.Line != row.Line {
+				t.Errorf("error %+v is not on line %d", e, row.Line)
+			}
+			got = append(got, e.Field+":"+e.Rule)
+		}
+		return got
+	}
+	tests := []struct {
+		name  string
+		row   *Row
+		line  int
+		rules []string
+	}{
+		{name: "every invalid field", row: rows[1], line: 4,
+			rules: []string{"open:number", "account:alphanum", "symbol:symbol", "volume:gt", "side:oneof"}},
+		{name: "open time in the future", row: rows[2], line: 6, rules: []string{"open_time:not_future"}},
+		{name: "short row", row: rows[3], line: 7,
+			rules: []string{"symbol:columns", "side:columns", "volume:columns", "open:columns", "close:columns", "open_time:columns"}},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if test.row.Trade != nil || test.row.Line != test.line {
+			t.Errorf("row = line %d trade %+v, want line %d and no trade", test.row.Line, test.row.Trade, test.line)
+		}
+		if got := rules(test.row); !reflect.DeepEqual(got, test.rules) {
+			t.Errorf("errors = %v, want %v", got, test.rules)
+		}
+	}
+}
+
+func TestReader_MissingColumns(t *testing.T) {
+	_, err := NewReader(strings.NewReader("account,symbol,side,volume\n"), nil, now)
+	if !errors.Is(err, ErrMissingColumn) || !strings.Contains(err.Error(), "open, close") {
+		t.Errorf("NewReader error = %v, want missing open, close", err)
+	}
+	if _, err = NewReader(strings.NewReader(""), nil, now); !errors.Is(err, ErrMissingColumn) {
+		t.Errorf("NewReader of empty file error = %v", err)
+	}
+}
+
+func TestImportKey(t *testing.T) {
+	trade := model.Trade{Account: "123", Symbol: "EURUSD", Side: "buy", Volume: 1, Open: 1.1, Close: 1.105}
+	same := trade
+	other := trade
+	other.Volume = 2
+	if importKey("", &trade) != importKey("", &same) {
+		t.Error("equal trades have different keys")
+	}
+	if importKey("", &trade) == importKey("", &other) {
+		t.Error("different trades have the same key")
+	}
+	if got := importKey("T1", &trade); got != "id:T1" {
+		t.Errorf("key with external id = %q", got)
+	}
+}
+
+// memStore keeps imported trades by import key.
+type memStore struct {
+	keys     map[string]bool
+	accounts map[string]*model.TradingAccount
+	saves    int
+	errs     []model.ImportError
+}
+
+func (s *memStore) GetTradingAccount(ctx context.Context, id string) (*model.TradingAccount, error) {
+	return s.accounts[id], nil
+}
+
+func (s *memStore) EnsureTradingAccount(ctx context.Context, a *model.TradingAccount) (*model.TradingAccount, error) {
+	if s.accounts[a.Id] == nil {
+		s.accounts[a.Id] = a
+	}
+	return s.accounts[a.Id], nil
+}
+
+func (s *memStore) ImportTrades(ctx context.Context, job *model.ImportJob, trades []*model.Trade) (int, error) {
+	n := 0
+	for _, trade := range trades {
+		if !s.keys[trade.ImportKey] {
+			s.keys[trade.ImportKey] = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memStore) ExistingImportKeys(ctx context.Context, keys []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	for _, key := range keys {
+		existing[key] = s.keys[key]
+	}
+	return existing, nil
+}
+
+func (s *memStore) SaveImportJob(ctx context.Context, job *model.ImportJob, errs []model.ImportError) error {
+	s.saves++
+	s.errs = append(s.errs, errs...)
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	var file strings.Builder
+	file.WriteString("id,account,symbol,side,volume,open,close\n")
+	for i := range BatchSize + 10 {
+		// every tenth row repeats the one before
+		id := i
+		if i%10 == 9 {
+			id--
+		}
+		file.WriteString("T" + strconv.Itoa(id) + ",123,EURUSD,buy,1,1.1,1.2\n")
+	}
+	file.WriteString("bad,123,EURUSD,buy,0,1.1,1.2\n")
+
+	store := &memStore{keys: map[string]bool{}, accounts: map[string]*model.TradingAccount{}}
+	for _, test := range []struct {
+		name      string
+		dryRun    bool
+		imported  int
+		duplicate int
+	}{
+		{name: "dry run", dryRun: true, imported: 459, duplicate: 51},
+		{name: "import", imported: 459, duplicate: 51},
+		{name: "import again", imported: 0, duplicate: 510},
+	} {
+		t.Log(test.name)
+		r, err := NewReader(strings.NewReader(file.String()), Mapping{"external_id": "id"}, now)
+		if err != nil {
+			t.Fatalf("NewReader: %v", err)
+		}
+		job := &model.ImportJob{DryRun: test.dryRun, Mode: model.ImportModeEnqueue}
+		store.saves, store.errs = 0, nil
+		if err = Run(t.Context(), store, job, r, true, func() time.Time { return now }); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if job.Status != model.ImportStatusCompleted || job.FinishedAt == nil || job.Rows != BatchSize+11 ||
+			job.Imported != test.imported || job.Duplicates != test.duplicate || job.Failed != 1 {
+			t.Errorf("job = %+v", job)
+		}
+		// two batches and the final status
+		if store.saves != 3 || len(store.errs) != 1 || store.errs[0].Line != BatchSize+12 {
+			t.Errorf("saved %d times with errors %+v", store.saves, store.errs)
+		}
+	}
+}
+
+func TestRun_Accounts(t *testing.T) {
+	const file = "account,symbol,side,volume,open,close,close_time\n" +
+		"123,EURUSD,buy,1,1.1,1.2,2025-06-01T10:00:00Z\n" +
+		"456,EURUSD,buy,1,1.1,1.2,2025-06-01T10:00:00Z\n" +
+		"789,EURUSD,buy,1,1.1,1.2,2025-06-01T10:00:00Z\n" +
+		"123,EURUSD,buy,2,1.1,1.2,\n"
+	tests := []struct {
+		name       string
+		mode       string
+		dryRun     bool
+		autoCreate bool
+		imported   int
+		// rules are the rules of the row errors, by line.
+		rules map[int]string
+		// created tells whether account 789 exists after the run.
+		created bool
+	}{
+		{name: "unknown accounts rejected", mode: model.ImportModeEnqueue, imported: 2,
+			rules: map[int]string{3: "account_active", 4: "account_exists"}},
+		{name: "unknown accounts checked in a dry run", mode: model.ImportModeEnqueue, dryRun: true, autoCreate: true, imported: 3,
+			rules: map[int]string{3: "account_active"}},
+		{name: "unknown accounts created", mode: model.ImportModeEnqueue, autoCreate: true, imported: 3,
+			rules: map[int]string{3: "account_active"}, created: true},
+		{name: "apply needs a time", mode: model.ImportModeApply, autoCreate: true, imported: 2,
+			rules: map[int]string{3: "account_active", 5: RuleRequired}, created: true},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		store := &memStore{keys: map[string]bool{}, accounts: map[string]*model.TradingAccount{
+			"123": {Id: "123", Status: model.AccountStatusActive},
+			"456": {Id: "456", Status: model.AccountStatusClosed},
+		}}
+		r, err := NewReader(strings.NewReader(file), Mapping{}, now)
+		if err != nil {
+			t.Fatalf("NewReader: %v", err)
+		}
+		job := &model.ImportJob{Mode: test.mode, DryRun: test.dryRun}
+		if err = Run(t.Context(), store, job, r, test.autoCreate, func() time.Time { return now }); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		rules := map[int]string{}
+		for _, e := range store.errs {
+			rules[e.Line] = e.Rule
+		}
+		if job.Imported != test.imported || job.Failed != len(test.rules) || !reflect.DeepEqual(rules, test.rules) {
+			t.Errorf("imported %d, failed %d, errors %v; want %d, %v", job.Imported, job.Failed, rules, test.imported, test.rules)
+		}
+		if created := store.accounts["789"] != nil; created != test.created {
+			t.Errorf("account 789 created = %v; want %v", created, test.created)
+		}
+	}
+}
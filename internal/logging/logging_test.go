@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew_InvalidOptions(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "loud", FormatJSON); err == nil {
+		t.Error("expected error for unknown level")
+	}
+	if _, err := New(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestNew_RequestIDFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "debug", FormatJSON)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	logger.With("trade_id", 7).InfoContext(ctx, "trade processed")
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("unmarshal %q: %v", buf.String(), err)
+	}
+	if rec[RequestIDKey] != "req-1" {
+		t.Errorf("request_id = %v; want req-1", rec[RequestIDKey])
+	}
+	if rec["trade_id"] != float64(7) {
+		t.Errorf("trade_id = %v; want 7", rec["trade_id"])
+	}
+}
+
+func TestNew_LevelFilter(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", FormatText)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	logger.Info("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("info record written at warn level: %q", buf.String())
+	}
+}
+
+func TestNewLeveled_LevelVar(t *testing.T) {
+	var buf bytes.Buffer
+	var level slog.LevelVar
+	level.Set(slog.LevelWarn)
+	logger, err := NewLeveled(&buf, &level, FormatText)
+	if err != nil {
+		t.Fatalf("NewLeveled: %v", err)
+	}
+	logger.Info("hidden")
+	level.Set(slog.LevelInfo)
+	logger.Info("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("output = %q; want only the record after the level changed", buf.String())
+	}
+}
+
+func TestNewRequestID_Unique(t *testing.T) {
+	a, b := NewRequestID(), NewRequestID()
+	if len(a) != 32 || a == b {
+		t.Errorf("unexpected ids %q, %q", a, b)
+	}
+}
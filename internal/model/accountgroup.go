@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// AccountGroup is a node of the group tree, e.g. a sub-IB below an IB.
+type AccountGroup struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// Parent is empty for a root group.
+	Parent    string    `json:"parent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GroupStats aggregates the processed trades of a group and all groups
+// below it. From and To bound the processing time; nil means unbounded.
+type GroupStats struct {
+	Group    string     `json:"group"`
+	From     *time.Time `json:"from,omitempty"`
+	To       *time.Time `json:"to,omitempty"`
+	Accounts int        `json:"accounts"`
+	Trades   int        `json:"trades"`
+	Volume   float64    `json:"volume"`
+	Profit   float64    `json:"profit"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+const (
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+
+	// ImportModeEnqueue queues imported trades for the worker;
+	// ImportModeApply books them as processed right away.
+	ImportModeEnqueue = "enqueue"
+	ImportModeApply   = "apply"
+)
+
+// ImportJob is the progress of one import. The counters grow while the job
+// runs, so they can be polled.
+type ImportJob struct {
+	Id     int    `json:"id"`
+	Status string `json:"status"`
+	Mode   string `json:"mode"`
+	DryRun bool   `json:"dry_run"`
+	// Source names the imported file.
+	Source string `json:"source"`
+	Actor  string `json:"actor"`
+	// Rows counts the data rows read; each is imported, a duplicate of a
+	// trade imported before, or failed.
+	Rows       int        `json:"rows"`
+	Imported   int        `json:"imported"`
+	Duplicates int        `json:"duplicates"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ImportError is a problem with one field of a row; Line is the line of the
+// file the row starts on.
+type ImportError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Value   string `json:"value"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// QueueDepth counts the trades of the queue by status.
+type QueueDepth struct {
+	Pending   int `json:"pending"`
+	Processed int `json:"processed"`
+	Cancelled int `json:"cancelled"`
+	// OldestPending is when the oldest pending trade was received; it is nil
+	// when no trade is pending.
+	OldestPending *time.Time `json:"oldest_pending,omitempty"`
+}
+
+// StatsDrift is an account whose stored stats differ from those of its
+// processed trades.
+type StatsDrift struct {
+	Account    string  `json:"account"`
+	Trades     int     `json:"trades"`
+	Profit     float64 `json:"profit"`
+	WantTrades int     `json:"want_trades"`
+	WantProfit float64 `json:"want_profit"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// AnySymbol is the symbol of a rebate rate that applies to every symbol
+// without a rate of its own.
+const AnySymbol = "*"
+
+// RebateRate pays a group PerLot for every lot traded in Symbol by the
+// accounts of the group and of all groups below it.
+type RebateRate struct {
+	Symbol string  `json:"symbol"`
+	PerLot float64 `json:"per_lot"`
+}
+
+// RebateAccrual is what one group earns on one version of a processed trade.
+// It is reversed when that version is amended or cancelled.
+type RebateAccrual struct {
+	TradeId    int        `json:"trade_id"`
+	Version    int        `json:"version"`
+	Group      string     `json:"group"`
+	Account    string     `json:"account"`
+	Symbol     string     `json:"symbol"`
+	Lots       float64    `json:"lots"`
+	Rate       float64    `json:"rate"`
+	Amount     float64    `json:"amount"`
+	AccruedAt  time.Time  `json:"accrued_at"`
+	ReversedAt *time.Time `json:"reversed_at,omitempty"`
+}
+
+// RebatePayout sums the rebates of a group over a period: what was accrued in
+// it less what was reversed in it.
+type RebatePayout struct {
+	Group    string  `json:"group"`
+	Trades   int     `json:"trades"`
+	Lots     float64 `json:"lots"`
+	Accrued  float64 `json:"accrued"`
+	Reversed float64 `json:"reversed"`
+	Payable  float64 `json:"payable"`
+}
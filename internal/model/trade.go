@@ -1,14 +1,84 @@
 package model
 
+import "time"
+
 type Trade struct {
 	Id        int
 	Account   string  `json:"account" validate:"required,alphanum"`
-	Symbol    string  `json:"symbol"  validate:"required,alpha,len=6"`
+	Symbol    string  `json:"symbol"  validate:"required,symbol"`
 	Volume    float64 `json:"volume"  validate:"gt=0"`
 	Open      float64 `json:"open"    validate:"gt=0"`
 	Close     float64 `json:"close"   validate:"gt=0"`
 	Side      string  `json:"side"    validate:"oneof=buy sell"`
 	Processed int
+
+	// OpenTime and CloseTime are supplied by the client and optional.
+	OpenTime  *time.Time `json:"open_time,omitempty"`
+	CloseTime *time.Time `json:"close_time,omitempty"`
+	// ReceivedAt is set by the server when the trade is enqueued, ProcessedAt
+	// by the worker when it claims the trade.
+	ReceivedAt  time.Time  `json:"-"`
+	ProcessedAt *time.Time `json:"-"`
+	// Version starts at 1 and increases with every amendment or
+	// cancellation. CancelledAt is set when the trade is cancelled.
+	Version     int        `json:"-"`
+	CancelledAt *time.Time `json:"-"`
+	// Group is the group of the account when the trade was processed; it
+	// stays when the account moves to another group.
+	Group string `json:"-"`
+	// Rollovers is the number of swap rollovers of the trading calendar
+	// between OpenTime and CloseTime, counted when the trade is processed.
+	Rollovers int `json:"-"`
+	// ImportKey identifies a trade loaded by an import, received from the
+	// FIX gateway or submitted with an Idempotency-Key, so that loading or
+	// receiving it again is detected; it is empty for other trades.
+	ImportKey string `json:"-"`
+
+	// RequestId and TraceParent tie the queued trade to the HTTP request
+	// that submitted it.
+	RequestId   string `json:"-"`
+	TraceParent string `json:"-"`
+}
+
+// Lot is the number of units in a volume of 1. It is set once from the
+// trading.lot_size setting before any trade is processed.
+var Lot = 100000.0
+
+// Profit is what the trade adds to the profit of its account.
+func (t *Trade) Profit() float64 {
+	profit := (t.Close - t.Open) * t.Volume * Lot
+	if t.Side == "sell" {
+		profit = -profit
+	}
+	return profit
+}
+
+// AppliedProfit returns the profit the trade has added to its account. ok is
+// false while the trade is pending and once it is cancelled, as it then adds
+// nothing; every API reports the profit of a trade this way.
+func (t *Trade) AppliedProfit() (profit float64, ok bool) {
+	if t.Status() != TradeStatusProcessed {
+		return 0, false
+	}
+	return t.Profit(), true
+}
+
+const (
+	TradeStatusPending   = "pending"
+	TradeStatusProcessed = "processed"
+	TradeStatusCancelled = "cancelled"
+)
+
+// Status tells whether the trade waits in the queue, has been applied to the
+// account stats or was cancelled.
+func (t *Trade) Status() string {
+	switch {
+	case t.CancelledAt != nil:
+		return TradeStatusCancelled
+	case t.Processed == 0:
+		return TradeStatusPending
+	}
+	return TradeStatusProcessed
 }
 
 //func (tr *Trade) ProcessTrade() error {
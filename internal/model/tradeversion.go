@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+const (
+	TradeActionAmend   = "amend"
+	TradeActionCancel  = "cancel"
+	TradeActionRequeue = "requeue"
+)
+
+// TradeVersion is a version of a trade replaced by an amendment, a
+// cancellation or a requeue, together with who made the change, why, and the adjustment
+// it made to the account stats.
+type TradeVersion struct {
+	TradeId   int
+	Version   int
+	Symbol    string
+	Volume    float64
+	Open      float64
+	Close     float64
+	Side      string
+	OpenTime  *time.Time
+	CloseTime *time.Time
+	// Status of the trade before the change.
+	Status string
+
+	Action    string
+	Actor     string
+	Reason    string
+	ChangedAt time.Time
+	// ProfitDelta and TradesDelta were added to the account stats by the
+	// change; both are zero for trades still pending.
+	ProfitDelta float64
+	TradesDelta int
+}
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+const (
+	AccountStatusActive = "active"
+	AccountStatusFrozen = "frozen"
+	AccountStatusClosed = "closed"
+)
+
+// TradingAccount is the master data of an account. Its trading results are
+// kept separately, in Account.
+type TradingAccount struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	Group    string `json:"group"`
+	Leverage int    `json:"leverage"`
+	// Status is active, frozen (no new trades) or closed, which is final.
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Defaults of accounts created without them, including those created
+// implicitly by their first trade.
+const (
+	DefaultCurrency = "USD"
+	DefaultLeverage = 1
+)
+
+// NewTradingAccount returns an active account id with the defaults, as
+// created by its first trade.
+func NewTradingAccount(id string, now time.Time) *TradingAccount {
+	now = now.UTC().Truncate(time.Millisecond)
+	return &TradingAccount{
+		Id:        id,
+		Name:      id,
+		Currency:  DefaultCurrency,
+		Leverage:  DefaultLeverage,
+		Status:    AccountStatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
@@ -0,0 +1,330 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Components struct {
+	Schemas   map[string]*Schema   `json:"schemas"`
+	Responses map[string]*Response `json:"responses"`
+}
+
+type Operation struct {
+	OperationId string                `json:"operationId"`
+	Security    []map[string][]string `json:"security"`
+	Scope       string                `json:"x-scope"`
+	Responses   map[string]*Response  `json:"responses"`
+}
+
+type Response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 any                `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Enum                 []any              `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	Format               string             `json:"format"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	MinItems             *int               `json:"minItems"`
+	Minimum              *float64           `json:"minimum"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum"`
+	AllOf                []*Schema          `json:"allOf"`
+}
+
+var httpMethods = []string{"get", "put", "post", "delete", "patch", "head", "options"}
+
+func Load(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decode openapi document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q", doc.OpenAPI)
+	}
+	for path, item := range doc.Paths {
+		for method := range item {
+			if !slices.Contains(httpMethods, method) {
+				return nil, fmt.Errorf("%s: unknown method %q", path, method)
+			}
+		}
+	}
+	return &doc, nil
+}
+
+// Operations returns every operation as "METHOD /path", sorted, in the form
+// used by http.ServeMux patterns.
+func (d *Document) Operations() []string {
+	var ops []string
+	for path, item := range d.Paths {
+		for method := range item {
+			ops = append(ops, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+func (d *Document) Operation(method, path string) (Operation, bool) {
+	op, ok := d.Paths[path][strings.ToLower(method)]
+	return op, ok
+}
+
+// ValidateResponse checks that status is documented for the operation and,
+// for JSON content, that body matches the documented schema.
+func (d *Document) ValidateResponse(method, path string, status int, contentType string, body []byte) error {
+	op, ok := d.Operation(method, path)
+	if !ok {
+		return fmt.Errorf("operation %s %s is not documented", method, path)
+	}
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if resp, ok = op.Responses["default"]; !ok {
+			return fmt.Errorf("%s %s: status %d is not documented", method, path, status)
+		}
+	}
+	resp, err := d.resolveResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Content) == 0 {
+		if len(body) != 0 {
+			return fmt.Errorf("%s %s %d: unexpected body %q", method, path, status, body)
+		}
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%s %s %d: invalid content type %q", method, path, status, contentType)
+	}
+	media, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s %s %d: content type %s is not documented", method, path, status, mediaType)
+	}
+	if media.Schema == nil || !isJSON(mediaType) {
+		return nil
+	}
+
+	var v any
+	if err = json.Unmarshal(body, &v); err != nil {
+		return fmt.Errorf("%s %s %d: invalid JSON: %w", method, path, status, err)
+	}
+	if err = d.Validate(media.Schema, v); err != nil {
+		return fmt.Errorf("%s %s %d: %w", method, path, status, err)
+	}
+	return nil
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func (d *Document) resolveResponse(r *Response) (*Response, error) {
+	if r.Ref == "" {
+		return r, nil
+	}
+	name, ok := strings.CutPrefix(r.Ref, "#/components/responses/")
+	if !ok || d.Components.Responses[name] == nil {
+		return nil, fmt.Errorf("unresolved response reference %q", r.Ref)
+	}
+	return d.Components.Responses[name], nil
+}
+
+func (d *Document) resolve(s *Schema) (*Schema, error) {
+	for depth := 0; s.Ref != ""; depth++ {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok || d.Components.Schemas[name] == nil || depth > 32 {
+			return nil, fmt.Errorf("unresolved schema reference %q", s.Ref)
+		}
+		s = d.Components.Schemas[name]
+	}
+	return s, nil
+}
+
+// Validate checks a decoded JSON value against schema. Only the subset of
+// JSON Schema used by the broker API is supported: type, properties,
+// required, additionalProperties, items, enum, pattern, length/item/number
+// bounds, format date-time, allOf and local $ref.
+func (d *Document) Validate(schema *Schema, v any) error {
+	return d.validate(schema, v, "$")
+}
+
+func (d *Document) validate(schema *Schema, v any, at string) error {
+	s, err := d.resolve(schema)
+	if err != nil {
+		return err
+	}
+	for _, sub := range s.AllOf {
+		if err = d.validate(sub, v, at); err != nil {
+			return err
+		}
+	}
+	if s.Type != nil && !matchesType(s.Type, v) {
+		return fmt.Errorf("%s: expected %v, got %s", at, s.Type, jsonType(v))
+	}
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, v) {
+		return fmt.Errorf("%s: %v is not one of %v", at, v, s.Enum)
+	}
+
+	switch v := v.(type) {
+	case string:
+		return s.validateString(v, at)
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s: %v is less than %v", at, v, *s.Minimum)
+		}
+		if s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum {
+			return fmt.Errorf("%s: %v is not greater than %v", at, v, *s.ExclusiveMinimum)
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%s: fewer than %d items", at, *s.MinItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err = d.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]any:
+		return d.validateObject(s, v, at)
+	}
+	return nil
+}
+
+func (s *Schema) validateString(v, at string) error {
+	n := len([]rune(v))
+	if s.MinLength != nil && n < *s.MinLength {
+		return fmt.Errorf("%s: shorter than %d", at, *s.MinLength)
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		return fmt.Errorf("%s: longer than %d", at, *s.MaxLength)
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern %q: %w", at, s.Pattern, err)
+		}
+		if !re.MatchString(v) {
+			return fmt.Errorf("%s: %q does not match %s", at, v, s.Pattern)
+		}
+	}
+	if s.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+			return fmt.Errorf("%s: %q is not a date-time", at, v)
+		}
+	}
+	return nil
+}
+
+func (d *Document) validateObject(s *Schema, v map[string]any, at string) error {
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			return fmt.Errorf("%s: missing required property %q", at, name)
+		}
+	}
+
+	var extra *Schema
+	closed := false
+	if len(s.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(s.AdditionalProperties, &allowed); err == nil {
+			closed = !allowed
+		} else if err = json.Unmarshal(s.AdditionalProperties, &extra); err != nil {
+			return fmt.Errorf("%s: invalid additionalProperties: %w", at, err)
+		}
+	}
+
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, ok := s.Properties[name]
+		switch {
+		case ok:
+		case extra != nil:
+			prop = extra
+		case closed:
+			return fmt.Errorf("%s: unexpected property %q", at, name)
+		default:
+			continue
+		}
+		if err := d.validate(prop, v[name], at+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchesType(t any, v any) bool {
+	switch t := t.(type) {
+	case string:
+		return typeMatches(t, v)
+	case []any:
+		for _, item := range t {
+			if s, ok := item.(string); ok && typeMatches(s, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeMatches(t string, v any) bool {
+	actual := jsonType(v)
+	if t == "number" && actual == "integer" {
+		return true
+	}
+	return t == actual
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
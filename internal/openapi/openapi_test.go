@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testDocument = `{
+  "openapi": "3.1.0",
+  "paths": {
+    "/things/{id}": {
+      "get": {
+        "responses": {
+          "200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Thing"}}}},
+          "204": {"description": "empty"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "responses": {
+      "Error": {"description": "error", "content": {"text/plain": {"schema": {"type": "string"}}}}
+    },
+    "schemas": {
+      "Thing": {
+        "type": "object",
+        "required": ["id"],
+        "additionalProperties": false,
+        "properties": {
+          "id": {"type": "string", "pattern": "^[a-z]+$"},
+          "count": {"type": "integer", "minimum": 0},
+          "kind": {"type": "string", "enum": ["a", "b"]},
+          "tags": {"type": "array", "items": {"type": "string"}},
+          "at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Tagged": {
+        "allOf": [
+          {"$ref": "#/components/schemas/Thing"},
+          {"required": ["tags"]}
+        ]
+      }
+    }
+  }
+}`
+
+func TestValidate(t *testing.T) {
+	doc, err := Load([]byte(testDocument))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		valid  bool
+	}{
+		{name: "valid", schema: "Thing", value: `{"id":"abc","count":3,"kind":"a","tags":["x"],"at":"2024-01-02T03:04:05Z"}`, valid: true},
+		{name: "missing required", schema: "Thing", value: `{"count":3}`, valid: false},
+		{name: "unexpected property", schema: "Thing", value: `{"id":"abc","other":1}`, valid: false},
+		{name: "wrong type", schema: "Thing", value: `{"id":1}`, valid: false},
+		{name: "pattern mismatch", schema: "Thing", value: `{"id":"ABC"}`, valid: false},
+		{name: "fractional integer", schema: "Thing", value: `{"id":"abc","count":1.5}`, valid: false},
+		{name: "below minimum", schema: "Thing", value: `{"id":"abc","count":-1}`, valid: false},
+		{name: "not in enum", schema: "Thing", value: `{"id":"abc","kind":"c"}`, valid: false},
+		{name: "wrong item type", schema: "Thing", value: `{"id":"abc","tags":[1]}`, valid: false},
+		{name: "bad date-time", schema: "Thing", value: `{"id":"abc","at":"yesterday"}`, valid: false},
+		{name: "allOf satisfied", schema: "Tagged", value: `{"id":"abc","tags":[]}`, valid: true},
+		{name: "allOf violated", schema: "Tagged", value: `{"id":"abc"}`, valid: false},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		var v any
+		if err := json.Unmarshal([]byte(test.value), &v); err != nil {
+			t.Fatalf("decode value: %v", err)
+		}
+		err := doc.Validate(&Schema{Ref: "#/components/schemas/" + test.schema}, v)
+		if (err == nil) != test.valid {
+			t.Errorf("Validate(%s) = %v; want valid %v", test.value, err, test.valid)
+		}
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	doc, err := Load([]byte(testDocument))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		status      int
+		contentType string
+		body        string
+		valid       bool
+	}{
+		{name: "json body", method: "GET", status: 200, contentType: "application/json; charset=utf-8", body: `{"id":"abc"}`, valid: true},
+		{name: "json body not matching schema", method: "GET", status: 200, contentType: "application/json", body: `{}`, valid: false},
+		{name: "undocumented content type", method: "GET", status: 200, contentType: "text/plain", body: `abc`, valid: false},
+		{name: "empty response", method: "GET", status: 204, valid: true},
+		{name: "unexpected body", method: "GET", status: 204, contentType: "text/plain", body: "x", valid: false},
+		{name: "referenced response", method: "GET", status: 404, contentType: "text/plain; charset=utf-8", body: "not found\n", valid: true},
+		{name: "undocumented status", method: "GET", status: 500, contentType: "text/plain", body: "boom", valid: false},
+		{name: "undocumented method", method: "POST", status: 200, contentType: "application/json", body: `{"id":"abc"}`, valid: false},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		err := doc.ValidateResponse(test.method, "/things/{id}", test.status, test.contentType, []byte(test.body))
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateResponse = %v; want valid %v", err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"gitlab.com/digineat/go-broker-test/internal/logging"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const ContentType = "application/problem+json"
+
+// Machine-readable error codes. They are part of the API contract: clients
+// switch on them, so existing values must never change.
+const (
+	CodeInvalidJSON      = "invalid_json"
+	CodeUnknownField     = "unknown_field"
+	CodeTrailingData     = "trailing_data"
+	CodeValidationFailed = "validation_failed"
+	CodeInvalidPath      = "invalid_path"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeQueueFull        = "queue_full"
+	CodeInternal         = "internal_error"
+	CodeAuthUnavailable  = "auth_unavailable"
+	CodeRateLimitingOff  = "rate_limiting_disabled"
+	CodeCalendarOff      = "calendar_disabled"
+)
+
+// Codes lists every error code.
+var Codes = []string{
+	CodeInvalidJSON, CodeUnknownField, CodeTrailingData, CodeValidationFailed, CodeInvalidPath,
+	CodeUnauthorized, CodeForbidden, CodeNotFound, CodeMethodNotAllowed, CodeConflict, CodeRateLimited,
+	CodeQueueFull, CodeInternal, CodeAuthUnavailable, CodeRateLimitingOff, CodeCalendarOff,
+}
+
+// TypePrefix prefixes the code to form the RFC 7807 problem type URI.
+const TypePrefix = "urn:broker:problem:"
+
+// Problem is an RFC 7807 problem details object. Code and Errors are
+// extension members.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestId string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one rejected field of a request body. Field is the
+// JSON path of the field, e.g. "symbol" or "scopes[1]".
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Value   any    `json:"value"`
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   TypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Validation builds a 400 problem listing errs.
+func Validation(errs ...FieldError) *Problem {
+	p := New(http.StatusBadRequest, CodeValidationFailed, "request validation failed")
+	p.Errors = errs
+	return p
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Code
+	}
+	return p.Code + ": " + p.Detail
+}
+
+// Write sends p as application/problem+json, filling in the request path and
+// request id.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestId == "" {
+		p.RequestId = logging.RequestID(r.Context())
+	}
+	resp, err := json.Marshal(p)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can not marshal problem", "error", err)
+		resp = []byte(`{"type":"` + TypePrefix + CodeInternal + `","status":500,"code":"` + CodeInternal + `"}`)
+		p.Status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if _, err = w.Write(resp); err != nil {
+		slog.ErrorContext(r.Context(), "can not write response", "error", err)
+	}
+}
+
+// Error writes a problem without field errors.
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Write(w, r, New(status, code, detail))
+}
+
+// Decode strictly decodes a single JSON value from body into v. Unknown
+// fields, type mismatches and data after the value are reported as problems.
+func Decode(body io.Reader, v any) *Problem {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeProblem(err)
+	}
+	var extra json.RawMessage
+	if err := dec.Decode(&extra); !errors.Is(err, io.EOF) {
+		return New(http.StatusBadRequest, CodeTrailingData, "request body must contain a single JSON value")
+	}
+	return nil
+}
+
+func decodeProblem(err error) *Problem {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	switch {
+	case errors.Is(err, io.EOF):
+		return New(http.StatusBadRequest, CodeInvalidJSON, "request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return New(http.StatusBadRequest, CodeInvalidJSON, "request body is truncated")
+	case errors.As(err, &syntaxErr):
+		return New(http.StatusBadRequest, CodeInvalidJSON, fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			return New(http.StatusBadRequest, CodeInvalidJSON, "request body must be "+article(jsonKind(typeErr.Type))+" JSON "+jsonKind(typeErr.Type))
+		}
+		return Validation(FieldError{
+			Field:   field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be %s %s", field, article(jsonKind(typeErr.Type)), jsonKind(typeErr.Type)),
+			Value:   typeErr.Value,
+		})
+	case errors.As(err, &timeErr):
+		// encoding/json does not say which field a time.Time came from.
+		return Validation(FieldError{
+			Rule:    "datetime",
+			Message: "timestamps must be RFC 3339 date-times",
+			Value:   strings.Trim(timeErr.Value, `"`),
+		})
+	}
+	// encoding/json has no typed error for unknown fields.
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		name = strings.Trim(name, `"`)
+		p := New(http.StatusBadRequest, CodeUnknownField, fmt.Sprintf("unknown field %q", name))
+		p.Errors = []FieldError{{Field: name, Rule: "unknown", Message: name + " is not a known field"}}
+		return p
+	}
+	return New(http.StatusBadRequest, CodeInvalidJSON, err.Error())
+}
+
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+func article(kind string) string {
+	if strings.ContainsRune("aeiou", rune(kind[0])) {
+		return "an"
+	}
+	return "a"
+}
+
+// JSONFieldName reports the JSON name of a struct field. Register it with
+// validator.RegisterTagNameFunc so field errors use the names clients send.
+func JSONFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+// FromValidation converts validator errors into a validation problem. Any
+// other error becomes a plain validation problem with err as detail.
+func FromValidation(err error) *Problem {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return New(http.StatusBadRequest, CodeValidationFailed, err.Error())
+	}
+	errs := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		errs = append(errs, FieldError{
+			Field:   fieldPath(fe.Namespace()),
+			Rule:    fe.Tag(),
+			Message: message(fe),
+			Value:   fe.Value(),
+		})
+	}
+	return Validation(errs...)
+}
+
+// fieldPath drops the struct name from a validator namespace such as
+// "Trade.symbol".
+func fieldPath(namespace string) string {
+	if _, path, ok := strings.Cut(namespace, "."); ok {
+		return path
+	}
+	return namespace
+}
+
+func message(fe validator.FieldError) string {
+	field := fieldPath(fe.Namespace())
+	param := fe.Param()
+	unit := "characters long"
+	switch fe.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = "items"
+	}
+	numeric := false
+	switch fe.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		numeric = true
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "alpha":
+		return field + " must contain only letters"
+	case "alphanum":
+		return field + " must contain only letters and digits"
+	case "oneof":
+		return field + " must be one of " + strings.Join(strings.Fields(param), ", ")
+	case "len":
+		return fmt.Sprintf("%s must be exactly %s %s", field, param, unit)
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, param)
+	case "gte":
+		return fmt.Sprintf("%s must be at least %s", field, param)
+	case "lt":
+		return fmt.Sprintf("%s must be less than %s", field, param)
+	case "lte":
+		return fmt.Sprintf("%s must be at most %s", field, param)
+	case "min":
+		if numeric {
+			return fmt.Sprintf("%s must be at least %s", field, param)
+		}
+		return fmt.Sprintf("%s must be at least %s %s", field, param, unit)
+	case "max":
+		if numeric {
+			return fmt.Sprintf("%s must be at most %s", field, param)
+		}
+		return fmt.Sprintf("%s must be at most %s %s", field, param, unit)
+	}
+	if param != "" {
+		return fmt.Sprintf("%s failed the %s=%s rule", field, fe.Tag(), param)
+	}
+	return fmt.Sprintf("%s failed the %s rule", field, fe.Tag())
+}
@@ -0,0 +1,117 @@
+package problem
+
+import (
+	"encoding/json"
+	"github.com/go-playground/validator/v10"
+	"gitlab.com/digineat/go-broker-test/internal/logging"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testRequest struct {
+	Name  string   `json:"name"  validate:"required,alpha,len=6"`
+	Count int      `json:"count" validate:"gt=0"`
+	Side  string   `json:"side"  validate:"oneof=buy sell"`
+	Tags  []string `json:"tags"  validate:"dive,alphanum"`
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		code   string
+		errors []FieldError
+	}{
+		{name: "valid", body: `{"name":"EURUSD","count":1}`},
+		{name: "empty body", body: ``, code: CodeInvalidJSON},
+		{name: "truncated", body: `{"name":"EURUSD"`, code: CodeInvalidJSON},
+		{name: "malformed", body: `{"name":<x>}`, code: CodeInvalidJSON},
+		{name: "not an object", body: `[1]`, code: CodeInvalidJSON},
+		{name: "wrong nested type", body: `{"tags":"a"}`, code: CodeValidationFailed,
+			errors: []FieldError{{Field: "tags", Rule: "type", Message: "tags must be an array", Value: "string"}}},
+		{name: "unknown field", body: `{"name":"EURUSD","colour":"red"}`, code: CodeUnknownField,
+			errors: []FieldError{{Field: "colour", Rule: "unknown", Message: "colour is not a known field"}}},
+		{name: "wrong type", body: `{"count":"one"}`, code: CodeValidationFailed,
+			errors: []FieldError{{Field: "count", Rule: "type", Message: "count must be an integer", Value: "string"}}},
+		{name: "trailing data", body: `{"name":"EURUSD"} {"name":"GBPUSD"}`, code: CodeTrailingData},
+		{name: "trailing garbage", body: `{"name":"EURUSD"}x`, code: CodeTrailingData},
+		{name: "trailing whitespace", body: "{\"name\":\"EURUSD\"}\n  "},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		var req testRequest
+		p := Decode(strings.NewReader(test.body), &req)
+		if test.code == "" {
+			if p != nil {
+				t.Errorf("Decode(%q) = %v; want nil", test.body, p)
+			}
+			continue
+		}
+		if p == nil {
+			t.Errorf("Decode(%q) = nil; want %s", test.body, test.code)
+			continue
+		}
+		if p.Code != test.code || p.Status != http.StatusBadRequest || p.Type != TypePrefix+test.code {
+			t.Errorf("Decode(%q) = %+v; want code %s", test.body, p, test.code)
+		}
+		if !reflect.DeepEqual(p.Errors, test.errors) {
+			t.Errorf("Decode(%q) errors = %+v; want %+v", test.body, p.Errors, test.errors)
+		}
+	}
+}
+
+func TestFromValidation(t *testing.T) {
+	v := validator.New()
+	v.RegisterTagNameFunc(JSONFieldName)
+
+	err := v.Struct(&testRequest{Name: "eur", Side: "hold", Tags: []string{"ok", "not ok"}})
+	p := FromValidation(err)
+
+	want := []FieldError{
+		{Field: "name", Rule: "len", Message: "name must be exactly 6 characters long", Value: "eur"},
+		{Field: "count", Rule: "gt", Message: "count must be greater than 0", Value: 0},
+		{Field: "side", Rule: "oneof", Message: "side must be one of buy, sell", Value: "hold"},
+		{Field: "tags[1]", Rule: "alphanum", Message: "tags[1] must contain only letters and digits", Value: "not ok"},
+	}
+	if p.Code != CodeValidationFailed || p.Status != http.StatusBadRequest {
+		t.Errorf("problem = %+v; want %s", p, CodeValidationFailed)
+	}
+	if !reflect.DeepEqual(p.Errors, want) {
+		t.Errorf("errors = %+v; want %+v", p.Errors, want)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/stats/123", nil)
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-1"))
+	rec := httptest.NewRecorder()
+
+	Error(rec, req, http.StatusNotFound, CodeNotFound, "account 123 not found")
+
+	res := rec.Result()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d; want %d", res.StatusCode, http.StatusNotFound)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != ContentType {
+		t.Errorf("content type = %q; want %q", ct, ContentType)
+	}
+	var got map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := map[string]any{
+		"type":       TypePrefix + CodeNotFound,
+		"title":      "Not Found",
+		"status":     float64(http.StatusNotFound),
+		"detail":     "account 123 not found",
+		"instance":   "/stats/123",
+		"code":       CodeNotFound,
+		"request_id": "req-1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %v; want %v", got, want)
+	}
+}
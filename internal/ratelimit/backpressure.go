@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DepthGauge caches the number of pending queue rows so that backpressure
+// checks do not count the queue on every request.
+type DepthGauge struct {
+	Count func(ctx context.Context) (int, error)
+	TTL   time.Duration
+
+	mu    sync.Mutex
+	value int
+	at    time.Time
+	now   func() time.Time
+}
+
+func NewDepthGauge(count func(ctx context.Context) (int, error), ttl time.Duration) *DepthGauge {
+	return &DepthGauge{Count: count, TTL: ttl, now: time.Now}
+}
+
+// Depth returns the cached queue depth, refreshing it when older than TTL.
+func (g *DepthGauge) Depth(ctx context.Context) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	if !g.at.IsZero() && now.Sub(g.at) < g.TTL {
+		return g.value, nil
+	}
+	n, err := g.Count(ctx)
+	if err != nil {
+		return 0, err
+	}
+	g.value, g.at = n, now
+	return n, nil
+}
@@ -0,0 +1,222 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	KindKey     = "key"
+	KindAccount = "account"
+)
+
+// maxBuckets bounds memory; idle buckets that refilled completely are
+// dropped once it is exceeded.
+const maxBuckets = 10000
+
+// Limit is a token bucket refilled at Rate tokens per second up to Burst.
+// A zero Rate disables the limit.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+func (l Limit) Enabled() bool {
+	return l.Rate > 0
+}
+
+func (l Limit) validate() error {
+	if l.Rate < 0 || math.IsNaN(l.Rate) || math.IsInf(l.Rate, 0) {
+		return fmt.Errorf("invalid rate %v", l.Rate)
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		return errors.New("burst must be at least 1")
+	}
+	return nil
+}
+
+// Config holds the default limits per API key and per account, overrides for
+// individual keys and accounts, and the queue depth at which new trades are
+// rejected (0 disables backpressure).
+type Config struct {
+	Key        Limit            `json:"key"`
+	Account    Limit            `json:"account"`
+	Keys       map[string]Limit `json:"keys,omitempty"`
+	Accounts   map[string]Limit `json:"accounts,omitempty"`
+	MaxPending int              `json:"max_pending"`
+}
+
+func (c Config) Validate() error {
+	if c.MaxPending < 0 {
+		return errors.New("max_pending must not be negative")
+	}
+	if err := c.Key.validate(); err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+	if err := c.Account.validate(); err != nil {
+		return fmt.Errorf("account: %w", err)
+	}
+	for id, l := range c.Keys {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("keys[%s]: %w", id, err)
+		}
+	}
+	for id, l := range c.Accounts {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("accounts[%s]: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (c Config) clone() Config {
+	c.Keys = maps.Clone(c.Keys)
+	c.Accounts = maps.Clone(c.Accounts)
+	return c
+}
+
+func (c Config) limit(kind, id string) Limit {
+	if kind == KindKey {
+		if l, ok := c.Keys[id]; ok {
+			return l
+		}
+		return c.Key
+	}
+	if l, ok := c.Accounts[id]; ok {
+		return l
+	}
+	return c.Account
+}
+
+// Target names one bucket, e.g. {KindAccount, "123"}.
+type Target struct {
+	Kind string
+	Id   string
+}
+
+// Result describes the most restrictive bucket checked by Allow.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+func (b *bucket) untilFull() time.Duration {
+	return time.Duration((float64(b.limit.Burst) - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+type Limiter struct {
+	mu      sync.Mutex
+	cfg     Config
+	buckets map[Target]*bucket
+	now     func() time.Time
+}
+
+func New(cfg Config) (*Limiter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Limiter{cfg: cfg.clone(), buckets: map[Target]*bucket{}, now: time.Now}, nil
+}
+
+func (l *Limiter) Config() Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg.clone()
+}
+
+// SetConfig replaces the limits at runtime. Buckets whose limit changed start
+// over full.
+func (l *Limiter) SetConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg.clone()
+	for t, b := range l.buckets {
+		if cfg.limit(t.Kind, t.Id) != b.limit {
+			delete(l.buckets, t)
+		}
+	}
+	return nil
+}
+
+// Allow takes one token from every target's bucket, or none if any of them
+// is empty.
+func (l *Limiter) Allow(targets ...Target) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	res := Result{Allowed: true, Remaining: math.MaxInt}
+	checked := make([]*bucket, 0, len(targets))
+	for _, t := range targets {
+		limit := l.cfg.limit(t.Kind, t.Id)
+		if !limit.Enabled() {
+			continue
+		}
+		b, ok := l.buckets[t]
+		if !ok {
+			l.sweep(now)
+			b = &bucket{tokens: float64(limit.Burst), last: now, limit: limit}
+			l.buckets[t] = b
+		}
+		b.refill(now)
+		checked = append(checked, b)
+
+		if b.tokens < 1 {
+			wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+			if !res.Allowed && wait <= res.RetryAfter {
+				continue
+			}
+			res = Result{Limit: limit.Burst, RetryAfter: wait, Reset: b.untilFull()}
+		} else if res.Allowed && int(b.tokens)-1 < res.Remaining {
+			res.Limit, res.Remaining = limit.Burst, int(b.tokens)-1
+		}
+	}
+
+	if !res.Allowed {
+		return res
+	}
+	if len(checked) == 0 {
+		return Result{Allowed: true}
+	}
+	for _, b := range checked {
+		b.tokens--
+		if reset := b.untilFull(); reset > res.Reset {
+			res.Reset = reset
+		}
+	}
+	return res
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if len(l.buckets) < maxBuckets {
+		return
+	}
+	for t, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, t)
+		}
+	}
+}
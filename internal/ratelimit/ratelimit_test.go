@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(t *testing.T, cfg Config) (*Limiter, *time.Time) {
+	l, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiter_TokenBucket(t *testing.T) {
+	l, now := newTestLimiter(t, Config{Account: Limit{Rate: 2, Burst: 3}})
+	acc := Target{Kind: KindAccount, Id: "123"}
+
+	for i, remaining := range []int{2, 1, 0} {
+		res := l.Allow(acc)
+		if !res.Allowed || res.Remaining != remaining || res.Limit != 3 {
+			t.Fatalf("request %d: %+v", i, res)
+		}
+	}
+	res := l.Allow(acc)
+	if res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("over limit: %+v", res)
+	}
+
+	*now = now.Add(500 * time.Millisecond)
+	if res = l.Allow(acc); !res.Allowed {
+		t.Fatalf("after refill: %+v", res)
+	}
+	if res.Reset != 1500*time.Millisecond {
+		t.Errorf("reset = %v; want 1.5s", res.Reset)
+	}
+}
+
+func TestLimiter_AllTargetsOrNothing(t *testing.T) {
+	l, _ := newTestLimiter(t, Config{
+		Key:     Limit{Rate: 1, Burst: 5},
+		Account: Limit{Rate: 1, Burst: 1},
+	})
+	key := Target{Kind: KindKey, Id: "key:a"}
+
+	if res := l.Allow(key, Target{Kind: KindAccount, Id: "1"}); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("first: %+v", res)
+	}
+	if res := l.Allow(key, Target{Kind: KindAccount, Id: "1"}); res.Allowed {
+		t.Fatalf("account bucket empty but allowed: %+v", res)
+	}
+	// the rejected request must not have used a key token
+	if res := l.Allow(key); !res.Allowed || res.Remaining != 3 {
+		t.Fatalf("key bucket: %+v", res)
+	}
+}
+
+func TestLimiter_OverridesAndSetConfig(t *testing.T) {
+	l, _ := newTestLimiter(t, Config{
+		Key:  Limit{Rate: 1, Burst: 1},
+		Keys: map[string]Limit{"key:unlimited": {}},
+	})
+	for i := 0; i < 3; i++ {
+		if res := l.Allow(Target{Kind: KindKey, Id: "key:unlimited"}); !res.Allowed {
+			t.Fatalf("unlimited key rejected: %+v", res)
+		}
+	}
+
+	limited := Target{Kind: KindKey, Id: "key:b"}
+	l.Allow(limited)
+	if res := l.Allow(limited); res.Allowed {
+		t.Fatalf("limited key allowed twice: %+v", res)
+	}
+	if err := l.SetConfig(Config{Key: Limit{Rate: 1, Burst: 10}}); err != nil {
+		t.Fatalf("SetConfig: %v", err)
+	}
+	if res := l.Allow(limited); !res.Allowed || res.Remaining != 9 {
+		t.Fatalf("after SetConfig: %+v", res)
+	}
+
+	if err := l.SetConfig(Config{MaxPending: -1}); err == nil {
+		t.Error("expected error for negative max_pending")
+	}
+	if err := l.SetConfig(Config{Account: Limit{Rate: 5}}); err == nil {
+		t.Error("expected error for zero burst")
+	}
+}
+
+func TestDepthGauge_Caches(t *testing.T) {
+	calls := 0
+	g := NewDepthGauge(func(context.Context) (int, error) {
+		calls++
+		return calls * 10, nil
+	}, time.Second)
+	now := time.Unix(0, 0)
+	g.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if n, err := g.Depth(context.Background()); err != nil || n != 10 {
+			t.Fatalf("Depth = %d, %v", n, err)
+		}
+	}
+	now = now.Add(time.Second)
+	if n, _ := g.Depth(context.Background()); n != 20 || calls != 2 {
+		t.Errorf("after ttl: depth %d, calls %d", n, calls)
+	}
+}
@@ -0,0 +1,184 @@
+// Package tlsconfig builds the TLS configuration of the HTTP server from PEM
+// files and picks up rotated files without a restart.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// ClientAuthRequire rejects clients without a valid certificate.
+	ClientAuthRequire = "require"
+	// ClientAuthOptional verifies a certificate when the client sends one,
+	// so that other clients can still authenticate with API keys or tokens.
+	ClientAuthOptional = "optional"
+)
+
+// checkInterval bounds how often the files are checked for changes.
+const checkInterval = 10 * time.Second
+
+// Files names the PEM files of the server.
+type Files struct {
+	Cert string
+	Key  string
+	// ClientCA is the bundle client certificates are verified against;
+	// empty means client certificates are not requested.
+	ClientCA string
+	// ClientAuth is ClientAuthRequire or ClientAuthOptional.
+	ClientAuth string
+}
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader serves the certificate and client CA bundle last read from the
+// files. On a handshake at least checkInterval after the last check, files
+// that changed are read again; a rotation that can not be read, e.g. a
+// certificate not matching the key yet, is logged and the previous files
+// stay in use.
+type Reloader struct {
+	files    Files
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	stamps  map[string]stamp
+	checked time.Time
+}
+
+// New reads the files, which must be valid.
+func New(files Files) (*Reloader, error) {
+	switch files.ClientAuth {
+	case "", ClientAuthRequire, ClientAuthOptional:
+	default:
+		return nil, fmt.Errorf("invalid client auth %q, expected require or optional", files.ClientAuth)
+	}
+	r := &Reloader{files: files, interval: checkInterval, now: time.Now}
+	stamps, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.load(stamps); err != nil {
+		return nil, err
+	}
+	r.checked = r.now()
+	return r, nil
+}
+
+// Config returns the server configuration using the current files.
+func (r *Reloader) Config() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+	if r.files.ClientCA == "" {
+		return cfg
+	}
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := cfg.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = r.clientCAs()
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		if r.files.ClientAuth == ClientAuthOptional {
+			c.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		return c, nil
+	}
+	return cfg
+}
+
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.check()
+	return r.cert, nil
+}
+
+func (r *Reloader) clientCAs() *x509.CertPool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.check()
+	return r.pool
+}
+
+// check reloads changed files once the interval has passed. r.mu must be
+// held.
+func (r *Reloader) check() {
+	now := r.now()
+	if now.Sub(r.checked) < r.interval {
+		return
+	}
+	r.checked = now
+	stamps, err := r.stat()
+	if err == nil && equalStamps(stamps, r.stamps) {
+		return
+	}
+	if err == nil {
+		err = r.load(stamps)
+	}
+	if err != nil {
+		slog.Error("can not reload TLS files, keeping the previous ones", "error", err)
+		return
+	}
+	slog.Info("TLS files reloaded", "cert", r.files.Cert, "client_ca", r.files.ClientCA)
+}
+
+func (r *Reloader) stat() (map[string]stamp, error) {
+	stamps := map[string]stamp{}
+	for _, path := range []string{r.files.Cert, r.files.Key, r.files.ClientCA} {
+		if path == "" {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		stamps[path] = stamp{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	return stamps, nil
+}
+
+// load reads all files and replaces the certificate and the pool if every
+// one of them is valid.
+func (r *Reloader) load(stamps map[string]stamp) error {
+	cert, err := tls.LoadX509KeyPair(r.files.Cert, r.files.Key)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if r.files.ClientCA != "" {
+		data, err := os.ReadFile(r.files.ClientCA)
+		if err != nil {
+			return fmt.Errorf("read client CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.New(r.files.ClientCA + ": no certificates found")
+		}
+	}
+	r.cert, r.pool, r.stamps = &cert, pool, stamps
+	return nil
+}
+
+func equalStamps(a, b map[string]stamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, s := range a {
+		if o, ok := b[path]; !ok || o.size != s.size || !o.modTime.Equal(s.modTime) {
+			return false
+		}
+	}
+	return true
+}
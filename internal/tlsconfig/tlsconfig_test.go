@@ -0,0 +1,266 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues self-signed test certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a server certificate for
+// 127.0.0.1, or of a client certificate.
+func (ca *testCA) issue(t *testing.T, name string, serial int64, client bool) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if client {
+		tmpl.ExtKeyUsage, tmpl.IPAddresses = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, nil
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes data to path with a modification time of at, so that a
+// rewrite within the timestamp resolution is still seen as a change.
+func writeFile(t *testing.T, path string, data []byte, at time.Time) {
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatalf("chtimes %s: %v", path, err)
+	}
+}
+
+// serve starts an HTTPS server with the configuration of r, like the broker
+// server does, and returns its URL. It answers with the common name of the
+// verified client certificate, or "-".
+func serve(t *testing.T, r *Reloader) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if len(req.TLS.VerifiedChains) == 0 {
+				w.Write([]byte("-"))
+				return
+			}
+			w.Write([]byte(req.TLS.VerifiedChains[0][0].Subject.CommonName))
+		}),
+		TLSConfig: r.Config(),
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	go srv.ServeTLS(l, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return "https://" + l.Addr().String()
+}
+
+// get requests url over a new connection trusting ca and returns the
+// serial number of the server certificate and the body.
+func get(url string, ca *testCA, clientCert *tls.Certificate) (serial int64, body string, err error) {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: roots}
+	if clientCert != nil {
+		cfg.Certificates = []tls.Certificate{*clientCert}
+	}
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true}}
+	res, err := c.Get(url)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	b := make([]byte, 64)
+	n, _ := res.Body.Read(b)
+	return res.TLS.PeerCertificates[0].SerialNumber.Int64(), string(b[:n]), nil
+}
+
+func TestReloader_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "test CA")
+	files := Files{Cert: filepath.Join(dir, "server.pem"), Key: filepath.Join(dir, "server.key")}
+	at := time.Now().Add(-time.Minute)
+	certPEM, keyPEM := ca.issue(t, "server", 1, false)
+	writeFile(t, files.Cert, certPEM, at)
+	writeFile(t, files.Key, keyPEM, at)
+
+	r, err := New(files)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r.interval = 0
+	url := serve(t, r)
+
+	tests := []struct {
+		name string
+		// rotate writes a new certificate and, unless certOnly, its key
+		// before the request.
+		rotate   bool
+		certOnly bool
+		serial   int64
+	}{
+		{name: "initial certificate", serial: 1},
+		{name: "rotated certificate", rotate: true, serial: 2},
+		{name: "certificate without its key keeps the previous one", rotate: true, certOnly: true, serial: 2},
+	}
+	for i, test := range tests {
+		t.Log(test.name)
+		if test.rotate {
+			certPEM, keyPEM := ca.issue(t, "server", int64(i+1), false)
+			at = at.Add(time.Second)
+			writeFile(t, files.Cert, certPEM, at)
+			if !test.certOnly {
+				writeFile(t, files.Key, keyPEM, at)
+			}
+		}
+		serial, _, err := get(url, ca, nil)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		if serial != test.serial {
+			t.Errorf("serial = %d; want %d", serial, test.serial)
+		}
+	}
+}
+
+func TestReloader_ClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	ca, other := newCA(t, "test CA"), newCA(t, "other CA")
+	certPEM, keyPEM := ca.issue(t, "server", 1, false)
+	at := time.Now()
+	writeFile(t, filepath.Join(dir, "server.pem"), certPEM, at)
+	writeFile(t, filepath.Join(dir, "server.key"), keyPEM, at)
+	writeFile(t, filepath.Join(dir, "ca.pem"), ca.pem, at)
+	clientCert := func(ca *testCA) *tls.Certificate {
+		certPEM, keyPEM := ca.issue(t, "algo-1", 2, true)
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("client key pair: %v", err)
+		}
+		return &cert
+	}
+	valid, foreign := clientCert(ca), clientCert(other)
+
+	tests := []struct {
+		name       string
+		clientAuth string
+		cert       *tls.Certificate
+		want       string
+		err        bool
+	}{
+		{name: "required certificate", clientAuth: ClientAuthRequire, cert: valid, want: "algo-1"},
+		{name: "missing required certificate", clientAuth: ClientAuthRequire, err: true},
+		{name: "certificate of another CA", clientAuth: ClientAuthRequire, cert: foreign, err: true},
+		{name: "optional certificate", clientAuth: ClientAuthOptional, cert: valid, want: "algo-1"},
+		{name: "no optional certificate", clientAuth: ClientAuthOptional, want: "-"},
+		// clients only send certificates issued by a CA the server accepts
+		{name: "optional certificate of another CA", clientAuth: ClientAuthOptional, cert: foreign, want: "-"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		r, err := New(Files{
+			Cert:       filepath.Join(dir, "server.pem"),
+			Key:        filepath.Join(dir, "server.key"),
+			ClientCA:   filepath.Join(dir, "ca.pem"),
+			ClientAuth: test.clientAuth,
+		})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		url := serve(t, r)
+		_, body, err := get(url, ca, test.cert)
+		if (err != nil) != test.err {
+			t.Fatalf("GET = %v; want error %v", err, test.err)
+		}
+		if body != test.want {
+			t.Errorf("body = %q; want %q", body, test.want)
+		}
+	}
+}
+
+func TestNew_InvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "test CA")
+	certPEM, keyPEM := ca.issue(t, "server", 1, false)
+	at := time.Now()
+	writeFile(t, filepath.Join(dir, "server.pem"), certPEM, at)
+	writeFile(t, filepath.Join(dir, "server.key"), keyPEM, at)
+	writeFile(t, filepath.Join(dir, "empty.pem"), nil, at)
+
+	tests := []struct {
+		name  string
+		files Files
+	}{
+		{name: "missing key", files: Files{Cert: filepath.Join(dir, "server.pem"), Key: filepath.Join(dir, "missing.key")}},
+		{name: "key is not a key", files: Files{Cert: filepath.Join(dir, "server.pem"), Key: filepath.Join(dir, "server.pem")}},
+		{name: "empty client CA", files: Files{Cert: filepath.Join(dir, "server.pem"), Key: filepath.Join(dir, "server.key"),
+			ClientCA: filepath.Join(dir, "empty.pem")}},
+		{name: "unknown client auth", files: Files{Cert: filepath.Join(dir, "server.pem"), Key: filepath.Join(dir, "server.key"),
+			ClientCA: filepath.Join(dir, "server.pem"), ClientAuth: "sometimes"}},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		if _, err := New(test.files); err == nil {
+			t.Errorf("New accepted %+v", test.files)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetup_StdoutFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(context.Background(), Config{
+		ServiceName: "test",
+		Exporter:    ExporterStdout,
+		File:        path,
+	})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	ctx, span := Tracer().Start(context.Background(), "HandlePostTrades")
+	traceparent := Inject(ctx)
+	span.End()
+
+	if !strings.HasPrefix(traceparent, "00-"+span.SpanContext().TraceID().String()) {
+		t.Errorf("traceparent %q does not carry trace id %s", traceparent, span.SpanContext().TraceID())
+	}
+
+	remote := trace.SpanContextFromContext(Extract(context.Background(), traceparent))
+	if !remote.IsRemote() || remote.TraceID() != span.SpanContext().TraceID() || remote.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("extracted span context %+v does not match %+v", remote, span.SpanContext())
+	}
+
+	if err = shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read trace file: %v", err)
+	}
+	if !strings.Contains(string(data), `"Name":"HandlePostTrades"`) {
+		t.Errorf("span not exported: %s", data)
+	}
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: "zipkin"}); err == nil {
+		t.Error("expected error for unknown exporter")
+	}
+}
+
+func TestExtract_Empty(t *testing.T) {
+	ctx := context.Background()
+	if got := Extract(ctx, ""); got != ctx {
+		t.Error("Extract with empty traceparent must return ctx unchanged")
+	}
+}
@@ -0,0 +1,256 @@
+package validation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/calendar"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"log/slog"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Config is the rules file. Each group has its own rule set. An account uses
+// the group it has in the accounts table (Deps.Accounts) when the file
+// defines it, else the group listing it in Accounts, else the Default group.
+//
+//	{
+//	  "default": "retail",
+//	  "groups": {
+//	    "retail": {"rules": [{"rule": "max_volume", "default": 10}]},
+//	    "pro": {"accounts": ["123"], "rules": [{"rule": "duplicate", "window": "2s"}]}
+//	  }
+//	}
+type Config struct {
+	Default string                 `json:"default"`
+	Groups  map[string]GroupConfig `json:"groups"`
+}
+
+type GroupConfig struct {
+	Accounts []string     `json:"accounts"`
+	Rules    []RuleConfig `json:"rules"`
+}
+
+// RuleConfig configures one rule; Rule selects it and only the fields of that
+// rule may be set.
+type RuleConfig struct {
+	Rule string `json:"rule"`
+	// Action is "reject" (the default) or "flag", which logs violations but
+	// accepts the trade.
+	Action string `json:"action,omitempty"`
+
+	// symbol
+	Pattern string `json:"pattern,omitempty"`
+	// price_band
+	MaxDeviation float64 `json:"max_deviation,omitempty"`
+	// max_volume
+	Default float64            `json:"default,omitempty"`
+	Symbols map[string]float64 `json:"symbols,omitempty"`
+	// trading_hours
+	Timezone string   `json:"timezone,omitempty"`
+	Days     []string `json:"days,omitempty"`
+	Open     string   `json:"open,omitempty"`
+	Close    string   `json:"close,omitempty"`
+	// duplicate
+	Window string `json:"window,omitempty"`
+}
+
+// Deps are the services rules depend on.
+type Deps struct {
+	Quotes   QuoteSource
+	Calendar MarketCalendar
+	Now      func() time.Time
+	// Accounts resolves the group of accounts; nil leaves groups to the
+	// rules file.
+	Accounts AccountStore
+}
+
+func Load(path string, deps Deps) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules: %w", err)
+	}
+	e, err := Parse(data, deps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return e, nil
+}
+
+func Parse(data []byte, deps Deps) (*Engine, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("decode rules: %w", err)
+	}
+	return cfg.Build(deps)
+}
+
+// Build validates cfg and creates the rules.
+func (cfg Config) Build(deps Deps) (*Engine, error) {
+	if deps.Now == nil {
+		deps.Now = time.Now
+	}
+	if _, ok := cfg.Groups[cfg.Default]; cfg.Default != "" && !ok {
+		return nil, fmt.Errorf("default group %q is not defined", cfg.Default)
+	}
+
+	groups := make(map[string]RuleSet, len(cfg.Groups))
+	accounts := make(map[string]string)
+	for name, group := range cfg.Groups {
+		for _, account := range group.Accounts {
+			if other, ok := accounts[account]; ok {
+				return nil, fmt.Errorf("account %s is in groups %s and %s", account, other, name)
+			}
+			accounts[account] = name
+		}
+		rules := make(RuleSet, 0, len(group.Rules))
+		for i, rc := range group.Rules {
+			rule, err := rc.build(deps)
+			if err != nil {
+				return nil, fmt.Errorf("group %s: rules[%d]: %w", name, i, err)
+			}
+			switch rc.Action {
+			case "", ActionReject:
+			case ActionFlag:
+				rule = &flagRule{Rule: rule}
+			default:
+				return nil, fmt.Errorf("group %s: rules[%d]: invalid action %q", name, i, rc.Action)
+			}
+			rules = append(rules, rule)
+		}
+		groups[name] = rules
+	}
+	e := NewEngine(groups, accounts, cfg.Default)
+	e.store = deps.Accounts
+	return e, nil
+}
+
+func (rc RuleConfig) build(deps Deps) (Rule, error) {
+	switch rc.Rule {
+	case RuleSymbol:
+		re, err := regexp.Compile(rc.Pattern)
+		if err != nil || rc.Pattern == "" {
+			return nil, fmt.Errorf("invalid pattern %q", rc.Pattern)
+		}
+		return &SymbolRule{Pattern: re}, nil
+
+	case RulePriceBand:
+		if rc.MaxDeviation <= 0 {
+			return nil, errors.New("max_deviation must be greater than 0")
+		}
+		if deps.Quotes == nil {
+			return nil, errors.New("no quote source available")
+		}
+		return &PriceBandRule{MaxDeviation: rc.MaxDeviation, Quotes: deps.Quotes}, nil
+
+	case RuleMaxVolume:
+		if rc.Default < 0 {
+			return nil, errors.New("default must not be negative")
+		}
+		for symbol, limit := range rc.Symbols {
+			if limit <= 0 {
+				return nil, fmt.Errorf("symbols[%s] must be greater than 0", symbol)
+			}
+		}
+		return &MaxVolumeRule{Default: rc.Default, Symbols: rc.Symbols}, nil
+
+	case RuleTradingHours:
+		return rc.buildTradingHours(deps)
+
+	case RuleMarketHours:
+		if deps.Calendar == nil {
+			return nil, errors.New("no trading calendar configured")
+		}
+		return &MarketHoursRule{Calendar: deps.Calendar, Now: deps.Now}, nil
+
+	case RuleDuplicate:
+		window, err := time.ParseDuration(rc.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid window %q", rc.Window)
+		}
+		return &DuplicateRule{Window: window, Now: deps.Now}, nil
+	}
+	return nil, fmt.Errorf("unknown rule %q", rc.Rule)
+}
+
+// buildTradingHours builds a calendar of one market open from Open to Close
+// on Days. A Close before Open spans midnight, and Days then refers to the
+// day the session opened.
+func (rc RuleConfig) buildTradingHours(deps Deps) (Rule, error) {
+	loc, err := time.LoadLocation(rc.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", rc.Timezone)
+	}
+	if len(rc.Days) == 0 {
+		return nil, errors.New("days are required")
+	}
+	days := make([]time.Weekday, 0, len(rc.Days))
+	for _, day := range rc.Days {
+		wd, err := calendar.ParseWeekday(day)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, wd)
+	}
+	open, err := calendar.ParseClock(rc.Open)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	closing, err := calendar.ParseClock(rc.Close)
+	if err != nil {
+		return nil, fmt.Errorf("close: %w", err)
+	}
+	if open == closing {
+		return nil, errors.New("open and close must differ")
+	}
+
+	market := &calendar.Market{Name: RuleTradingHours, Location: loc}
+	if open < closing {
+		market.Sessions = []calendar.Session{{Days: days, Open: open, Close: closing}}
+	} else {
+		// calendar sessions end by midnight
+		next := make([]time.Weekday, len(days))
+		for i, day := range days {
+			next[i] = (day + 1) % 7
+		}
+		market.Sessions = []calendar.Session{{Days: days, Open: open, Close: 24 * time.Hour}}
+		if closing > 0 {
+			market.Sessions = append(market.Sessions, calendar.Session{Days: next, Close: closing})
+		}
+	}
+	cal := calendar.New([]*calendar.Market{market}, nil, market.Name)
+	return &MarketHoursRule{Calendar: cal, Now: deps.Now, name: RuleTradingHours}, nil
+}
+
+const (
+	ActionReject = "reject"
+	ActionFlag   = "flag"
+)
+
+// flagRule reports violations of Rule in the log instead of rejecting the
+// trade.
+type flagRule struct {
+	Rule
+}
+
+func (r *flagRule) Check(ctx context.Context, t *model.Trade) (*problem.FieldError, error) {
+	fe, err := r.Rule.Check(ctx, t)
+	if fe != nil {
+		slog.WarnContext(ctx, "trade flagged", "rule", fe.Rule, "account", t.Account, "field", fe.Field, "message", fe.Message)
+	}
+	return nil, err
+}
+
+// Record lets a flagged DuplicateRule still remember trades.
+func (r *flagRule) Record(t *model.Trade) {
+	if rec, ok := r.Rule.(Recorder); ok {
+		rec.Record(t)
+	}
+}
@@ -0,0 +1,141 @@
+package validation
+
+import (
+	"context"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRules = `{
+  "default": "retail",
+  "groups": {
+    "retail": {
+      "rules": [
+        {"rule": "symbol", "pattern": "^(EUR|GBP)[A-Z]{3}$"},
+        {"rule": "max_volume", "default": 10, "symbols": {"GBPJPY": 1}},
+        {"rule": "price_band", "max_deviation": 0.1}
+      ]
+    },
+    "pro": {
+      "accounts": ["777"],
+      "rules": [
+        {"rule": "trading_hours", "timezone": "Europe/London", "days": ["mon", "tue", "wed", "thu", "fri"], "open": "00:00", "close": "24:00"},
+        {"rule": "duplicate", "window": "2s"},
+        {"rule": "max_volume", "default": 1, "action": "flag"}
+      ]
+    }
+  }
+}`
+
+// accountGroups maps accounts to their group in the accounts table.
+type accountGroups map[string]string
+
+func (g accountGroups) GetTradingAccount(_ context.Context, id string) (*model.TradingAccount, error) {
+	group, ok := g[id]
+	if !ok {
+		return nil, nil
+	}
+	return &model.TradingAccount{Id: id, Group: group}, nil
+}
+
+func TestEngine_AccountGroups(t *testing.T) {
+	e, err := Parse([]byte(testRules), Deps{Quotes: quotes{}, Accounts: accountGroups{"123": "pro", "777": "retail", "456": "ib1"}})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		account string
+		group   string
+	}{
+		{name: "group of the account", account: "123", group: "pro"},
+		{name: "group of the account over the file", account: "777", group: "retail"},
+		{name: "group without rules", account: "456", group: "retail"},
+		{name: "unknown account", account: "999", group: "retail"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		group, err := e.Group(context.Background(), test.account)
+		if err != nil {
+			t.Fatalf("group: %v", err)
+		}
+		if group != test.group {
+			t.Errorf("group of %s = %q; want %q", test.account, group, test.group)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC) // Saturday
+	e, err := Parse([]byte(testRules), Deps{Quotes: quotes{"EURUSD": 1.1}, Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if g, _ := e.Group(context.Background(), "123"); g != "retail" {
+		t.Errorf("group of 123 = %q; want retail", g)
+	}
+	if g, _ := e.Group(context.Background(), "777"); g != "pro" {
+		t.Errorf("group of 777 = %q; want pro", g)
+	}
+
+	tr := trade()
+	tr.Symbol, tr.Volume, tr.Close = "USDJPY", 20, 2
+	violations, err := e.Check(context.Background(), tr)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	var rules []string
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	if got := strings.Join(rules, ","); got != "symbol,max_volume" {
+		t.Errorf("retail violations = %s; want symbol,max_volume", got)
+	}
+
+	tr = trade()
+	tr.Account = "777"
+	tr.Volume = 5
+	violations, err = e.Check(context.Background(), tr)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Rule != RuleTradingHours {
+		t.Errorf("pro violations = %+v; want trading_hours", violations)
+	}
+
+	var none *Engine
+	if v, err := none.Check(context.Background(), tr); v != nil || err != nil {
+		t.Errorf("nil engine = %v, %v", v, err)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		err   string
+	}{
+		{name: "unknown rule", rules: `{"groups":{"a":{"rules":[{"rule":"magic"}]}}}`, err: `unknown rule "magic"`},
+		{name: "unknown field", rules: `{"groups":{"a":{"rules":[{"rule":"symbol","patern":"x"}]}}}`, err: "unknown field"},
+		{name: "missing default group", rules: `{"default":"b","groups":{"a":{}}}`, err: `default group "b"`},
+		{name: "account in two groups", rules: `{"groups":{"a":{"accounts":["1"]},"b":{"accounts":["1"]}}}`, err: "account 1 is in groups"},
+		{name: "bad pattern", rules: `{"groups":{"a":{"rules":[{"rule":"symbol","pattern":"("}]}}}`, err: "invalid pattern"},
+		{name: "bad deviation", rules: `{"groups":{"a":{"rules":[{"rule":"price_band"}]}}}`, err: "max_deviation"},
+		{name: "bad timezone", rules: `{"groups":{"a":{"rules":[{"rule":"trading_hours","timezone":"Mars/Base","days":["mon"],"open":"09:00","close":"17:00"}]}}}`, err: "invalid timezone"},
+		{name: "bad day", rules: `{"groups":{"a":{"rules":[{"rule":"trading_hours","timezone":"UTC","days":["funday"],"open":"09:00","close":"17:00"}]}}}`, err: "invalid day"},
+		{name: "bad clock", rules: `{"groups":{"a":{"rules":[{"rule":"trading_hours","timezone":"UTC","days":["mon"],"open":"9am","close":"17:00"}]}}}`, err: "open: invalid time"},
+		{name: "bad action", rules: `{"groups":{"a":{"rules":[{"rule":"max_volume","action":"warn"}]}}}`, err: `invalid action "warn"`},
+		{name: "market hours without calendar", rules: `{"groups":{"a":{"rules":[{"rule":"market_hours"}]}}}`, err: "no trading calendar"},
+		{name: "bad window", rules: `{"groups":{"a":{"rules":[{"rule":"duplicate","window":"0s"}]}}}`, err: "invalid window"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		_, err := Parse([]byte(test.rules), Deps{Quotes: quotes{}})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Parse = %v; want error containing %q", err, test.err)
+		}
+	}
+}
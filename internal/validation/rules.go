@@ -0,0 +1,237 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/calendar"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"math"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rule names, as used in the rules file and in the rule of field errors.
+const (
+	RuleSymbol       = "symbol"
+	RulePriceBand    = "price_band"
+	RuleMaxVolume    = "max_volume"
+	RuleTradingHours = "trading_hours"
+	RuleDuplicate    = "duplicate"
+	RuleMarketHours  = "market_hours"
+)
+
+// SymbolRule restricts symbols to Pattern, e.g. to the instruments a group
+// may trade.
+type SymbolRule struct {
+	Pattern *regexp.Regexp
+}
+
+func (r *SymbolRule) Name() string { return RuleSymbol }
+
+func (r *SymbolRule) Check(_ context.Context, t *model.Trade) (*problem.FieldError, error) {
+	if r.Pattern.MatchString(t.Symbol) {
+		return nil, nil
+	}
+	return &problem.FieldError{
+		Field:   "symbol",
+		Rule:    RuleSymbol,
+		Message: fmt.Sprintf("symbol must match %s", r.Pattern),
+		Value:   t.Symbol,
+	}, nil
+}
+
+// QuoteSource reports the last known price of a symbol, leaving out the
+// trade with id except, so that an amended trade is not checked against its
+// own price. ok is false when there is none.
+type QuoteSource interface {
+	LastQuote(ctx context.Context, symbol string, except int) (price float64, ok bool, err error)
+}
+
+// PriceBandRule rejects open and close prices deviating from the last quote
+// of the symbol by more than MaxDeviation, a fraction of the quote. Symbols
+// without a quote are not checked.
+type PriceBandRule struct {
+	MaxDeviation float64
+	Quotes       QuoteSource
+}
+
+func (r *PriceBandRule) Name() string { return RulePriceBand }
+
+func (r *PriceBandRule) Check(ctx context.Context, t *model.Trade) (*problem.FieldError, error) {
+	quote, ok, err := r.Quotes.LastQuote(ctx, t.Symbol, t.Id)
+	if err != nil || !ok || quote <= 0 {
+		return nil, err
+	}
+	for _, p := range []struct {
+		field string
+		price float64
+	}{{"open", t.Open}, {"close", t.Close}} {
+		if math.Abs(p.price-quote)/quote > r.MaxDeviation {
+			return &problem.FieldError{
+				Field: p.field,
+				Rule:  RulePriceBand,
+				Message: fmt.Sprintf("%s deviates more than %s%% from the last quote %s",
+					p.field, strconv.FormatFloat(r.MaxDeviation*100, 'f', -1, 64), strconv.FormatFloat(quote, 'f', -1, 64)),
+				Value: p.price,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// MaxVolumeRule caps the volume of a single trade. Symbols maps instruments to
+// their own cap; other symbols use Default, where 0 means unlimited.
+type MaxVolumeRule struct {
+	Default float64
+	Symbols map[string]float64
+}
+
+func (r *MaxVolumeRule) Name() string { return RuleMaxVolume }
+
+func (r *MaxVolumeRule) Check(_ context.Context, t *model.Trade) (*problem.FieldError, error) {
+	limit, ok := r.Symbols[t.Symbol]
+	if !ok {
+		limit = r.Default
+	}
+	if limit == 0 || t.Volume <= limit {
+		return nil, nil
+	}
+	return &problem.FieldError{
+		Field:   "volume",
+		Rule:    RuleMaxVolume,
+		Message: fmt.Sprintf("volume must be at most %s for %s", strconv.FormatFloat(limit, 'f', -1, 64), t.Symbol),
+		Value:   t.Volume,
+	}, nil
+}
+
+// MarketCalendar reports whether a symbol is tradable at a given time.
+type MarketCalendar interface {
+	IsOpen(symbol string, at time.Time) (bool, error)
+}
+
+// MarketHoursRule rejects trades for symbols whose market is closed, by the
+// sessions and holidays of the trading calendar. The trading_hours rule is a
+// MarketHoursRule over a calendar of one market, named after the rule.
+type MarketHoursRule struct {
+	Calendar MarketCalendar
+	Now      func() time.Time
+	// name is the rule violations are reported with, market_hours if empty.
+	name string
+}
+
+func (r *MarketHoursRule) Name() string {
+	if r.name != "" {
+		return r.name
+	}
+	return RuleMarketHours
+}
+
+// Check checks the market at the open_time and close_time of the trade. A
+// trade without them is checked at the time it was received, e.g. when it is
+// amended, or at the current time while it is being submitted.
+func (r *MarketHoursRule) Check(_ context.Context, t *model.Trade) (*problem.FieldError, error) {
+	type when struct {
+		field string
+		at    time.Time
+	}
+	var times []when
+	if t.OpenTime != nil {
+		times = append(times, when{"open_time", *t.OpenTime})
+	}
+	if t.CloseTime != nil {
+		times = append(times, when{"close_time", *t.CloseTime})
+	}
+	if len(times) == 0 && !t.ReceivedAt.IsZero() {
+		times = append(times, when{"symbol", t.ReceivedAt})
+	}
+	if len(times) == 0 {
+		times = append(times, when{"symbol", r.Now()})
+	}
+
+	for _, w := range times {
+		open, err := r.Calendar.IsOpen(t.Symbol, w.at)
+		if errors.Is(err, calendar.ErrUnknownSymbol) {
+			return &problem.FieldError{
+				Field:   "symbol",
+				Rule:    r.Name(),
+				Message: "symbol " + t.Symbol + " is not traded on any market",
+				Value:   t.Symbol,
+			}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if open {
+			continue
+		}
+		fe := &problem.FieldError{
+			Field:   w.field,
+			Rule:    r.Name(),
+			Message: fmt.Sprintf("market of %s is closed at %s", t.Symbol, w.at.UTC().Format(time.RFC3339)),
+			Value:   t.Symbol,
+		}
+		if w.field != "symbol" {
+			fe.Value = w.at
+		}
+		return fe, nil
+	}
+	return nil, nil
+}
+
+// DuplicateRule rejects a trade identical to one submitted by the same account
+// within Window. Trades are remembered in memory once Record reports them
+// stored, so a retry of a failed or rejected submission is accepted and the
+// check only covers the current server process.
+type DuplicateRule struct {
+	Window time.Duration
+	Now    func() time.Time
+
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	swept time.Time
+}
+
+func (r *DuplicateRule) Name() string { return RuleDuplicate }
+
+func (r *DuplicateRule) Check(_ context.Context, t *model.Trade) (*problem.FieldError, error) {
+	key := duplicateKey(t)
+	now := r.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if at, ok := r.seen[key]; ok && now.Sub(at) <= r.Window {
+		return &problem.FieldError{
+			Rule:    RuleDuplicate,
+			Message: fmt.Sprintf("identical trade submitted %s ago", now.Sub(at).Round(time.Millisecond)),
+		}, nil
+	}
+	return nil, nil
+}
+
+// Record remembers t, which was stored.
+func (r *DuplicateRule) Record(t *model.Trade) {
+	now := r.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen == nil {
+		r.seen = make(map[string]time.Time)
+	}
+	if now.Sub(r.swept) > r.Window {
+		for k, at := range r.seen {
+			if now.Sub(at) > r.Window {
+				delete(r.seen, k)
+			}
+		}
+		r.swept = now
+	}
+	r.seen[duplicateKey(t)] = now
+}
+
+func duplicateKey(t *model.Trade) string {
+	return fmt.Sprintf("%s|%s|%s|%v|%v|%v", t.Account, t.Symbol, t.Side, t.Volume, t.Open, t.Close)
+}
@@ -0,0 +1,316 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gitlab.com/digineat/go-broker-test/internal/calendar"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+func trade() *model.Trade {
+	return &model.Trade{Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: "buy"}
+}
+
+func TestStruct_Symbol(t *testing.T) {
+	tests := []struct {
+		symbol string
+		valid  bool
+	}{
+		{symbol: "EURUSD", valid: true},
+		{symbol: "eurusd", valid: false},
+		{symbol: "EurUsd", valid: false},
+		{symbol: "EURUS", valid: false},
+		{symbol: "EURUSD1", valid: false},
+		{symbol: "", valid: false},
+	}
+	for _, test := range tests {
+		t.Log(test.symbol)
+		tr := trade()
+		tr.Symbol = test.symbol
+		if err := Struct(tr); (err == nil) != test.valid {
+			t.Errorf("Struct(%q) = %v; want valid %v", test.symbol, err, test.valid)
+		}
+	}
+}
+
+func TestSymbolRule(t *testing.T) {
+	rule := &SymbolRule{Pattern: regexp.MustCompile(`^(EUR|GBP)[A-Z]{3}$`)}
+
+	tr := trade()
+	if fe, _ := rule.Check(context.Background(), tr); fe != nil {
+		t.Errorf("EURUSD rejected: %+v", fe)
+	}
+	tr.Symbol = "USDJPY"
+	fe, _ := rule.Check(context.Background(), tr)
+	if fe == nil || fe.Field != "symbol" || fe.Rule != RuleSymbol || fe.Value != "USDJPY" {
+		t.Errorf("USDJPY: got %+v", fe)
+	}
+}
+
+type quotes map[string]float64
+
+func (q quotes) LastQuote(_ context.Context, symbol string, _ int) (float64, bool, error) {
+	if symbol == "BROKEN" {
+		return 0, false, errors.New("quote source down")
+	}
+	price, ok := q[symbol]
+	return price, ok, nil
+}
+
+func TestPriceBandRule(t *testing.T) {
+	rule := &PriceBandRule{MaxDeviation: 0.05, Quotes: quotes{"EURUSD": 1.1}}
+
+	tests := []struct {
+		name   string
+		symbol string
+		open   float64
+		close  float64
+		field  string
+	}{
+		{name: "within band", symbol: "EURUSD", open: 1.1, close: 1.15},
+		{name: "close above band", symbol: "EURUSD", open: 1.1, close: 1.2, field: "close"},
+		{name: "open below band", symbol: "EURUSD", open: 1.0, close: 1.1, field: "open"},
+		{name: "no quote", symbol: "GBPUSD", open: 100, close: 200},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		tr := trade()
+		tr.Symbol, tr.Open, tr.Close = test.symbol, test.open, test.close
+		fe, err := rule.Check(context.Background(), tr)
+		if err != nil {
+			t.Fatalf("check: %v", err)
+		}
+		switch {
+		case fe == nil && test.field != "":
+			t.Errorf("no violation; want field %q", test.field)
+		case fe != nil && (fe.Field != test.field || fe.Rule != RulePriceBand):
+			t.Errorf("got %+v; want field %q", fe, test.field)
+		}
+	}
+
+	tr := trade()
+	tr.Symbol = "BROKEN"
+	if _, err := rule.Check(context.Background(), tr); err == nil {
+		t.Error("quote source error was swallowed")
+	}
+}
+
+func TestMaxVolumeRule(t *testing.T) {
+	rule := &MaxVolumeRule{Default: 10, Symbols: map[string]float64{"XAUUSD": 2}}
+
+	tests := []struct {
+		symbol string
+		volume float64
+		valid  bool
+	}{
+		{symbol: "EURUSD", volume: 10, valid: true},
+		{symbol: "EURUSD", volume: 10.5, valid: false},
+		{symbol: "XAUUSD", volume: 2, valid: true},
+		{symbol: "XAUUSD", volume: 3, valid: false},
+	}
+	for _, test := range tests {
+		t.Log(test.symbol, test.volume)
+		tr := trade()
+		tr.Symbol, tr.Volume = test.symbol, test.volume
+		fe, _ := rule.Check(context.Background(), tr)
+		if (fe == nil) != test.valid {
+			t.Errorf("got %+v; want valid %v", fe, test.valid)
+		}
+		if fe != nil && (fe.Field != "volume" || fe.Value != test.volume) {
+			t.Errorf("got %+v", fe)
+		}
+	}
+
+	unlimited := &MaxVolumeRule{}
+	tr := trade()
+	tr.Volume = 1e9
+	if fe, _ := unlimited.Check(context.Background(), tr); fe != nil {
+		t.Errorf("default 0 must not limit: %+v", fe)
+	}
+}
+
+func TestTradingHoursRule(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	build := func(rc RuleConfig) Rule {
+		rc.Rule, rc.Timezone = RuleTradingHours, "America/New_York"
+		rule, err := rc.build(Deps{})
+		if err != nil {
+			t.Fatalf("build %+v: %v", rc, err)
+		}
+		return rule
+	}
+	day := build(RuleConfig{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Open: "09:30", Close: "16:00"})
+	// Sessions from 17:00 to 16:59 the next day, Sunday to Friday, as an FX week.
+	overnight := build(RuleConfig{Days: []string{"sun", "mon", "tue", "wed", "thu"}, Open: "17:00", Close: "16:59"})
+
+	tests := []struct {
+		name string
+		rule Rule
+		at   time.Time
+		open bool
+	}{
+		{name: "before open", rule: day, at: time.Date(2024, 3, 8, 9, 29, 0, 0, ny), open: false},
+		{name: "at open", rule: day, at: time.Date(2024, 3, 8, 9, 30, 0, 0, ny), open: true},
+		{name: "at close", rule: day, at: time.Date(2024, 3, 8, 16, 0, 0, 0, ny), open: false},
+		{name: "saturday", rule: day, at: time.Date(2024, 3, 9, 12, 0, 0, 0, ny), open: false},
+		// 2024-03-10 is the US spring forward; 09:30 local on Monday is 13:30 UTC.
+		{name: "after DST change", rule: day, at: time.Date(2024, 3, 11, 13, 30, 0, 0, time.UTC), open: true},
+		{name: "before DST change", rule: day, at: time.Date(2024, 3, 8, 13, 30, 0, 0, time.UTC), open: false},
+		{name: "sunday evening", rule: overnight, at: time.Date(2024, 3, 10, 18, 0, 0, 0, ny), open: true},
+		{name: "sunday afternoon", rule: overnight, at: time.Date(2024, 3, 10, 12, 0, 0, 0, ny), open: false},
+		{name: "friday morning", rule: overnight, at: time.Date(2024, 3, 15, 10, 0, 0, 0, ny), open: true},
+		{name: "friday evening", rule: overnight, at: time.Date(2024, 3, 15, 18, 0, 0, 0, ny), open: false},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		test.rule.(*MarketHoursRule).Now = func() time.Time { return test.at }
+		fe, err := test.rule.Check(context.Background(), trade())
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if (fe == nil) != test.open || (fe != nil && fe.Rule != RuleTradingHours) {
+			t.Errorf("Check at %s = %+v; want open %v", test.at, fe, test.open)
+		}
+	}
+}
+
+func TestDuplicateRule(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rule := &DuplicateRule{Window: 5 * time.Second, Now: func() time.Time { return now }}
+	engine := NewEngine(map[string]RuleSet{"default": {rule}}, nil, "default")
+	other := trade()
+	other.Close = 1.2
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		trade   *model.Trade
+		// stored records the trade as submitTrade does once it is stored.
+		stored   bool
+		accepted bool
+	}{
+		{name: "first submission fails to be stored", trade: trade(), accepted: true},
+		{name: "retry after the failure", advance: time.Second, trade: trade(), stored: true, accepted: true},
+		{name: "duplicate within window", advance: time.Second, trade: trade()},
+		{name: "different trade", trade: other, accepted: true},
+		{name: "submission after window", advance: 6 * time.Second, trade: trade(), accepted: true},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		now = now.Add(test.advance)
+		violations, err := engine.Check(context.Background(), test.trade)
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if (len(violations) == 0) != test.accepted {
+			t.Errorf("violations = %+v; want accepted %v", violations, test.accepted)
+		}
+		if test.stored {
+			engine.Record(context.Background(), test.trade)
+		}
+	}
+}
+
+type calendarFunc func(symbol string, at time.Time) (bool, error)
+
+func (f calendarFunc) IsOpen(symbol string, at time.Time) (bool, error) { return f(symbol, at) }
+
+func TestMarketHoursRule(t *testing.T) {
+	weekend := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	cal := calendarFunc(func(symbol string, at time.Time) (bool, error) {
+		switch symbol {
+		case "XXXYYY":
+			return false, fmt.Errorf("%w: %s", calendar.ErrUnknownSymbol, symbol)
+		case "BROKEN":
+			return false, errors.New("calendar unavailable")
+		}
+		return at.Weekday() != time.Saturday, nil
+	})
+
+	friday := weekend.AddDate(0, 0, -1)
+	at := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name   string
+		symbol string
+		now    time.Time
+		// openTime, closeTime and receivedAt are the times of the trade, if any.
+		openTime, closeTime *time.Time
+		receivedAt          time.Time
+		field, message      string
+		err                 bool
+	}{
+		{name: "open", symbol: "EURUSD", now: friday},
+		{name: "closed", symbol: "EURUSD", now: weekend, field: "symbol", message: "market of EURUSD is closed at 2024-03-09T12:00:00Z"},
+		{name: "unknown symbol", symbol: "XXXYYY", now: weekend, field: "symbol", message: "symbol XXXYYY is not traded on any market"},
+		{name: "calendar error", symbol: "BROKEN", now: weekend, err: true},
+		{name: "traded while open, checked on the weekend", symbol: "EURUSD", now: weekend,
+			openTime: at(friday), closeTime: at(friday.Add(time.Hour))},
+		{name: "opened on the weekend", symbol: "EURUSD", now: friday, openTime: at(weekend),
+			field: "open_time", message: "market of EURUSD is closed at 2024-03-09T12:00:00Z"},
+		{name: "closed on the weekend", symbol: "EURUSD", now: friday, openTime: at(friday), closeTime: at(weekend.Add(time.Hour)),
+			field: "close_time", message: "market of EURUSD is closed at 2024-03-09T13:00:00Z"},
+		{name: "received while open, checked on the weekend", symbol: "EURUSD", now: weekend, receivedAt: friday},
+		{name: "received on the weekend", symbol: "EURUSD", now: friday, receivedAt: weekend,
+			field: "symbol", message: "market of EURUSD is closed at 2024-03-09T12:00:00Z"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		rule := &MarketHoursRule{Calendar: cal, Now: func() time.Time { return test.now }}
+		tr := trade()
+		tr.Symbol, tr.OpenTime, tr.CloseTime, tr.ReceivedAt = test.symbol, test.openTime, test.closeTime, test.receivedAt
+		fe, err := rule.Check(context.Background(), tr)
+		if (err != nil) != test.err {
+			t.Fatalf("err = %v; want error %v", err, test.err)
+		}
+		switch {
+		case test.message == "" && fe != nil:
+			t.Errorf("unexpected violation %+v", fe)
+		case test.message != "" && (fe == nil || fe.Message != test.message || fe.Field != test.field || fe.Rule != RuleMarketHours):
+			t.Errorf("got %+v; want %s: %q", fe, test.field, test.message)
+		}
+	}
+}
+
+func TestTimes(t *testing.T) {
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		v := now.Add(d)
+		return &v
+	}
+	tests := []struct {
+		name      string
+		openTime  *time.Time
+		closeTime *time.Time
+		rules     []string
+	}{
+		{name: "no timestamps"},
+		{name: "past", openTime: at(-time.Hour), closeTime: at(-time.Minute)},
+		{name: "equal", openTime: at(-time.Hour), closeTime: at(-time.Hour)},
+		{name: "within skew", openTime: at(time.Second), closeTime: at(2 * time.Second)},
+		{name: "open in future", openTime: at(time.Minute), rules: []string{RuleNotFuture}},
+		{name: "close before open", openTime: at(-time.Minute), closeTime: at(-time.Hour), rules: []string{RuleAfterOpen}},
+		{name: "both in future", openTime: at(time.Hour), closeTime: at(time.Minute),
+			rules: []string{RuleNotFuture, RuleNotFuture, RuleAfterOpen}},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		tr := trade()
+		tr.OpenTime, tr.CloseTime = test.openTime, test.closeTime
+		var rules []string
+		for _, fe := range Times(tr, now, 5*time.Second) {
+			rules = append(rules, fe.Rule)
+		}
+		if !slices.Equal(rules, test.rules) {
+			t.Errorf("rules = %v; want %v", rules, test.rules)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/problem"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// SymbolPattern is the documented format of trade symbols.
+var SymbolPattern = regexp.MustCompile(`^[A-Z]{6}$`)
+
+// validate is built once: validator.New is expensive and caches struct
+// metadata, so it must not be constructed per request.
+var validate = sync.OnceValue(func() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(problem.JSONFieldName)
+	if err := v.RegisterValidation("symbol", func(fl validator.FieldLevel) bool {
+		return SymbolPattern.MatchString(fl.Field().String())
+	}); err != nil {
+		panic(err)
+	}
+	return v
+})
+
+// Struct checks the validate tags of v. Failures are
+// validator.ValidationErrors, reported by JSON field name.
+func Struct(v any) error {
+	return validate().Struct(v)
+}
+
+// Rules of the field errors reported by Times.
+const (
+	RuleNotFuture = "not_future"
+	RuleAfterOpen = "after_open"
+)
+
+// Times checks the client supplied timestamps of t: neither may be later
+// than now plus skew, the clock difference tolerated between client and
+// server, and close_time must not be before open_time.
+func Times(t *model.Trade, now time.Time, skew time.Duration) []problem.FieldError {
+	var errs []problem.FieldError
+	limit := now.Add(skew)
+	for _, f := range []struct {
+		field string
+		at    *time.Time
+	}{{"open_time", t.OpenTime}, {"close_time", t.CloseTime}} {
+		if f.at != nil && f.at.After(limit) {
+			errs = append(errs, problem.FieldError{
+				Field:   f.field,
+				Rule:    RuleNotFuture,
+				Message: fmt.Sprintf("%s must not be in the future (server time %s)", f.field, now.UTC().Format(time.RFC3339Nano)),
+				Value:   f.at.Format(time.RFC3339Nano),
+			})
+		}
+	}
+	if t.OpenTime != nil && t.CloseTime != nil && t.CloseTime.Before(*t.OpenTime) {
+		errs = append(errs, problem.FieldError{
+			Field:   "close_time",
+			Rule:    RuleAfterOpen,
+			Message: "close_time must not be before open_time",
+			Value:   t.CloseTime.Format(time.RFC3339Nano),
+		})
+	}
+	return errs
+}
+
+// Rules of the field errors reported by Account.
+const (
+	RuleAccountExists = "account_exists"
+	RuleAccountActive = "account_active"
+)
+
+// AccountStore finds trading accounts; *db.Manager implements it.
+type AccountStore interface {
+	GetTradingAccount(ctx context.Context, id string) (*model.TradingAccount, error)
+}
+
+// Account checks that trades may be booked on account: it must be active,
+// and exist unless autoCreate accepts unknown accounts, which are created
+// with their first trade. missing reports such an unknown account.
+func Account(ctx context.Context, accounts AccountStore, account string, autoCreate bool) (missing bool, fe *problem.FieldError, err error) {
+	a, err := accounts.GetTradingAccount(ctx, account)
+	if err != nil {
+		return false, nil, err
+	}
+	switch {
+	case a == nil && autoCreate:
+		return true, nil, nil
+	case a == nil:
+		fe = &problem.FieldError{Rule: RuleAccountExists, Message: "account " + account + " does not exist"}
+	case a.Status != model.AccountStatusActive:
+		fe = &problem.FieldError{Rule: RuleAccountActive, Message: "account " + account + " is " + a.Status}
+	default:
+		return false, nil, nil
+	}
+	fe.Field, fe.Value = "account", account
+	return false, fe, nil
+}
+
+// Rule is a business check applied to a trade after its fields are valid.
+// Check returns a field error when the trade breaks the rule; err is reserved
+// for failures of the rule itself, such as an unavailable quote source.
+type Rule interface {
+	Name() string
+	Check(ctx context.Context, t *model.Trade) (*problem.FieldError, error)
+}
+
+// Recorder is a rule that remembers stored trades, such as DuplicateRule.
+type Recorder interface {
+	Record(t *model.Trade)
+}
+
+// RuleSet is an ordered list of rules. All rules are checked so that every
+// violation is reported at once.
+type RuleSet []Rule
+
+func (rs RuleSet) Check(ctx context.Context, t *model.Trade) ([]problem.FieldError, error) {
+	var violations []problem.FieldError
+	for _, rule := range rs {
+		fe, err := rule.Check(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		if fe != nil {
+			violations = append(violations, *fe)
+		}
+	}
+	return violations, nil
+}
+
+// Engine selects the rule set of a trade by the group of its account. It is
+// immutable; load a new one to change the rules.
+type Engine struct {
+	groups   map[string]RuleSet
+	accounts map[string]string
+	fallback string
+	// store holds the group of each account; nil leaves groups to accounts.
+	store AccountStore
+}
+
+// NewEngine returns an engine using groups, where accounts maps an account to
+// its group. Accounts without a group use the fallback group, if any.
+func NewEngine(groups map[string]RuleSet, accounts map[string]string, fallback string) *Engine {
+	return &Engine{groups: groups, accounts: accounts, fallback: fallback}
+}
+
+// Group returns the name of the group account belongs to: its group in the
+// store when the engine has rules for that group, else the group listing it
+// in accounts, else the fallback group. Groups of the store without rules,
+// such as the IBs of the group tree, leave the choice to the rules file.
+func (e *Engine) Group(ctx context.Context, account string) (string, error) {
+	if e.store != nil {
+		a, err := e.store.GetTradingAccount(ctx, account)
+		if err != nil {
+			return "", fmt.Errorf("get account %s: %w", account, err)
+		}
+		if a != nil {
+			if _, ok := e.groups[a.Group]; ok {
+				return a.Group, nil
+			}
+		}
+	}
+	if group, ok := e.accounts[account]; ok {
+		return group, nil
+	}
+	return e.fallback, nil
+}
+
+func (e *Engine) Rules(ctx context.Context, account string) (RuleSet, error) {
+	group, err := e.Group(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	return e.groups[group], nil
+}
+
+// Check applies the rules of the trade's account group. A nil engine has no
+// rules.
+func (e *Engine) Check(ctx context.Context, t *model.Trade) ([]problem.FieldError, error) {
+	if e == nil {
+		return nil, nil
+	}
+	rules, err := e.Rules(ctx, t.Account)
+	if err != nil {
+		return nil, err
+	}
+	return rules.Check(ctx, t)
+}
+
+// Record reports t, which passed Check, as stored to the rules of its
+// account group that remember trades. A nil engine has no rules.
+func (e *Engine) Record(ctx context.Context, t *model.Trade) {
+	if e == nil {
+		return
+	}
+	rules, err := e.Rules(ctx, t.Account)
+	if err != nil {
+		slog.WarnContext(ctx, "can not record trade for rules", "account", t.Account, "error", err)
+		return
+	}
+	for _, rule := range rules {
+		if r, ok := rule.(Recorder); ok {
+			r.Record(t)
+		}
+	}
+}
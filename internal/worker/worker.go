@@ -0,0 +1,140 @@
+// Package worker applies queued trades to the accounts. The worker command
+// runs it in a loop; tests drive it directly to process trades the same way.
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gitlab.com/digineat/go-broker-test/internal/audit"
+	"gitlab.com/digineat/go-broker-test/internal/calendar"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/logging"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"gitlab.com/digineat/go-broker-test/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+)
+
+// Hook takes part in processing a trade, in the transaction that applies it
+// to its account; an error rolls the processing back.
+type Hook func(ctx context.Context, tx *sql.Tx, trade *model.Trade) error
+
+// Rollovers returns a hook that records the number of swap rollovers of cal
+// the trade was held over, from its open_time to its close_time. Trades
+// without both times, or for symbols cal has no market for, have none.
+func Rollovers(dbManager *dbmanager.Manager, cal *calendar.Calendar) Hook {
+	return func(ctx context.Context, tx *sql.Tx, trade *model.Trade) error {
+		if trade.OpenTime == nil || trade.CloseTime == nil {
+			return nil
+		}
+		n, err := cal.Rollovers(trade.Symbol, *trade.OpenTime, *trade.CloseTime)
+		if errors.Is(err, calendar.ErrUnknownSymbol) {
+			return nil
+		}
+		if err != nil || n == 0 {
+			return err
+		}
+		trade.Rollovers = n
+		return dbManager.SetRollovers(ctx, tx, trade.Id, n)
+	}
+}
+
+// ProcessNext claims the oldest pending trade, if any, stamps it with the
+// time of clk, applies it to its account, accrues its rebates, runs hooks
+// and returns it. Errors are logged, except when another connection holds
+// the database lock, which the caller is expected to retry.
+func ProcessNext(dbManager *dbmanager.Manager, clk clock.Clock, hooks ...Hook) (*model.Trade, error) {
+	// при начале транзакции забирается строка из базы trade и помечается как FOR UPDATE
+
+	// creating transaction
+	ctx := audit.WithActor(context.Background(), "worker")
+	tx, err := dbManager.CreateTx(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return nil, err
+	}
+
+	claimedAt := clk.Now()
+	trade, err := dbManager.GetTrade(ctx, tx, claimedAt)
+	if err != nil {
+		rollback(ctx, dbManager, tx)
+		if !dbmanager.IsBusy(err) {
+			slog.Error("failed to claim trade", "error", err)
+		}
+		return nil, err
+	}
+	if trade == nil {
+		rollback(ctx, dbManager, tx)
+		return nil, nil
+	}
+
+	// continue the trace started by the HTTP request that enqueued the trade
+	ctx = tracing.Extract(logging.WithRequestID(ctx, trade.RequestId), trade.TraceParent)
+	ctx, span := tracing.Tracer().Start(ctx, "ProcessTrade",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithTimestamp(claimedAt),
+		trace.WithAttributes(
+			attribute.Int("trade.id", trade.Id),
+			attribute.String("trade.account", trade.Account),
+			attribute.String("trade.symbol", trade.Symbol),
+		),
+	)
+	log := slog.With("trade_id", trade.Id, "account", trade.Account)
+	fail := func(msg string, err error) (*model.Trade, error) {
+		rollback(ctx, dbManager, tx)
+		endSpan(span, err)
+		if !dbmanager.IsBusy(err) {
+			log.ErrorContext(ctx, msg, "error", err)
+		}
+		return nil, err
+	}
+
+	profit := trade.Profit()
+
+	if err = dbManager.UpdateAccount(ctx, tx, trade.Account, profit); err != nil {
+		return fail("failed to update account", err)
+	}
+
+	rebates, err := dbManager.AccrueRebates(ctx, tx, trade, claimedAt)
+	if err != nil {
+		return fail("failed to accrue rebates", err)
+	}
+
+	for _, hook := range hooks {
+		if err = hook(ctx, tx, trade); err != nil {
+			return fail("failed to process trade", err)
+		}
+	}
+
+	if err = dbManager.CommitTx(tx); err != nil {
+		return fail("failed to commit trade", err)
+	}
+	endSpan(span, nil)
+	log.InfoContext(ctx, "trade processed",
+		"symbol", trade.Symbol,
+		"side", trade.Side,
+		"volume", trade.Volume,
+		"profit", profit,
+		"rebates", len(rebates),
+		"rollovers", trade.Rollovers,
+	)
+	return trade, nil
+}
+
+func rollback(ctx context.Context, dbManager *dbmanager.Manager, tx *sql.Tx) {
+	if err := dbManager.RollbackTx(tx); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		slog.ErrorContext(ctx, "failed to rollback transaction", "error", err)
+	}
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
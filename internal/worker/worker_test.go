@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"database/sql"
+	"gitlab.com/digineat/go-broker-test/internal/calendar"
+	"gitlab.com/digineat/go-broker-test/internal/clock"
+	dbmanager "gitlab.com/digineat/go-broker-test/internal/db"
+	"gitlab.com/digineat/go-broker-test/internal/model"
+	"math"
+	"testing"
+	"time"
+)
+
+// newMemoryManager returns a manager of a new in-memory database.
+func newMemoryManager(t *testing.T) *dbmanager.Manager {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetMaxOpenConns(1)
+	dbManager := &dbmanager.Manager{}
+	if err = dbManager.InitDbManager(conn); err != nil {
+		t.Fatalf("init db manager: %v", err)
+	}
+	if err = dbManager.CreateTablesIfNeed(); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+	return dbManager
+}
+
+func TestProcessNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		trades []model.Trade
+		// trades and profit are the expected stats of account m.
+		count  int
+		profit float64
+	}{
+		{name: "empty queue"},
+		{name: "buy", trades: []model.Trade{{Volume: 2, Open: 10, Close: 15, Side: "buy"}},
+			count: 1, profit: (15 - 10) * 2 * 100000.0},
+		{name: "sell", trades: []model.Trade{{Volume: 1, Open: 20, Close: 15, Side: "sell"}},
+			count: 1, profit: -(15 - 20) * 1 * 100000.0},
+		{name: "several trades", trades: []model.Trade{
+			{Volume: 1, Open: 1, Close: 2, Side: "buy"},
+			{Volume: 0.5, Open: 2, Close: 1.5, Side: "sell"},
+		}, count: 2, profit: (2-1)*1*100000.0 + -(1.5-2)*0.5*100000.0},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		dbManager := newMemoryManager(t)
+		for _, trade := range test.trades {
+			trade.Account, trade.Symbol, trade.ReceivedAt = "m", "EURUSD", time.Now()
+			if err := dbManager.CreateTrade(t.Context(), &trade); err != nil {
+				t.Fatalf("create trade: %v", err)
+			}
+		}
+		for i := range test.trades {
+			if trade, err := ProcessNext(dbManager, clock.System{}); err != nil || trade == nil {
+				t.Fatalf("ProcessNext #%d = %v, %v; want a trade", i, trade, err)
+			}
+		}
+		if trade, err := ProcessNext(dbManager, clock.System{}); err != nil || trade != nil {
+			t.Fatalf("ProcessNext of an empty queue = %v, %v; want nil", trade, err)
+		}
+
+		stats, err := dbManager.GetClient(t.Context(), "m")
+		if err != nil {
+			t.Fatalf("get stats: %v", err)
+		}
+		count, profit := 0, 0.0
+		if stats != nil {
+			count, profit = stats.Trades, stats.Profit
+		}
+		if count != test.count || math.Abs(profit-test.profit) > 1e-6 {
+			t.Errorf("stats = %d trades, profit %v; want %d, %v", count, profit, test.count, test.profit)
+		}
+	}
+}
+
+func TestRollovers(t *testing.T) {
+	cal, err := calendar.Parse([]byte(`{
+  "symbols": {"EURUSD": "fx"},
+  "markets": {"fx": {
+    "timezone": "UTC",
+    "rollover": "21:00",
+    "sessions": [{"days": ["mon", "tue", "wed", "thu", "fri"], "open": "00:00", "close": "22:00"}]
+  }}
+}`))
+	if err != nil {
+		t.Fatalf("parse calendar: %v", err)
+	}
+	at := func(day, hour int) *time.Time {
+		v := time.Date(2024, 3, day, hour, 0, 0, 0, time.UTC)
+		return &v
+	}
+
+	tests := []struct {
+		name                string
+		symbol              string
+		openTime, closeTime *time.Time
+		want                int
+	}{
+		{name: "without times", symbol: "EURUSD"},
+		{name: "without close time", symbol: "EURUSD", openTime: at(4, 12)},
+		{name: "intraday", symbol: "EURUSD", openTime: at(4, 10), closeTime: at(4, 20)},
+		{name: "overnight", symbol: "EURUSD", openTime: at(4, 12), closeTime: at(5, 12), want: 1},
+		{name: "over the weekend", symbol: "EURUSD", openTime: at(7, 12), closeTime: at(11, 12), want: 2},
+		{name: "symbol without a market", symbol: "USDJPY", openTime: at(4, 12), closeTime: at(5, 12)},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		dbManager := newMemoryManager(t)
+		trade := model.Trade{Account: "m", Symbol: test.symbol, Volume: 1, Open: 1, Close: 2, Side: "buy",
+			OpenTime: test.openTime, CloseTime: test.closeTime, ReceivedAt: time.Now()}
+		if err := dbManager.CreateTrade(t.Context(), &trade); err != nil {
+			t.Fatalf("create trade: %v", err)
+		}
+		processed, err := ProcessNext(dbManager, clock.System{}, Rollovers(dbManager, cal))
+		if err != nil || processed == nil {
+			t.Fatalf("ProcessNext = %v, %v; want the trade", processed, err)
+		}
+		stored, err := dbManager.FindTrade(t.Context(), trade.Id)
+		if err != nil {
+			t.Fatalf("find trade: %v", err)
+		}
+		if processed.Rollovers != test.want || stored.Rollovers != test.want {
+			t.Errorf("rollovers = %d, stored %d; want %d", processed.Rollovers, stored.Rollovers, test.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Statuses of an account.
+const (
+	AccountStatusActive = "active"
+	AccountStatusFrozen = "frozen"
+	AccountStatusClosed = "closed"
+)
+
+// Account is a trading account.
+type Account struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	Group    string `json:"group"`
+	Leverage int    `json:"leverage"`
+	// Status is active, frozen (no new trades) or closed, which is final.
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CreateAccountRequest is a new account; empty fields get the server's
+// defaults.
+type CreateAccountRequest struct {
+	Id       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Leverage int    `json:"leverage,omitempty"`
+}
+
+// UpdateAccountRequest sets the fields to change; nil fields keep their
+// value.
+type UpdateAccountRequest struct {
+	Name     *string `json:"name,omitempty"`
+	Currency *string `json:"currency,omitempty"`
+	Group    *string `json:"group,omitempty"`
+	Leverage *int    `json:"leverage,omitempty"`
+	Status   *string `json:"status,omitempty"`
+}
+
+// Group is a node of the account group tree.
+type Group struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// Parent is empty for a root group.
+	Parent    string    `json:"parent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateGroupRequest is a new group below Parent, or a root group.
+type CreateGroupRequest struct {
+	Id     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Parent string `json:"parent,omitempty"`
+}
+
+// GroupStats aggregate the accounts of a group and of every group below
+// it, over the trades processed in [From, To).
+type GroupStats struct {
+	Group    string     `json:"group"`
+	From     *time.Time `json:"from,omitempty"`
+	To       *time.Time `json:"to,omitempty"`
+	Accounts int        `json:"accounts"`
+	Trades   int        `json:"trades"`
+	Volume   float64    `json:"volume"`
+	Profit   float64    `json:"profit"`
+}
+
+// RebateRate is the rebate per lot a group earns on a symbol, or on every
+// symbol without a rate of its own when Symbol is "*".
+type RebateRate struct {
+	Symbol string  `json:"symbol"`
+	PerLot float64 `json:"per_lot"`
+}
+
+// RebateAccrual is the rebate a group earned on a trade.
+type RebateAccrual struct {
+	TradeId    int        `json:"trade_id"`
+	Version    int        `json:"version"`
+	Group      string     `json:"group"`
+	Account    string     `json:"account"`
+	Symbol     string     `json:"symbol"`
+	Lots       float64    `json:"lots"`
+	Rate       float64    `json:"rate"`
+	Amount     float64    `json:"amount"`
+	AccruedAt  time.Time  `json:"accrued_at"`
+	ReversedAt *time.Time `json:"reversed_at,omitempty"`
+}
+
+// RebatePayouts are the rebates payable to each group for [From, To).
+type RebatePayouts struct {
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	Payouts []RebatePayout `json:"payouts"`
+}
+
+type RebatePayout struct {
+	Group    string  `json:"group"`
+	Trades   int     `json:"trades"`
+	Lots     float64 `json:"lots"`
+	Accrued  float64 `json:"accrued"`
+	Reversed float64 `json:"reversed"`
+	Payable  float64 `json:"payable"`
+}
+
+// CreateAccount creates an account (POST /accounts).
+func (c *Client) CreateAccount(ctx context.Context, req CreateAccountRequest) (*Account, error) {
+	account := &Account{}
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/accounts", body: req}, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// ListAccounts lists the accessible accounts, only those with status unless
+// it is empty (GET /accounts).
+func (c *Client) ListAccounts(ctx context.Context, status string) ([]Account, error) {
+	q := url.Values{}
+	setIf(q, "status", status)
+	var resp struct {
+		Accounts []Account `json:"accounts"`
+	}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/accounts", query: q, idempotent: true}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Accounts, nil
+}
+
+// GetAccount returns an account (GET /accounts/{id}).
+func (c *Client) GetAccount(ctx context.Context, id string) (*Account, error) {
+	account := &Account{}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/accounts/" + url.PathEscape(id), idempotent: true}, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// UpdateAccount changes an account (PATCH /accounts/{id}).
+func (c *Client) UpdateAccount(ctx context.Context, id string, req UpdateAccountRequest) (*Account, error) {
+	account := &Account{}
+	if _, err := c.do(ctx, request{method: http.MethodPatch, path: "/accounts/" + url.PathEscape(id), body: req}, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// CloseAccount closes an account (DELETE /accounts/{id}); it and its trades
+// are kept.
+func (c *Client) CloseAccount(ctx context.Context, id string) (*Account, error) {
+	account := &Account{}
+	if _, err := c.do(ctx, request{method: http.MethodDelete, path: "/accounts/" + url.PathEscape(id), idempotent: true}, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// CreateGroup adds a group to the tree (POST /groups).
+func (c *Client) CreateGroup(ctx context.Context, req CreateGroupRequest) (*Group, error) {
+	group := &Group{}
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/groups", body: req}, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// ListGroups lists every group (GET /groups).
+func (c *Client) ListGroups(ctx context.Context) ([]Group, error) {
+	var resp struct {
+		Groups []Group `json:"groups"`
+	}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/groups", idempotent: true}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Groups, nil
+}
+
+// GetGroupStats returns the stats of a group over the trades processed in
+// [from, to); nil bounds are open (GET /groups/{id}/stats).
+func (c *Client) GetGroupStats(ctx context.Context, id string, from, to *time.Time) (*GroupStats, error) {
+	q := url.Values{}
+	setIf(q, "from", timeParam(from))
+	setIf(q, "to", timeParam(to))
+	stats := &GroupStats{}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/groups/" + url.PathEscape(id) + "/stats", query: q, idempotent: true}, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetRebateRates returns the rebate rates of a group (GET
+// /groups/{id}/rebates).
+func (c *Client) GetRebateRates(ctx context.Context, group string) ([]RebateRate, error) {
+	var resp struct {
+		Rates []RebateRate `json:"rates"`
+	}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/groups/" + url.PathEscape(group) + "/rebates", idempotent: true}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Rates, nil
+}
+
+// SetRebateRates replaces the rebate rates of a group; no rates removes
+// them (PUT /groups/{id}/rebates).
+func (c *Client) SetRebateRates(ctx context.Context, group string, rates []RebateRate) ([]RebateRate, error) {
+	if rates == nil {
+		rates = []RebateRate{}
+	}
+	var resp struct {
+		Rates []RebateRate `json:"rates"`
+	}
+	_, err := c.do(ctx, request{
+		method:     http.MethodPut,
+		path:       "/groups/" + url.PathEscape(group) + "/rebates",
+		body:       map[string][]RebateRate{"rates": rates},
+		idempotent: true,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Rates, nil
+}
+
+// GetRebatePayouts reports the rebates payable to each group for [from, to)
+// (GET /rebates/payouts).
+func (c *Client) GetRebatePayouts(ctx context.Context, from, to time.Time) (*RebatePayouts, error) {
+	q := url.Values{"from": {timeParam(&from)}, "to": {timeParam(&to)}}
+	payouts := &RebatePayouts{}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/rebates/payouts", query: q, idempotent: true}, payouts); err != nil {
+		return nil, err
+	}
+	return payouts, nil
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scopes of API keys.
+const (
+	ScopeTradeWrite = "trade:write"
+	ScopeStatsRead  = "stats:read"
+	ScopeTradeAmend = "trade:amend"
+	ScopeAdmin      = "admin"
+)
+
+// ApiKey is an API key without its secret.
+type ApiKey struct {
+	Id     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Accounts the key may act on; empty means any account.
+	Accounts  []string   `json:"accounts,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type CreateApiKeyRequest struct {
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	Accounts []string `json:"accounts,omitempty"`
+}
+
+// CreatedApiKey is a new API key with its token, which is returned only
+// once.
+type CreatedApiKey struct {
+	ApiKey
+	Key string `json:"key"`
+}
+
+// AuditEntry is an entry of the audit log.
+type AuditEntry struct {
+	Seq         int64           `json:"seq"`
+	At          time.Time       `json:"at"`
+	Actor       string          `json:"actor"`
+	Action      string          `json:"action"`
+	Payload     json.RawMessage `json:"payload"`
+	PayloadHash string          `json:"payload_hash"`
+	PrevHash    string          `json:"prev_hash"`
+	Hash        string          `json:"hash"`
+}
+
+// AuditPage is a range of audit entries.
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	// Next is the from of the following page; it is zero on the last page.
+	Next int64 `json:"next,omitempty"`
+}
+
+// Limits are the rate limits of trade submissions and the queue depth at
+// which new trades are rejected (0 disables backpressure).
+type Limits struct {
+	Key        Limit            `json:"key"`
+	Account    Limit            `json:"account"`
+	Keys       map[string]Limit `json:"keys,omitempty"`
+	Accounts   map[string]Limit `json:"accounts,omitempty"`
+	MaxPending int              `json:"max_pending"`
+}
+
+// Limit is a token bucket; a Rate of 0 means unlimited.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Import modes.
+const (
+	ImportModeEnqueue = "enqueue"
+	ImportModeApply   = "apply"
+)
+
+// ImportOptions tell how to import a CSV file. The zero value enqueues the
+// trades, reading each field from the column named like it.
+type ImportOptions struct {
+	// Mode is enqueue (the default) or apply.
+	Mode   string
+	DryRun bool
+	// Mapping maps a field to the header of its column.
+	Mapping map[string]string
+	// Source is the name the job records for the file.
+	Source string
+}
+
+// Import is an import job with the errors of its rows so far.
+type Import struct {
+	Id         int           `json:"id"`
+	Status     string        `json:"status"`
+	Mode       string        `json:"mode"`
+	DryRun     bool          `json:"dry_run"`
+	Source     string        `json:"source"`
+	Actor      string        `json:"actor"`
+	Rows       int           `json:"rows"`
+	Imported   int           `json:"imported"`
+	Duplicates int           `json:"duplicates"`
+	Failed     int           `json:"failed"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Errors     []ImportError `json:"errors"`
+}
+
+// ImportError is a rejected field of an imported row.
+type ImportError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Value   string `json:"value"`
+}
+
+// CreateApiKey issues an API key (POST /admin/keys).
+func (c *Client) CreateApiKey(ctx context.Context, req CreateApiKeyRequest) (*CreatedApiKey, error) {
+	key := &CreatedApiKey{}
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/admin/keys", body: req}, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListApiKeys lists the API keys (GET /admin/keys).
+func (c *Client) ListApiKeys(ctx context.Context) ([]ApiKey, error) {
+	var keys []ApiKey
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/admin/keys", idempotent: true}, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeApiKey revokes an API key (DELETE /admin/keys/{id}).
+func (c *Client) RevokeApiKey(ctx context.Context, id string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: "/admin/keys/" + url.PathEscape(id), idempotent: true}, nil)
+	return err
+}
+
+// GetAudit exports at most limit audit entries from sequence number from;
+// zero values mean the server's defaults (GET /admin/audit).
+func (c *Client) GetAudit(ctx context.Context, from int64, limit int) (*AuditPage, error) {
+	q := url.Values{}
+	if from > 0 {
+		q.Set("from", strconv.FormatInt(from, 10))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	page := &AuditPage{}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/admin/audit", query: q, idempotent: true}, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// GetLimits returns the rate limits (GET /admin/limits).
+func (c *Client) GetLimits(ctx context.Context) (*Limits, error) {
+	limits := &Limits{}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/admin/limits", idempotent: true}, limits); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// SetLimits replaces the rate limits (PUT /admin/limits).
+func (c *Client) SetLimits(ctx context.Context, limits Limits) (*Limits, error) {
+	resp := &Limits{}
+	if _, err := c.do(ctx, request{method: http.MethodPut, path: "/admin/limits", body: limits, idempotent: true}, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// StartImport uploads a CSV file of trades and starts importing it in the
+// background (POST /imports); GetImport reports its progress. The upload is
+// retried only when csv is an io.Seeker.
+func (c *Client) StartImport(ctx context.Context, csv io.Reader, opts ImportOptions) (*Import, error) {
+	q := url.Values{}
+	setIf(q, "mode", opts.Mode)
+	if opts.DryRun {
+		q.Set("dry_run", "true")
+	}
+	setIf(q, "source", opts.Source)
+	if len(opts.Mapping) > 0 {
+		pairs := make([]string, 0, len(opts.Mapping))
+		for field, header := range opts.Mapping {
+			pairs = append(pairs, field+"="+header)
+		}
+		sort.Strings(pairs)
+		q.Set("map", strings.Join(pairs, ","))
+	}
+	job := &Import{}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/imports", query: q, raw: csv, contentType: "text/csv"}, job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetImport returns an import job (GET /imports/{id}).
+func (c *Client) GetImport(ctx context.Context, id int) (*Import, error) {
+	job := &Import{}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/imports/" + strconv.Itoa(id), idempotent: true}, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
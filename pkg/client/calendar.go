@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Market is a market of the trading calendar with its weekly sessions and
+// holidays.
+type Market struct {
+	Name     string    `json:"name"`
+	Timezone string    `json:"timezone"`
+	Rollover string    `json:"rollover,omitempty"`
+	Sessions []Session `json:"sessions"`
+	Holidays []Holiday `json:"holidays"`
+}
+
+type Session struct {
+	Days  []string `json:"days"`
+	Open  string   `json:"open"`
+	Close string   `json:"close"`
+}
+
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// MarketStatus tells whether a symbol is tradable at At, in the time zone
+// of its market.
+type MarketStatus struct {
+	Symbol       string     `json:"symbol"`
+	Market       string     `json:"market"`
+	At           time.Time  `json:"at"`
+	Open         bool       `json:"open"`
+	Holiday      string     `json:"holiday,omitempty"`
+	NextOpen     *time.Time `json:"next_open,omitempty"`
+	NextClose    *time.Time `json:"next_close,omitempty"`
+	NextRollover *time.Time `json:"next_rollover,omitempty"`
+}
+
+// GetCalendar returns the markets of the trading calendar (GET /calendar).
+// A server without a calendar answers ErrDisabled.
+func (c *Client) GetCalendar(ctx context.Context) ([]Market, error) {
+	var markets []Market
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/calendar", idempotent: true}, &markets); err != nil {
+		return nil, err
+	}
+	return markets, nil
+}
+
+// GetMarketStatus tells whether symbol is tradable at at, or now when at is
+// zero (GET /calendar/{symbol}).
+func (c *Client) GetMarketStatus(ctx context.Context, symbol string, at time.Time) (*MarketStatus, error) {
+	q := url.Values{}
+	if !at.IsZero() {
+		q.Set("at", timeParam(&at))
+	}
+	status := &MarketStatus{}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/calendar/" + url.PathEscape(symbol), query: q, idempotent: true}, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Health checks that the server and its database are up (GET /healthz).
+func (c *Client) Health(ctx context.Context) error {
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/healthz", idempotent: true}, nil)
+	return err
+}
+
+// GetOpenAPI returns the OpenAPI description of the API (GET
+// /openapi.json).
+func (c *Client) GetOpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var doc json.RawMessage
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/openapi.json", idempotent: true}, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,284 @@
+// Package client is the Go client of the broker HTTP API.
+//
+//	c := client.New("http://localhost:8080")
+//	c.ApiKey = os.Getenv("BROKER_API_KEY")
+//	_, err := c.SubmitTrade(ctx, client.SubmitTradeRequest{
+//		Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.105, Side: client.SideBuy,
+//	})
+//	if errors.Is(err, client.ErrInvalidRequest) {
+//		var apiErr *client.Error
+//		errors.As(err, &apiErr) // apiErr.Errors lists the rejected fields
+//	}
+//
+// Requests that fail with 429, or with a 5xx status or without a response
+// when they are safe to repeat, are retried with exponential backoff. Trades
+// are submitted with an idempotency key, so a retried submission is
+// enqueued once.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header names used by the API.
+const (
+	ApiKeyHeader         = "X-API-Key"
+	IdempotencyKeyHeader = "Idempotency-Key"
+	RequestIdHeader      = "X-Request-ID"
+)
+
+// Defaults of a Client returned by New.
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// Client calls the broker API. Its fields must not be changed while it is
+// in use; it is safe for concurrent use otherwise.
+type Client struct {
+	// BaseURL is the URL of the server, e.g. "http://localhost:8080".
+	BaseURL string
+	// HTTPClient sends the requests; nil means http.DefaultClient.
+	HTTPClient *http.Client
+	// ApiKey is sent in X-API-Key, BearerToken as a bearer token in
+	// Authorization. Both are empty when the server runs without
+	// authentication.
+	ApiKey      string
+	BearerToken string
+	// UserAgent is sent in User-Agent when set.
+	UserAgent string
+
+	// MaxRetries is how many times a failed request is repeated; 0 disables
+	// retries. The wait before a retry starts at MinBackoff and doubles up
+	// to MaxBackoff, with jitter; a Retry-After of the server is honoured,
+	// and a request whose Retry-After exceeds MaxBackoff is not retried.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// New returns a client of the server at baseURL with the default retry
+// policy.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		MaxRetries: DefaultMaxRetries,
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+	}
+}
+
+// Response holds the metadata of a successful response.
+type Response struct {
+	StatusCode int
+	// RequestId is the X-Request-ID the server assigned to the request.
+	RequestId string
+	// RateLimit is set on trade submissions when the server limits them.
+	RateLimit *RateLimit
+}
+
+// RateLimit is the state of the most restrictive rate limit of a trade
+// submission.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	// Reset is how long until the limit is replenished.
+	Reset time.Duration
+}
+
+// request describes one API call.
+type request struct {
+	method string
+	// path is the escaped path, query its query parameters
+	path  string
+	query url.Values
+	// body is encoded as JSON; raw, if set, is sent as it is with
+	// contentType instead. A raw body that is not an io.Seeker is sent at
+	// most once.
+	body        any
+	raw         io.Reader
+	contentType string
+	header      http.Header
+	// idempotent requests are retried after a 5xx response or a transport
+	// error, which may come after the server applied them. Other requests
+	// are retried only after a 429, which means they were not applied.
+	idempotent bool
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// send performs req with retries and returns the successful response, whose
+// body the caller must close. An error response is returned as *Error.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var body []byte
+	contentType := req.contentType
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		contentType = "application/json"
+	}
+	target := c.BaseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader
+		rewindable := true
+		switch {
+		case req.raw != nil:
+			reader = req.raw
+			seeker, ok := req.raw.(io.Seeker)
+			if ok && attempt > 0 {
+				if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+					return nil, fmt.Errorf("rewind request body: %w", err)
+				}
+			}
+			rewindable = ok
+		case body != nil:
+			reader = bytes.NewReader(body)
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, target, reader)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range req.header {
+			httpReq.Header[k] = v
+		}
+		if contentType != "" {
+			httpReq.Header.Set("Content-Type", contentType)
+		}
+		httpReq.Header.Set("Accept", "application/json, application/problem+json")
+		if c.ApiKey != "" {
+			httpReq.Header.Set(ApiKeyHeader, c.ApiKey)
+		}
+		if c.BearerToken != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+c.BearerToken)
+		}
+		if c.UserAgent != "" {
+			httpReq.Header.Set("User-Agent", c.UserAgent)
+		}
+
+		res, err := c.httpClient().Do(httpReq)
+		var retryAfter time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || !req.idempotent || !rewindable || attempt >= c.MaxRetries {
+				return nil, err
+			}
+		case res.StatusCode < http.StatusBadRequest:
+			return res, nil
+		default:
+			apiErr := readError(res)
+			retry := res.StatusCode == http.StatusTooManyRequests ||
+				(req.idempotent && res.StatusCode >= http.StatusInternalServerError)
+			if !retry || !rewindable || attempt >= c.MaxRetries ||
+				(c.MaxBackoff > 0 && apiErr.RetryAfter > c.MaxBackoff) {
+				return nil, apiErr
+			}
+			retryAfter = apiErr.RetryAfter
+		}
+
+		wait := c.backoff(attempt, retryAfter)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff is the wait before retry number attempt+1: retryAfter when the
+// server gave one, else MinBackoff doubled attempt times, capped at
+// MaxBackoff, of which the upper half is random.
+func (c *Client) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	d := c.MinBackoff
+	for i := 0; i < attempt && (c.MaxBackoff <= 0 || d < c.MaxBackoff); i++ {
+		d *= 2
+	}
+	if c.MaxBackoff > 0 && d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + mathrand.N(d/2+1)
+}
+
+// do performs req and decodes the JSON response body into out, unless out
+// is nil.
+func (c *Client) do(ctx context.Context, req request, out any) (*Response, error) {
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if out != nil {
+		if err = json.NewDecoder(res.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+	} else if _, err = io.Copy(io.Discard, res.Body); err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	return newResponse(res), nil
+}
+
+func newResponse(res *http.Response) *Response {
+	resp := &Response{StatusCode: res.StatusCode, RequestId: res.Header.Get(RequestIdHeader)}
+	if limit, err := strconv.Atoi(res.Header.Get("X-RateLimit-Limit")); err == nil {
+		remaining, _ := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+		reset, _ := strconv.Atoi(res.Header.Get("X-RateLimit-Reset"))
+		resp.RateLimit = &RateLimit{Limit: limit, Remaining: remaining, Reset: time.Duration(reset) * time.Second}
+	}
+	return resp
+}
+
+// NewIdempotencyKey returns a random key for a request that may be retried.
+func NewIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.New("client: can not read random bytes: " + err.Error()))
+	}
+	return hex.EncodeToString(b)
+}
+
+// timeParam formats t as a query parameter, or "" when t is nil.
+func timeParam(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// setIf adds the query parameter name unless value is empty.
+func setIf(q url.Values, name, value string) {
+	if value != "" {
+		q.Set(name, value)
+	}
+}
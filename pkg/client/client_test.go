@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// script answers the requests of a test server with the statuses in turn
+// and records the requests.
+type script struct {
+	mu       sync.Mutex
+	statuses []int
+	// retryAfter is sent with every error response when set.
+	retryAfter string
+	requests   []*http.Request
+	bodies     []string
+}
+
+func (s *script) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, string(body))
+
+	status := http.StatusOK
+	if i := len(s.requests) - 1; i < len(s.statuses) {
+		status = s.statuses[i]
+	}
+	w.Header().Set(RequestIdHeader, "req-1")
+	if status >= http.StatusBadRequest {
+		if s.retryAfter != "" {
+			w.Header().Set("Retry-After", s.retryAfter)
+		}
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		code := CodeInternal
+		switch status {
+		case http.StatusNotFound:
+			code = CodeNotFound
+		case http.StatusTooManyRequests:
+			code = CodeRateLimited
+		}
+		w.Write([]byte(`{"status":` + strconv.Itoa(status) + `,"code":"` + code + `"}`))
+		return
+	}
+	w.Header().Set("X-RateLimit-Limit", "10")
+	w.Header().Set("X-RateLimit-Remaining", "9")
+	w.Header().Set("X-RateLimit-Reset", "2")
+	w.WriteHeader(status)
+	w.Write([]byte("{}"))
+}
+
+func newScriptedClient(t *testing.T, s *script) *Client {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	c := New(srv.URL + "/")
+	c.MinBackoff, c.MaxBackoff = time.Millisecond, 10*time.Millisecond
+	return c
+}
+
+func TestClient_Retries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		call       func(ctx context.Context, c *Client) error
+		requests   int
+		err        error
+	}{
+		{name: "submit retried after 503", statuses: []int{503, 502, 200}, requests: 3,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.SubmitTrade(ctx, SubmitTradeRequest{Account: "123"})
+				return err
+			}},
+		{name: "submit gives up after MaxRetries", statuses: []int{500, 500, 500, 500, 500}, requests: 4, err: ErrServer,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.SubmitTrade(ctx, SubmitTradeRequest{Account: "123"})
+				return err
+			}},
+		{name: "amend not retried after 500", statuses: []int{500}, requests: 1, err: ErrServer,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.AmendTrade(ctx, 1, AmendTradeRequest{Reason: "typo"})
+				return err
+			}},
+		{name: "amend retried after 429", statuses: []int{429}, requests: 2,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.AmendTrade(ctx, 1, AmendTradeRequest{Reason: "typo"})
+				return err
+			}},
+		{name: "retry after beyond MaxBackoff", statuses: []int{429}, retryAfter: "60", requests: 1, err: ErrRateLimited,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.GetStats(ctx, "123")
+				return err
+			}},
+		{name: "client error not retried", statuses: []int{404}, requests: 1, err: ErrNotFound,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.GetStats(ctx, "123")
+				return err
+			}},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		s := &script{statuses: test.statuses, retryAfter: test.retryAfter}
+		c := newScriptedClient(t, s)
+		err := test.call(t.Context(), c)
+		if test.err == nil && err != nil || test.err != nil && !errors.Is(err, test.err) {
+			t.Fatalf("err = %v; want %v", err, test.err)
+		}
+		if len(s.requests) != test.requests {
+			t.Fatalf("%d requests; want %d", len(s.requests), test.requests)
+		}
+	}
+}
+
+func TestClient_SubmitTrade(t *testing.T) {
+	s := &script{statuses: []int{503, 200}}
+	c := newScriptedClient(t, s)
+	c.ApiKey = "id.secret"
+
+	resp, err := c.SubmitTrade(t.Context(), SubmitTradeRequest{Account: "123", Symbol: "EURUSD", Volume: 1, Open: 1.1, Close: 1.2, Side: SideBuy})
+	if err != nil {
+		t.Fatalf("SubmitTrade: %v", err)
+	}
+	if resp.RequestId != "req-1" || resp.RateLimit == nil || *resp.RateLimit != (RateLimit{Limit: 10, Remaining: 9, Reset: 2 * time.Second}) {
+		t.Errorf("response = %+v, rate limit %+v", resp, resp.RateLimit)
+	}
+	first, second := s.requests[0], s.requests[1]
+	if key := first.Header.Get(IdempotencyKeyHeader); len(key) != 32 || second.Header.Get(IdempotencyKeyHeader) != key {
+		t.Errorf("idempotency keys = %q, %q; want the same random key", key, second.Header.Get(IdempotencyKeyHeader))
+	}
+	if first.Header.Get(ApiKeyHeader) != "id.secret" || first.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", first.Header)
+	}
+	if s.bodies[0] != s.bodies[1] || !strings.Contains(s.bodies[1], `"account":"123"`) {
+		t.Errorf("bodies = %q; want the trade sent twice", s.bodies)
+	}
+
+	s = &script{}
+	c = newScriptedClient(t, s)
+	if _, err = c.SubmitTrade(t.Context(), SubmitTradeRequest{IdempotencyKey: "mine"}); err != nil {
+		t.Fatalf("SubmitTrade: %v", err)
+	}
+	if key := s.requests[0].Header.Get(IdempotencyKeyHeader); key != "mine" {
+		t.Errorf("idempotency key = %q; want mine", key)
+	}
+}
+
+func TestClient_CancelledDuringBackoff(t *testing.T) {
+	s := &script{statuses: []int{503, 503}}
+	c := newScriptedClient(t, s)
+	c.MinBackoff, c.MaxBackoff = time.Hour, time.Hour
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetStats(ctx, "123"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		kind        error
+		code        string
+		message     string
+	}{
+		{name: "validation", status: 400, contentType: "application/problem+json",
+			body: `{"status":400,"code":"validation_failed","detail":"request validation failed","request_id":"r1",` +
+				`"errors":[{"field":"symbol","rule":"len","message":"symbol must be exactly 6 characters long","value":"EUR"}]}`,
+			kind: ErrInvalidRequest, code: CodeValidationFailed,
+			message: "broker: 400 validation_failed: request validation failed: symbol must be exactly 6 characters long"},
+		{name: "queue full", status: 503, contentType: "application/problem+json",
+			body: `{"status":503,"code":"queue_full","detail":"trade queue is full"}`,
+			kind: ErrQueueFull, code: CodeQueueFull, message: "broker: 503 queue_full: trade queue is full"},
+		{name: "calendar disabled", status: 404, contentType: "application/problem+json",
+			body: `{"status":404,"code":"calendar_disabled"}`, kind: ErrDisabled, code: CodeCalendarOff,
+			message: "broker: 404 calendar_disabled"},
+		{name: "plain text from a proxy", status: 502, contentType: "text/plain", body: "bad gateway\n",
+			kind: ErrServer, message: "broker: 502: bad gateway"},
+		{name: "unknown route", status: 404, contentType: "text/plain; charset=utf-8", body: "404 page not found\n",
+			kind: ErrNotFound, message: "broker: 404: 404 page not found"},
+	}
+	for _, test := range tests {
+		t.Log(test.name)
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Content-Type", test.contentType)
+		rec.WriteHeader(test.status)
+		rec.WriteString(test.body)
+		err := readError(rec.Result())
+		if !errors.Is(err, test.kind) || err.Code != test.code || err.Error() != test.message {
+			t.Fatalf("error = %q (code %q); want %q of kind %v", err, err.Code, test.message, test.kind)
+		}
+		if errors.Is(err, ErrConflict) {
+			t.Fatalf("error %q matches ErrConflict", err)
+		}
+	}
+}
+
+func TestClient_Backoff(t *testing.T) {
+	c := &Client{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{attempt: 0, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 2, min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{attempt: 10, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 0, retryAfter: 2 * time.Second, min: 2 * time.Second, max: 2 * time.Second},
+	}
+	for _, test := range tests {
+		t.Log(test.attempt, test.retryAfter)
+		for range 20 {
+			if d := c.backoff(test.attempt, test.retryAfter); d < test.min || d > test.max {
+				t.Fatalf("backoff = %v; want between %v and %v", d, test.min, test.max)
+			}
+		}
+	}
+}
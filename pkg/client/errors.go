@@ -0,0 +1,168 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error codes of the API, the Code of an Error. Clients switch on them; they
+// never change.
+const (
+	CodeInvalidJSON      = "invalid_json"
+	CodeUnknownField     = "unknown_field"
+	CodeTrailingData     = "trailing_data"
+	CodeValidationFailed = "validation_failed"
+	CodeInvalidPath      = "invalid_path"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeQueueFull        = "queue_full"
+	CodeInternal         = "internal_error"
+	CodeAuthUnavailable  = "auth_unavailable"
+	CodeRateLimitingOff  = "rate_limiting_disabled"
+	CodeCalendarOff      = "calendar_disabled"
+)
+
+// Kinds of errors, matched by errors.Is against an *Error.
+var (
+	// ErrInvalidRequest: the request was malformed or failed validation.
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrUnauthorized   = errors.New("missing or invalid credentials")
+	ErrForbidden      = errors.New("forbidden")
+	ErrNotFound       = errors.New("not found")
+	ErrConflict       = errors.New("conflict")
+	// ErrRateLimited and ErrQueueFull: the trade was not enqueued and may be
+	// submitted again after Error.RetryAfter.
+	ErrRateLimited = errors.New("rate limited")
+	ErrQueueFull   = errors.New("queue full")
+	// ErrDisabled: the feature is not enabled on the server.
+	ErrDisabled = errors.New("disabled")
+	ErrServer   = errors.New("server error")
+)
+
+var codeErrors = map[string]error{
+	CodeInvalidJSON:      ErrInvalidRequest,
+	CodeUnknownField:     ErrInvalidRequest,
+	CodeTrailingData:     ErrInvalidRequest,
+	CodeValidationFailed: ErrInvalidRequest,
+	CodeInvalidPath:      ErrInvalidRequest,
+	CodeUnauthorized:     ErrUnauthorized,
+	CodeForbidden:        ErrForbidden,
+	CodeNotFound:         ErrNotFound,
+	CodeMethodNotAllowed: ErrInvalidRequest,
+	CodeConflict:         ErrConflict,
+	CodeRateLimited:      ErrRateLimited,
+	CodeQueueFull:        ErrQueueFull,
+	CodeInternal:         ErrServer,
+	CodeAuthUnavailable:  ErrServer,
+	CodeRateLimitingOff:  ErrDisabled,
+	CodeCalendarOff:      ErrDisabled,
+}
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:       ErrInvalidRequest,
+	http.StatusUnauthorized:     ErrUnauthorized,
+	http.StatusForbidden:        ErrForbidden,
+	http.StatusNotFound:         ErrNotFound,
+	http.StatusMethodNotAllowed: ErrInvalidRequest,
+	http.StatusConflict:         ErrConflict,
+	http.StatusTooManyRequests:  ErrRateLimited,
+}
+
+// maxErrorBody caps the error response body read.
+const maxErrorBody = 1 << 20
+
+// Error is an error response of the API, decoded from its RFC 7807 problem
+// document. Responses without one, e.g. from a proxy, have an empty Code.
+type Error struct {
+	StatusCode int
+	Code       string
+	Title      string
+	Detail     string
+	RequestId  string
+	// Errors lists the rejected fields of a validation failure.
+	Errors []FieldError
+	// RetryAfter is the Retry-After of the response, or zero.
+	RetryAfter time.Duration
+}
+
+// FieldError describes one rejected field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Value   any    `json:"value"`
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("broker: ")
+	b.WriteString(strconv.Itoa(e.StatusCode))
+	if e.Code != "" {
+		b.WriteString(" " + e.Code)
+	}
+	if e.Detail != "" {
+		b.WriteString(": " + e.Detail)
+	}
+	for i, fe := range e.Errors {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		b.WriteString(fe.Message)
+	}
+	return b.String()
+}
+
+// Is matches the kind of e: the error its code maps to, or, without a known
+// code, the error its status maps to. Any other 5xx is ErrServer.
+func (e *Error) Is(target error) bool {
+	if kind, ok := codeErrors[e.Code]; ok {
+		return kind == target
+	}
+	if kind, ok := statusErrors[e.StatusCode]; ok {
+		return kind == target
+	}
+	return target == ErrServer && e.StatusCode >= http.StatusInternalServerError
+}
+
+// readError reads the error response res and closes its body.
+func readError(res *http.Response) *Error {
+	defer res.Body.Close()
+	e := &Error{StatusCode: res.StatusCode, RequestId: res.Header.Get(RequestIdHeader)}
+	if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	var doc struct {
+		Title     string       `json:"title"`
+		Detail    string       `json:"detail"`
+		Code      string       `json:"code"`
+		RequestId string       `json:"request_id"`
+		Errors    []FieldError `json:"errors"`
+	}
+	if (mediaType == "application/problem+json" || mediaType == "application/json") && json.Unmarshal(body, &doc) == nil {
+		e.Code, e.Title, e.Detail, e.Errors = doc.Code, doc.Title, doc.Detail, doc.Errors
+		if doc.RequestId != "" {
+			e.RequestId = doc.RequestId
+		}
+		return e
+	}
+	e.Title = http.StatusText(res.StatusCode)
+	if detail := strings.TrimSpace(string(body)); len(detail) <= 200 {
+		e.Detail = detail
+	}
+	return e
+}
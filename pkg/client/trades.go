@@ -0,0 +1,225 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sides of a trade.
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
+// Statuses of a trade.
+const (
+	TradeStatusPending   = "pending"
+	TradeStatusProcessed = "processed"
+	TradeStatusCancelled = "cancelled"
+)
+
+// SubmitTradeRequest is a trade to enqueue.
+type SubmitTradeRequest struct {
+	Account string  `json:"account"`
+	Symbol  string  `json:"symbol"`
+	Volume  float64 `json:"volume"`
+	Open    float64 `json:"open"`
+	Close   float64 `json:"close"`
+	Side    string  `json:"side"`
+	// OpenTime and CloseTime are optional.
+	OpenTime  *time.Time `json:"open_time,omitempty"`
+	CloseTime *time.Time `json:"close_time,omitempty"`
+
+	// IdempotencyKey identifies the submission, so that it is enqueued once
+	// however often it is sent; empty means a new random key. Set it to
+	// submit the same trade again safely after SubmitTrade failed.
+	IdempotencyKey string `json:"-"`
+}
+
+// Trade is a trade as seen by back office.
+type Trade struct {
+	Id      int     `json:"id"`
+	Version int     `json:"version"`
+	Status  string  `json:"status"`
+	Account string  `json:"account"`
+	Symbol  string  `json:"symbol"`
+	Volume  float64 `json:"volume"`
+	Open    float64 `json:"open"`
+	Close   float64 `json:"close"`
+	Side    string  `json:"side"`
+	// Profit is what the trade added to its account; nil while it is pending
+	// and once it is cancelled.
+	Profit      *float64   `json:"profit,omitempty"`
+	OpenTime    *time.Time `json:"open_time,omitempty"`
+	CloseTime   *time.Time `json:"close_time,omitempty"`
+	ReceivedAt  *time.Time `json:"received_at,omitempty"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	// Rollovers is the number of swap rollovers the position was held over,
+	// counted by a worker with a trading calendar.
+	Rollovers int `json:"rollovers,omitempty"`
+	// History lists the replaced versions, Rebates the rebates accrued for
+	// the trade; both are returned by GetTrade only.
+	History []TradeVersion  `json:"history,omitempty"`
+	Rebates []RebateAccrual `json:"rebates,omitempty"`
+}
+
+// TradeVersion is a replaced version of a trade and the change that
+// replaced it.
+type TradeVersion struct {
+	Version     int        `json:"version"`
+	Status      string     `json:"status"`
+	Symbol      string     `json:"symbol"`
+	Volume      float64    `json:"volume"`
+	Open        float64    `json:"open"`
+	Close       float64    `json:"close"`
+	Side        string     `json:"side"`
+	OpenTime    *time.Time `json:"open_time,omitempty"`
+	CloseTime   *time.Time `json:"close_time,omitempty"`
+	Action      string     `json:"action"`
+	Actor       string     `json:"actor"`
+	Reason      string     `json:"reason"`
+	ChangedAt   time.Time  `json:"changed_at"`
+	ProfitDelta float64    `json:"profit_delta"`
+	TradesDelta int        `json:"trades_delta"`
+}
+
+// AmendTradeRequest sets the fields to correct; nil fields keep their value.
+type AmendTradeRequest struct {
+	Symbol    *string    `json:"symbol,omitempty"`
+	Volume    *float64   `json:"volume,omitempty"`
+	Open      *float64   `json:"open,omitempty"`
+	Close     *float64   `json:"close,omitempty"`
+	Side      *string    `json:"side,omitempty"`
+	OpenTime  *time.Time `json:"open_time,omitempty"`
+	CloseTime *time.Time `json:"close_time,omitempty"`
+	Reason    string     `json:"reason"`
+}
+
+// AccountStats are the statistics of the processed trades of an account.
+type AccountStats struct {
+	Account string  `json:"account"`
+	Trades  int     `json:"trades"`
+	Profit  float64 `json:"profit"`
+}
+
+// ExportOptions select what a CSV export contains. The zero value exports
+// every column with times in UTC.
+type ExportOptions struct {
+	// Columns are the columns in order; empty means all.
+	Columns []string
+	// TimeZone is the IANA time zone of the exported times.
+	TimeZone string
+	// BOM starts the file with a UTF-8 byte order mark for Excel.
+	BOM bool
+	// From and To bound the processing time of exported trades; they are
+	// ignored by StatsCSV.
+	From, To *time.Time
+}
+
+func (o ExportOptions) query(withRange bool) url.Values {
+	q := url.Values{}
+	setIf(q, "columns", strings.Join(o.Columns, ","))
+	setIf(q, "tz", o.TimeZone)
+	if o.BOM {
+		q.Set("bom", "true")
+	}
+	if withRange {
+		setIf(q, "from", timeParam(o.From))
+		setIf(q, "to", timeParam(o.To))
+	}
+	return q
+}
+
+// SubmitTrade enqueues a trade (POST /trades); it is applied to the account
+// stats by the worker. The submission carries an idempotency key and is
+// retried on failure.
+func (c *Client) SubmitTrade(ctx context.Context, trade SubmitTradeRequest) (*Response, error) {
+	key := trade.IdempotencyKey
+	if key == "" {
+		key = NewIdempotencyKey()
+	}
+	return c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/trades",
+		body:       trade,
+		header:     http.Header{IdempotencyKeyHeader: {key}},
+		idempotent: true,
+	}, nil)
+}
+
+// GetTrade returns a trade with its history (GET /trades/{id}).
+func (c *Client) GetTrade(ctx context.Context, id int) (*Trade, error) {
+	trade := &Trade{}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/trades/" + strconv.Itoa(id), idempotent: true}, trade)
+	if err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+// AmendTrade corrects a trade (PATCH /trades/{id}) and returns the new
+// version.
+func (c *Client) AmendTrade(ctx context.Context, id int, req AmendTradeRequest) (*Trade, error) {
+	trade := &Trade{}
+	_, err := c.do(ctx, request{method: http.MethodPatch, path: "/trades/" + strconv.Itoa(id), body: req}, trade)
+	if err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+// CancelTrade cancels a trade (POST /trades/{id}/cancel).
+func (c *Client) CancelTrade(ctx context.Context, id int, reason string) (*Trade, error) {
+	trade := &Trade{}
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/trades/" + strconv.Itoa(id) + "/cancel",
+		body:   map[string]string{"reason": reason},
+	}, trade)
+	if err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+// GetStats returns the stats of an account (GET /stats/{acc}). An account
+// without processed trades is ErrNotFound.
+func (c *Client) GetStats(ctx context.Context, account string) (*AccountStats, error) {
+	stats := &AccountStats{}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/stats/" + url.PathEscape(account), idempotent: true}, stats)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// TradesCSV streams the trades of an account as CSV (GET
+// /accounts/{acc}/trades.csv). The caller must close the returned body.
+func (c *Client) TradesCSV(ctx context.Context, account string, opts ExportOptions) (io.ReadCloser, error) {
+	res, err := c.send(ctx, request{
+		method:     http.MethodGet,
+		path:       "/accounts/" + url.PathEscape(account) + "/trades.csv",
+		query:      opts.query(true),
+		idempotent: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// StatsCSV streams the stats of every accessible account as CSV (GET
+// /stats.csv). The caller must close the returned body.
+func (c *Client) StatsCSV(ctx context.Context, opts ExportOptions) (io.ReadCloser, error) {
+	res, err := c.send(ctx, request{method: http.MethodGet, path: "/stats.csv", query: opts.query(false), idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}